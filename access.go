@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Refresh priority tiers of the candle fetcher, from client traffic
+const (
+	PriorityHot  = "hot"  // Most requested symbols
+	PriorityWarm = "warm" // Other recently requested symbols
+	PriorityCold = "cold" // Symbols nobody has requested lately
+)
+
+// accessScoreFloor is the decayed score below which a symbol counts as not
+// recently requested: one request a bit over three half-lives ago
+const accessScoreFloor = 0.1
+
+// symbolAccess is one symbol's request score as of updated
+type symbolAccess struct {
+	score    float64
+	updated  time.Time
+	requests int64
+}
+
+// AccessStats counts client requests per symbol. Scores decay
+// exponentially, so they follow recent traffic rather than all-time totals.
+// A nil AccessStats records nothing.
+type AccessStats struct {
+	mu       sync.Mutex
+	halfLife time.Duration
+	symbols  map[string]*symbolAccess
+}
+
+// NewAccessStats creates access stats whose scores halve every halfLife
+func NewAccessStats(halfLife time.Duration) *AccessStats {
+	return &AccessStats{
+		halfLife: halfLife,
+		symbols:  make(map[string]*symbolAccess),
+	}
+}
+
+// Record counts a client request for symbol
+func (s *AccessStats) Record(symbol string) {
+	if s == nil {
+		return
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.symbols[symbol]
+	if !ok {
+		a = &symbolAccess{updated: now}
+		s.symbols[symbol] = a
+	}
+	a.score = s.decayed(a, now) + 1
+	a.updated = now
+	a.requests++
+}
+
+// decayed returns a's score as of now
+func (s *AccessStats) decayed(a *symbolAccess, now time.Time) float64 {
+	if s.halfLife <= 0 {
+		return a.score
+	}
+	return a.score * math.Exp2(-float64(now.Sub(a.updated))/float64(s.halfLife))
+}
+
+// SymbolAccess reports a symbol's traffic and the refresh tier it earns
+type SymbolAccess struct {
+	Symbol      string    `json:"symbol"`
+	Score       float64   `json:"score"`    // Decayed request count
+	Requests    int64     `json:"requests"` // Since startup
+	LastRequest time.Time `json:"last_request"`
+	Tier        string    `json:"tier"`
+}
+
+// Ranked returns the recently requested symbols, highest score first, with
+// the hotCount highest hot and the rest warm. Symbols that have decayed
+// below the floor are forgotten and left out, so they're cold.
+func (s *AccessStats) Ranked(hotCount int) []SymbolAccess {
+	if s == nil {
+		return nil
+	}
+	now := time.Now()
+	s.mu.Lock()
+	ranked := make([]SymbolAccess, 0, len(s.symbols))
+	for symbol, a := range s.symbols {
+		score := s.decayed(a, now)
+		if score < accessScoreFloor {
+			delete(s.symbols, symbol)
+			continue
+		}
+		ranked = append(ranked, SymbolAccess{Symbol: symbol, Score: score, Requests: a.requests, LastRequest: a.updated})
+	}
+	s.mu.Unlock()
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Symbol < ranked[j].Symbol
+	})
+	for i := range ranked {
+		ranked[i].Tier = PriorityWarm
+		if i < hotCount {
+			ranked[i].Tier = PriorityHot
+		}
+	}
+	return ranked
+}
+
+// Tiers maps each recently requested symbol to its refresh tier; symbols
+// that aren't in it are cold
+func (s *AccessStats) Tiers(hotCount int) map[string]string {
+	ranked := s.Ranked(hotCount)
+	tiers := make(map[string]string, len(ranked))
+	for _, a := range ranked {
+		tiers[a.Symbol] = a.Tier
+	}
+	return tiers
+}
+
+// PriorityProfile sets how often each refresh tier is fetched, in fetch
+// cycles. Hot symbols are fetched every cycle.
+type PriorityProfile struct {
+	HotSymbols int // How many of the most requested symbols are hot
+	WarmEvery  int
+	ColdEvery  int
+}
+
+// every returns how many cycles apart tier is fetched
+func (p PriorityProfile) every(tier string) int {
+	switch tier {
+	case PriorityWarm:
+		return max(p.WarmEvery, 1)
+	case PriorityCold:
+		return max(p.ColdEvery, 1)
+	default:
+		return 1
+	}
+}
+
+// priorityPhase spreads a tier's symbols over the cycles it's fetched in.
+// It's salted so it doesn't line up with the shard hash.
+func priorityPhase(symbol string, every int) int {
+	h := fnv.New32a()
+	h.Write([]byte("priority\x00" + symbol))
+	return int(h.Sum32() % uint32(every))
+}
+
+func handleAdminAccess(w http.ResponseWriter, r *http.Request) {
+	ranked := accessStats.Ranked(config.PriorityHotSymbols)
+	if ranked == nil {
+		ranked = []SymbolAccess{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"half_life_minutes": config.AccessHalfLifeMin,
+		"hot_symbols":       config.PriorityHotSymbols,
+		"warm_every":        max(config.PriorityWarmEvery, 1),
+		"cold_every":        max(config.PriorityColdEvery, 1),
+		"symbols":           ranked,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+)
+
+// newAdminMux builds the handler for the admin listener: operational
+// endpoints that must never be exposed on the public API port. In read-only
+// mode only metrics are served.
+func newAdminMux(readOnly bool) *Router {
+	mux := NewRouter()
+
+	mux.HandleFunc("/metrics", handleMetrics, http.MethodGet)
+	if readOnly {
+		return mux
+	}
+
+	mux.HandleFunc("/admin/refresh", logRequest(handleAdminRefresh), http.MethodPost)
+	mux.HandleFunc("/admin/backfill", logRequest(handleAdminBackfill), http.MethodPost)
+	mux.HandleFunc("/admin/jobs", logRequest(handleAdminJobs), http.MethodGet)
+	mux.HandleFunc("/admin/jobs/{id}", logRequest(handleAdminJob), http.MethodGet)
+	// Operations were renamed to jobs; the old paths still answer
+	mux.HandleFunc("/admin/operations", logRequest(handleAdminJobs), http.MethodGet)
+	mux.HandleFunc("/admin/operations/{id}", logRequest(handleAdminJob), http.MethodGet)
+	mux.HandleFunc("/admin/audit", logRequest(handleAdminAudit), http.MethodGet)
+	mux.HandleFunc("/admin/errors", logRequest(handleAdminErrors), http.MethodGet)
+	mux.HandleFunc("/admin/latency", logRequest(handleAdminLatency), http.MethodGet)
+	mux.HandleFunc("/admin/budget", logRequest(handleAdminBudget), http.MethodGet)
+	mux.HandleFunc("/admin/access", logRequest(handleAdminAccess), http.MethodGet)
+	mux.HandleFunc("/admin/config", logRequest(handleAdminConfig), http.MethodGet)
+	mux.HandleFunc("/admin/flags", logRequest(handleAdminFlags), http.MethodGet, http.MethodPost)
+	mux.HandleFunc("/admin/schedule", logRequest(handleAdminSchedule), http.MethodGet, http.MethodPost)
+	mux.HandleFunc("/admin/sources", logRequest(handleAdminSources), http.MethodGet, http.MethodPost)
+	mux.HandleFunc("/admin/verify", logRequest(handleAdminVerify), http.MethodGet, http.MethodPost)
+	mux.HandleFunc("/admin/export", logRequest(handleAdminExport), http.MethodPost)
+	mux.HandleFunc("/admin/exports/{name}", logRequest(handleAdminExportFile), http.MethodGet)
+	mux.HandleFunc("/admin/webhooks", logRequest(handleAdminWebhooks), http.MethodGet, http.MethodPost)
+	mux.HandleFunc("/admin/webhooks/{id}", logRequest(handleAdminWebhook), http.MethodDelete)
+	mux.HandleFunc("/admin/cdn/purge", logRequest(handleAdminCDNPurge), http.MethodPost)
+	addClusterRoutes(mux)
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index, http.MethodGet)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline, http.MethodGet)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile, http.MethodGet)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol, http.MethodGet, http.MethodPost)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace, http.MethodGet)
+
+	return mux
+}
+
+// newClusterMux builds the handler for the cluster listener, which serves
+// only what other instances call, so followers and shard nodes on other
+// hosts don't need the whole admin listener exposed to them
+func newClusterMux() *Router {
+	mux := NewRouter()
+	addClusterRoutes(mux)
+	return mux
+}
+
+// addClusterRoutes registers the replication stream and the shard
+// coordinator's endpoints
+func addClusterRoutes(mux *Router) {
+	mux.HandleFunc("/admin/replication", logRequest(handleAdminReplication), http.MethodGet)
+	mux.HandleFunc("/admin/shards", handleAdminShards, http.MethodGet, http.MethodPost) // Heartbeats every few seconds, so not logged
+}
+
+// handleAdminRefresh triggers an immediate refresh of symbols and/or candles.
+// ?target=candles|symbols|all (default all), or ?symbol=BTC for a single symbol
+func handleAdminRefresh(w http.ResponseWriter, r *http.Request) {
+	if config.SharedSnapshotMode == "reader" {
+		http.Error(w, "Shared snapshot reader: refresh the writer process instead", http.StatusConflict)
+		return
+	}
+	if config.ReplicationMode == ReplicationFollower {
+		http.Error(w, "Replication follower: refresh the leader instead", http.StatusConflict)
+		return
+	}
+
+	if symbol := r.URL.Query().Get("symbol"); symbol != "" {
+		symbol = cache.CanonicalSymbol(symbol)
+		if !cache.HasSymbol(symbol) {
+			http.Error(w, "Symbol not found", http.StatusNotFound)
+			return
+		}
+		if !inShard(symbol) {
+			_, count := currentShard()
+			http.Error(w, fmt.Sprintf("%s is fetched by shard %d", symbol, shardOf(symbol, count)), http.StatusConflict)
+			return
+		}
+		// Run in the background; the response doesn't wait for the upstream call
+		submitJob(w, r, "refresh", map[string]string{"symbol": symbol})
+		return
+	}
+
+	target := r.URL.Query().Get("target")
+	switch target {
+	case "", "all":
+		target = "all"
+	case "symbols", "candles":
+	default:
+		http.Error(w, "Invalid target: use candles, symbols or all", http.StatusBadRequest)
+		return
+	}
+
+	submitJob(w, r, "refresh", map[string]string{"target": target})
+}
+
+// runRefreshJob refreshes params' symbol, or its target: candles, symbols
+// or all
+func runRefreshJob(params map[string]string) (interface{}, error) {
+	if symbol := params["symbol"]; symbol != "" {
+		if onDemand == nil {
+			return nil, permanent(fmt.Errorf("on-demand fetching not running"))
+		}
+		entry, ok := onDemand.Fetch(symbol, jobTimeout)
+		if !ok {
+			return nil, fmt.Errorf("failed to fetch %s", symbol)
+		}
+		return map[string]interface{}{"candles": entry.Candles.Len(), "last_update": entry.LastUpdate}, nil
+	}
+
+	target := params["target"]
+	// Symbols first, so a full refresh fetches candles for new listings
+	if target != "candles" {
+		done := make(chan struct{})
+		if err := awaitActor(&symbolFetcherPID, FetchSymbolsMsg{Done: done}, done); err != nil {
+			return nil, fmt.Errorf("symbol refresh: %w", err)
+		}
+	}
+	if target != "symbols" {
+		done := make(chan struct{})
+		if err := awaitActor(&candleFetcherPID, FetchCandlesMsg{All: true, Done: done}, done); err != nil {
+			return nil, fmt.Errorf("candle refresh: %w", err)
+		}
+	}
+	return map[string]interface{}{"symbol_count": len(cache.GetSymbols()), "last_update": cache.GetLastUpdate()}, nil
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// errTooManyAlerts is returned by AlertStore.Add at ALERTS_MAX_RULES
+var errTooManyAlerts = errors.New("too many alerts")
+
+// Alert conditions
+const (
+	AlertAbove = "above"
+	AlertBelow = "below"
+)
+
+// defaultAlertCooldown applies to repeating alerts without a cooldown
+const defaultAlertCooldown = time.Hour
+
+// AlertRule fires when the latest close of a symbol crosses a price level.
+// One-shot rules fire once; repeating rules fire again while the condition
+// holds, at most once per cooldown. Delivery goes to the webhook URL and/or
+// the Telegram target.
+type AlertRule struct {
+	ID           string          `json:"id"`
+	Symbol       string          `json:"symbol"`
+	Condition    string          `json:"condition"` // above or below
+	Price        float64         `json:"price"`
+	Repeat       bool            `json:"repeat"`
+	CooldownSec  int             `json:"cooldown_seconds,omitempty"`
+	WebhookURL   string          `json:"webhook_url,omitempty"`
+	Telegram     *TelegramTarget `json:"telegram,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+	TriggeredAt  *time.Time      `json:"triggered_at,omitempty"`
+	TriggerCount int             `json:"trigger_count"`
+}
+
+// validate checks a rule submitted through the API
+func (a *AlertRule) validate() error {
+	a.Symbol = cache.CanonicalSymbol(strings.ToUpper(a.Symbol))
+	if a.Symbol == "" {
+		return fmt.Errorf("symbol required")
+	}
+	if a.Condition != AlertAbove && a.Condition != AlertBelow {
+		return fmt.Errorf("invalid condition %q: use above or below", a.Condition)
+	}
+	if a.Price <= 0 {
+		return fmt.Errorf("price must be positive")
+	}
+	if a.WebhookURL == "" && a.Telegram == nil {
+		return fmt.Errorf("webhook_url or telegram required")
+	}
+	if a.WebhookURL != "" && !strings.HasPrefix(a.WebhookURL, "http://") && !strings.HasPrefix(a.WebhookURL, "https://") {
+		return fmt.Errorf("webhook_url must be an http(s) URL")
+	}
+	if a.Telegram != nil && (a.Telegram.BotToken == "" || a.Telegram.ChatID == "") {
+		return fmt.Errorf("telegram requires bot_token and chat_id")
+	}
+	if a.CooldownSec < 0 {
+		return fmt.Errorf("cooldown_seconds must not be negative")
+	}
+	return nil
+}
+
+// armed reports whether the rule may fire at now
+func (a *AlertRule) armed(now time.Time) bool {
+	if a.TriggeredAt == nil {
+		return true
+	}
+	if !a.Repeat {
+		return false
+	}
+	cooldown := time.Duration(a.CooldownSec) * time.Second
+	if cooldown == 0 {
+		cooldown = defaultAlertCooldown
+	}
+	return now.Sub(*a.TriggeredAt) >= cooldown
+}
+
+// redacted returns a copy safe to return from the API. Webhook URLs carry
+// their secret in the path, so only the scheme and host are kept.
+func (a AlertRule) redacted() AlertRule {
+	if a.Telegram != nil {
+		a.Telegram = &TelegramTarget{BotToken: "***", ChatID: a.Telegram.ChatID}
+	}
+	a.WebhookURL = redactWebhookURL(a.WebhookURL)
+	return a
+}
+
+func redactWebhookURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "***"
+	}
+	return u.Scheme + "://" + u.Host + "/***"
+}
+
+// matches reports whether price satisfies the rule's condition
+func (a *AlertRule) matches(price float64) bool {
+	if a.Condition == AlertAbove {
+		return price >= a.Price
+	}
+	return price <= a.Price
+}
+
+// AlertStore holds alert rules, persisting them to a JSON file after every
+// change when a path is configured
+type AlertStore struct {
+	mu       sync.RWMutex
+	rules    map[string]*AlertRule
+	path     string
+	maxRules int
+}
+
+// NewAlertStore creates an empty alert store holding up to maxRules rules;
+// path may be empty for memory only
+func NewAlertStore(path string, maxRules int) *AlertStore {
+	return &AlertStore{rules: make(map[string]*AlertRule), path: path, maxRules: maxRules}
+}
+
+// Load reads rules from the store's file; a missing file is not an error
+func (s *AlertStore) Load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read alerts: %w", err)
+	}
+
+	var rules []*AlertRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("failed to decode alerts: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rule := range rules {
+		s.rules[rule.ID] = rule
+	}
+	log.Printf("[Alerts] Loaded %d alerts from %s", len(rules), s.path)
+	return nil
+}
+
+// saveLocked writes all rules to the store's file. The file holds bot
+// tokens, so it's only readable by the owner. Callers must hold s.mu.
+func (s *AlertStore) saveLocked() {
+	if s.path == "" {
+		return
+	}
+	rules := make([]*AlertRule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		rules = append(rules, rule)
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		log.Printf("[Alerts] ERROR: Failed to encode alerts: %v", err)
+		errorTrace.Record(SubsystemStorage, "alerts", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		log.Printf("[Alerts] ERROR: Failed to create alerts dir: %v", err)
+		errorTrace.Record(SubsystemStorage, "alerts", err)
+		return
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		log.Printf("[Alerts] ERROR: Failed to write alerts: %v", err)
+		errorTrace.Record(SubsystemStorage, "alerts", err)
+		return
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		log.Printf("[Alerts] ERROR: Failed to replace alerts: %v", err)
+		errorTrace.Record(SubsystemStorage, "alerts", err)
+	}
+}
+
+// Add assigns an ID to the rule and stores it, failing with
+// errTooManyAlerts when the store is full
+func (s *AlertStore) Add(rule AlertRule) (AlertRule, error) {
+	rule.ID = newAlertID()
+	rule.CreatedAt = time.Now().UTC()
+	rule.TriggeredAt = nil
+	rule.TriggerCount = 0
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.rules) >= s.maxRules {
+		return AlertRule{}, errTooManyAlerts
+	}
+	s.rules[rule.ID] = &rule
+	s.saveLocked()
+	return rule, nil
+}
+
+// Get returns a copy of a rule
+func (s *AlertStore) Get(id string) (AlertRule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rule, ok := s.rules[id]
+	if !ok {
+		return AlertRule{}, false
+	}
+	return *rule, true
+}
+
+// Update replaces a rule's definition and re-arms it
+func (s *AlertStore) Update(id string, rule AlertRule) (AlertRule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.rules[id]
+	if !ok {
+		return AlertRule{}, false
+	}
+	rule.ID = id
+	rule.CreatedAt = existing.CreatedAt
+	rule.TriggeredAt = nil
+	rule.TriggerCount = 0
+	s.rules[id] = &rule
+	s.saveLocked()
+	return rule, true
+}
+
+// Delete removes a rule, reporting whether it existed
+func (s *AlertStore) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rules[id]; !ok {
+		return false
+	}
+	delete(s.rules, id)
+	s.saveLocked()
+	return true
+}
+
+// List returns copies of all rules, oldest first
+func (s *AlertStore) List() []AlertRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]AlertRule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		result = append(result, *rule)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// armed returns copies of rules that may fire at now
+func (s *AlertStore) armed(now time.Time) []AlertRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]AlertRule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		if rule.armed(now) {
+			result = append(result, *rule)
+		}
+	}
+	return result
+}
+
+// markTriggered records that a rule fired
+func (s *AlertStore) markTriggered(id string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rule, ok := s.rules[id]; ok {
+		rule.TriggeredAt = &at
+		rule.TriggerCount++
+		s.saveLocked()
+	}
+}
+
+func newAlertID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// AlertActor evaluates alert rules against the latest cached closes after
+// every cache update and delivers the ones that fire
+type AlertActor struct {
+	cache     *Cache
+	store     *AlertStore
+	telegram  *TelegramClient
+	webhooks  *http.Client
+	evaluated time.Time
+}
+
+// NewAlertActor creates a new alert actor
+func NewAlertActor(cache *Cache, store *AlertStore) *AlertActor {
+	return &AlertActor{
+		cache:    cache,
+		store:    store,
+		telegram: NewTelegramClient(),
+		webhooks: newPublicHTTPClient(10 * time.Second),
+	}
+}
+
+// newPublicHTTPClient creates a client that refuses to connect to
+// loopback, private and link-local addresses. The check runs on the
+// resolved address, so a public name pointing inside the network is
+// refused too. Alert webhooks are caller-supplied URLs.
+func newPublicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+				return fmt.Errorf("refusing to connect to non-public address %s", host)
+			}
+			return nil
+		},
+	}
+	// No proxy: the check must see the webhook's own address
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: timeout},
+	}
+}
+
+func (a *AlertActor) Receive(ctx *actor.Context) {
+	switch ctx.Message().(type) {
+	case actor.Started:
+		log.Println("[Alerts] Actor started")
+		ctx.SendRepeat(ctx.PID(), EvaluateAlertsMsg{}, 15*time.Second)
+
+	case EvaluateAlertsMsg:
+		a.evaluate()
+
+	case actor.Stopped:
+		log.Println("[Alerts] Actor stopped")
+	}
+}
+
+func (a *AlertActor) evaluate() {
+	if !features.Enabled(FlagAlerts) {
+		return
+	}
+	// Prices only move when the cache does
+	lastUpdate := a.cache.GetLastUpdate()
+	if lastUpdate.Equal(a.evaluated) {
+		return
+	}
+	a.evaluated = lastUpdate
+
+	for _, rule := range a.store.armed(time.Now()) {
+		entry, ok := a.cache.Get(rule.Symbol)
+		n := entry.Candles.Len()
+		if !ok || n == 0 {
+			continue
+		}
+		price := entry.Candles.Closes[n-1]
+		if !rule.matches(price) {
+			continue
+		}
+
+		a.store.markTriggered(rule.ID, time.Now().UTC())
+		log.Printf("[Alerts] Alert %s triggered: %s %s %v (last %v)", rule.ID, rule.Symbol, rule.Condition, rule.Price, price)
+		go a.deliver(rule, price)
+	}
+}
+
+// deliver sends a triggered alert to each of its channels
+func (a *AlertActor) deliver(rule AlertRule, price float64) {
+	text := fmt.Sprintf("%s is %s %v (last price %v)", rule.Symbol, rule.Condition, rule.Price, price)
+
+	if rule.WebhookURL != "" {
+		payload := map[string]interface{}{
+			"text":     text,
+			"content":  text,
+			"event":    "price_alert",
+			"alert_id": rule.ID,
+			"symbol":   rule.Symbol,
+			"price":    price,
+			"time":     time.Now().UTC(),
+		}
+		result := "success"
+		if err := postWebhook(a.webhooks, rule.WebhookURL, payload); err != nil {
+			log.Printf("[Alerts] ERROR: Webhook delivery for %s failed: %v", rule.ID, err)
+			result = "error"
+		}
+		metrics.Inc("alert_deliveries_total", "channel", "webhook", "result", result)
+	}
+
+	if rule.Telegram != nil {
+		result := "success"
+		if err := a.telegram.SendMessage(*rule.Telegram, text); err != nil {
+			log.Printf("[Alerts] ERROR: Telegram delivery for %s failed: %v", rule.ID, err)
+			result = "error"
+		}
+		metrics.Inc("alert_deliveries_total", "channel", "telegram", "result", result)
+	}
+}
+
+// handleAlerts lists alerts (GET) or creates one (POST)
+func handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if !checkBearerToken(w, r, config.AlertsToken) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		rules := alertStore.List()
+		for i := range rules {
+			rules[i] = rules[i].redacted()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"alerts": rules,
+			"count":  len(rules),
+		})
+
+	case http.MethodPost:
+		rule, ok := decodeAlertRule(w, r, nil)
+		if !ok {
+			return
+		}
+		rule, err := alertStore.Add(rule)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Too many alerts: at most %d", config.AlertsMaxRules), http.StatusConflict)
+			return
+		}
+		log.Printf("[Alerts] Created alert %s: %s %s %v", rule.ID, rule.Symbol, rule.Condition, rule.Price)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(rule.redacted())
+	}
+}
+
+// handleAlert reads (GET), replaces (PUT) or deletes (DELETE) /api/alerts/{id}
+func handleAlert(w http.ResponseWriter, r *http.Request) {
+	if !checkBearerToken(w, r, config.AlertsToken) {
+		return
+	}
+	id := r.PathValue("id")
+	existing, exists := alertStore.Get(id)
+	if !exists {
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(existing.redacted())
+
+	case http.MethodPut:
+		rule, ok := decodeAlertRule(w, r, &existing)
+		if !ok {
+			return
+		}
+		rule, ok = alertStore.Update(id, rule)
+		if !ok {
+			http.Error(w, "Alert not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[Alerts] Updated alert %s: %s %s %v", rule.ID, rule.Symbol, rule.Condition, rule.Price)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rule.redacted())
+
+	case http.MethodDelete:
+		if !alertStore.Delete(id) {
+			http.Error(w, "Alert not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[Alerts] Deleted alert %s", id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// decodeAlertRule parses and validates a rule from the request body,
+// writing the error response itself when it fails. existing is the rule
+// being replaced, if any.
+func decodeAlertRule(w http.ResponseWriter, r *http.Request, existing *AlertRule) (AlertRule, bool) {
+	var rule AlertRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return rule, false
+	}
+	// Clients only ever see redacted secrets, so let them send the rule back as-is
+	if existing != nil && rule.Telegram != nil && existing.Telegram != nil && (rule.Telegram.BotToken == "" || rule.Telegram.BotToken == "***") {
+		rule.Telegram.BotToken = existing.Telegram.BotToken
+	}
+	if existing != nil && existing.WebhookURL != "" && rule.WebhookURL == redactWebhookURL(existing.WebhookURL) {
+		rule.WebhookURL = existing.WebhookURL
+	}
+	if err := rule.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return rule, false
+	}
+	return rule, true
+}
+
+// checkBearerToken answers 401 unless the request carries token as its
+// bearer token; an empty token lets every request through
+func checkBearerToken(w http.ResponseWriter, r *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Anomaly describes how unusual a symbol's latest candle is relative to its
+// trailing window
+type Anomaly struct {
+	Symbol    string   `json:"symbol"`
+	Timestamp int64    `json:"timestamp"`
+	Return    float64  `json:"return"`   // Percent, close to close
+	ReturnZ   float64  `json:"return_z"` // Standard deviations from the trailing mean
+	Volume    float64  `json:"volume"`
+	VolumeZ   float64  `json:"volume_z"`
+	Flags     []string `json:"flags,omitempty"` // "return" and/or "volume"
+}
+
+var latestScores = &cycleMemo[[]Anomaly]{
+	compute: func() []Anomaly {
+		return scoreLatest(cache.GetAll(), config.AnomalyWindow)
+	},
+}
+
+// scoreLatest computes return and volume z-scores of each symbol's latest
+// candle against the preceding window candles
+func scoreLatest(all map[string]CacheEntry, window int) []Anomaly {
+	result := make([]Anomaly, 0, len(all))
+	for symbol, entry := range all {
+		n := entry.Candles.Len()
+		// Need window returns plus the latest one
+		if n < window+2 {
+			continue
+		}
+		closes := entry.Candles.Closes[n-window-2:]
+
+		returns := make([]float64, 0, window+1)
+		for i := 1; i < len(closes); i++ {
+			prev := closes[i-1]
+			if prev <= 0 {
+				returns = append(returns, 0)
+			} else {
+				returns = append(returns, (closes[i]-prev)/prev*100)
+			}
+		}
+		volumes := entry.Candles.Volumes[n-window-1:]
+
+		last := len(returns) - 1
+		result = append(result, Anomaly{
+			Symbol:    symbol,
+			Timestamp: entry.Candles.Timestamp(n - 1),
+			Return:    returns[last],
+			ReturnZ:   zScore(returns[last], returns[:last]),
+			Volume:    volumes[last],
+			VolumeZ:   zScore(volumes[last], volumes[:last]),
+		})
+	}
+	return result
+}
+
+// zScore returns how many sample standard deviations x is from the mean of
+// sample, or 0 when the sample has no variance
+func zScore(x float64, sample []float64) float64 {
+	var mean float64
+	for _, v := range sample {
+		mean += v
+	}
+	mean /= float64(len(sample))
+
+	var variance float64
+	for _, v := range sample {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(len(sample) - 1)
+
+	if variance == 0 {
+		return 0
+	}
+	return (x - mean) / math.Sqrt(variance)
+}
+
+// flagAnomalies returns the scores whose return or volume z-score reaches
+// threshold, most extreme first
+func flagAnomalies(scores []Anomaly, threshold float64) []Anomaly {
+	result := make([]Anomaly, 0)
+	for _, a := range scores {
+		a.Flags = nil
+		if math.Abs(a.ReturnZ) >= threshold {
+			a.Flags = append(a.Flags, "return")
+		}
+		if a.VolumeZ >= threshold {
+			a.Flags = append(a.Flags, "volume")
+		}
+		if len(a.Flags) > 0 {
+			result = append(result, a)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return max(math.Abs(result[i].ReturnZ), result[i].VolumeZ) > max(math.Abs(result[j].ReturnZ), result[j].VolumeZ)
+	})
+	return result
+}
+
+func handleGetAnomalies(w http.ResponseWriter, r *http.Request) {
+	threshold := config.AnomalyZScore
+	if raw := r.URL.Query().Get("z"); raw != "" {
+		z, err := strconv.ParseFloat(raw, 64)
+		if err != nil || z <= 0 {
+			http.Error(w, "Invalid z: use a positive number", http.StatusBadRequest)
+			return
+		}
+		threshold = z
+	}
+
+	lastUpdate := cache.GetLastUpdate()
+	if setETag(w, r, generateETag(lastUpdate)) {
+		return
+	}
+
+	anomalies := flagAnomalies(latestScores.get(lastUpdate), threshold)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := writeJSON(r.Context(), w, map[string]interface{}{
+		"threshold": threshold,
+		"window":    config.AnomalyWindow,
+		"anomalies": anomalies,
+		"count":     len(anomalies),
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SymbolOutcome is the result of fetching one symbol during a cycle
+type SymbolOutcome struct {
+	Symbol  string `json:"symbol"`
+	OK      bool   `json:"ok"`
+	Candles int    `json:"candles"`
+	Error   string `json:"error,omitempty"`
+	FetchStats
+}
+
+// AuditRecord describes one candle fetch cycle
+type AuditRecord struct {
+	Start       time.Time        `json:"start"`
+	End         time.Time        `json:"end"`
+	Symbols     int              `json:"symbols"`
+	Succeeded   int              `json:"succeeded"`
+	Bytes       int64            `json:"bytes"`
+	RateLimited int              `json:"rate_limited"`
+	Latency     LatencyQuantiles `json:"latency_ms"`
+	Outcomes    []SymbolOutcome  `json:"outcomes"`
+}
+
+// AuditLog appends one JSON line per fetch cycle to a rotating file
+type AuditLog struct {
+	file *rotatingFile
+}
+
+// NewAuditLog opens the audit log at path, rotating at maxSize and keeping
+// keep rotated files
+func NewAuditLog(path string, maxSize int64, keep int) (*AuditLog, error) {
+	file, err := openRotatingFile(path, rotationPolicy{MaxSize: maxSize, Keep: keep})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &AuditLog{file: file}, nil
+}
+
+// Append writes a cycle record; a nil log discards it
+func (a *AuditLog) Append(rec AuditRecord) {
+	if a == nil {
+		return
+	}
+	for _, o := range rec.Outcomes {
+		rec.Bytes += o.Bytes
+		rec.RateLimited += o.RateLimited
+		if o.OK {
+			rec.Succeeded++
+		}
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("[Audit] ERROR: Failed to encode record: %v", err)
+		errorTrace.Record(SubsystemStorage, "audit", err)
+		return
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		log.Printf("[Audit] ERROR: Failed to write record: %v", err)
+		errorTrace.Record(SubsystemStorage, "audit", err)
+	}
+}
+
+// Query returns up to limit cycles that started at or after since, newest
+// first. With a symbol, outcomes are narrowed to that symbol.
+func (a *AuditLog) Query(since time.Time, symbol string, limit int) ([]AuditRecord, error) {
+	records := []AuditRecord{}
+	for _, path := range a.file.Files() {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue // Rotated away while we were reading
+		}
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var rec AuditRecord
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.Start.Before(since) {
+				continue
+			}
+			if symbol != "" {
+				outcomes := rec.Outcomes[:0]
+				for _, o := range rec.Outcomes {
+					if o.Symbol == symbol {
+						outcomes = append(outcomes, o)
+					}
+				}
+				rec.Outcomes = outcomes
+			}
+			records = append(records, rec)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Files are oldest first; reverse to newest first and trim
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	if len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// handleAdminAudit returns recent fetch cycle records.
+// ?limit=20, ?since=<RFC3339 or lookback like 6h>, ?symbol=BTC
+func handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	if auditLog == nil {
+		http.Error(w, "Audit log disabled: set AUDIT_LOG_PATH", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 20
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	var since time.Time
+	if raw := query.Get("since"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			lookback, lerr := parseLookback(raw)
+			if lerr != nil {
+				http.Error(w, "Invalid since: use RFC3339 or a duration like 6h", http.StatusBadRequest)
+				return
+			}
+			t = time.Now().Add(-lookback)
+		}
+		since = t
+	}
+	symbol := query.Get("symbol")
+	if symbol != "" {
+		symbol = cache.CanonicalSymbol(symbol)
+	}
+
+	records, err := auditLog.Query(since, symbol, limit)
+	if err != nil {
+		log.Printf("[Audit] ERROR: Failed to read audit log: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":  len(records),
+		"cycles": records,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+)
+
+// maxPriceBars caps the bars one request may build, so a tiny brick can't
+// turn a series into millions of bars
+const maxPriceBars = 100000
+
+// Non-time bar types for ?type=
+const (
+	BarTypeRenko = "renko"
+	BarTypeRange = "range"
+)
+
+// parseBarQuery reads ?type= with its size parameter (?brick= for renko,
+// ?range= for range bars). An empty type means regular time candles.
+func parseBarQuery(query url.Values) (string, float64, error) {
+	barType := query.Get("type")
+	var param string
+	switch barType {
+	case "", "time":
+		return "", 0, nil
+	case BarTypeRenko:
+		param = "brick"
+	case BarTypeRange:
+		param = "range"
+	default:
+		return "", 0, fmt.Errorf("invalid type %q: use renko or range", barType)
+	}
+	size, err := strconv.ParseFloat(query.Get(param), 64)
+	if err != nil || math.IsNaN(size) || size <= 0 || math.IsInf(size, 0) {
+		return "", 0, fmt.Errorf("type=%s needs a positive ?%s= price size", barType, param)
+	}
+	return barType, size, nil
+}
+
+// buildPriceBars converts time candles to renko bricks or range bars
+func buildPriceBars(candles CandleSeries, barType string, size float64) ([]Candle, error) {
+	if barType == BarTypeRenko {
+		return renkoBricks(candles, size)
+	}
+	return rangeBars(candles, size)
+}
+
+// renkoBricks builds close-based renko bricks of size brick. A new brick
+// forms when a close moves a full brick beyond the last brick's top or
+// bottom, so a reversal takes two bricks. Each brick carries the timestamp
+// of the candle that completed it, and the volume traded since the previous
+// brick goes to the first brick formed.
+func renkoBricks(candles CandleSeries, brick float64) ([]Candle, error) {
+	if candles.Len() == 0 {
+		return nil, nil
+	}
+
+	var bricks []Candle
+	// Start from an empty brick at the first close's brick boundary
+	low := math.Floor(candles.Closes[0]/brick) * brick
+	high := low
+	var volume decimalSum
+	for i := 0; i < candles.Len(); i++ {
+		price := candles.Closes[i]
+		volume.Add(candles.Volumes[i])
+		for price >= high+brick || price <= low-brick {
+			if len(bricks) >= maxPriceBars {
+				return nil, fmt.Errorf("brick %v builds more than %d bricks; use a larger brick", brick, maxPriceBars)
+			}
+			b := Candle{Timestamp: candles.Timestamp(i), Volume: volume.Value()}
+			if price >= high+brick {
+				b.Open, b.Close = high, high+brick
+				b.Low, b.High = high, high+brick
+			} else {
+				b.Open, b.Close = low, low-brick
+				b.Low, b.High = low-brick, low
+			}
+			low, high = b.Low, b.High
+			bricks = append(bricks, b)
+			volume = decimalSum{}
+		}
+	}
+	return bricks, nil
+}
+
+// rangeBars builds bars whose high-low span is exactly size. Candles only
+// give OHLC, so the path inside each one is assumed to be open, low, high,
+// close for up candles and open, high, low, close for down candles. The
+// last bar is still forming and may span less than size.
+func rangeBars(candles CandleSeries, size float64) ([]Candle, error) {
+	if candles.Len() == 0 {
+		return nil, nil
+	}
+
+	var bars []Candle
+	cur := Candle{
+		Timestamp: candles.Timestamp(0),
+		Open:      candles.Opens[0],
+		High:      candles.Opens[0],
+		Low:       candles.Opens[0],
+		Close:     candles.Opens[0],
+	}
+	for i := 0; i < candles.Len(); i++ {
+		ts := candles.Timestamp(i)
+		path := [4]float64{candles.Opens[i], candles.Lows[i], candles.Highs[i], candles.Closes[i]}
+		if candles.Closes[i] < candles.Opens[i] {
+			path[1], path[2] = candles.Highs[i], candles.Lows[i]
+		}
+		// Volume is attributed to the bar forming when the candle starts
+		cur.Volume = addDecimal(cur.Volume, candles.Volumes[i])
+
+		for _, target := range path {
+			for {
+				price := target
+				// Close the bar at the boundary if the move reaches it
+				if target > cur.Low+size {
+					price = cur.Low + size
+				} else if target < cur.High-size {
+					price = cur.High - size
+				}
+				cur.High = max(cur.High, price)
+				cur.Low = min(cur.Low, price)
+				cur.Close = price
+				if cur.High-cur.Low < size*(1-1e-9) {
+					break
+				}
+				if len(bars) >= maxPriceBars {
+					return nil, fmt.Errorf("range %v builds more than %d bars; use a larger range", size, maxPriceBars)
+				}
+				bars = append(bars, cur)
+				cur = Candle{Timestamp: ts, Open: price, High: price, Low: price, Close: price}
+				if price == target {
+					break
+				}
+			}
+		}
+	}
+	if cur.High > cur.Low || cur.Volume > 0 {
+		bars = append(bars, cur)
+	}
+	return bars, nil
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// benchReservoir is how many latency samples each load worker keeps
+const benchReservoir = 10000
+
+// defaultBenchEndpoints are the routes hit when -endpoints isn't given
+var defaultBenchEndpoints = []string{
+	"/api/candles",
+	"/api/candles/BTC",
+	"/api/candles/BTC?lookback=24h",
+	"/api/candles/latest",
+	"/api/mids",
+	"/api/symbols",
+	"/api/summary",
+	"/api/heatmap",
+	"/api/volatility",
+}
+
+// BenchResult is one endpoint's load run
+type BenchResult struct {
+	Endpoint      string
+	Requests      int
+	Errors        int
+	Elapsed       time.Duration
+	Latency       LatencyQuantiles // Milliseconds
+	BytesPerReq   float64
+	AllocsPerReq  float64
+	AllocBytesReq float64
+}
+
+// benchWorker accumulates one load goroutine's stats. Its reservoir is
+// allocated before the run so it doesn't show up in the alloc counts.
+type benchWorker struct {
+	rng      *rand.Rand
+	samples  []float64
+	requests int
+	errors   int
+	bytes    int64
+}
+
+func (bw *benchWorker) record(latency time.Duration, n int64, ok bool) {
+	bw.requests++
+	bw.bytes += n
+	if !ok {
+		bw.errors++
+	}
+	ms := float64(latency) / float64(time.Millisecond)
+	if len(bw.samples) < cap(bw.samples) {
+		bw.samples = append(bw.samples, ms)
+	} else if i := bw.rng.Intn(bw.requests); i < len(bw.samples) {
+		bw.samples[i] = ms
+	}
+}
+
+// runBench implements the bench subcommand: it fills the cache with
+// synthetic candles and drives load against the API handlers, one endpoint
+// at a time, reporting throughput, latency and allocations per request
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	symbols := fs.Int("symbols", 200, "synthetic symbols to cache")
+	candles := fs.Int("candles", 2000, "candles per symbol")
+	duration := fs.Duration("duration", 5*time.Second, "load duration per endpoint")
+	concurrency := fs.Int("concurrency", 8, "concurrent clients")
+	endpoints := fs.String("endpoints", strings.Join(defaultBenchEndpoints, ","), "comma-separated request paths")
+	direct := fs.Bool("direct", false, "call the handler in-process instead of over loopback HTTP, so allocations are the server's alone")
+	useGzip := fs.Bool("gzip", false, "request gzip-encoded responses")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *symbols <= 0 || *candles <= 0 || *concurrency <= 0 || *duration <= 0 {
+		return fmt.Errorf("-symbols, -candles, -concurrency and -duration must be positive")
+	}
+
+	config = loadConfig()
+	if err := config.normalizeIntervals(); err != nil {
+		return err
+	}
+	var err error
+	if jsonEncoder, err = newJSONEncoder(config.JSONEncoder); err != nil {
+		return err
+	}
+	if config.GzipCacheMB > 0 {
+		gzipCache = NewGzipCache(config.GzipCacheMB << 20)
+	}
+	categories = NewCategories(config.SymbolCategories)
+	fetchLatency = NewLatencyTracker(0)
+	cache = NewCache()
+	populateBenchCache(cache, *symbols, *candles, config.CandleInterval)
+
+	handler := http.Handler(newAPIMux())
+	fmt.Printf("Cache: %d symbols x %d %s candles, encoder %s, %d clients, %v per endpoint\n",
+		*symbols, *candles, config.CandleInterval, jsonEncoder.Name(), *concurrency, *duration)
+
+	// Request logging would dominate the numbers
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	var do func(path string) (int64, bool)
+	if *direct {
+		do = func(path string) (int64, bool) {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if *useGzip {
+				req.Header.Set("Accept-Encoding", "gzip")
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			return int64(rec.Body.Len()), rec.Code == http.StatusOK
+		}
+	} else {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		client := &http.Client{Transport: &http.Transport{
+			MaxIdleConnsPerHost: *concurrency,
+			DisableCompression:  true,
+		}}
+		do = func(path string) (int64, bool) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+			if err != nil {
+				return 0, false
+			}
+			if *useGzip {
+				req.Header.Set("Accept-Encoding", "gzip")
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return 0, false
+			}
+			n, _ := io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			return n, resp.StatusCode == http.StatusOK
+		}
+	}
+
+	var results []BenchResult
+	for _, endpoint := range strings.Split(*endpoints, ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint == "" {
+			continue
+		}
+		results = append(results, benchEndpoint(endpoint, do, *concurrency, *duration))
+	}
+	printBenchResults(os.Stdout, results)
+	return nil
+}
+
+// benchEndpoint runs concurrent clients against one path for d
+func benchEndpoint(path string, do func(string) (int64, bool), concurrency int, d time.Duration) BenchResult {
+	// Warm up pools and connections outside the measured window
+	for i := 0; i < concurrency; i++ {
+		do(path)
+	}
+
+	workers := make([]*benchWorker, concurrency)
+	for i := range workers {
+		workers[i] = &benchWorker{
+			rng:     rand.New(rand.NewSource(int64(i))),
+			samples: make([]float64, 0, benchReservoir),
+		}
+	}
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	deadline := start.Add(d)
+	var wg sync.WaitGroup
+	for _, bw := range workers {
+		wg.Add(1)
+		go func(bw *benchWorker) {
+			defer wg.Done()
+			for {
+				t := time.Now()
+				if !t.Before(deadline) {
+					return
+				}
+				n, ok := do(path)
+				bw.record(time.Since(t), n, ok)
+			}
+		}(bw)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	result := BenchResult{Endpoint: path, Elapsed: elapsed}
+	var samples []float64
+	var bytes int64
+	for _, bw := range workers {
+		result.Requests += bw.requests
+		result.Errors += bw.errors
+		bytes += bw.bytes
+		samples = append(samples, bw.samples...)
+	}
+	result.Latency = quantilesOf(samples)
+	if result.Requests > 0 {
+		n := float64(result.Requests)
+		result.BytesPerReq = float64(bytes) / n
+		result.AllocsPerReq = float64(after.Mallocs-before.Mallocs) / n
+		result.AllocBytesReq = float64(after.TotalAlloc-before.TotalAlloc) / n
+	}
+	return result
+}
+
+func printBenchResults(w io.Writer, results []BenchResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "endpoint\treqs\treq/s\tp50 ms\tp95 ms\tp99 ms\tKB/resp\tallocs/req\tKB alloc/req\terrors\t")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%.0f\t%.3f\t%.3f\t%.3f\t%.1f\t%.0f\t%.1f\t%d\t\n",
+			r.Endpoint, r.Requests, float64(r.Requests)/r.Elapsed.Seconds(),
+			r.Latency.P50, r.Latency.P95, r.Latency.P99,
+			r.BytesPerReq/1024, r.AllocsPerReq, r.AllocBytesReq/1024, r.Errors)
+	}
+	tw.Flush()
+}
+
+// populateBenchCache fills c with random-walk candles. The first symbols are
+// named after real markets so paths like /api/candles/BTC work.
+func populateBenchCache(c *Cache, symbols, candles int, interval string) {
+	step, ok := intervalDuration(interval)
+	if !ok {
+		step = time.Hour
+	}
+	known := []string{"BTC", "ETH", "SOL", "HYPE", "DOGE", "XRP", "AVAX", "LINK"}
+	rng := rand.New(rand.NewSource(1))
+	end := time.Now().Truncate(step)
+	first := end.Add(-time.Duration(candles-1) * step).UnixMilli()
+
+	names := make([]string, symbols)
+	metadata := make([]SymbolMeta, symbols)
+	for i := range names {
+		name := fmt.Sprintf("SYN%04d", i)
+		if i < len(known) {
+			name = known[i]
+		}
+		names[i] = name
+
+		series := make([]Candle, candles)
+		price := 1 + rng.Float64()*1000
+		for j := range series {
+			open := price
+			price *= math.Exp(rng.NormFloat64() * 0.01)
+			series[j] = Candle{
+				Timestamp: first + int64(j)*step.Milliseconds(),
+				Open:      open,
+				High:      math.Max(open, price) * (1 + rng.Float64()*0.005),
+				Low:       math.Min(open, price) * (1 - rng.Float64()*0.005),
+				Close:     price,
+				Volume:    rng.Float64() * 1e6,
+			}
+		}
+		c.Set(name, series)
+		metadata[i] = SymbolMeta{Name: name, Market: MarketPerp, MarkPx: price, PrevDayPx: series[0].Open, DayNtlVlm: rng.Float64() * 1e8}
+	}
+	c.SetSymbols(names)
+	c.SetMetadata(metadata)
+}
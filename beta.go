@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SymbolBeta is a symbol's beta and correlation to the benchmark over the
+// latest window of log returns
+type SymbolBeta struct {
+	Symbol      string  `json:"symbol"`
+	Beta        float64 `json:"beta"`
+	Correlation float64 `json:"correlation"`
+}
+
+// BetaPoint is the beta and correlation over the window ending at Timestamp
+type BetaPoint struct {
+	Timestamp   int64   `json:"timestamp"`
+	Beta        float64 `json:"beta"`
+	Correlation float64 `json:"correlation"`
+}
+
+// betaMemosKept bounds how many (benchmark, window) pairs keep their
+// betas between fetch cycles
+const betaMemosKept = 8
+
+type betaKey struct {
+	benchmark string
+	window    int
+}
+
+// betaMemos keeps the betas of the most recently asked (benchmark, window)
+// pairs, so dashboards polling a non-default pair don't recompute them over
+// the whole cache on every request
+type betaMemos struct {
+	mu    sync.Mutex
+	memos map[betaKey]*cycleMemo[[]SymbolBeta]
+	order []betaKey // Least recently asked first
+}
+
+var latestBetas = &betaMemos{memos: make(map[betaKey]*cycleMemo[[]SymbolBeta])}
+
+// get returns the betas to benchmark over window for the cache state at
+// lastUpdate
+func (b *betaMemos) get(benchmark string, window int, lastUpdate time.Time) []SymbolBeta {
+	key := betaKey{benchmark: benchmark, window: window}
+
+	b.mu.Lock()
+	memo, ok := b.memos[key]
+	if ok {
+		b.order = slices.DeleteFunc(b.order, func(k betaKey) bool { return k == key })
+	} else {
+		if len(b.order) >= betaMemosKept {
+			delete(b.memos, b.order[0])
+			b.order = b.order[1:]
+		}
+		memo = &cycleMemo[[]SymbolBeta]{
+			compute: func() []SymbolBeta {
+				betas, _ := computeBetas(cache.GetAll(), benchmark, window, config.CandleInterval)
+				return betas
+			},
+		}
+		b.memos[key] = memo
+	}
+	b.order = append(b.order, key)
+	b.mu.Unlock()
+
+	return memo.get(lastUpdate)
+}
+
+// maxBetaWindow is the most candle returns a symbol's cached history can
+// hold at CANDLE_INTERVAL
+func maxBetaWindow() int {
+	step, ok := intervalDuration(config.CandleInterval)
+	if !ok {
+		return config.BetaWindow
+	}
+	days := config.LookbackDays(config.CandleInterval)
+	return max(int(time.Duration(days)*24*time.Hour/step), config.BetaWindow)
+}
+
+// logReturns returns each candle's log return from the previous one, keyed
+// by timestamp. Returns across a gap in the series are left out, so two
+// symbols' returns only pair up over the same span.
+func logReturns(candles CandleSeries, step int64) map[int64]float64 {
+	returns := make(map[int64]float64, candles.Len())
+	for i := 1; i < candles.Len(); i++ {
+		prev, cur := candles.Closes[i-1], candles.Closes[i]
+		if candles.Timestamp(i)-candles.Timestamp(i-1) != step || prev <= 0 || cur <= 0 {
+			continue
+		}
+		returns[candles.Timestamp(i)] = math.Log(cur / prev)
+	}
+	return returns
+}
+
+// pairedReturns returns the timestamps where both the symbol and the
+// benchmark have a return, oldest first, with the benchmark's and the
+// symbol's returns
+func pairedReturns(candles CandleSeries, step int64, benchmark map[int64]float64) ([]int64, []float64, []float64) {
+	var timestamps []int64
+	var xs, ys []float64
+	for i := 1; i < candles.Len(); i++ {
+		ts := candles.Timestamp(i)
+		prev, cur := candles.Closes[i-1], candles.Closes[i]
+		x, ok := benchmark[ts]
+		if !ok || ts-candles.Timestamp(i-1) != step || prev <= 0 || cur <= 0 {
+			continue
+		}
+		timestamps = append(timestamps, ts)
+		xs = append(xs, x)
+		ys = append(ys, math.Log(cur/prev))
+	}
+	return timestamps, xs, ys
+}
+
+// betaOf regresses ys on xs: the slope and the correlation. ok is false when
+// either side doesn't move.
+func betaOf(xs, ys []float64) (beta, correlation float64, ok bool) {
+	n := float64(len(xs))
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= n
+	meanY /= n
+
+	var cov, varX, varY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return 0, 0, false
+	}
+	return cov / varX, cov / math.Sqrt(varX*varY), true
+}
+
+// computeBetas computes every cached symbol's beta to benchmark over its
+// latest window returns. Symbols with fewer paired returns are left out.
+func computeBetas(all map[string]CacheEntry, benchmark string, window int, interval string) ([]SymbolBeta, error) {
+	step, ok := intervalDuration(interval)
+	if !ok {
+		return []SymbolBeta{}, nil
+	}
+	bench, ok := all[benchmark]
+	if !ok {
+		return nil, fmt.Errorf("benchmark %s is not cached", benchmark)
+	}
+	benchReturns := logReturns(bench.Candles, step.Milliseconds())
+
+	result := make([]SymbolBeta, 0, len(all))
+	for symbol, entry := range all {
+		_, xs, ys := pairedReturns(entry.Candles, step.Milliseconds(), benchReturns)
+		if len(xs) < window {
+			continue
+		}
+		beta, correlation, ok := betaOf(xs[len(xs)-window:], ys[len(ys)-window:])
+		if !ok {
+			continue
+		}
+		result = append(result, SymbolBeta{Symbol: symbol, Beta: beta, Correlation: correlation})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Symbol < result[j].Symbol })
+	return result, nil
+}
+
+// rollingBeta returns the beta and correlation over each window of paired
+// returns in the symbol's history
+func rollingBeta(candles CandleSeries, benchmark CandleSeries, window int, step time.Duration) []BetaPoint {
+	timestamps, xs, ys := pairedReturns(candles, step.Milliseconds(), logReturns(benchmark, step.Milliseconds()))
+	points := make([]BetaPoint, 0, max(len(xs)-window+1, 0))
+	for end := window; end <= len(xs); end++ {
+		beta, correlation, ok := betaOf(xs[end-window:end], ys[end-window:end])
+		if !ok {
+			continue
+		}
+		points = append(points, BetaPoint{Timestamp: timestamps[end-1], Beta: beta, Correlation: correlation})
+	}
+	return points
+}
+
+// handleGetBeta returns each symbol's beta and correlation to the benchmark
+// (?benchmark=, default BETA_BENCHMARK) over the last ?window= candle
+// returns. ?symbol= returns that symbol's rolling series instead.
+func handleGetBeta(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	window := config.BetaWindow
+	if raw := query.Get("window"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 2 {
+			http.Error(w, "Invalid window: use at least 2 candles", http.StatusBadRequest)
+			return
+		}
+		if limit := maxBetaWindow(); n > limit {
+			http.Error(w, fmt.Sprintf("Invalid window: at most %d candles are cached", limit), http.StatusBadRequest)
+			return
+		}
+		window = n
+	}
+	benchmark := config.BetaBenchmark
+	if raw := query.Get("benchmark"); raw != "" {
+		benchmark = cache.CanonicalSymbol(raw)
+	}
+	if _, ok := cache.Get(benchmark); !ok {
+		http.Error(w, "Benchmark not found", http.StatusNotFound)
+		return
+	}
+
+	lastUpdate := cache.GetLastUpdate()
+	if setETag(w, r, generateETag(lastUpdate)) {
+		return
+	}
+
+	response := map[string]interface{}{
+		"interval":  config.CandleInterval,
+		"benchmark": benchmark,
+		"window":    window,
+	}
+	if raw := query.Get("symbol"); raw != "" {
+		symbol := cache.CanonicalSymbol(raw)
+		entry, exists := cache.Get(symbol)
+		if !exists {
+			http.Error(w, "Symbol not found", http.StatusNotFound)
+			return
+		}
+		bench, _ := cache.Get(benchmark)
+		step, ok := intervalDuration(config.CandleInterval)
+		if !ok {
+			step = time.Hour
+		}
+		response["symbol"] = symbol
+		response["series"] = rollingBeta(entry.Candles, bench.Candles, window, step)
+	} else {
+		betas := latestBetas.get(benchmark, window, lastUpdate)
+		if betas == nil {
+			http.Error(w, "Benchmark not found", http.StatusNotFound)
+			return
+		}
+		response["symbols"] = betas
+		response["count"] = len(betas)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := writeJSON(r.Context(), w, response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Hyperliquid limits REST traffic per IP by request weight: 1200 per minute,
+// with most info requests weighing 20 and candle snapshots a further 1 per
+// 60 candles returned
+const (
+	defaultWeightBudgetPerMin = 1200
+	infoRequestWeight         = 20
+	lightInfoRequestWeight    = 2
+	candlesPerExtraWeight     = 60
+)
+
+// lightInfoTypes are the info request types weighing 2 instead of 20
+var lightInfoTypes = map[string]bool{
+	"allMids":                true,
+	"l2Book":                 true,
+	"clearinghouseState":     true,
+	"orderStatus":            true,
+	"spotClearinghouseState": true,
+	"exchangeStatus":         true,
+}
+
+// infoWeight returns the rate limit weight of an info request of type
+// reqType that returned items elements (candles for candleSnapshot)
+func infoWeight(reqType string, items int) int {
+	if lightInfoTypes[reqType] {
+		return lightInfoRequestWeight
+	}
+	if reqType == "candleSnapshot" {
+		return infoRequestWeight + items/candlesPerExtraWeight
+	}
+	return infoRequestWeight
+}
+
+// budgetSecond is the traffic of one second
+type budgetSecond struct {
+	unix        int64
+	requests    int
+	weight      int
+	rateLimited int
+}
+
+// budgetMinute is the traffic of one minute by request type
+type budgetMinute struct {
+	unix   int64 // Minute start
+	byType map[string]*BudgetUsage
+}
+
+// BudgetUsage is the traffic over a window
+type BudgetUsage struct {
+	Requests    int `json:"requests"`
+	Weight      int `json:"weight"`
+	RateLimited int `json:"rate_limited,omitempty"` // 429 responses
+}
+
+// RequestBudget tracks outbound Hyperliquid requests and their weight over
+// the last minute and hour against a per-minute weight budget
+type RequestBudget struct {
+	mu           sync.Mutex
+	budgetPerMin int
+	seconds      [3600]budgetSecond
+	minutes      [60]budgetMinute
+	lastCycle    CycleBudget
+	lastWarn     time.Time
+}
+
+// CycleBudget is the weight of the last candle fetch cycle, projected to a
+// steady per-minute rate
+type CycleBudget struct {
+	Finished         time.Time `json:"finished"`
+	Symbols          int       `json:"symbols"`
+	Weight           int       `json:"weight"`
+	WeightPerSymbol  float64   `json:"weight_per_symbol"`
+	ProjectedPerMin  float64   `json:"projected_weight_per_min"` // Cycle weight spread over the refresh interval
+	MaxSymbolsBudget int       `json:"max_symbols_at_budget"`    // Symbols one refresh interval could fetch within the budget
+}
+
+// requestBudget records every Hyperliquid REST request
+var requestBudget = NewRequestBudget(defaultWeightBudgetPerMin)
+
+// NewRequestBudget creates a tracker for budgetPerMin weight per minute
+func NewRequestBudget(budgetPerMin int) *RequestBudget {
+	return &RequestBudget{budgetPerMin: budgetPerMin}
+}
+
+// Record counts one request of reqType with its weight
+func (b *RequestBudget) Record(reqType string, weight int, rateLimited bool) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sec := now.Unix()
+	s := &b.seconds[sec%int64(len(b.seconds))]
+	if s.unix != sec {
+		*s = budgetSecond{unix: sec}
+	}
+	s.requests++
+	s.weight += weight
+
+	minuteStart := sec - sec%60
+	m := &b.minutes[(sec/60)%int64(len(b.minutes))]
+	if m.unix != minuteStart {
+		*m = budgetMinute{unix: minuteStart, byType: make(map[string]*BudgetUsage)}
+	}
+	usage := m.byType[reqType]
+	if usage == nil {
+		usage = &BudgetUsage{}
+		m.byType[reqType] = usage
+	}
+	usage.Requests++
+	usage.Weight += weight
+	if rateLimited {
+		s.rateLimited++
+		usage.RateLimited++
+	}
+
+	metrics.Inc("hyperliquid_requests_total", "type", reqType)
+	metrics.Add("hyperliquid_request_weight_total", float64(weight), "type", reqType)
+	minute := b.windowLocked(now, time.Minute)
+	metrics.Set("hyperliquid_weight_last_minute", float64(minute.Weight))
+	if b.budgetPerMin > 0 && minute.Weight > b.budgetPerMin*9/10 && now.Sub(b.lastWarn) > time.Minute {
+		b.lastWarn = now
+		log.Printf("[Budget] WARNING: %d of %d request weight used in the last minute", minute.Weight, b.budgetPerMin)
+	}
+}
+
+// windowLocked sums the seconds within window of now. Callers must hold b.mu.
+func (b *RequestBudget) windowLocked(now time.Time, window time.Duration) BudgetUsage {
+	var usage BudgetUsage
+	oldest := now.Add(-window).Unix()
+	for _, s := range b.seconds {
+		if s.unix > oldest && s.unix <= now.Unix() {
+			usage.Requests += s.requests
+			usage.Weight += s.weight
+			usage.RateLimited += s.rateLimited
+		}
+	}
+	return usage
+}
+
+// CycleDone projects the weight spent since start, by a fetch cycle over
+// symbols, onto refreshInterval
+func (b *RequestBudget) CycleDone(start time.Time, symbols int, refreshInterval time.Duration) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Whole seconds, so the cycle's first second counts
+	weight := b.windowLocked(now, now.Sub(start.Truncate(time.Second))+time.Second).Weight
+	cycle := CycleBudget{Finished: now, Symbols: symbols, Weight: weight}
+	if symbols > 0 {
+		cycle.WeightPerSymbol = float64(weight) / float64(symbols)
+	}
+	if minutes := refreshInterval.Minutes(); minutes > 0 {
+		cycle.ProjectedPerMin = float64(weight) / minutes
+		if cycle.WeightPerSymbol > 0 {
+			cycle.MaxSymbolsBudget = int(float64(b.budgetPerMin) * minutes / cycle.WeightPerSymbol)
+		}
+	}
+	b.lastCycle = cycle
+	metrics.Set("hyperliquid_cycle_weight", float64(weight))
+}
+
+// BudgetWindow is the usage and headroom over one window
+type BudgetWindow struct {
+	BudgetUsage
+	Budget    int     `json:"budget"`
+	Remaining int     `json:"remaining"`
+	UsedRatio float64 `json:"used_ratio"`
+}
+
+func newBudgetWindow(usage BudgetUsage, budget int) BudgetWindow {
+	w := BudgetWindow{BudgetUsage: usage, Budget: budget, Remaining: max(budget-usage.Weight, 0)}
+	if budget > 0 {
+		w.UsedRatio = float64(usage.Weight) / float64(budget)
+	}
+	return w
+}
+
+// BudgetReport is the /admin/budget response
+type BudgetReport struct {
+	Minute    BudgetWindow            `json:"minute"`
+	Hour      BudgetWindow            `json:"hour"`
+	ByType    map[string]*BudgetUsage `json:"by_type"` // Last hour
+	LastCycle *CycleBudget            `json:"last_cycle,omitempty"`
+}
+
+// Report summarises the last minute and hour
+func (b *RequestBudget) Report() BudgetReport {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	report := BudgetReport{
+		Minute: newBudgetWindow(b.windowLocked(now, time.Minute), b.budgetPerMin),
+		Hour:   newBudgetWindow(b.windowLocked(now, time.Hour), b.budgetPerMin*60),
+		ByType: make(map[string]*BudgetUsage),
+	}
+	oldest := now.Add(-time.Hour).Unix()
+	for _, m := range b.minutes {
+		if m.unix <= oldest {
+			continue
+		}
+		for reqType, usage := range m.byType {
+			total := report.ByType[reqType]
+			if total == nil {
+				total = &BudgetUsage{}
+				report.ByType[reqType] = total
+			}
+			total.Requests += usage.Requests
+			total.Weight += usage.Weight
+			total.RateLimited += usage.RateLimited
+		}
+	}
+	if !b.lastCycle.Finished.IsZero() {
+		cycle := b.lastCycle
+		report.LastCycle = &cycle
+	}
+	return report
+}
+
+// handleAdminBudget reports Hyperliquid request weight used against the
+// budget over the last minute and hour
+func handleAdminBudget(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(requestBudget.Report()); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -10,29 +13,270 @@ type Cache struct {
 	mu          sync.RWMutex
 	data        map[string]CacheEntry
 	symbols     []string
+	metadata    []SymbolMeta
+	marketData  map[string]MarketData
 	lastUpdate  time.Time
 	symbolUpdate time.Time
+	marketDataUpdate time.Time
+	
+	// Memory budget: when budget > 0, the least recently requested series
+	// are evicted once the estimated size of all series exceeds it
+	budget     int64
+	used       int64
+	evicted    map[string]bool
+	expiredAt  map[string]time.Time // Series expired for want of requests, until refilled
+	accessMu   sync.Mutex
+	lastAccess map[string]time.Time
+	
+	hot       *hotResponses
+	precision map[string]Precision // Response rounding per symbol, from metadata
+	namespace string              // Pipeline name, empty for the main cache
+	watch     func(symbol string) // Told of every series change, e.g. the stream hub
 }
 
 // NewCache creates a new cache instance
 func NewCache() *Cache {
 	return &Cache{
-		data:    make(map[string]CacheEntry),
-		symbols: []string{},
+		data:       make(map[string]CacheEntry),
+		symbols:    []string{},
+		evicted:    make(map[string]bool),
+		expiredAt:  make(map[string]time.Time),
+		lastAccess: make(map[string]time.Time),
+		hot:        newHotResponses(),
 	}
 }
 
+// Watch calls fn with the symbol whenever a series is stored or updated.
+// fn is called with the cache locked, so it must not block or call back in.
+func (c *Cache) Watch(fn func(symbol string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.watch = fn
+}
+
+// changedLocked tells the watcher symbol's series changed
+func (c *Cache) changedLocked(symbol string) {
+	if c.watch != nil {
+		c.watch(symbol)
+	}
+}
+
+// labels returns the metric labels of this cache's series
+func (c *Cache) labels() []string {
+	if c.namespace == "" {
+		return nil
+	}
+	return []string{"pipeline", c.namespace}
+}
+
+// entrySize estimates the memory held by a cache entry
+func entrySize(entry CacheEntry) int64 {
+	perCandle := int64(5 * 8)
+	if entry.Candles.timestamps != nil {
+		perCandle += 8
+	}
+	return int64(entry.Candles.Len())*perCandle + int64(len(entry.Symbol)) + 128
+}
+
+// SetBudget sets the memory budget in bytes; zero disables eviction
+func (c *Cache) SetBudget(budget int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.budget = budget
+}
+
 // Set stores candle data for a symbol
 func (c *Cache) Set(symbol string, candles []Candle) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	
-	c.data[symbol] = CacheEntry{
+	c.setLocked(symbol, candles)
+}
+
+func (c *Cache) setLocked(symbol string, candles []Candle) {
+	entry := CacheEntry{
 		Symbol:     symbol,
-		Candles:    candles,
+		Candles:    NewCandleSeries(candles),
 		LastUpdate: time.Now(),
 	}
+	if prev, ok := c.data[symbol]; ok {
+		c.used -= entrySize(prev)
+	}
+	c.used += entrySize(entry)
+	c.data[symbol] = entry
+	c.refilledLocked(symbol)
 	c.lastUpdate = time.Now()
+	
+	if c.budget > 0 && c.used > c.budget && c.evictLocked(symbol) {
+		c.hot.replace(c.data, c.precision)
+	} else {
+		c.hot.update(symbol, entry.Candles)
+	}
+	c.changedLocked(symbol)
+	metrics.Set("cache_memory_bytes", float64(c.used), c.labels()...)
+}
+
+// refilledLocked clears the evicted and expired marks of a symbol that's
+// cached again. Callers must hold c.mu.
+func (c *Cache) refilledLocked(symbol string) {
+	delete(c.evicted, symbol)
+	if expired, ok := c.expiredAt[symbol]; ok {
+		// Fetched again after expiring: frequent refills mean the TTL is too short
+		metrics.Inc("cache_refills_total", c.labels()...)
+		metrics.Add("cache_refill_after_seconds_total", time.Since(expired).Seconds(), c.labels()...)
+		delete(c.expiredAt, symbol)
+		metrics.Set("cache_expired_symbols", float64(len(c.expiredAt)), c.labels()...)
+	}
+}
+
+// SetFetched stores candles fetched from REST starting at started. Streamed
+// updates to the cache made since then are newer than the fetch, so a
+// cached candle at or after the fetched last one is kept in its place.
+func (c *Cache) SetFetched(symbol string, candles []Candle, started time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if prev, ok := c.data[symbol]; ok && prev.LastUpdate.After(started) && len(candles) > 0 {
+		last := candles[len(candles)-1].Timestamp
+		i := prev.Candles.Search(last)
+		// The fetched slice may be shared with other callers of the same
+		// fetch, so the merge goes into a copy
+		merged := make([]Candle, len(candles), len(candles)+prev.Candles.Len()-i)
+		copy(merged, candles)
+		if i < prev.Candles.Len() && prev.Candles.Timestamp(i) == last {
+			merged[len(merged)-1] = prev.Candles.At(i)
+			i++
+		}
+		for ; i < prev.Candles.Len(); i++ {
+			merged = append(merged, prev.Candles.At(i))
+		}
+		candles = merged
+	}
+	c.setLocked(symbol, candles)
+}
+
+// Apply stores entries received from a replication leader, keeping their
+// update times. Entries older than the cached ones are skipped, so a
+// lagging leader, or a shard's stale copy of a symbol that moved, can't
+// roll a series back. A follower keeps to its own memory budget, evicting
+// as Restore does.
+func (c *Cache) Apply(entries map[string]CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for symbol, entry := range entries {
+		if prev, ok := c.data[symbol]; ok {
+			if entry.LastUpdate.Before(prev.LastUpdate) {
+				continue
+			}
+			c.used -= entrySize(prev)
+		}
+		c.used += entrySize(entry)
+		c.data[symbol] = entry
+		c.refilledLocked(symbol)
+		if entry.LastUpdate.After(c.lastUpdate) {
+			c.lastUpdate = entry.LastUpdate
+		}
+		c.hot.update(symbol, entry.Candles)
+		c.changedLocked(symbol)
+	}
+	if c.budget > 0 && c.used > c.budget && c.evictLocked("") {
+		c.hot.replace(c.data, c.precision)
+	}
+	metrics.Set("cache_memory_bytes", float64(c.used), c.labels()...)
+}
+
+// Touch records a client request for symbol, keeping it off the eviction
+// list. Symbols neither cached nor listed are ignored, so requests for
+// made-up names can't grow the access times.
+func (c *Cache) Touch(symbol string) {
+	c.mu.RLock()
+	_, cached := c.data[symbol]
+	known := cached || slices.Contains(c.symbols, symbol)
+	c.mu.RUnlock()
+	if !known {
+		return
+	}
+	c.accessMu.Lock()
+	c.lastAccess[symbol] = time.Now()
+	c.accessMu.Unlock()
+}
+
+// LastAccess returns when symbol was last requested, or zero if never
+func (c *Cache) LastAccess(symbol string) time.Time {
+	c.accessMu.Lock()
+	defer c.accessMu.Unlock()
+	return c.lastAccess[symbol]
+}
+
+// Expire drops series nobody has requested lately. Like series evicted for
+// the memory budget they're skipped by the refresh cycle until a request
+// fetches them on demand; that refill is counted in the metrics.
+func (c *Cache) Expire(symbols ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	now := time.Now()
+	for _, symbol := range symbols {
+		entry, ok := c.data[symbol]
+		if !ok {
+			continue
+		}
+		c.used -= entrySize(entry)
+		delete(c.data, symbol)
+		c.evicted[symbol] = true
+		c.expiredAt[symbol] = now
+		metrics.Inc("cache_expirations_total", c.labels()...)
+	}
+	metrics.Set("cache_expired_symbols", float64(len(c.expiredAt)), c.labels()...)
+	c.hot.replace(c.data, c.precision)
+	metrics.Set("cache_memory_bytes", float64(c.used), c.labels()...)
+}
+
+// evictLocked drops the least recently requested series other than keep
+// until the cache fits its budget, reporting whether any were dropped.
+// Callers must hold c.mu.
+func (c *Cache) evictLocked(keep string) bool {
+	c.accessMu.Lock()
+	candidates := make([]string, 0, len(c.data))
+	for symbol := range c.data {
+		if symbol != keep {
+			candidates = append(candidates, symbol)
+		}
+	}
+	// Never-requested series have a zero access time and go first
+	sort.Slice(candidates, func(i, j int) bool {
+		return c.lastAccess[candidates[i]].Before(c.lastAccess[candidates[j]])
+	})
+	c.accessMu.Unlock()
+	
+	evicted := false
+	for _, symbol := range candidates {
+		if c.used <= c.budget {
+			break
+		}
+		evicted = true
+		c.used -= entrySize(c.data[symbol])
+		delete(c.data, symbol)
+		c.evicted[symbol] = true
+		metrics.Inc("cache_evictions_total", c.labels()...)
+	}
+	return evicted
+}
+
+// Omitted returns how many symbols were evicted and haven't been fetched
+// again, so are missing from aggregate responses
+func (c *Cache) Omitted() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.evicted)
+}
+
+// IsEvicted reports whether symbol's series was dropped to stay within the
+// memory budget and hasn't been fetched again since
+func (c *Cache) IsEvicted(symbol string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.evicted[symbol]
 }
 
 // Get retrieves candle data for a specific symbol
@@ -64,6 +308,24 @@ func (c *Cache) SetSymbols(symbols []string) {
 	
 	c.symbols = symbols
 	c.symbolUpdate = time.Now()
+	
+	// Forget delisted symbols that are no longer cached
+	listed := make(map[string]bool, len(symbols))
+	for _, symbol := range symbols {
+		listed[symbol] = true
+	}
+	c.accessMu.Lock()
+	for symbol := range c.lastAccess {
+		if _, cached := c.data[symbol]; !cached && !listed[symbol] {
+			delete(c.lastAccess, symbol)
+		}
+	}
+	c.accessMu.Unlock()
+	for symbol := range c.evicted {
+		if !listed[symbol] {
+			delete(c.evicted, symbol)
+		}
+	}
 }
 
 // GetSymbols returns the active symbol list
@@ -77,6 +339,36 @@ func (c *Cache) GetSymbols() []string {
 	return result
 }
 
+// HasSymbol reports whether symbol is in the active symbol list
+func (c *Cache) HasSymbol(symbol string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	
+	for _, s := range c.symbols {
+		if s == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+// CanonicalSymbol maps a case-insensitive symbol to its exchange spelling
+// (e.g. KPEPE -> kPEPE), returning the input unchanged if unknown
+func (c *Cache) CanonicalSymbol(symbol string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	
+	if _, ok := c.data[symbol]; ok {
+		return symbol
+	}
+	for _, s := range c.symbols {
+		if strings.EqualFold(s, symbol) {
+			return s
+		}
+	}
+	return symbol
+}
+
 // GetLastUpdate returns the time of the last candle update
 func (c *Cache) GetLastUpdate() time.Time {
 	c.mu.RLock()
@@ -91,3 +383,250 @@ func (c *Cache) GetSymbolUpdate() time.Time {
 	return c.symbolUpdate
 }
 
+
+// SetMetadata replaces the symbol metadata (perp and spot)
+func (c *Cache) SetMetadata(metadata []SymbolMeta) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	c.metadata = metadata
+	c.precision = metadataPrecision(metadata)
+	c.hot.replace(c.data, c.precision)
+}
+
+// Precision returns the response rounding for symbol, if known
+func (c *Cache) Precision(symbol string) (Precision, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	p, ok := c.precision[symbol]
+	return p, ok
+}
+
+// GetMetadata returns a copy of the symbol metadata, enriched with market
+// data where available
+func (c *Cache) GetMetadata() []SymbolMeta {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	
+	result := make([]SymbolMeta, len(c.metadata))
+	copy(result, c.metadata)
+	for i := range result {
+		if md, ok := lookupMarketData(c.marketData, result[i].Name); ok {
+			result[i].MarketCap = md.MarketCap
+			result[i].CirculatingSupply = md.CirculatingSupply
+		}
+	}
+	return result
+}
+
+// SetMarketData replaces the external market data (market cap, supply),
+// keyed by upper-case ticker
+func (c *Cache) SetMarketData(marketData map[string]MarketData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	c.marketData = marketData
+	c.marketDataUpdate = time.Now()
+}
+
+// GetMarketDataUpdate returns when market data was last refreshed
+func (c *Cache) GetMarketDataUpdate() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.marketDataUpdate
+}
+
+// Snapshot returns a copy of the cache contents for persistence
+func (c *Cache) Snapshot() CacheSnapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	
+	entries := make(map[string]CacheEntry, len(c.data))
+	for k, v := range c.data {
+		entries[k] = v
+	}
+	return CacheSnapshot{
+		Version:      snapshotVersion,
+		SavedAt:      time.Now(),
+		Symbols:      append([]string(nil), c.symbols...),
+		SymbolUpdate: c.symbolUpdate,
+		Metadata:     append([]SymbolMeta(nil), c.metadata...),
+		Entries:      entries,
+	}
+}
+
+// Restore loads a snapshot into the cache, marking every entry stale
+func (c *Cache) Restore(snapshot CacheSnapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	for k, v := range snapshot.Entries {
+		v.Stale = true
+		if prev, ok := c.data[k]; ok {
+			c.used -= entrySize(prev)
+		}
+		c.used += entrySize(v)
+		c.data[k] = v
+		if v.LastUpdate.After(c.lastUpdate) {
+			c.lastUpdate = v.LastUpdate
+		}
+	}
+	if len(snapshot.Symbols) > 0 {
+		c.symbols = snapshot.Symbols
+		c.symbolUpdate = snapshot.SymbolUpdate
+	}
+	if len(snapshot.Metadata) > 0 {
+		c.metadata = snapshot.Metadata
+		c.precision = metadataPrecision(c.metadata)
+	}
+	if c.budget > 0 && c.used > c.budget {
+		c.evictLocked("")
+	}
+	c.hot.replace(c.data, c.precision)
+	metrics.Set("cache_memory_bytes", float64(c.used))
+}
+
+// ReplaceAll swaps in a complete set of entries, symbols and metadata, as
+// loaded from a shared snapshot written by another process
+func (c *Cache) ReplaceAll(entries map[string]CacheEntry, symbols []string, metadata []SymbolMeta, lastUpdate time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	// The entries live in the shared mapping, not the heap, so they're never evicted
+	c.data = entries
+	c.used = 0
+	for _, entry := range entries {
+		c.used += entrySize(entry)
+	}
+	c.symbols = symbols
+	c.metadata = metadata
+	c.precision = metadataPrecision(metadata)
+	c.lastUpdate = lastUpdate
+	c.symbolUpdate = lastUpdate
+	c.hot.replace(c.data, c.precision)
+	for symbol := range entries {
+		c.changedLocked(symbol)
+	}
+}
+
+// MarkStale flags symbol's series as not refreshed, keeping its candles
+func (c *Cache) MarkStale(symbol string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	if entry, ok := c.data[symbol]; ok && !entry.Stale {
+		entry.Stale = true
+		c.data[symbol] = entry
+		// Every write goes through the hot responses, as in Set
+		c.hot.update(symbol, entry.Candles)
+	}
+}
+
+// UpdateLatest applies streamed candles, in order, to their symbols' series:
+// each replaces the cached candle with the same timestamp, such as the newest
+// or, after a stream gap, one that closed during it, or is appended when
+// newer. Older candles not in the series, and symbols that aren't cached,
+// are left to the fetch cycle. The new series are built outside the lock, and a
+// series replaced meanwhile by a fetch is skipped. Only the symbols' own
+// update times move, not the cache's, so validators and memos that follow
+// fetch cycles aren't invalidated on every tick. It returns how many series
+// changed.
+func (c *Cache) UpdateLatest(streamed map[string][]Candle) int {
+	c.mu.RLock()
+	prev := make(map[string]CacheEntry, len(streamed))
+	for symbol := range streamed {
+		if entry, ok := c.data[symbol]; ok {
+			prev[symbol] = entry
+		}
+	}
+	c.mu.RUnlock()
+
+	next := make(map[string]CandleSeries, len(prev))
+	for symbol, entry := range prev {
+		if series, ok := withLatest(entry.Candles, streamed[symbol]); ok {
+			next[symbol] = series
+		}
+	}
+	if len(next) == 0 {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	applied := make(map[string]CandleSeries, len(next))
+	for symbol, series := range next {
+		entry, ok := c.data[symbol]
+		if !ok || !entry.LastUpdate.Equal(prev[symbol].LastUpdate) {
+			continue
+		}
+		c.used -= entrySize(entry)
+		entry.Candles = series
+		entry.LastUpdate = now
+		c.used += entrySize(entry)
+		c.data[symbol] = entry
+		applied[symbol] = series
+		c.changedLocked(symbol)
+	}
+	if c.budget > 0 && c.used > c.budget && c.evictLocked("") {
+		c.hot.replace(c.data, c.precision)
+	} else {
+		c.hot.updateAll(applied)
+	}
+	metrics.Set("cache_memory_bytes", float64(c.used), c.labels()...)
+	return len(applied)
+}
+
+// withLatest returns series with the streamed candles applied, copying it
+// only when one of them changes it
+func withLatest(series CandleSeries, streamed []Candle) (CandleSeries, bool) {
+	n := series.Len()
+	if n == 0 {
+		return series, false
+	}
+	var candles []Candle
+	last := series.At(n - 1)
+	for _, candle := range streamed {
+		if candle.Timestamp < last.Timestamp {
+			i := series.Search(candle.Timestamp)
+			if i == n || series.Timestamp(i) != candle.Timestamp || series.At(i) == candle {
+				continue
+			}
+			if candles == nil {
+				candles = series.Candles()
+			}
+			candles[i] = candle
+			continue
+		}
+		if candle == last {
+			continue
+		}
+		if candles == nil {
+			candles = series.Candles()
+		}
+		if candle.Timestamp == last.Timestamp {
+			candles[len(candles)-1] = candle
+		} else {
+			candles = append(candles, candle)
+		}
+		last = candle
+	}
+	if candles == nil {
+		return series, false
+	}
+	return NewCandleSeries(candles), true
+}
+
+// StaleCount returns how many entries are restored data not yet refreshed
+func (c *Cache) StaleCount() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	
+	count := 0
+	for _, entry := range c.data {
+		if entry.Stale {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// Streamed candles are applied to the cache in batches this often, so a
+// busy stream costs one series copy per symbol per batch, not per message
+const candleStreamFlushInterval = time.Second
+
+// CandleStreamActor keeps the in-progress candle of every cached symbol
+// current from Hyperliquid's WebSocket candle channel, so it isn't as old as
+// the last fetch cycle. The REST cycle still backfills new series and
+// reconciles the streamed candles with the exchange's snapshot.
+type CandleStreamActor struct {
+	cache      *Cache
+	client     *HyperliquidClient
+	interval   string
+	wsClient   *HyperliquidWSClient
+	subscribed map[string]bool
+	pending    map[string][]Candle // Streamed since the last flush, in order
+	refetching bool                // A gap refetch is in flight
+	nextGap    time.Time           // Start of a gap reported meanwhile, refetched after it; zero when none
+}
+
+// NewCandleStreamActor creates a new candle stream actor
+func NewCandleStreamActor(cache *Cache, client *HyperliquidClient, interval string) *CandleStreamActor {
+	return &CandleStreamActor{
+		cache:      cache,
+		client:     client,
+		interval:   interval,
+		subscribed: make(map[string]bool),
+		pending:    make(map[string][]Candle),
+	}
+}
+
+func (a *CandleStreamActor) Receive(ctx *actor.Context) {
+	switch msg := ctx.Message().(type) {
+	case actor.Started:
+		log.Printf("[CandleStream] Actor started for %s candles", a.interval)
+		ctx.Engine().Subscribe(ctx.PID())
+		engine, pid := ctx.Engine(), ctx.PID()
+		a.wsClient = NewHyperliquidWSClient("candles", func(m WSMessage) {
+			if m.Channel != "candle" {
+				return
+			}
+			candles, err := parseStreamedCandles(m.Data)
+			if err != nil {
+				log.Printf("[CandleStream] ERROR: Failed to parse candle: %v", err)
+				errorTrace.Record(SubsystemWS, "candles", err)
+				return
+			}
+			engine.Send(pid, StreamedCandlesMsg{Candles: candles})
+		})
+		a.wsClient.OnReconnect(func(gapStart, gapEnd time.Time) {
+			engine.Send(pid, WSReconnectedMsg{GapStart: gapStart, GapEnd: gapEnd})
+		})
+		// A restored snapshot is cached before the first cycle
+		a.syncSubscriptions()
+		go a.wsClient.Run()
+		ctx.SendRepeat(ctx.PID(), FlushStreamedCandlesMsg{}, candleStreamFlushInterval)
+
+	case StreamedCandlesMsg:
+		if !features.Enabled(FlagCandleStream) {
+			return
+		}
+		for _, c := range msg.Candles {
+			if c.Interval != a.interval {
+				continue
+			}
+			candle := Candle{Timestamp: c.T, Open: c.O, High: c.H, Low: c.L, Close: c.C, Volume: c.V}
+			// Only a candle's last update matters, but one that closed keeps its own
+			pending := a.pending[c.Coin]
+			if n := len(pending); n > 0 && pending[n-1].Timestamp == candle.Timestamp {
+				pending[n-1] = candle
+			} else {
+				a.pending[c.Coin] = append(pending, candle)
+			}
+		}
+
+	case FlushStreamedCandlesMsg:
+		if len(a.pending) == 0 {
+			return
+		}
+		if updated := a.cache.UpdateLatest(a.pending); updated > 0 {
+			metrics.Add("candle_stream_updates_total", float64(updated))
+		}
+		a.pending = make(map[string][]Candle)
+
+	case WSReconnectedMsg:
+		// Candles that closed during the gap may have missed their last
+		// updates, so refetch the gap now rather than wait for the next cycle
+		log.Printf("[CandleStream] Stream missed %s to %s, refetching the gap from REST",
+			msg.GapStart.UTC().Format(time.RFC3339), msg.GapEnd.UTC().Format(time.RFC3339))
+		if a.refetching {
+			// One refetch at a time: the next covers every gap reported meanwhile
+			if a.nextGap.IsZero() || msg.GapStart.Before(a.nextGap) {
+				a.nextGap = msg.GapStart
+			}
+			return
+		}
+		a.refetchGap(ctx, msg.GapStart)
+
+	case GapCandlesMsg:
+		// Streamed candles are newer, so they go on top of the refetched ones
+		for symbol, candles := range msg.Candles {
+			a.pending[symbol] = withStreamed(candles, a.pending[symbol])
+		}
+		a.refetching = false
+		if !a.nextGap.IsZero() {
+			gapStart := a.nextGap
+			a.nextGap = time.Time{}
+			a.refetchGap(ctx, gapStart)
+		}
+
+	case CandleCycleDoneMsg, SymbolsListedMsg, ListingsBackfilledMsg:
+		a.syncSubscriptions()
+
+	case actor.Stopped:
+		ctx.Engine().Unsubscribe(ctx.PID())
+		if a.wsClient != nil {
+			a.wsClient.Close()
+		}
+		log.Println("[CandleStream] Actor stopped")
+	}
+}
+
+// refetchGap fetches the streamed symbols' candles from the one open at
+// gapStart up to now, a few symbols at a time, and sends them back as a
+// GapCandlesMsg. Only the gap is fetched: the REST cycle still owns the rest
+// of the window.
+func (a *CandleStreamActor) refetchGap(ctx *actor.Context, gapStart time.Time) {
+	symbols := make([]string, 0, len(a.subscribed))
+	for symbol := range a.subscribed {
+		symbols = append(symbols, symbol)
+	}
+	if len(symbols) == 0 {
+		return
+	}
+	// Back one interval so the candle already open at gapStart is included
+	start := gapStart.AddDate(0, -1, 0)
+	if d, ok := intervalDuration(a.interval); ok && a.interval != "1M" {
+		start = gapStart.Add(-d)
+	}
+	a.refetching = true
+	metrics.Add("ws_gap_fill_symbols_total", float64(len(symbols)))
+
+	engine, pid, client, interval := ctx.Engine(), ctx.PID(), a.client, a.interval
+	go func() {
+		end := time.Now().UnixMilli()
+		var mu sync.Mutex
+		fetched := make(map[string][]Candle, len(symbols))
+		slots := make(chan struct{}, gapFillConcurrency)
+		var wg sync.WaitGroup
+		for _, symbol := range symbols {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(symbol string) {
+				defer func() { <-slots; wg.Done() }()
+				candles, err := client.FetchCandlesWithRetry(symbol, interval, start.UnixMilli(), end, 3)
+				if err != nil {
+					// The next cycle reconciles it
+					log.Printf("[CandleStream] ERROR: Failed to refetch %s after the gap: %v", symbol, err)
+					return
+				}
+				mu.Lock()
+				fetched[symbol] = candles
+				mu.Unlock()
+			}(symbol)
+		}
+		wg.Wait()
+		log.Printf("[CandleStream] Refetched %d/%d symbols over the gap", len(fetched), len(symbols))
+		engine.Send(pid, GapCandlesMsg{Candles: fetched})
+	}()
+}
+
+// withStreamed returns the refetched candles followed by the streamed ones,
+// dropping refetched candles the stream has already updated
+func withStreamed(refetched, streamed []Candle) []Candle {
+	if len(streamed) == 0 {
+		return refetched
+	}
+	first := streamed[0].Timestamp
+	n := 0
+	for n < len(refetched) && refetched[n].Timestamp < first {
+		n++
+	}
+	return append(refetched[:n:n], streamed...)
+}
+
+// syncSubscriptions subscribes to the candles of every cached symbol this
+// shard fetches, and drops the subscriptions of symbols no longer cached
+// (delisted, evicted or, in lazy mode, expired)
+func (a *CandleStreamActor) syncSubscriptions() {
+	want := make(map[string]bool)
+	for symbol, entry := range a.cache.GetAll() {
+		if entry.Candles.Len() > 0 && inShard(symbol) {
+			want[symbol] = true
+		}
+	}
+	added, removed := 0, 0
+	for symbol := range want {
+		if !a.subscribed[symbol] {
+			a.wsClient.Subscribe(a.subscription(symbol))
+			a.subscribed[symbol] = true
+			added++
+		}
+	}
+	for symbol := range a.subscribed {
+		if !want[symbol] {
+			a.wsClient.Unsubscribe(a.subscription(symbol))
+			delete(a.subscribed, symbol)
+			removed++
+		}
+	}
+	if added > 0 || removed > 0 {
+		log.Printf("[CandleStream] Subscribed to %d symbols, dropped %d, streaming %d", added, removed, len(a.subscribed))
+	}
+	metrics.Set("candle_stream_symbols", float64(len(a.subscribed)))
+}
+
+func (a *CandleStreamActor) subscription(symbol string) map[string]interface{} {
+	return map[string]interface{}{"type": "candle", "coin": symbol, "interval": a.interval}
+}
+
+// parseStreamedCandles decodes a candle channel payload, which is a single
+// candle or a list of them
+func parseStreamedCandles(data json.RawMessage) ([]HyperliquidWSCandle, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var candles []HyperliquidWSCandle
+		err := json.Unmarshal(data, &candles)
+		return candles, err
+	}
+	var candle HyperliquidWSCandle
+	if err := json.Unmarshal(data, &candle); err != nil {
+		return nil, err
+	}
+	return []HyperliquidWSCandle{candle}, nil
+}
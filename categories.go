@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// uncategorized is the bucket for symbols without a configured category
+const uncategorized = "Other"
+
+// Categories maps symbols to sector/category tags (L1, DeFi, AI, meme, ...)
+type Categories struct {
+	mu       sync.RWMutex
+	bySymbol map[string]string
+}
+
+// NewCategories creates a category map from symbol -> category pairs
+func NewCategories(mapping map[string]string) *Categories {
+	c := &Categories{}
+	c.Replace(mapping)
+	return c
+}
+
+// Replace swaps in a new mapping
+func (c *Categories) Replace(mapping map[string]string) {
+	bySymbol := make(map[string]string, len(mapping))
+	for symbol, category := range mapping {
+		bySymbol[strings.ToUpper(symbol)] = category
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bySymbol = bySymbol
+}
+
+// Groups returns the given symbols keyed by category
+func (c *Categories) Groups(symbols []string) map[string][]string {
+	groups := make(map[string][]string)
+	for _, symbol := range symbols {
+		category := c.Of(symbol)
+		groups[category] = append(groups[category], symbol)
+	}
+	return groups
+}
+
+// Of returns the category for symbol, or "Other" when unmapped
+func (c *Categories) Of(symbol string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if category, ok := c.bySymbol[strings.ToUpper(symbol)]; ok {
+		return category
+	}
+	return uncategorized
+}
+
+// parseStringMap parses "key=value" pairs separated by commas, e.g.
+// "BTC=L1,UNI=DeFi". Malformed pairs are skipped.
+func parseStringMap(s string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || strings.TrimSpace(key) == "" || strings.TrimSpace(val) == "" {
+			continue
+		}
+		result[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return result
+}
+
+// loadCategorySource reads a category file or http(s) URL holding JSON of the
+// form {"L1": ["BTC", "ETH"], "DeFi": ["UNI"]} and flattens it to symbol -> category
+func loadCategorySource(source string) (map[string]string, error) {
+	var body []byte
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Get(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch categories: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("categories source returned status %d", resp.StatusCode)
+		}
+		if body, err = io.ReadAll(resp.Body); err != nil {
+			return nil, fmt.Errorf("failed to read categories: %w", err)
+		}
+	} else {
+		var err error
+		if body, err = os.ReadFile(source); err != nil {
+			return nil, fmt.Errorf("failed to read categories: %w", err)
+		}
+	}
+
+	var byCategory map[string][]string
+	if err := json.Unmarshal(body, &byCategory); err != nil {
+		return nil, fmt.Errorf("failed to parse categories: %w", err)
+	}
+
+	mapping := make(map[string]string)
+	for category, symbols := range byCategory {
+		for _, symbol := range symbols {
+			mapping[symbol] = category
+		}
+	}
+	return mapping, nil
+}
+
+// resolveCategories merges the category source with inline SYMBOL_CATEGORIES
+// entries, which take precedence
+func resolveCategories(source string, inline map[string]string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	if source != "" {
+		loaded, err := loadCategorySource(source)
+		if err != nil {
+			return nil, err
+		}
+		mapping = loaded
+	}
+	for symbol, category := range inline {
+		mapping[symbol] = category
+	}
+	return mapping, nil
+}
+
+// CategoryStats aggregates cached candles across one category
+type CategoryStats struct {
+	Category     string  `json:"category"`
+	Symbols      int     `json:"symbols"`
+	VolumeUSD24h float64 `json:"volume_usd_24h"`
+	AvgChange24h float64 `json:"avg_change_24h"` // Percent, unweighted
+	Advancers    int     `json:"advancers"`
+	Decliners    int     `json:"decliners"`
+}
+
+// categoryStats derives per-category aggregates from the 24h heat map,
+// with volumes rounded unless full is set
+func categoryStats(all map[string]CacheEntry, categories *Categories, full bool) []CategoryStats {
+	groups := buildHeatmap(all, 24*time.Hour, categories, full)
+
+	stats := make([]CategoryStats, 0, len(groups))
+	for _, group := range groups {
+		s := CategoryStats{
+			Category:     group.Category,
+			Symbols:      len(group.Symbols),
+			VolumeUSD24h: group.VolumeUSD,
+		}
+		for _, cell := range group.Symbols {
+			s.AvgChange24h += cell.Change
+			switch {
+			case cell.Change > 0:
+				s.Advancers++
+			case cell.Change < 0:
+				s.Decliners++
+			}
+		}
+		if s.Symbols > 0 {
+			s.AvgChange24h /= float64(s.Symbols)
+		}
+		stats = append(stats, s)
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].Category < stats[j].Category })
+	return stats
+}
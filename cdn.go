@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// CDN purge providers
+const (
+	CDNProviderFastly     = "fastly"     // POST <url>/purge with a Surrogate-Key header
+	CDNProviderCloudflare = "cloudflare" // POST <url> with {"tags": [...]}
+	CDNProviderWebhook    = "webhook"    // POST <url> with {"keys": [...]}
+)
+
+// Surrogate keys tag candle responses so a fronting CDN can purge them by
+// key. Every candle response carries "candles" and "interval:<Y>"; responses
+// for one symbol carry "symbol:<X>", and responses that change whenever any
+// symbol does (all candles, latest, mids) carry "all".
+const (
+	surrogateKeyCandles = "candles"
+	surrogateKeyAll     = "all"
+)
+
+func symbolSurrogateKey(symbol string) string {
+	return "symbol:" + symbol
+}
+
+func intervalSurrogateKey(interval string) string {
+	return "interval:" + interval
+}
+
+// setSurrogateKeys tags a response with keys. Cloudflare reads Cache-Tag
+// (comma-separated) rather than Surrogate-Key.
+func setSurrogateKeys(w http.ResponseWriter, keys ...string) {
+	w.Header().Set("Surrogate-Key", strings.Join(keys, " "))
+	if config.CDNPurgeProvider == CDNProviderCloudflare {
+		w.Header().Set("Cache-Tag", strings.Join(keys, ","))
+	}
+}
+
+// allSurrogateKeys returns the header values for responses covering every
+// symbol, built once so pre-rendered responses can share them
+var allSurrogateKeys = sync.OnceValue(func() map[string][]string {
+	keys := []string{surrogateKeyCandles, surrogateKeyAll, intervalSurrogateKey(config.CandleInterval)}
+	headers := map[string][]string{"Surrogate-Key": {strings.Join(keys, " ")}}
+	if config.CDNPurgeProvider == CDNProviderCloudflare {
+		headers["Cache-Tag"] = []string{strings.Join(keys, ",")}
+	}
+	return headers
+})
+
+// Per-request key limits of the purge APIs
+const (
+	fastlyPurgeBatch     = 256
+	cloudflarePurgeBatch = 30
+)
+
+// CDNPurger invalidates cached responses at a fronting CDN by surrogate key
+type CDNPurger struct {
+	provider   string
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+// NewCDNPurger creates a purger for provider; an empty provider disables
+// purging and returns nil
+func NewCDNPurger(provider, url, token string) (*CDNPurger, error) {
+	switch provider {
+	case "":
+		return nil, nil
+	case CDNProviderFastly, CDNProviderCloudflare, CDNProviderWebhook:
+	default:
+		return nil, fmt.Errorf("unknown CDN purge provider %q (supported: fastly, cloudflare, webhook)", provider)
+	}
+	if url == "" {
+		return nil, fmt.Errorf("CDN_PURGE_URL is required for provider %s", provider)
+	}
+	return &CDNPurger{
+		provider:   provider,
+		url:        strings.TrimSuffix(url, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Purge invalidates every cached response tagged with any of keys
+func (p *CDNPurger) Purge(keys []string) error {
+	if p == nil || len(keys) == 0 {
+		return nil
+	}
+
+	batch := len(keys)
+	switch p.provider {
+	case CDNProviderFastly:
+		batch = fastlyPurgeBatch
+	case CDNProviderCloudflare:
+		batch = cloudflarePurgeBatch
+	}
+	for start := 0; start < len(keys); start += batch {
+		chunk := keys[start:min(start+batch, len(keys))]
+		err := p.purge(chunk)
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		metrics.Inc("cdn_purge_total", "result", result)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *CDNPurger) purge(keys []string) error {
+	var req *http.Request
+	var err error
+	switch p.provider {
+	case CDNProviderFastly:
+		req, err = http.NewRequest(http.MethodPost, p.url+"/purge", nil)
+		if err == nil {
+			req.Header.Set("Surrogate-Key", strings.Join(keys, " "))
+			req.Header.Set("Fastly-Key", p.token)
+		}
+	case CDNProviderCloudflare:
+		req, err = newJSONRequest(p.url, map[string][]string{"tags": keys})
+	default:
+		req, err = newJSONRequest(p.url, map[string][]string{"keys": keys})
+	}
+	if err != nil {
+		return err
+	}
+	if p.token != "" && p.provider != CDNProviderFastly {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to purge: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("purge returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func newJSONRequest(url string, payload interface{}) (*http.Request, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// CDNPurgeActor purges the changed symbols' responses at the end of each
+// candle cycle
+type CDNPurgeActor struct {
+	purger *CDNPurger
+}
+
+// NewCDNPurgeActor creates a new CDN purge actor
+func NewCDNPurgeActor(purger *CDNPurger) *CDNPurgeActor {
+	return &CDNPurgeActor{purger: purger}
+}
+
+func (a *CDNPurgeActor) Receive(ctx *actor.Context) {
+	switch msg := ctx.Message().(type) {
+	case actor.Started:
+		ctx.Engine().Subscribe(ctx.PID())
+		log.Println("[CDN] Purge actor started")
+
+	case CandleCycleDoneMsg:
+		a.purge(msg.Changed)
+
+	case ListingsBackfilledMsg:
+		a.purge(msg.Symbols)
+
+	case actor.Stopped:
+		ctx.Engine().Unsubscribe(ctx.PID())
+		log.Println("[CDN] Purge actor stopped")
+	}
+}
+
+// purge purges the responses of changed symbols and every aggregate one
+func (a *CDNPurgeActor) purge(changed []string) {
+	if len(changed) == 0 {
+		return
+	}
+	keys := []string{surrogateKeyAll}
+	for _, symbol := range changed {
+		keys = append(keys, symbolSurrogateKey(symbol))
+	}
+	// Off the actor goroutine so a slow CDN API doesn't back up the mailbox
+	go func() {
+		if err := a.purger.Purge(keys); err != nil {
+			log.Printf("[CDN] ERROR: Purge of %d keys failed: %v", len(keys), err)
+		}
+	}()
+}
+
+// handleAdminCDNPurge purges CDN-cached responses. ?symbol=BTC,ETH purges
+// those symbols, ?key=... purges raw surrogate keys, and no parameters
+// purges every candle response.
+func handleAdminCDNPurge(w http.ResponseWriter, r *http.Request) {
+	if cdnPurger == nil {
+		http.Error(w, "CDN purging disabled", http.StatusNotFound)
+		return
+	}
+
+	var keys []string
+	if symbols := r.URL.Query().Get("symbol"); symbols != "" {
+		for _, symbol := range strings.Split(symbols, ",") {
+			if symbol = strings.TrimSpace(symbol); symbol != "" {
+				keys = append(keys, symbolSurrogateKey(cache.CanonicalSymbol(symbol)))
+			}
+		}
+		keys = append(keys, surrogateKeyAll)
+	}
+	for _, key := range r.URL.Query()["key"] {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		keys = []string{surrogateKeyCandles}
+	}
+
+	submitJob(w, r, "purge", map[string]string{"keys": strings.Join(keys, ",")})
+}
+
+// runPurgeJob purges params' comma-separated surrogate keys at the CDN
+func runPurgeJob(params map[string]string) (interface{}, error) {
+	if cdnPurger == nil {
+		return nil, permanent(fmt.Errorf("CDN purging disabled"))
+	}
+	keys := strings.Split(params["keys"], ",")
+	if err := cdnPurger.Purge(keys); err != nil {
+		return nil, err
+	}
+	log.Printf("[Admin] Purged CDN keys %v", keys)
+	return map[string]interface{}{"keys": keys}, nil
+}
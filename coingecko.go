@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+const coinGeckoPerPage = 250
+
+// CoinGeckoClient fetches market cap data from CoinGecko's /coins/markets
+type CoinGeckoClient struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewCoinGeckoClient creates a new CoinGecko client. Pro API base URLs use
+// the pro key header, everything else the demo key header.
+func NewCoinGeckoClient(baseURL, apiKey string) *CoinGeckoClient {
+	return &CoinGeckoClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		httpClient: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+	}
+}
+
+// coinGeckoMarket is one row of the /coins/markets response
+type coinGeckoMarket struct {
+	Symbol            string  `json:"symbol"`
+	MarketCap         float64 `json:"market_cap"`
+	CirculatingSupply float64 `json:"circulating_supply"`
+}
+
+// FetchMarkets returns market data keyed by upper-case ticker for the top
+// pages*250 coins by market cap. Tickers shared by several coins resolve to
+// the one with the largest market cap.
+func (c *CoinGeckoClient) FetchMarkets(pages int) (map[string]MarketData, error) {
+	result := make(map[string]MarketData)
+
+	for page := 1; page <= pages; page++ {
+		params := url.Values{
+			"vs_currency": {"usd"},
+			"order":       {"market_cap_desc"},
+			"per_page":    {fmt.Sprint(coinGeckoPerPage)},
+			"page":        {fmt.Sprint(page)},
+		}
+		req, err := http.NewRequest(http.MethodGet, c.baseURL+"/coins/markets?"+params.Encode(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		if c.apiKey != "" {
+			if strings.Contains(c.baseURL, "pro-api") {
+				req.Header.Set("x-cg-pro-api-key", c.apiKey)
+			} else {
+				req.Header.Set("x-cg-demo-api-key", c.apiKey)
+			}
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch markets: %w", err)
+		}
+		var markets []coinGeckoMarket
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("CoinGecko returned status %d on page %d", resp.StatusCode, page)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&markets)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode markets: %w", err)
+		}
+
+		for _, m := range markets {
+			symbol := strings.ToUpper(m.Symbol)
+			if _, ok := result[symbol]; ok {
+				continue // Results are ordered by market cap, keep the largest
+			}
+			result[symbol] = MarketData{MarketCap: m.MarketCap, CirculatingSupply: m.CirculatingSupply}
+		}
+
+		if len(markets) < coinGeckoPerPage {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// MarketDataActor periodically pulls market cap and circulating supply for
+// tracked symbols and stores them alongside the symbol metadata
+type MarketDataActor struct {
+	cache           *Cache
+	client          *CoinGeckoClient
+	refreshInterval time.Duration
+	pages           int
+}
+
+// NewMarketDataActor creates a new market data actor
+func NewMarketDataActor(cache *Cache, client *CoinGeckoClient, refreshInterval time.Duration, pages int) *MarketDataActor {
+	return &MarketDataActor{
+		cache:           cache,
+		client:          client,
+		refreshInterval: refreshInterval,
+		pages:           pages,
+	}
+}
+
+func (a *MarketDataActor) Receive(ctx *actor.Context) {
+	switch ctx.Message().(type) {
+	case actor.Started:
+		log.Println("[MarketData] Actor started")
+		a.fetchMarketData()
+		scheduler.Add(RefreshMarketData, a.refreshInterval, ctx.PID(), FetchMarketDataMsg{})
+
+	case FetchMarketDataMsg:
+		a.fetchMarketData()
+
+	case actor.Stopped:
+		scheduler.Remove(RefreshMarketData, ctx.PID())
+		log.Println("[MarketData] Actor stopped")
+	}
+}
+
+func (a *MarketDataActor) fetchMarketData() {
+	markets, err := a.client.FetchMarkets(a.pages)
+	if err != nil {
+		// Keep the previous data, market caps move slowly
+		log.Printf("[MarketData] ERROR: Failed to fetch market data: %v", err)
+		return
+	}
+
+	a.cache.SetMarketData(markets)
+	log.Printf("[MarketData] Updated market data for %d tickers", len(markets))
+}
+
+// lookupMarketData finds market data for a Hyperliquid symbol. Hyperliquid
+// lists some low-priced coins in thousands with a "k" prefix (kPEPE), so
+// their circulating supply is scaled to match.
+func lookupMarketData(marketData map[string]MarketData, symbol string) (MarketData, bool) {
+	if md, ok := marketData[strings.ToUpper(symbol)]; ok {
+		return md, true
+	}
+	if base, ok := strings.CutPrefix(symbol, "k"); ok {
+		if md, ok := marketData[strings.ToUpper(base)]; ok {
+			md.CirculatingSupply /= 1000
+			return md, true
+		}
+	}
+	return MarketData{}, false
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// fundingInterval is how often Hyperliquid pays funding
+const fundingInterval = time.Hour
+
+// FundingHistory caches each symbol's funding payments, fetched on request
+// and topped up at most once per funding interval
+type FundingHistory struct {
+	client *HyperliquidClient
+	group  singleflight.Group
+
+	mu       sync.Mutex
+	bySymbol map[string]*fundingSeries
+}
+
+type fundingSeries struct {
+	rates     []FundingRate
+	since     int64 // Start of the fetched window (ms)
+	fetchedAt time.Time
+}
+
+// NewFundingHistory creates an empty funding cache
+func NewFundingHistory(client *HyperliquidClient) *FundingHistory {
+	return &FundingHistory{client: client, bySymbol: make(map[string]*fundingSeries)}
+}
+
+// Get returns symbol's funding payments from since on. A failed refresh
+// falls back to the payments already cached, if they cover since.
+func (f *FundingHistory) Get(symbol string, since int64) ([]FundingRate, error) {
+	f.mu.Lock()
+	series := f.bySymbol[symbol]
+	f.mu.Unlock()
+	if series != nil && series.since <= since && series.fetchedAt.After(lastFundingTime()) {
+		return ratesSince(series.rates, since), nil
+	}
+
+	// Keyed by since too: a caller reaching back further than a refresh in
+	// flight needs its own fetch
+	v, err, _ := f.group.Do(fmt.Sprintf("%s|%d", symbol, since), func() (interface{}, error) {
+		return f.refresh(symbol, since, series)
+	})
+	if err != nil {
+		metrics.Inc("funding_history_fetch_total", "result", "error")
+		if series != nil && series.since <= since {
+			log.Printf("[Funding] ERROR: Failed to refresh %s, serving cached payments: %v", symbol, err)
+			return ratesSince(series.rates, since), nil
+		}
+		return nil, err
+	}
+	metrics.Inc("funding_history_fetch_total", "result", "success")
+	return ratesSince(v.(*fundingSeries).rates, since), nil
+}
+
+// refresh fetches the payments missing from series, or all of them from
+// since when series doesn't reach back that far
+func (f *FundingHistory) refresh(symbol string, since int64, series *fundingSeries) (*fundingSeries, error) {
+	next := &fundingSeries{since: since, fetchedAt: time.Now()}
+	start := since
+	if series != nil && series.since <= since {
+		next.since = series.since
+		next.rates = series.rates
+		if n := len(series.rates); n > 0 {
+			start = series.rates[n-1].Time + 1
+		}
+	}
+	rates, err := f.client.FetchFundingHistory(symbol, start)
+	if err != nil {
+		return nil, err
+	}
+	next.rates = append(next.rates[:len(next.rates):len(next.rates)], rates...)
+
+	// Drop what no candle window reaches any more
+	cutoff := time.Now().AddDate(0, 0, -config.LookbackDays(config.CandleInterval)-1).UnixMilli()
+	if next.since < cutoff {
+		next.rates = ratesSince(next.rates, cutoff)
+		next.since = cutoff
+	}
+
+	f.mu.Lock()
+	f.bySymbol[symbol] = next
+	f.mu.Unlock()
+	return next, nil
+}
+
+// lastFundingTime is when the latest payment is settled: on the hour, with
+// a minute's grace for it to show up in the history
+func lastFundingTime() time.Time {
+	return time.Now().Add(-time.Minute).Truncate(fundingInterval).Add(time.Minute)
+}
+
+// ratesSince returns the payments at or after ts
+func ratesSince(rates []FundingRate, ts int64) []FundingRate {
+	i := sort.Search(len(rates), func(i int) bool { return rates[i].Time >= ts })
+	return rates[i:]
+}
+
+// oiSample is a symbol's open interest at one time
+type oiSample struct {
+	Time  int64
+	Value float64
+}
+
+// OpenInterestHistory records open interest from each metadata refresh.
+// Hyperliquid has no open interest history, so it only reaches back to
+// when this instance started. One sample is kept per candle interval.
+type OpenInterestHistory struct {
+	mu       sync.RWMutex
+	step     int64 // Candle interval (ms)
+	keep     time.Duration
+	bySymbol map[string][]oiSample
+}
+
+// NewOpenInterestHistory creates an empty history at interval's resolution,
+// keeping lookbackDays of samples
+func NewOpenInterestHistory(interval string, lookbackDays int) *OpenInterestHistory {
+	step := time.Hour
+	if d, ok := intervalDuration(interval); ok {
+		step = d
+	}
+	return &OpenInterestHistory{
+		step:     step.Milliseconds(),
+		keep:     time.Duration(lookbackDays) * 24 * time.Hour,
+		bySymbol: make(map[string][]oiSample),
+	}
+}
+
+// Record adds the open interest of every perp in metadata, replacing an
+// earlier sample in the same candle interval
+func (h *OpenInterestHistory) Record(metadata []SymbolMeta) {
+	if h == nil {
+		return
+	}
+	now := time.Now().UnixMilli()
+	cutoff := now - h.keep.Milliseconds()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, meta := range metadata {
+		if meta.Market != MarketPerp {
+			continue
+		}
+		samples := h.bySymbol[meta.Name]
+		sample := oiSample{Time: now, Value: meta.OpenInterest}
+		if n := len(samples); n > 0 && samples[n-1].Time/h.step == now/h.step {
+			samples[n-1] = sample
+		} else {
+			samples = append(samples, sample)
+		}
+		i := sort.Search(len(samples), func(i int) bool { return samples[i].Time >= cutoff })
+		h.bySymbol[meta.Name] = samples[i:]
+	}
+}
+
+// Samples returns symbol's recorded open interest, oldest first
+func (h *OpenInterestHistory) Samples(symbol string) []oiSample {
+	if h == nil {
+		return nil
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	// Record overwrites the last sample in place
+	return slices.Clone(h.bySymbol[symbol])
+}
+
+// CombinedSeries is a symbol's candles with the funding rate and open
+// interest as of each candle's close, index for index. Values are null
+// where nothing was known yet.
+type CombinedSeries struct {
+	Symbol       string       `json:"symbol"`
+	Interval     string       `json:"interval"`
+	Candles      CandleSeries `json:"candles"`
+	Funding      []*float64   `json:"funding"`
+	OpenInterest []*float64   `json:"open_interest"`
+	LastUpdate   time.Time    `json:"last_update"`
+}
+
+// alignAsOf returns, for each candle, the value of the last point before
+// the candle's close. points are (time, value) pairs sorted by time.
+func alignAsOf(candles CandleSeries, step int64, n int, point func(i int) (int64, float64)) []*float64 {
+	aligned := make([]*float64, candles.Len())
+	j := 0
+	var last *float64
+	for i := range aligned {
+		closeTime := candles.Timestamp(i) + step
+		for ; j < n; j++ {
+			ts, v := point(j)
+			if ts >= closeTime {
+				break
+			}
+			last = &v
+		}
+		aligned[i] = last
+	}
+	return aligned
+}
+
+// buildCombined aligns funding payments and open interest samples to entry's
+// candles
+func buildCombined(entry CacheEntry, interval string, rates []FundingRate, oi []oiSample) CombinedSeries {
+	step := time.Hour.Milliseconds()
+	if d, ok := intervalDuration(interval); ok {
+		step = d.Milliseconds()
+	}
+	return CombinedSeries{
+		Symbol:   entry.Symbol,
+		Interval: interval,
+		Candles:  entry.Candles,
+		Funding: alignAsOf(entry.Candles, step, len(rates), func(i int) (int64, float64) {
+			return rates[i].Time, float64(rates[i].Rate)
+		}),
+		OpenInterest: alignAsOf(entry.Candles, step, len(oi), func(i int) (int64, float64) {
+			return oi[i].Time, oi[i].Value
+		}),
+		LastUpdate: entry.LastUpdate,
+	}
+}
+
+// handleGetCombined returns a symbol's candles, funding and open interest
+// aligned in one response, for chart overlays
+func handleGetCombined(w http.ResponseWriter, r *http.Request) {
+	symbol := cache.CanonicalSymbol(r.PathValue("symbol"))
+	entry, exists := cache.Get(symbol)
+	if !exists {
+		http.Error(w, "Symbol not found", http.StatusNotFound)
+		return
+	}
+	candles, err := filterCandles(entry.Candles, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entry.Candles = candles
+
+	var rates []FundingRate
+	if fundingHistory != nil && candles.Len() > 0 {
+		rates, err = fundingHistory.Get(symbol, candles.Timestamp(0)-fundingInterval.Milliseconds())
+		if err != nil {
+			log.Printf("[Funding] ERROR: Failed to fetch %s funding history: %v", symbol, err)
+			http.Error(w, "Failed to fetch funding history", http.StatusBadGateway)
+			return
+		}
+	}
+	// Funding changes on the hour even when the candles haven't
+	etagTime := entry.LastUpdate
+	if n := len(rates); n > 0 && time.UnixMilli(rates[n-1].Time).After(etagTime) {
+		etagTime = time.UnixMilli(rates[n-1].Time)
+	}
+	if setETag(w, r, generateETag(etagTime)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	combined := buildCombined(entry, config.CandleInterval, rates, openInterestHistory.Samples(symbol))
+	if err := writeJSON(r.Context(), w, combined); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
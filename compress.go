@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gzipMinSize is the smallest body worth compressing; below roughly one
+// packet the gzip framing overhead outweighs the savings
+const gzipMinSize = 1400
+
+// gzipWriterPools holds one pool per compression level
+var gzipWriterPools sync.Map // int -> *sync.Pool
+
+func getGzipWriter(level int) *gzip.Writer {
+	pool, _ := gzipWriterPools.LoadOrStore(level, &sync.Pool{
+		New: func() interface{} {
+			gz, err := gzip.NewWriterLevel(nil, level)
+			if err != nil {
+				gz = gzip.NewWriter(nil)
+			}
+			return gz
+		},
+	})
+	return pool.(*sync.Pool).Get().(*gzip.Writer)
+}
+
+func putGzipWriter(level int, gz *gzip.Writer) {
+	if pool, ok := gzipWriterPools.Load(level); ok {
+		pool.(*sync.Pool).Put(gz)
+	}
+}
+
+// gzipHandler compresses responses at the default compression level
+func gzipHandler(next http.HandlerFunc) http.HandlerFunc {
+	return gzipHandlerLevel(gzip.DefaultCompression, next)
+}
+
+// gzipHandlerLevel compresses responses at the given level when the client
+// accepts gzip and the body is large enough to benefit
+func gzipHandlerLevel(level int, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next(w, r)
+			return
+		}
+
+		if gzipCache != nil && r.Method == http.MethodGet {
+			gzipCache.serve(w, r, level, next)
+			return
+		}
+
+		gzw := &gzipResponseWriter{ResponseWriter: w, level: level, statusCode: http.StatusOK}
+		defer gzw.Close()
+
+		next(gzw, r)
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip. A
+// q-value of zero, however it's written (q=0, q=0.0, q=0.000), refuses it.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if !strings.EqualFold(strings.TrimSpace(name), "q") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the start of the body to decide whether to
+// compress, and passes through bodiless or already-encoded responses
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	level       int
+	gz          *gzip.Writer
+	buf         []byte
+	statusCode  int
+	wroteHeader bool // Header decision has been forwarded to the underlying writer
+	passthrough bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader || w.passthrough {
+		return
+	}
+	w.statusCode = code
+
+	// Bodiless statuses and handler-encoded bodies are never compressed
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified ||
+		w.Header().Get("Content-Encoding") != "" {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	if w.Header().Get("Content-Encoding") != "" {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(w.statusCode)
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) < gzipMinSize {
+		return len(b), nil
+	}
+
+	if err := w.startGzip(); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (w *gzipResponseWriter) startGzip() error {
+	h := w.Header()
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	w.wroteHeader = true
+
+	w.gz = getGzipWriter(w.level)
+	w.gz.Reset(w.ResponseWriter)
+
+	_, err := w.gz.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// Close finishes the gzip stream, or flushes a small body uncompressed
+func (w *gzipResponseWriter) Close() {
+	if w.gz != nil {
+		w.gz.Close()
+		putGzipWriter(w.level, w.gz)
+		w.gz = nil
+		return
+	}
+	if w.passthrough || w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	if len(w.buf) > 0 {
+		w.ResponseWriter.Write(w.buf)
+	}
+}
+
+// gzipCache holds compressed responses between refreshes; nil disables it
+var gzipCache *GzipCache
+
+// gzipCacheEntry is one compressed body, valid while the response's ETag
+// stays the same
+type gzipCacheEntry struct {
+	key  string
+	etag string
+	data []byte
+}
+
+// GzipCache keeps the gzipped bytes of recent responses keyed by request
+// URI, ETag and encoding, so a payload is compressed once per refresh rather
+// than once per client. The oldest entries are dropped past maxBytes.
+type GzipCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	size     int
+	entries  map[string]*list.Element
+	order    *list.List // Front is newest
+}
+
+// NewGzipCache creates a cache holding up to maxBytes of compressed bodies
+func NewGzipCache(maxBytes int) *GzipCache {
+	return &GzipCache{
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *GzipCache) get(key, etag string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok || el.Value.(*gzipCacheEntry).etag != etag {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*gzipCacheEntry).data, true
+}
+
+func (c *GzipCache) put(key, etag string, data []byte) {
+	if len(data) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A new ETag replaces the body compressed for the previous one
+	if el, ok := c.entries[key]; ok {
+		c.size -= len(el.Value.(*gzipCacheEntry).data)
+		c.order.Remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&gzipCacheEntry{key: key, etag: etag, data: data})
+	c.size += len(data)
+	for c.size > c.maxBytes {
+		oldest := c.order.Back().Value.(*gzipCacheEntry)
+		c.order.Remove(c.order.Back())
+		delete(c.entries, oldest.key)
+		c.size -= len(oldest.data)
+	}
+	metrics.Set("gzip_cache_bytes", float64(c.size))
+}
+
+// serve runs next into a buffer, then answers with the cached compressed
+// body for its ETag, compressing and caching it on a miss. Responses
+// without an ETag are compressed as usual.
+func (c *GzipCache) serve(w http.ResponseWriter, r *http.Request, level int, next http.HandlerFunc) {
+	captured := &capturedResponse{ResponseWriter: w, statusCode: http.StatusOK}
+	next(captured, r)
+
+	etag := w.Header().Get("ETag")
+	body := captured.buf.Bytes()
+	if captured.statusCode != http.StatusOK || etag == "" || len(body) < gzipMinSize ||
+		w.Header().Get("Content-Encoding") != "" {
+		gzw := &gzipResponseWriter{ResponseWriter: w, level: level, statusCode: http.StatusOK}
+		gzw.WriteHeader(captured.statusCode)
+		gzw.Write(body)
+		gzw.Close()
+		return
+	}
+
+	key := r.URL.RequestURI() + "\x00gzip"
+	data, ok := c.get(key, etag)
+	if ok {
+		metrics.Inc("gzip_cache_requests_total", "result", "hit")
+	} else {
+		metrics.Inc("gzip_cache_requests_total", "result", "miss")
+		var buf bytes.Buffer
+		gz := getGzipWriter(level)
+		gz.Reset(&buf)
+		gz.Write(body)
+		gz.Close()
+		putGzipWriter(level, gz)
+		data = buf.Bytes()
+		c.put(key, etag, data)
+	}
+
+	h := w.Header()
+	h.Set("Content-Encoding", "gzip")
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// capturedResponse buffers a handler's status and body; headers go straight
+// to the underlying writer
+type capturedResponse struct {
+	http.ResponseWriter
+	buf         bytes.Buffer
+	statusCode  int
+	wroteHeader bool
+}
+
+func (w *capturedResponse) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.statusCode = code
+		w.wroteHeader = true
+	}
+}
+
+func (w *capturedResponse) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.buf.Write(b)
+}
+
+// renderedLengthsKept bounds how many request URIs keep their last
+// rendered length for HEAD
+const renderedLengthsKept = 4096
+
+// renderedLength is the uncompressed length of a body rendered for etag
+type renderedLength struct {
+	key    string
+	etag   string
+	length string
+}
+
+// RenderedLengths keeps the uncompressed Content-Length of the last body
+// rendered per request URI and ETag, so HEAD can report it without
+// rendering the body again. The least recently used URIs are dropped past
+// renderedLengthsKept.
+type RenderedLengths struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Front is newest
+}
+
+var renderedLengths = NewRenderedLengths()
+
+// NewRenderedLengths creates an empty length store
+func NewRenderedLengths() *RenderedLengths {
+	return &RenderedLengths{entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func (l *RenderedLengths) get(key, etag string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.entries[key]
+	if !ok || el.Value.(*renderedLength).etag != etag {
+		return "", false
+	}
+	l.order.MoveToFront(el)
+	return el.Value.(*renderedLength).length, true
+}
+
+func (l *RenderedLengths) put(key, etag, length string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.entries[key]; ok {
+		entry := el.Value.(*renderedLength)
+		entry.etag, entry.length = etag, length
+		l.order.MoveToFront(el)
+		return
+	}
+	l.entries[key] = l.order.PushFront(&renderedLength{key: key, etag: etag, length: length})
+	if l.order.Len() > renderedLengthsKept {
+		oldest := l.order.Back().Value.(*renderedLength)
+		l.order.Remove(l.order.Back())
+		delete(l.entries, oldest.key)
+	}
+}
+
+// headLengthHandler records the Content-Length of successful GET responses
+// and sets it on HEAD requests for the same URI while the ETag hasn't
+// changed. It must sit inside gzipHandler so the length is the
+// uncompressed one.
+func headLengthHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lw := &lengthWriter{ResponseWriter: w, key: r.URL.RequestURI(), head: r.Method == http.MethodHead}
+		next(lw, r)
+		if lw.head && !lw.wroteHeader {
+			lw.WriteHeader(http.StatusOK)
+		}
+	}
+}
+
+// lengthWriter records or fills in Content-Length as the header goes out
+type lengthWriter struct {
+	http.ResponseWriter
+	key         string
+	head        bool
+	wroteHeader bool
+}
+
+func (w *lengthWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	if etag := h.Get("ETag"); code == http.StatusOK && etag != "" && h.Get("Content-Encoding") == "" {
+		if !w.head {
+			if length := h.Get("Content-Length"); length != "" {
+				renderedLengths.put(w.key, etag, length)
+			}
+		} else if h.Get("Content-Length") == "" {
+			if length, ok := renderedLengths.get(w.key, etag); ok {
+				h.Set("Content-Length", length)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *lengthWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *lengthWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redacted replaces secret values in the config dump
+const redacted = "***"
+
+// EnvSetting is one environment variable the config was loaded from
+type EnvSetting struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"` // "env" or "default"
+}
+
+var (
+	envSettingsMu sync.Mutex
+	envSettings   = make(map[string]EnvSetting)
+)
+
+// noteEnv records where key's value comes from, for /admin/config
+func noteEnv(key, defaultVal string) {
+	setting := EnvSetting{Name: key, Value: defaultVal, Source: "default"}
+	if val := os.Getenv(key); val != "" {
+		setting.Value, setting.Source = val, "env"
+	}
+	envSettingsMu.Lock()
+	envSettings[key] = setting
+	envSettingsMu.Unlock()
+}
+
+// isSecret reports whether a variable or Config field name holds a
+// credential. Key files are paths, not keys.
+func isSecret(name string) bool {
+	name = strings.ToUpper(name)
+	if strings.HasSuffix(name, "FILE") {
+		return false
+	}
+	for _, marker := range []string{"KEY", "TOKEN", "PASSWORD", "SECRET"} {
+		if strings.Contains(name, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL keeps only the scheme and host: webhook URLs carry their token in
+// the path, and others may carry credentials in the user info or query
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+	result := u.Scheme + "://" + u.Host
+	if u.User != nil || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" {
+		result += "/" + redacted
+	}
+	return result
+}
+
+// redactValue masks a value by its variable or field name
+func redactValue(name, val string) string {
+	switch {
+	case val == "":
+		return val
+	case isSecret(name):
+		return redacted
+	case strings.Contains(strings.ToUpper(name), "URL"):
+		urls := strings.Split(val, ",")
+		for i, raw := range urls {
+			urls[i] = redactURL(strings.TrimSpace(raw))
+		}
+		return strings.Join(urls, ",")
+	default:
+		return val
+	}
+}
+
+// effectiveConfig returns the resolved Config by field name, with secrets
+// masked
+func effectiveConfig(c *Config) map[string]interface{} {
+	result := make(map[string]interface{})
+	v := reflect.ValueOf(*c)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			result[name] = redactValue(name, field.String())
+		case reflect.Slice:
+			items := make([]string, field.Len())
+			for j := range items {
+				items[j] = redactValue(name, fmt.Sprint(field.Index(j).Interface()))
+			}
+			result[name] = items
+		case reflect.Map:
+			if isSecret(name) && field.Len() > 0 {
+				result[name] = redacted
+			} else {
+				result[name] = field.Interface()
+			}
+		case reflect.Uint32:
+			// os.FileMode, shown the way it's configured
+			result[name] = fmt.Sprintf("%04o", field.Uint())
+		default:
+			if isSecret(name) {
+				result[name] = redacted
+			} else {
+				result[name] = field.Interface()
+			}
+		}
+	}
+	return result
+}
+
+// handleAdminConfig returns the configuration this instance is running
+// with: each variable it read, set or defaulted, and the effective values
+// after normalization. Secrets are masked.
+func handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	envSettingsMu.Lock()
+	variables := make([]EnvSetting, 0, len(envSettings))
+	for _, setting := range envSettings {
+		setting.Value = redactValue(setting.Name, setting.Value)
+		variables = append(variables, setting)
+	}
+	envSettingsMu.Unlock()
+	sort.Slice(variables, func(i, j int) bool { return variables[i].Name < variables[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"variables": variables,
+		"effective": effectiveConfig(config),
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
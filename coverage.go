@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CoverageGap describes a run of missing candles between two present ones
+type CoverageGap struct {
+	From    int64 `json:"from"` // First missing candle timestamp (ms)
+	To      int64 `json:"to"`   // Last missing candle timestamp (ms)
+	Missing int   `json:"missing"`
+}
+
+// CoverageReport compares the cached series against the configured window
+type CoverageReport struct {
+	Symbol         string        `json:"symbol"`
+	Interval       string        `json:"interval"`
+	WindowStart    int64         `json:"window_start"`
+	WindowEnd      int64         `json:"window_end"`
+	Expected       int           `json:"expected"`
+	Present        int           `json:"present"`
+	Missing        int           `json:"missing"`
+	CoveragePct    float64       `json:"coverage_pct"`
+	FirstTimestamp int64         `json:"first_timestamp,omitempty"`
+	LastTimestamp  int64         `json:"last_timestamp,omitempty"`
+	Gaps           []CoverageGap `json:"gaps"`
+	LastUpdate     time.Time     `json:"last_update"`
+}
+
+// buildCoverage reports how completely candles fill [end-lookback, end]
+func buildCoverage(entry CacheEntry, interval string, lookback time.Duration) CoverageReport {
+	step := time.Hour.Milliseconds()
+	if d, ok := intervalDuration(interval); ok {
+		step = d.Milliseconds()
+	}
+
+	// The window ends at the last fetch time, mirroring the fetcher's range
+	end := entry.LastUpdate.UnixMilli()
+	start := end - lookback.Milliseconds()
+
+	// Number of candle open times within [start, end]
+	firstBucket := (start + step - 1) / step * step
+	expected := 0
+	if end >= firstBucket {
+		expected = int((end-firstBucket)/step) + 1
+	}
+
+	report := CoverageReport{
+		Symbol:      entry.Symbol,
+		Interval:    interval,
+		WindowStart: start,
+		WindowEnd:   end,
+		Expected:    expected,
+		Present:     entry.Candles.Len(),
+		Gaps:        []CoverageGap{},
+		LastUpdate:  entry.LastUpdate,
+	}
+
+	if n := entry.Candles.Len(); n > 0 {
+		report.FirstTimestamp = entry.Candles.Timestamp(0)
+		report.LastTimestamp = entry.Candles.Timestamp(n - 1)
+
+		// Leading gap between the window start and the first candle
+		if report.FirstTimestamp-firstBucket >= step {
+			report.Gaps = append(report.Gaps, CoverageGap{
+				From:    firstBucket,
+				To:      report.FirstTimestamp - step,
+				Missing: int((report.FirstTimestamp - firstBucket) / step),
+			})
+		}
+		for i := 1; i < n; i++ {
+			prev, cur := entry.Candles.Timestamp(i-1), entry.Candles.Timestamp(i)
+			if cur-prev > step {
+				report.Gaps = append(report.Gaps, CoverageGap{
+					From:    prev + step,
+					To:      cur - step,
+					Missing: int((cur-prev)/step) - 1,
+				})
+			}
+		}
+	}
+
+	report.Missing = max(expected-report.Present, 0)
+	if expected > 0 {
+		report.CoveragePct = min(float64(report.Present)/float64(expected)*100, 100)
+	}
+
+	return report
+}
+
+func handleGetCoverage(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(r.PathValue("symbol"))
+	entry, exists := cache.Get(symbol)
+	if !exists {
+		http.Error(w, "Symbol not found", http.StatusNotFound)
+		return
+	}
+
+	lookback := time.Duration(config.LookbackDays(config.CandleInterval)) * 24 * time.Hour
+	report := buildCoverage(entry, config.CandleInterval, lookback)
+
+	if setETag(w, r, generateETag(entry.LastUpdate)) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
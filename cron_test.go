@@ -0,0 +1,148 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+		"@every 500ms",
+		"@every soon",
+		"@fortnightly",
+	} {
+		if _, err := parseSchedule(spec, time.Time{}); err == nil {
+			t.Errorf("parseSchedule(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     []int
+	}{
+		{"*", 0, 5, []int{0, 1, 2, 3, 4, 5}},
+		{"3", 0, 59, []int{3}},
+		{"1,4,9", 0, 59, []int{1, 4, 9}},
+		{"10-13", 0, 59, []int{10, 11, 12, 13}},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}},
+		{"9-17/4", 0, 23, []int{9, 13, 17}},
+		{"50/5", 0, 59, []int{50, 55}},
+		{"1-3,*/10", 0, 30, []int{0, 1, 2, 3, 10, 20, 30}},
+		{"*/2", 1, 12, []int{1, 3, 5, 7, 9, 11}},
+	}
+	for _, tt := range tests {
+		mask, err := parseCronField(tt.field, tt.min, tt.max)
+		if err != nil {
+			t.Errorf("parseCronField(%q): %v", tt.field, err)
+			continue
+		}
+		var want uint64
+		for _, v := range tt.want {
+			want |= 1 << v
+		}
+		if mask != want {
+			t.Errorf("parseCronField(%q) = %b, want %b", tt.field, mask, want)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// A Thursday
+	after := time.Date(2026, 1, 15, 10, 7, 30, 0, time.UTC)
+	at := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec  string
+		after time.Time
+		want  time.Time
+	}{
+		{"* * * * *", after, at(2026, 1, 15, 10, 8)},
+		{"*/5 * * * *", after, at(2026, 1, 15, 10, 10)},
+		{"*/5 * * * *", at(2026, 1, 15, 10, 10), at(2026, 1, 15, 10, 15)}, // Strictly after
+		{"15,45 * * * *", after, at(2026, 1, 15, 10, 15)},
+		{"0 * * * *", after, at(2026, 1, 15, 11, 0)},
+		{"@hourly", after, at(2026, 1, 15, 11, 0)},
+		{"0 9-17/4 * * *", after, at(2026, 1, 15, 13, 0)},
+		{"30 9 * * *", after, at(2026, 1, 16, 9, 30)},
+		{"0 0 1 * *", after, at(2026, 2, 1, 0, 0)},
+		{"0 0 * 3 *", after, at(2026, 3, 1, 0, 0)},
+		{"59 23 31 12 *", after, at(2026, 12, 31, 23, 59)},
+		{"0 0 1 1 *", after, at(2027, 1, 1, 0, 0)},
+		// Months without a 31st are skipped
+		{"0 0 31 * *", at(2026, 1, 31, 12, 0), at(2026, 3, 31, 0, 0)},
+		{"0 0 29 2 *", after, at(2028, 2, 29, 0, 0)},
+		// Day of week, with 0 and 7 both Sunday
+		{"0 12 * * 1", after, at(2026, 1, 19, 12, 0)},
+		{"0 12 * * 0", after, at(2026, 1, 18, 12, 0)},
+		{"0 12 * * 7", after, at(2026, 1, 18, 12, 0)},
+		{"0 0 * * 1-5", at(2026, 1, 16, 12, 0), at(2026, 1, 19, 0, 0)},
+		{"@weekly", after, at(2026, 1, 18, 0, 0)},
+		// Day of month or day of week when both are restricted
+		{"0 0 1 * 1", after, at(2026, 1, 19, 0, 0)},
+		{"0 0 16 * 1", after, at(2026, 1, 16, 0, 0)},
+		// Day of month and day of week when either is *
+		{"0 0 13 * *", after, at(2026, 2, 13, 0, 0)},
+		{"0 0 * * 5", after, at(2026, 1, 16, 0, 0)},
+	}
+	for _, tt := range tests {
+		s, err := parseSchedule(tt.spec, time.Time{})
+		if err != nil {
+			t.Errorf("parseSchedule(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(tt.after); !got.Equal(tt.want) {
+			t.Errorf("%q after %s: got %s, want %s", tt.spec, tt.after.Format(time.RFC3339), got.Format(time.RFC3339), tt.want.Format(time.RFC3339))
+		}
+	}
+}
+
+func TestCronScheduleNeverMatches(t *testing.T) {
+	s, err := parseSchedule("0 0 30 2 *", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Errorf("February 30th: got %s, want the zero time", got)
+	}
+}
+
+func TestEveryScheduleNext(t *testing.T) {
+	origin := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	s, err := parseSchedule("@every 15m", origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		after, want time.Time
+	}{
+		{origin.Add(-time.Hour), origin},
+		{origin, origin.Add(15 * time.Minute)},
+		{origin.Add(7 * time.Minute), origin.Add(15 * time.Minute)},
+		{origin.Add(15 * time.Minute), origin.Add(30 * time.Minute)},
+	}
+	for _, tt := range tests {
+		if got := s.Next(tt.after); !got.Equal(tt.want) {
+			t.Errorf("after %s: got %s, want %s", tt.after.Format(time.RFC3339), got.Format(time.RFC3339), tt.want.Format(time.RFC3339))
+		}
+	}
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+const dayMs = int64(24 * time.Hour / time.Millisecond)
+
+// DailyStore holds a long-lived daily candle series per symbol, independent
+// of the hot cache window
+type DailyStore struct {
+	mu         sync.RWMutex
+	series     map[string][]Candle
+	lastUpdate map[string]time.Time
+}
+
+// NewDailyStore creates an empty daily store
+func NewDailyStore() *DailyStore {
+	return &DailyStore{
+		series:     make(map[string][]Candle),
+		lastUpdate: make(map[string]time.Time),
+	}
+}
+
+// Has reports whether any daily data exists for symbol
+func (s *DailyStore) Has(symbol string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.series[symbol]) > 0
+}
+
+// Merge upserts daily candles for a symbol. Days already stored are only
+// replaced when overwrite is true, so a partial day at the edge of the hot
+// window never clobbers a complete one.
+func (s *DailyStore) Merge(symbol string, days []Candle, overwrite func(day int64) bool) {
+	if len(days) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byDay := make(map[int64]Candle, len(s.series[symbol])+len(days))
+	for _, c := range s.series[symbol] {
+		byDay[c.Timestamp] = c
+	}
+	for _, c := range days {
+		if _, exists := byDay[c.Timestamp]; exists && !overwrite(c.Timestamp) {
+			continue
+		}
+		byDay[c.Timestamp] = c
+	}
+
+	merged := make([]Candle, 0, len(byDay))
+	for _, c := range byDay {
+		merged = append(merged, c)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Timestamp < merged[j].Timestamp })
+
+	s.series[symbol] = merged
+	s.lastUpdate[symbol] = time.Now()
+}
+
+// Get returns a copy of the daily series for symbol
+func (s *DailyStore) Get(symbol string) (CacheEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	series, ok := s.series[symbol]
+	if !ok {
+		return CacheEntry{}, false
+	}
+	return CacheEntry{
+		Symbol:     symbol,
+		Candles:    NewCandleSeries(series),
+		LastUpdate: s.lastUpdate[symbol],
+	}, true
+}
+
+// Save writes the store to path atomically
+func (s *DailyStore) Save(path string) error {
+	s.mu.RLock()
+	data, err := json.Marshal(s.series)
+	s.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode daily store: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create daily store dir: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write daily store: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load reads the store from path; a missing file is not an error
+func (s *DailyStore) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read daily store: %w", err)
+	}
+
+	var series map[string][]Candle
+	if err := json.Unmarshal(data, &series); err != nil {
+		return fmt.Errorf("failed to decode daily store: %w", err)
+	}
+	if series == nil {
+		// A file holding null decodes to a nil map, which Merge can't write to
+		series = make(map[string][]Candle)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.series = series
+	for symbol := range series {
+		s.lastUpdate[symbol] = time.Now()
+	}
+	return nil
+}
+
+// rollupDaily aggregates intraday candles into UTC days. Day timestamps are
+// the day's open time in milliseconds.
+func rollupDaily(candles CandleSeries) []Candle {
+	var days []Candle
+	var volume decimalSum
+	for i := 0; i < candles.Len(); i++ {
+		ts := candles.Timestamp(i)
+		day := ts - ts%dayMs
+		if n := len(days); n > 0 && days[n-1].Timestamp == day {
+			d := &days[n-1]
+			d.High = max(d.High, candles.Highs[i])
+			d.Low = min(d.Low, candles.Lows[i])
+			d.Close = candles.Closes[i]
+			volume.Add(candles.Volumes[i])
+			d.Volume = volume.Value()
+			continue
+		}
+		c := candles.At(i)
+		c.Timestamp = day
+		days = append(days, c)
+		volume = decimalSum{}
+		volume.Add(c.Volume)
+	}
+	return days
+}
+
+// DailyRollupActor keeps the daily store current from the hot cache and
+// backfills full daily history for symbols it hasn't seen yet
+type DailyRollupActor struct {
+	cache             *Cache
+	store             *DailyStore
+	hyperliquidClient *HyperliquidClient
+	tickInterval      time.Duration
+	backfillPerTick   int
+	backfillDays      int
+	storePath         string
+	backfilled        map[string]bool
+}
+
+// NewDailyRollupActor creates a new daily rollup actor
+func NewDailyRollupActor(
+	cache *Cache,
+	store *DailyStore,
+	hyperliquidClient *HyperliquidClient,
+	tickInterval time.Duration,
+	backfillPerTick int,
+	backfillDays int,
+	storePath string,
+) *DailyRollupActor {
+	return &DailyRollupActor{
+		cache:             cache,
+		store:             store,
+		hyperliquidClient: hyperliquidClient,
+		tickInterval:      tickInterval,
+		backfillPerTick:   backfillPerTick,
+		backfillDays:      backfillDays,
+		storePath:         storePath,
+		backfilled:        make(map[string]bool),
+	}
+}
+
+func (a *DailyRollupActor) Receive(ctx *actor.Context) {
+	switch msg := ctx.Message().(type) {
+	case actor.Started:
+		log.Println("[DailyRollup] Actor started")
+		ctx.Engine().Subscribe(ctx.PID())
+		startHeartbeat(ctx)
+		scheduler.Add(RefreshDaily, a.tickInterval, ctx.PID(), RollupDailyMsg{})
+
+	case HeartbeatMsg:
+		heartbeats.Beat(ctx.PID())
+
+	case RollupDailyMsg:
+		a.rollup()
+		a.backfill()
+		a.saveStore()
+
+	case SymbolsListedMsg:
+		// New listings have little history, so this is cheap
+		for _, symbol := range msg.Symbols {
+			a.backfillSymbol(symbol)
+		}
+
+	case BackfillDailyMsg:
+		var failed []string
+		for _, symbol := range msg.Symbols {
+			if err := a.fetchHistory(symbol, true); err != nil {
+				failed = append(failed, symbol)
+			}
+			// A long backfill is progress, not a stuck handler, so it
+			// mustn't starve the heartbeat the watchdog goes by
+			heartbeats.Beat(ctx.PID())
+		}
+		a.saveStore()
+		if len(failed) > 0 {
+			msg.Done <- fmt.Errorf("failed to backfill %s", strings.Join(failed, ", "))
+		} else {
+			msg.Done <- nil
+		}
+
+	case actor.Stopped:
+		scheduler.Remove(RefreshDaily, ctx.PID())
+		ctx.Engine().Unsubscribe(ctx.PID())
+		a.saveStore()
+		log.Println("[DailyRollup] Actor stopped")
+	}
+}
+
+// saveStore persists the daily store, if it has a path
+func (a *DailyRollupActor) saveStore() {
+	if a.storePath == "" {
+		return
+	}
+	if err := a.store.Save(a.storePath); err != nil {
+		log.Printf("[DailyRollup] ERROR: %v", err)
+		errorTrace.Record(SubsystemStorage, "daily", err)
+	}
+}
+
+func (a *DailyRollupActor) rollup() {
+	for symbol, entry := range a.cache.GetAll() {
+		if entry.Candles.Len() == 0 {
+			continue
+		}
+		days := rollupDaily(entry.Candles)
+		// The first day in the window is usually partial (rolling off), so it
+		// only fills a gap; every later day is complete or still in progress
+		firstDay := days[0].Timestamp
+		a.store.Merge(symbol, days, func(day int64) bool { return day != firstDay })
+	}
+}
+
+func (a *DailyRollupActor) backfill() {
+	done := 0
+	for _, symbol := range a.cache.GetSymbols() {
+		if done >= a.backfillPerTick {
+			return
+		}
+		if a.backfillSymbol(symbol) {
+			done++
+		}
+	}
+}
+
+// backfillSymbol fetches symbol's full daily history unless it's been
+// backfilled already, reporting whether it called upstream
+func (a *DailyRollupActor) backfillSymbol(symbol string) bool {
+	if a.backfilled[symbol] || !inShard(symbol) || a.hasHistory(symbol) {
+		return false
+	}
+	a.fetchHistory(symbol, false)
+	return true
+}
+
+// fetchHistory fetches symbol's full daily history into the store. With
+// replace the fetched days overwrite the stored ones; otherwise they only
+// fill gaps.
+func (a *DailyRollupActor) fetchHistory(symbol string, replace bool) error {
+	endTime := time.Now().UnixMilli()
+	startTime := time.Now().AddDate(0, 0, -a.backfillDays).UnixMilli()
+	days, err := a.hyperliquidClient.FetchCandlesWithRetry(symbol, "1d", startTime, endTime, 3)
+	if errors.Is(err, errDryRun) {
+		return nil // Nothing to store
+	}
+	if err != nil {
+		log.Printf("[DailyRollup] ERROR: Failed to backfill %s: %v", symbol, err)
+		errorTrace.RecordSymbol(SubsystemFetcher, "daily", symbol, err)
+		return err
+	}
+
+	// Copy before normalizing: fetch results may be shared with other callers
+	normalized := make([]Candle, len(days))
+	for i, c := range days {
+		c.Timestamp -= c.Timestamp % dayMs
+		normalized[i] = c
+	}
+	// Unless replacing, the hot-window rollup wins where the two overlap
+	a.store.Merge(symbol, normalized, func(int64) bool { return replace })
+	a.backfilled[symbol] = true
+	log.Printf("[DailyRollup] Backfilled %d days for %s", len(days), symbol)
+	return nil
+}
+
+// hasHistory reports whether the store already reaches back beyond the hot
+// cache window, e.g. from a previous run's persisted store
+func (a *DailyRollupActor) hasHistory(symbol string) bool {
+	daily, ok := a.store.Get(symbol)
+	if !ok || daily.Candles.Len() == 0 {
+		return false
+	}
+	cached, ok := a.cache.Get(symbol)
+	if !ok || cached.Candles.Len() == 0 {
+		return true
+	}
+	return daily.Candles.Timestamp(0) < cached.Candles.Timestamp(0)-dayMs
+}
+
+func handleGetDaily(w http.ResponseWriter, r *http.Request) {
+	symbol := cache.CanonicalSymbol(strings.ToUpper(r.PathValue("symbol")))
+	if dailyStore == nil {
+		http.Error(w, "Daily rollup disabled", http.StatusNotFound)
+		return
+	}
+
+	entry, exists := dailyStore.Get(symbol)
+	if !exists {
+		http.Error(w, "Symbol not found", http.StatusNotFound)
+		return
+	}
+
+	candles, err := filterCandles(entry.Candles, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entry.Candles = candles
+	page, err := parseCandlePage(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// ?interval=1w|1M resamples the days into calendar weeks or months
+	if requested := r.URL.Query().Get("interval"); requested != "" {
+		target, err := normalizeInterval(requested)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if target != "1d" {
+			if !canResample("1d", target) {
+				http.Error(w, "Daily history resamples to 1w or 1M only", http.StatusBadRequest)
+				return
+			}
+			// The days are UTC, so only an explicit tz moves the boundaries
+			loc := time.UTC
+			if r.URL.Query().Get("tz") != "" {
+				if loc, err = requestLocation(r.URL.Query()); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			buckets, err := resample(entry.Candles, "1d", target, loc)
+			if err != nil {
+				http.Error(w, err.Error()+"; daily history is kept in UTC days", http.StatusBadRequest)
+				return
+			}
+			entry.Candles = NewCandleSeries(buckets)
+			entry.Interval = target
+			entry.Timezone = loc.String()
+		}
+	}
+	entry.Candles = page.apply(entry.Candles)
+	applyPrecision(&entry, r.URL.Query())
+
+	if setETag(w, r, generateETag(entry.LastUpdate)) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := writeJSON(r.Context(), w, entry); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleAdminBackfill refetches the full daily history of ?symbol=BTC,ETH,
+// replacing what the daily store holds for them
+func handleAdminBackfill(w http.ResponseWriter, r *http.Request) {
+	if dailyStore == nil || loadPID(&dailyRollupPID) == nil {
+		http.Error(w, "Daily rollup disabled", http.StatusNotFound)
+		return
+	}
+	var symbols []string
+	for _, symbol := range strings.Split(r.URL.Query().Get("symbol"), ",") {
+		if symbol = strings.TrimSpace(symbol); symbol == "" {
+			continue
+		}
+		symbol = cache.CanonicalSymbol(symbol)
+		if !cache.HasSymbol(symbol) {
+			http.Error(w, fmt.Sprintf("Symbol %s not found", symbol), http.StatusNotFound)
+			return
+		}
+		if !inShard(symbol) {
+			_, count := currentShard()
+			http.Error(w, fmt.Sprintf("%s is fetched by shard %d", symbol, shardOf(symbol, count)), http.StatusConflict)
+			return
+		}
+		symbols = append(symbols, symbol)
+	}
+	if len(symbols) == 0 {
+		http.Error(w, "symbol required", http.StatusBadRequest)
+		return
+	}
+
+	submitJob(w, r, "backfill", map[string]string{"symbol": strings.Join(symbols, ",")})
+}
+
+// runBackfillJob has the daily rollup refetch the history of params' symbol
+// list
+func runBackfillJob(params map[string]string) (interface{}, error) {
+	if dailyStore == nil {
+		return nil, permanent(fmt.Errorf("daily rollup disabled"))
+	}
+	pid := loadPID(&dailyRollupPID)
+	if pid == nil {
+		return nil, fmt.Errorf("daily rollup not running")
+	}
+	symbols := strings.Split(params["symbol"], ",")
+	done := make(chan error, 1)
+	engine.Send(pid, BackfillDailyMsg{Symbols: symbols, Done: done})
+	select {
+	case err := <-done:
+		return map[string]interface{}{"symbols": symbols}, err
+	case <-time.After(jobTimeout):
+		return nil, fmt.Errorf("no answer after %s", jobTimeout)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import "math"
+
+// Hyperliquid prices and sizes have at most 8 decimals, so aggregations add
+// them as integer counts of 1e-8 instead of floats. Summing float volumes
+// drifts (0.1 + 0.2 = 0.30000000000000004) and the error grows with every
+// candle or trade folded in; integer ticks keep sums equal to what the
+// exchange reports.
+const (
+	decimalTicks      = 1e8
+	decimalTicksInt   = int64(decimalTicks)
+	maxExactTickWhole = (1 << 53) / decimalTicksInt // Whole part below which whole*1e8 + frac fits a float64 exactly
+)
+
+// toTicks splits v into its integer part and the rest in 1e-8 ticks. ok is
+// false when v doesn't fit an int64 or isn't finite.
+func toTicks(v float64) (whole, frac int64, ok bool) {
+	if math.IsNaN(v) || math.Abs(v) >= 1<<62 {
+		return 0, 0, false
+	}
+	w := math.Trunc(v)
+	// v - w is exact for floats, so only the scaling rounds
+	return int64(w), int64(math.Round((v - w) * decimalTicks)), true
+}
+
+// fromTicks converts whole units plus frac ticks back to the nearest float
+func fromTicks(whole, frac int64) float64 {
+	whole += frac / decimalTicksInt
+	frac %= decimalTicksInt
+	if whole > -maxExactTickWhole && whole < maxExactTickWhole {
+		// One exact integer divided by an exact power of ten rounds once
+		return float64(whole*decimalTicksInt+frac) / decimalTicks
+	}
+	return float64(whole) + float64(frac)/decimalTicks
+}
+
+// decimalSum accumulates values in 1e-8 ticks. Values too large for ticks
+// fall back to float addition. It's only exact for raw exchange values,
+// prices, sizes and volumes: products such as notional or derived figures
+// such as percentages have more decimals and are summed as floats.
+type decimalSum struct {
+	whole, frac int64
+	overflow    float64
+}
+
+// Add adds v to the sum
+func (s *decimalSum) Add(v float64) {
+	whole, frac, ok := toTicks(v)
+	if !ok {
+		s.overflow += v
+		return
+	}
+	s.whole += whole
+	s.frac += frac
+	if s.frac >= decimalTicksInt || s.frac <= -decimalTicksInt {
+		s.whole += s.frac / decimalTicksInt
+		s.frac %= decimalTicksInt
+	}
+}
+
+// Value returns the sum as a float
+func (s *decimalSum) Value() float64 {
+	return fromTicks(s.whole, s.frac) + s.overflow
+}
+
+// addDecimal returns a + b added in ticks, for running totals kept as floats
+func addDecimal(a, b float64) float64 {
+	var s decimalSum
+	s.Add(a)
+	s.Add(b)
+	return s.Value()
+}
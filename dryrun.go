@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// Hyperliquid returns at most this many candles per candleSnapshot request
+const maxCandlesPerSnapshot = 5000
+
+// dryRun is set from DRY_RUN: Hyperliquid requests are logged and counted
+// against the request budget but never sent
+func dryRun() bool {
+	return config != nil && config.DryRun
+}
+
+// errDryRun is returned instead of data by every Hyperliquid request in a
+// dry run, so callers keep what they have rather than storing nothing
+var errDryRun = errors.New("dry run: request not sent")
+
+// plannedCandles estimates how many candles a candleSnapshot request for
+// interval between startTime and endTime (milliseconds) would return
+func plannedCandles(interval string, startTime, endTime int64) int {
+	d, ok := intervalDuration(interval)
+	if !ok || endTime <= startTime {
+		return 0
+	}
+	return min(int((endTime-startTime)/d.Milliseconds())+1, maxCandlesPerSnapshot)
+}
+
+// dryRunFetch logs the candleSnapshot request fetchCandles would send and
+// records its estimated weight
+func dryRunFetch(symbol, interval string, startTime, endTime int64, stats *FetchStats) error {
+	stats.Attempts++
+	candles := plannedCandles(interval, startTime, endTime)
+	weight := infoWeight("candleSnapshot", candles)
+	log.Printf("[DryRun] candleSnapshot %s %s %s to %s (~%d candles, weight %d)",
+		symbol, interval,
+		time.UnixMilli(startTime).UTC().Format(time.RFC3339),
+		time.UnixMilli(endTime).UTC().Format(time.RFC3339),
+		candles, weight)
+	requestBudget.Record("candleSnapshot", weight, false)
+	metrics.Inc("dry_run_requests_total", "type", "candleSnapshot")
+	return errDryRun
+}
+
+// logDryRunCycle summarises the weight a fetch cycle would have used
+// against the budget
+func logDryRunCycle() {
+	report := requestBudget.Report()
+	cycle := report.LastCycle
+	if cycle == nil {
+		return
+	}
+	verdict := "within"
+	if cycle.ProjectedPerMin > float64(report.Minute.Budget) {
+		verdict = "OVER"
+	}
+	log.Printf("[DryRun] Cycle would use weight %d for %d symbols (%.1f per symbol), %.0f/min projected, %s the %d/min budget (max %d symbols at this interval)",
+		cycle.Weight, cycle.Symbols, cycle.WeightPerSymbol, cycle.ProjectedPerMin, verdict, report.Minute.Budget, cycle.MaxSymbolsBudget)
+}
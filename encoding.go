@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// JSONEncoder serializes response payloads. Candle endpoints go through
+// jsonEncoder so the implementation can be swapped via JSON_ENCODER.
+type JSONEncoder interface {
+	Encode(w io.Writer, v interface{}) error
+	Name() string
+}
+
+// jsonEncoder is the encoder used on hot paths, std until configured otherwise
+var jsonEncoder JSONEncoder = stdJSONEncoder{}
+
+// newJSONEncoder returns the encoder registered under name
+func newJSONEncoder(name string) (JSONEncoder, error) {
+	switch name {
+	case "", "std":
+		return stdJSONEncoder{}, nil
+	case "jsoniter":
+		return jsoniterEncoder{api: jsoniter.ConfigCompatibleWithStandardLibrary}, nil
+	case "sonic":
+		return newSonicEncoder()
+	default:
+		return nil, fmt.Errorf("unknown JSON encoder %q (supported: std, jsoniter, sonic)", name)
+	}
+}
+
+// maxPooledBufferSize caps the buffers returned to the pool so a single
+// oversized render doesn't pin its memory for the life of the process
+const maxPooledBufferSize = 32 << 20
+
+var responseBufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// writeJSON renders v into a pooled buffer and writes it with a
+// Content-Length. Nothing is written to w if encoding fails. A render that
+// outlives ctx is abandoned: a missed deadline is answered with 503, a
+// client that went away gets nothing.
+func writeJSON(ctx context.Context, w http.ResponseWriter, v interface{}) error {
+	buf := responseBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBufferSize {
+			responseBufferPool.Put(buf)
+		}
+	}()
+
+	var err error
+	if entries, ok := v.(map[string]CacheEntry); ok {
+		err = encodeEntries(ctx, buf, entries)
+	} else if err = ctx.Err(); err == nil {
+		err = jsonEncoder.Encode(buf, v)
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		abandonRequest(w, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// encodeEntries renders entries as encoding/json would (keys sorted), one
+// entry at a time so an abandoned request stops rendering early
+func encodeEntries(ctx context.Context, buf *bytes.Buffer, entries map[string]CacheEntry) error {
+	symbols := make([]string, 0, len(entries))
+	for symbol := range entries {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	buf.WriteByte('{')
+	for i, symbol := range symbols {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(symbol)
+		if err != nil {
+			return err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		if err := jsonEncoder.Encode(buf, entries[symbol]); err != nil {
+			return err
+		}
+		buf.Truncate(buf.Len() - 1) // Encode's trailing newline
+	}
+	buf.WriteString("}\n")
+	return nil
+}
+
+// abandonRequest records a render cut short by its request's context
+func abandonRequest(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		metrics.Inc("http_requests_abandoned_total", "reason", "deadline")
+		http.Error(w, "Request deadline exceeded", http.StatusServiceUnavailable)
+		return
+	}
+	metrics.Inc("http_requests_abandoned_total", "reason", "client_gone")
+}
+
+// stdJSONEncoder uses encoding/json
+type stdJSONEncoder struct{}
+
+func (stdJSONEncoder) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (stdJSONEncoder) Name() string { return "std" }
+
+// jsoniterEncoder uses json-iterator in standard-library compatible mode,
+// producing byte-identical output with considerably less CPU
+type jsoniterEncoder struct {
+	api jsoniter.API
+}
+
+func (e jsoniterEncoder) Encode(w io.Writer, v interface{}) error {
+	return e.api.NewEncoder(w).Encode(v)
+}
+
+func (jsoniterEncoder) Name() string { return "jsoniter" }
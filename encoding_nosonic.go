@@ -0,0 +1,11 @@
+//go:build !(amd64 || arm64) || go1.27
+
+package main
+
+import "errors"
+
+// newSonicEncoder refuses sonic where it would only fall back to
+// encoding/json: it supports amd64 and arm64 up to Go 1.26
+func newSonicEncoder() (JSONEncoder, error) {
+	return nil, errors.New("sonic needs amd64 or arm64 and Go 1.26 or older, use jsoniter")
+}
@@ -0,0 +1,25 @@
+//go:build (amd64 || arm64) && !go1.27
+
+package main
+
+import (
+	"io"
+
+	"github.com/bytedance/sonic"
+)
+
+// sonicEncoder uses sonic in standard-library compatible mode (sorted map
+// keys, escaped HTML), with encoders JIT-compiled per type
+type sonicEncoder struct {
+	api sonic.API
+}
+
+func newSonicEncoder() (JSONEncoder, error) {
+	return sonicEncoder{api: sonic.ConfigStd}, nil
+}
+
+func (e sonicEncoder) Encode(w io.Writer, v interface{}) error {
+	return e.api.NewEncoder(w).Encode(v)
+}
+
+func (sonicEncoder) Name() string { return "sonic" }
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResponseMeta describes the data in an enveloped response
+type ResponseMeta struct {
+	GeneratedAt    time.Time            `json:"generated_at"`
+	DataAsOf       time.Time            `json:"data_as_of,omitempty"` // Last candle cache update
+	Interval       string               `json:"interval"`
+	SymbolCount    int                  `json:"symbol_count"`
+	NextRefreshETA *time.Time           `json:"next_refresh_eta,omitempty"` // Next candle fetch cycle
+	NextRefresh    map[string]time.Time `json:"next_refresh,omitempty"`     // Per refresh tier
+	Exchange       *ExchangeStatus      `json:"exchange,omitempty"`         // Hyperliquid's own status, once polled
+	ExpectedStale  bool                 `json:"expected_stale,omitempty"`   // Data isn't refreshing because of exchange maintenance
+}
+
+// responseMeta builds the meta block for r
+func responseMeta(r *http.Request) ResponseMeta {
+	now := time.Now().UTC()
+	meta := ResponseMeta{
+		GeneratedAt: now,
+		DataAsOf:    requestCache(r).GetLastUpdate().UTC(),
+		Interval:    requestInterval(r),
+		SymbolCount: len(requestCache(r).GetSymbols()),
+	}
+	if interval, err := normalizeInterval(r.URL.Query().Get("interval")); err == nil && interval != "" {
+		meta.Interval = interval
+	}
+	tier := RefreshCandles
+	if p := requestPipeline(r); p != nil {
+		tier = pipelineRefreshTier(p.Name)
+	}
+	if next, ok := scheduler.Next(tier, now); ok {
+		next = next.UTC()
+		meta.NextRefreshETA = &next
+	}
+	meta.NextRefresh = scheduler.All(now)
+	if status, ok := exchangeStatus.Get(); ok {
+		meta.Exchange = &status
+		meta.ExpectedStale = status.Maintenance
+	}
+	return meta
+}
+
+// envelopeHandler wraps successful JSON responses as {"meta": ..., "data": ...}
+// when the request has ?envelope=true. The meta changes on every request, so
+// enveloped responses carry no ETag and are never answered with a 304.
+func envelopeHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("envelope") != "true" || r.Method != http.MethodGet {
+			next(w, r)
+			return
+		}
+
+		// Plain JSON from the handler; compression happens outside
+		inner := r.Clone(r.Context())
+		inner.Header.Del("If-None-Match")
+		inner.Header.Del("Accept-Encoding")
+		ew := &envelopeWriter{ResponseWriter: w, r: r, statusCode: http.StatusOK}
+		next(ew, inner)
+		ew.finish()
+	}
+}
+
+// envelopeSuffix closes the envelope after the handler's body
+var envelopeSuffix = []byte("}\n")
+
+// envelopeWriter streams the handler's body between the envelope's prefix
+// and suffix rather than buffering it. Whether to wrap is decided on the
+// first write, once the status and headers are known; anything but a plain
+// JSON 200 passes through untouched.
+type envelopeWriter struct {
+	http.ResponseWriter
+	r          *http.Request
+	statusCode int
+	started    bool
+	wrapping   bool
+	wroteBody  bool
+}
+
+func (w *envelopeWriter) WriteHeader(code int) {
+	if !w.started {
+		w.statusCode = code
+	}
+}
+
+func (w *envelopeWriter) Write(b []byte) (int, error) {
+	if !w.started {
+		w.start()
+	}
+	if len(b) > 0 {
+		w.wroteBody = true
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *envelopeWriter) start() {
+	w.started = true
+	h := w.Header()
+	if w.statusCode != http.StatusOK || h.Get("Content-Encoding") != "" ||
+		!strings.HasPrefix(h.Get("Content-Type"), "application/json") {
+		w.ResponseWriter.WriteHeader(w.statusCode)
+		return
+	}
+
+	meta, err := json.Marshal(responseMeta(w.r))
+	if err != nil {
+		log.Printf("Error encoding response meta: %v", err)
+		w.ResponseWriter.WriteHeader(w.statusCode)
+		return
+	}
+	prefix := append(append([]byte(`{"meta":`), meta...), `,"data":`...)
+	w.wrapping = true
+	h.Del("ETag")
+	if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil {
+		h.Set("Content-Length", strconv.Itoa(len(prefix)+n+len(envelopeSuffix)))
+	}
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	w.ResponseWriter.Write(prefix)
+}
+
+// finish closes the envelope, or writes the header of a bodiless response
+func (w *envelopeWriter) finish() {
+	if !w.started {
+		w.start()
+	}
+	if !w.wrapping {
+		return
+	}
+	if !w.wroteBody {
+		w.ResponseWriter.Write([]byte("null"))
+	}
+	w.ResponseWriter.Write(envelopeSuffix)
+}
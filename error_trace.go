@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Subsystems whose recent errors are kept for /admin/errors
+const (
+	SubsystemFetcher = "fetcher" // Candle fetches, in cycles and on demand
+	SubsystemSymbols = "symbols" // Symbol list and metadata refreshes
+	SubsystemStorage = "storage" // Snapshots, archives and persisted state
+	SubsystemWS      = "ws"      // Hyperliquid WebSocket streams
+)
+
+var errorSubsystems = []string{SubsystemFetcher, SubsystemSymbols, SubsystemStorage, SubsystemWS}
+
+// TracedError is one error in a subsystem's trace
+type TracedError struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"` // What failed, e.g. "snapshot" or the stream name
+	Symbol string    `json:"symbol,omitempty"`
+	Error  string    `json:"error"`
+}
+
+// ErrorTraceSummary is a subsystem's trace on /admin/errors
+type ErrorTraceSummary struct {
+	Total  int           `json:"total"` // Errors since startup, including those no longer kept
+	Last   *time.Time    `json:"last,omitempty"`
+	Errors []TracedError `json:"errors"` // Newest first
+}
+
+// errorRing holds a subsystem's last errors, overwriting the oldest
+type errorRing struct {
+	entries []TracedError
+	next    int
+	total   int
+}
+
+// ErrorTrace keeps the last errors of each subsystem in memory, so a
+// transient failure can be looked at after the fact without digging
+// through logs
+type ErrorTrace struct {
+	mu    sync.Mutex
+	size  int
+	rings map[string]*errorRing
+}
+
+var errorTrace = NewErrorTrace(50)
+
+// NewErrorTrace creates a trace keeping size errors per subsystem
+func NewErrorTrace(size int) *ErrorTrace {
+	return &ErrorTrace{size: size, rings: make(map[string]*errorRing)}
+}
+
+// Record adds err to subsystem's trace
+func (t *ErrorTrace) Record(subsystem, source string, err error) {
+	t.RecordSymbol(subsystem, source, "", err)
+}
+
+// RecordSymbol adds err, which concerns symbol, to subsystem's trace
+func (t *ErrorTrace) RecordSymbol(subsystem, source, symbol string, err error) {
+	if err == nil {
+		return
+	}
+	entry := TracedError{Time: time.Now().UTC(), Source: source, Symbol: symbol, Error: err.Error()}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ring, ok := t.rings[subsystem]
+	if !ok {
+		ring = &errorRing{entries: make([]TracedError, 0, t.size)}
+		t.rings[subsystem] = ring
+	}
+	if len(ring.entries) < t.size {
+		ring.entries = append(ring.entries, entry)
+	} else {
+		ring.entries[ring.next] = entry
+	}
+	ring.next = (ring.next + 1) % t.size
+	ring.total++
+}
+
+// Snapshot returns each subsystem's trace, keeping up to limit errors and
+// only those in symbol's when it isn't empty
+func (t *ErrorTrace) Snapshot(limit int, symbol string) map[string]ErrorTraceSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make(map[string]ErrorTraceSummary, len(errorSubsystems))
+	for _, subsystem := range errorSubsystems {
+		result[subsystem] = ErrorTraceSummary{Errors: []TracedError{}}
+	}
+	for subsystem, ring := range t.rings {
+		summary := ErrorTraceSummary{Total: ring.total, Errors: []TracedError{}}
+		// Walk back from the newest entry
+		for i := 0; i < len(ring.entries); i++ {
+			entry := ring.entries[(ring.next-1-i+len(ring.entries))%len(ring.entries)]
+			if summary.Last == nil {
+				last := entry.Time
+				summary.Last = &last
+			}
+			if symbol != "" && entry.Symbol != symbol {
+				continue
+			}
+			if len(summary.Errors) >= limit {
+				break
+			}
+			summary.Errors = append(summary.Errors, entry)
+		}
+		result[subsystem] = summary
+	}
+	return result
+}
+
+// handleAdminErrors returns the recent errors of each subsystem.
+// ?subsystem=fetcher, ?symbol=BTC, ?limit=20
+func handleAdminErrors(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := errorTrace.size
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	symbol := query.Get("symbol")
+	if symbol != "" {
+		symbol = cache.CanonicalSymbol(symbol)
+	}
+
+	traces := errorTrace.Snapshot(limit, symbol)
+	var response interface{} = traces
+	if subsystem := query.Get("subsystem"); subsystem != "" {
+		summary, ok := traces[subsystem]
+		if !ok {
+			http.Error(w, "Unknown subsystem, use one of "+strings.Join(errorSubsystems, ", "), http.StatusBadRequest)
+			return
+		}
+		response = summary
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
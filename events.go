@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EventListing   = "listing"
+	EventDelisting = "delisting"
+
+	// Events kept in memory and on disk; older ones are dropped
+	maxSymbolEvents = 1000
+	// SSE comment sent on idle streams so proxies keep them open
+	eventStreamHeartbeat = 15 * time.Second
+)
+
+// SymbolEvent is a symbol joining or leaving Hyperliquid's listings
+type SymbolEvent struct {
+	ID     int64     `json:"id"`
+	Type   string    `json:"type"`
+	Symbol string    `json:"symbol"`
+	Market string    `json:"market"`
+	Time   time.Time `json:"time"`
+}
+
+// SymbolEventLog keeps recent symbol lifecycle events and fans new ones out
+// to stream subscribers. Events are persisted to a JSON file after every
+// change when a path is configured.
+type SymbolEventLog struct {
+	mu          sync.Mutex
+	events      []SymbolEvent
+	nextID      int64
+	path        string
+	subscribers map[chan SymbolEvent]bool
+}
+
+// symbolEvents records listings and delistings found by the symbol fetcher
+var symbolEvents = NewSymbolEventLog("")
+
+// NewSymbolEventLog creates an empty event log; path may be empty for memory only
+func NewSymbolEventLog(path string) *SymbolEventLog {
+	return &SymbolEventLog{nextID: 1, path: path, subscribers: make(map[chan SymbolEvent]bool)}
+}
+
+// Load reads events from the log's file; a missing file is not an error
+func (l *SymbolEventLog) Load() error {
+	if l.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read symbol events: %w", err)
+	}
+	var events []SymbolEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		return fmt.Errorf("failed to decode symbol events: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = events
+	if n := len(events); n > 0 {
+		l.nextID = events[n-1].ID + 1
+	}
+	log.Printf("[Events] Loaded %d symbol events from %s", len(events), l.path)
+	return nil
+}
+
+// saveLocked writes the events to the log's file. Callers must hold l.mu.
+func (l *SymbolEventLog) saveLocked() {
+	if l.path == "" {
+		return
+	}
+	data, err := json.Marshal(l.events)
+	if err != nil {
+		log.Printf("[Events] ERROR: Failed to encode symbol events: %v", err)
+		errorTrace.Record(SubsystemStorage, "events", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		log.Printf("[Events] ERROR: Failed to create events dir: %v", err)
+		errorTrace.Record(SubsystemStorage, "events", err)
+		return
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("[Events] ERROR: Failed to write symbol events: %v", err)
+		errorTrace.Record(SubsystemStorage, "events", err)
+		return
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		log.Printf("[Events] ERROR: Failed to replace symbol events: %v", err)
+		errorTrace.Record(SubsystemStorage, "events", err)
+	}
+}
+
+// Record appends an event of eventType for each symbol and notifies stream
+// subscribers. A subscriber too slow to keep up is dropped.
+func (l *SymbolEventLog) Record(eventType, market string, symbols []string) {
+	if len(symbols) == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, symbol := range symbols {
+		event := SymbolEvent{ID: l.nextID, Type: eventType, Symbol: symbol, Market: market, Time: now}
+		l.nextID++
+		l.events = append(l.events, event)
+		log.Printf("[Events] %s %s", eventType, symbol)
+		metrics.Inc("symbol_events_total", "type", eventType)
+		for ch := range l.subscribers {
+			select {
+			case ch <- event:
+			default:
+				delete(l.subscribers, ch)
+				close(ch)
+				metrics.Set("event_stream_clients", float64(len(l.subscribers)))
+			}
+		}
+	}
+	if len(l.events) > maxSymbolEvents {
+		l.events = append([]SymbolEvent(nil), l.events[len(l.events)-maxSymbolEvents:]...)
+	}
+	l.saveLocked()
+}
+
+// Query returns up to limit of the newest events matching eventType (all
+// types when empty) and symbol with an ID above afterID, oldest first
+func (l *SymbolEventLog) Query(eventType, symbol string, afterID int64, since time.Time, limit int) []SymbolEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var result []SymbolEvent
+	for i := len(l.events) - 1; i >= 0 && len(result) < limit; i-- {
+		e := l.events[i]
+		if e.ID <= afterID || e.Time.Before(since) {
+			break
+		}
+		if (eventType == "" || e.Type == eventType) && (symbol == "" || strings.EqualFold(e.Symbol, symbol)) {
+			result = append(result, e)
+		}
+	}
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// Latest returns the time of the newest event, for ETags
+func (l *SymbolEventLog) Latest() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n := len(l.events); n > 0 {
+		return l.events[n-1].Time
+	}
+	return time.Time{}
+}
+
+// subscribe returns a channel receiving every new event, along with the
+// events after afterID recorded before it, so a reconnecting stream misses
+// nothing
+func (l *SymbolEventLog) subscribe(afterID int64) (chan SymbolEvent, []SymbolEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ch := make(chan SymbolEvent, 16)
+	l.subscribers[ch] = true
+	metrics.Set("event_stream_clients", float64(len(l.subscribers)))
+	var backlog []SymbolEvent
+	for _, e := range l.events {
+		if e.ID > afterID {
+			backlog = append(backlog, e)
+		}
+	}
+	return ch, backlog
+}
+
+func (l *SymbolEventLog) unsubscribe(ch chan SymbolEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.subscribers[ch] {
+		delete(l.subscribers, ch)
+		close(ch)
+		metrics.Set("event_stream_clients", float64(len(l.subscribers)))
+	}
+}
+
+// parseEventType validates ?type=
+func parseEventType(raw string) (string, error) {
+	switch raw {
+	case "", EventListing, EventDelisting:
+		return raw, nil
+	}
+	return "", fmt.Errorf("Invalid type: use %s or %s", EventListing, EventDelisting)
+}
+
+// handleGetEvents lists symbol lifecycle events.
+// ?type=listing|delisting, ?symbol=BTC, ?since=<RFC3339 or lookback like 7d>, ?limit=100
+func handleGetEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	eventType, err := parseEventType(query.Get("type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxSymbolEvents {
+			http.Error(w, fmt.Sprintf("Invalid limit: use 1 to %d", maxSymbolEvents), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	var since time.Time
+	if raw := query.Get("since"); raw != "" {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			lookback, lerr := parseLookback(raw)
+			if lerr != nil {
+				http.Error(w, "Invalid since: use RFC3339 or a duration like 7d", http.StatusBadRequest)
+				return
+			}
+			t = time.Now().Add(-lookback)
+		}
+		since = t
+	}
+	// Matched case-insensitively: delisted symbols are no longer in the cache
+	symbol := query.Get("symbol")
+
+	if setETag(w, r, generateETag(symbolEvents.Latest())) {
+		return
+	}
+	events := symbolEvents.Query(eventType, symbol, 0, since, limit)
+	if events == nil {
+		events = []SymbolEvent{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":  len(events),
+		"events": events,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// handleEventStream streams new symbol events as server-sent events. A
+// reconnecting client's Last-Event-ID header (or ?after=<id>) replays the
+// events it missed. ?type= filters as on /api/events.
+func handleEventStream(w http.ResponseWriter, r *http.Request) {
+	eventType, err := parseEventType(r.URL.Query().Get("type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("after")
+	}
+	afterID := int64(-1) // Nothing to replay for a new client
+	if lastID != "" {
+		if afterID, err = strconv.ParseInt(lastID, 10, 64); err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, backlog := symbolEvents.subscribe(max(afterID, 0))
+	defer symbolEvents.unsubscribe(events)
+	if afterID < 0 {
+		backlog = nil
+	}
+
+	rc := http.NewResponseController(w)
+	// Streams outlive WRITE_TIMEOUT_SEC
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	send := func(e SymbolEvent) error {
+		if eventType != "" && e.Type != eventType {
+			return nil
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	if _, err := w.Write([]byte(": connected\n\n")); err != nil {
+		return
+	}
+	for _, e := range backlog {
+		if err := send(e); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			err = send(e)
+		case <-heartbeat.C:
+			if _, err = w.Write([]byte(": ping\n\n")); err == nil {
+				err = rc.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
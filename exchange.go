@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// Webhook events for Hyperliquid entering and leaving maintenance
+const (
+	EventMaintenanceStarted = "exchange_maintenance_started"
+	EventMaintenanceEnded   = "exchange_maintenance_ended"
+)
+
+// ExchangeStatus is what Hyperliquid last reported about itself
+type ExchangeStatus struct {
+	Maintenance bool       `json:"maintenance"`
+	Detail      string     `json:"detail,omitempty"` // Special statuses as reported
+	Since       *time.Time `json:"since,omitempty"`  // Start of the current maintenance
+	CheckedAt   time.Time  `json:"checked_at"`
+}
+
+// ExchangeStatusTracker holds the latest exchange status
+type ExchangeStatusTracker struct {
+	mu     sync.RWMutex
+	status ExchangeStatus
+	known  bool
+}
+
+var exchangeStatus = &ExchangeStatusTracker{}
+
+// Set records a polled status, reporting whether maintenance started or ended
+func (t *ExchangeStatusTracker) Set(maintenance bool, detail string) bool {
+	now := time.Now().UTC()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	changed := t.status.Maintenance != maintenance
+	since := t.status.Since
+	if !maintenance {
+		since = nil
+	} else if changed {
+		since = &now
+	}
+	t.status = ExchangeStatus{Maintenance: maintenance, Detail: detail, Since: since, CheckedAt: now}
+	t.known = true
+	return changed
+}
+
+// Get returns the latest status, or false before the first poll
+func (t *ExchangeStatusTracker) Get() (ExchangeStatus, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.status, t.known
+}
+
+// InMaintenance reports whether the exchange last said it's in maintenance
+func (t *ExchangeStatusTracker) InMaintenance() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.status.Maintenance
+}
+
+// FetchExchangeStatus asks Hyperliquid for its status. Normal operation
+// reports specialStatuses as null; anything else counts as maintenance.
+func (c *HyperliquidClient) FetchExchangeStatus() (bool, string, error) {
+	jsonData, err := json.Marshal(map[string]string{"type": "exchangeStatus"})
+	if err != nil {
+		return false, "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	source, baseURL := hyperliquidSources.Primary()
+	start := time.Now()
+	resp, err := c.httpClient.Post(baseURL+hyperliquidInfoPath, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		hyperliquidSources.Record(source, err, 0)
+		requestBudget.Record("exchangeStatus", infoWeight("exchangeStatus", 0), false)
+		upstreams.Record("hyperliquid", err)
+		return false, "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	clockSkew.ObserveResponse(resp, start)
+
+	body, err := io.ReadAll(resp.Body)
+	requestBudget.Record("exchangeStatus", infoWeight("exchangeStatus", 0), resp.StatusCode == http.StatusTooManyRequests)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		hyperliquidSources.Record(source, sourceFailure(resp.StatusCode, nil), time.Since(start))
+		upstreams.Record("hyperliquid", err)
+		return false, "", err
+	}
+	if err != nil {
+		hyperliquidSources.Record(source, err, 0)
+		upstreams.Record("hyperliquid", err)
+		return false, "", fmt.Errorf("failed to read response: %w", err)
+	}
+	hyperliquidSources.Record(source, nil, time.Since(start))
+	upstreams.Record("hyperliquid", nil)
+
+	var status struct {
+		SpecialStatuses json.RawMessage `json:"specialStatuses"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return false, "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	switch string(bytes.TrimSpace(status.SpecialStatuses)) {
+	case "", "null", "[]", "{}":
+		return false, "", nil
+	}
+	var detail bytes.Buffer
+	json.Compact(&detail, status.SpecialStatuses)
+	return true, detail.String(), nil
+}
+
+// ExchangeStatusActor polls the exchange status
+type ExchangeStatusActor struct {
+	hyperliquidClient *HyperliquidClient
+	pollInterval      time.Duration
+}
+
+// NewExchangeStatusActor creates a new exchange status actor
+func NewExchangeStatusActor(hyperliquidClient *HyperliquidClient, pollInterval time.Duration) *ExchangeStatusActor {
+	return &ExchangeStatusActor{
+		hyperliquidClient: hyperliquidClient,
+		pollInterval:      pollInterval,
+	}
+}
+
+func (a *ExchangeStatusActor) Receive(ctx *actor.Context) {
+	switch ctx.Message().(type) {
+	case actor.Started:
+		log.Println("[Exchange] Actor started")
+		a.poll()
+		ctx.SendRepeat(ctx.PID(), PollExchangeStatusMsg{}, a.pollInterval)
+
+	case PollExchangeStatusMsg:
+		a.poll()
+
+	case actor.Stopped:
+		log.Println("[Exchange] Actor stopped")
+	}
+}
+
+func (a *ExchangeStatusActor) poll() {
+	maintenance, detail, err := a.hyperliquidClient.FetchExchangeStatus()
+	if err != nil {
+		// The status endpoint may be down with everything else; keep the last answer
+		log.Printf("[Exchange] ERROR: %v", err)
+		return
+	}
+	if !exchangeStatus.Set(maintenance, detail) {
+		return
+	}
+	if maintenance {
+		metrics.Set("exchange_maintenance", 1)
+		log.Printf("[Exchange] Hyperliquid maintenance started: %s", detail)
+		notifier.Notify(EventMaintenanceStarted, "Hyperliquid maintenance started, fetch failure alerts suppressed: "+detail)
+	} else {
+		metrics.Set("exchange_maintenance", 0)
+		log.Println("[Exchange] Hyperliquid maintenance ended")
+		notifier.Notify(EventMaintenanceEnded, "Hyperliquid maintenance ended")
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultExportLimit = 1000
+	maxExportLimit     = 10000
+)
+
+// exportCursor is the position an export page ends at. It's keyed by candle
+// time rather than index, so pages stay consistent while the cache refreshes.
+type exportCursor struct {
+	Symbol   string `json:"s"`
+	Interval string `json:"i"`
+	After    int64  `json:"a"` // Timestamp of the last candle exported
+}
+
+func (c exportCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeExportCursor(raw string) (exportCursor, error) {
+	var c exportCursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	return c, err
+}
+
+// exportSeries returns the stored series of symbol at interval: the candle
+// cache at CANDLE_INTERVAL, the daily store at 1d, or a symbol override's
+// series
+func exportSeries(symbol, interval string) (CacheEntry, bool, error) {
+	switch {
+	case interval == config.CandleInterval:
+		entry, ok := cache.Get(symbol)
+		return entry, ok, nil
+	case interval == "1d" && dailyStore != nil:
+		entry, ok := dailyStore.Get(symbol)
+		return entry, ok, nil
+	}
+	stored := []string{config.CandleInterval}
+	if dailyStore != nil && config.CandleInterval != "1d" {
+		stored = append(stored, "1d")
+	}
+	if override, ok := symbolOverrides.Separate(symbol); ok {
+		if override.Interval == interval {
+			entry, ok := symbolOverrides.Series(symbol)
+			return entry, ok, nil
+		}
+		stored = append(stored, override.Interval)
+	}
+	return CacheEntry{}, false, fmt.Errorf("%s history is not stored at %s: use %s", symbol, interval, strings.Join(stored, ", "))
+}
+
+// closedCandles returns how many of candles at interval had closed by now:
+// the newest is still open until its interval ends
+func closedCandles(candles CandleSeries, interval string, now time.Time) int {
+	closed := candles.Len()
+	for closed > 0 && candleClose(interval, candles.Timestamp(closed-1)) > now.UnixMilli() {
+		closed--
+	}
+	return closed
+}
+
+// handleExport pages through a symbol's stored history oldest first, for
+// bulk ingestion. Only closed candles are exported, and each page's
+// next_cursor resumes right after it, so following the cursors until
+// has_more is false and polling the last one later picks up each candle once.
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	symbol := cache.CanonicalSymbol(r.PathValue("symbol"))
+	interval := config.CandleInterval
+	if requested := query.Get("interval"); requested != "" {
+		normalized, err := normalizeInterval(requested)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		interval = normalized
+	}
+	limit := defaultExportLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxExportLimit {
+			http.Error(w, fmt.Sprintf("Invalid limit: use 1 to %d", maxExportLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	after := int64(-1)
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := decodeExportCursor(raw)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		if cursor.Symbol != symbol || cursor.Interval != interval {
+			http.Error(w, fmt.Sprintf("Cursor is for %s %s", cursor.Symbol, cursor.Interval), http.StatusBadRequest)
+			return
+		}
+		after = cursor.After
+	}
+
+	entry, exists, err := exportSeries(symbol, interval)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !exists {
+		http.Error(w, "Symbol not found", http.StatusNotFound)
+		return
+	}
+
+	candles := entry.Candles
+	closed := closedCandles(candles, interval, time.Now())
+	start := candles.SearchAfter(after)
+	end := min(start+limit, closed)
+	page := candles.Slice(min(start, end), end)
+
+	// Candles between the cursor and the oldest one stored have left the
+	// window since the previous page
+	truncated := after >= 0 && candles.Len() > 0 && candles.Timestamp(0) > candleClose(interval, after)
+
+	next := exportCursor{Symbol: symbol, Interval: interval, After: after}
+	if n := page.Len(); n > 0 {
+		next.After = page.Timestamp(n - 1)
+	}
+	w.Header().Set("X-Next-Cursor", next.encode())
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := writeJSON(r.Context(), w, map[string]interface{}{
+		"symbol":      symbol,
+		"interval":    interval,
+		"candles":     page,
+		"count":       page.Len(),
+		"next_cursor": next.encode(),
+		"has_more":    end < closed,
+		"truncated":   truncated,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleAdminExport queues an export job writing a symbol's closed candles
+// to EXPORT_DIR in one file: ?symbol=BTC, with ?interval= as on
+// /api/export and ?format=json (the default), csv, ndjson or parquet
+func handleAdminExport(w http.ResponseWriter, r *http.Request) {
+	if config.ExportDir == "" {
+		http.Error(w, "EXPORT_DIR is not set", http.StatusConflict)
+		return
+	}
+	query := r.URL.Query()
+	symbol := cache.CanonicalSymbol(query.Get("symbol"))
+	if symbol == "" {
+		http.Error(w, "symbol is required", http.StatusBadRequest)
+		return
+	}
+	interval := config.CandleInterval
+	if requested := query.Get("interval"); requested != "" {
+		normalized, err := normalizeInterval(requested)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		interval = normalized
+	}
+	format := query.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if _, ok := candleFormats[format]; !ok && format != "json" {
+		http.Error(w, fmt.Sprintf("Format %s is not available here; use one of: json, %s", format, strings.Join(candleFormats.names(), ", ")), http.StatusBadRequest)
+		return
+	}
+	if _, _, err := exportSeries(symbol, interval); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	submitJob(w, r, "export", map[string]string{
+		"symbol":   symbol,
+		"interval": interval,
+		"format":   format,
+		"dir":      config.ExportDir,
+	})
+}
+
+// runExportJob writes params' symbol's closed candles at params' interval to
+// a file in params' dir, named after the symbol, interval and export time
+func runExportJob(params map[string]string) (interface{}, error) {
+	symbol, interval, format := params["symbol"], params["interval"], params["format"]
+	entry, exists, err := exportSeries(symbol, interval)
+	if err != nil {
+		return nil, permanent(err)
+	}
+	if !exists {
+		return nil, permanent(fmt.Errorf("%s is not cached", symbol))
+	}
+	entry.Candles = entry.Candles.Slice(0, closedCandles(entry.Candles, interval, time.Now()))
+
+	if err := os.MkdirAll(params["dir"], 0755); err != nil {
+		return nil, fmt.Errorf("failed to create export dir: %w", err)
+	}
+	// Spot symbols such as PURR/USDC can't be used in a file name as they are
+	name := fmt.Sprintf("%s-%s-%s.%s", strings.ReplaceAll(symbol, "/", "_"), interval, time.Now().UTC().Format("20060102T150405Z"), format)
+	tmp, err := os.CreateTemp(params["dir"], ".export.tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	body, err := json.Marshal(entry)
+	if err == nil {
+		if transcode, ok := candleFormats[format]; ok {
+			err = transcode(tmp, body)
+		} else {
+			_, err = tmp.Write(body)
+		}
+	}
+	if err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write export: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write export: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(params["dir"], name)); err != nil {
+		return nil, fmt.Errorf("failed to store export: %w", err)
+	}
+	log.Printf("[Export] Wrote %d %s %s candles to %s", entry.Candles.Len(), symbol, interval, name)
+	return map[string]interface{}{
+		"file":     name,
+		"url":      "/admin/exports/" + name,
+		"candles":  entry.Candles.Len(),
+		"interval": interval,
+	}, nil
+}
+
+// handleAdminExportFile serves a file written by an export job
+func handleAdminExportFile(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if config.ExportDir == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		http.Error(w, "Export not found", http.StatusNotFound)
+		return
+	}
+	http.ServeFile(w, r, filepath.Join(config.ExportDir, name))
+}
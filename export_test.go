@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExportCursorRoundTrip(t *testing.T) {
+	cursor := exportCursor{Symbol: "BTC", Interval: "1h", After: 1700000000000}
+	decoded, err := decodeExportCursor(cursor.encode())
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded != cursor {
+		t.Errorf("decoded %+v, want %+v", decoded, cursor)
+	}
+
+	for _, raw := range []string{"not base64!", "bm90IGpzb24"} {
+		if _, err := decodeExportCursor(raw); err == nil {
+			t.Errorf("decodeExportCursor(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestClosedCandles(t *testing.T) {
+	jan := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	monthly := NewCandleSeries([]Candle{
+		{Timestamp: jan.AddDate(0, -1, 0).UnixMilli()},
+		{Timestamp: jan.UnixMilli()},
+	})
+	hourly := NewCandleSeries([]Candle{
+		{Timestamp: jan.UnixMilli()},
+		{Timestamp: jan.Add(time.Hour).UnixMilli()},
+	})
+
+	tests := []struct {
+		name     string
+		candles  CandleSeries
+		interval string
+		now      time.Time
+		want     int
+	}{
+		{"hour still open", hourly, "1h", jan.Add(90 * time.Minute), 1},
+		{"hour just closed", hourly, "1h", jan.Add(2 * time.Hour), 2},
+		// January has 31 days, so a fixed 30-day month would close it early
+		{"month open past 30 days", monthly, "1M", jan.AddDate(0, 0, 30).Add(12 * time.Hour), 1},
+		{"month closed at the calendar boundary", monthly, "1M", jan.AddDate(0, 1, 0), 2},
+		{"empty", NewCandleSeries(nil), "1h", jan, 0},
+	}
+	for _, tt := range tests {
+		if got := closedCandles(tt.candles, tt.interval, tt.now); got != tt.want {
+			t.Errorf("%s: closedCandles = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// exportPage requests one export page and decodes it
+func exportPage(t *testing.T, query string) (int, map[string]json.RawMessage) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/export/BTC?"+query, nil)
+	req.SetPathValue("symbol", "BTC")
+	rec := httptest.NewRecorder()
+	handleExport(rec, req)
+	if rec.Code != http.StatusOK {
+		return rec.Code, nil
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode page: %v", err)
+	}
+	return rec.Code, body
+}
+
+func TestExportPaging(t *testing.T) {
+	prevConfig, prevCache := config, cache
+	defer func() { config, cache = prevConfig, prevCache }()
+	config = &Config{CandleInterval: "1h"}
+	cache = NewCache()
+
+	// Ten hourly candles, the last of them still open
+	open := time.Now().Truncate(time.Hour)
+	candles := make([]Candle, 10)
+	for i := range candles {
+		candles[i] = Candle{Timestamp: open.Add(time.Duration(i-9) * time.Hour).UnixMilli(), Close: float64(i)}
+	}
+	cache.Set("BTC", candles)
+
+	var seen []int64
+	query := "limit=4"
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("export never reported has_more=false")
+		}
+		code, page := exportPage(t, query)
+		if code != http.StatusOK {
+			t.Fatalf("page %d: status %d", pages, code)
+		}
+		var got []Candle
+		var cursor string
+		var more bool
+		json.Unmarshal(page["candles"], &got)
+		json.Unmarshal(page["next_cursor"], &cursor)
+		json.Unmarshal(page["has_more"], &more)
+		for _, c := range got {
+			seen = append(seen, c.Timestamp)
+		}
+		query = "limit=4&cursor=" + cursor
+		if !more {
+			break
+		}
+	}
+
+	if len(seen) != 9 {
+		t.Fatalf("exported %d candles, want the 9 closed ones", len(seen))
+	}
+	for i, ts := range seen {
+		if ts != candles[i].Timestamp {
+			t.Errorf("candle %d: timestamp %d, want %d", i, ts, candles[i].Timestamp)
+		}
+	}
+
+	// The last cursor stays valid and has nothing new until a candle closes
+	_, page := exportPage(t, query)
+	var count int
+	json.Unmarshal(page["count"], &count)
+	if count != 0 {
+		t.Errorf("polling the last cursor returned %d candles, want 0", count)
+	}
+
+	other := exportCursor{Symbol: "ETH", Interval: "1h"}
+	if code, _ := exportPage(t, "cursor="+other.encode()); code != http.StatusBadRequest {
+		t.Errorf("another symbol's cursor: status %d, want 400", code)
+	}
+}
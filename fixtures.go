@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fixtureSet is what serve-fixtures loads from its directory
+type fixtureSet struct {
+	entries    map[string]CacheEntry
+	symbols    []string
+	metadata   []SymbolMeta
+	lastUpdate time.Time
+}
+
+// runServeFixtures serves the public API from candle fixtures on disk, with
+// no fetchers and no network access, so frontend CI gets the real response
+// shapes over stable data. The directory may hold:
+//
+//	candles.json       a recorded /api/candles?precision=full response
+//	candles/BTC.json   a recorded /api/candles/BTC response, or a bare array of candles
+//	symbols.json       a recorded /api/symbols?details=true response
+//
+// Without symbols.json the symbol list is every symbol with candles.
+func runServeFixtures(args []string) error {
+	fs := flag.NewFlagSet("serve-fixtures", flag.ContinueOnError)
+	dir := fs.String("dir", "testdata", "fixture directory")
+	addr := fs.String("addr", ":8080", "listen address")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	config = loadConfig()
+	if err := config.normalizeIntervals(); err != nil {
+		return err
+	}
+	// Nothing here fetches or persists, and the health checks mustn't
+	// depend on how long the server has been up
+	config.HealthUpstreamMaxAgeMin = 0
+	config.HealthCacheMaxAgeMin = 0
+	config.SnapshotPath = ""
+	config.DailyStorePath = ""
+	config.AlertsEnabled = false
+	config.AlertsPath = ""
+	config.ReadOnly = true
+
+	var err error
+	if jsonEncoder, err = newJSONEncoder(config.JSONEncoder); err != nil {
+		return err
+	}
+	if exchangeLocation, err = time.LoadLocation(config.ExchangeTimezone); err != nil {
+		return fmt.Errorf("invalid EXCHANGE_TIMEZONE %q: %w", config.ExchangeTimezone, err)
+	}
+	categories = NewCategories(config.SymbolCategories)
+	fetchLatency = NewLatencyTracker(0)
+
+	fixtures, err := loadFixtures(*dir)
+	if err != nil {
+		return err
+	}
+	cache = NewCache()
+	cache.ReplaceAll(fixtures.entries, fixtures.symbols, fixtures.metadata, fixtures.lastUpdate)
+
+	log.Printf("[Fixtures] Serving %d symbols (%d with candles) from %s on %s",
+		len(fixtures.symbols), len(fixtures.entries), *dir, *addr)
+	return http.ListenAndServe(*addr, newAPIMux())
+}
+
+// loadFixtures reads a fixture directory. Update times come from the
+// fixtures themselves, so ETags and last_update fields are stable.
+func loadFixtures(dir string) (fixtureSet, error) {
+	set := fixtureSet{entries: make(map[string]CacheEntry)}
+
+	var recorded map[string]CacheEntry
+	if ok, err := readFixture(filepath.Join(dir, "candles.json"), &recorded); err != nil {
+		return set, err
+	} else if ok {
+		for symbol, entry := range recorded {
+			set.add(symbol, entry)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "candles", "*.json"))
+	if err != nil {
+		return set, err
+	}
+	for _, path := range files {
+		symbol := strings.TrimSuffix(filepath.Base(path), ".json")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return set, err
+		}
+		var entry CacheEntry
+		if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+			err = json.Unmarshal(data, &entry.Candles)
+		} else {
+			err = json.Unmarshal(data, &entry)
+		}
+		if err != nil {
+			return set, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		set.add(symbol, entry)
+	}
+
+	var symbols struct {
+		Symbols []string     `json:"symbols"`
+		Assets  []SymbolMeta `json:"assets"`
+	}
+	if ok, err := readFixture(filepath.Join(dir, "symbols.json"), &symbols); err != nil {
+		return set, err
+	} else if ok {
+		set.symbols = symbols.Symbols
+		set.metadata = symbols.Assets
+	} else {
+		for symbol := range set.entries {
+			set.symbols = append(set.symbols, symbol)
+		}
+		sort.Strings(set.symbols)
+	}
+
+	if len(set.entries) == 0 && len(set.symbols) == 0 {
+		return set, fmt.Errorf("no fixtures in %s: expected candles.json, candles/*.json or symbols.json", dir)
+	}
+	return set, nil
+}
+
+// add stores a fixture entry. Handcrafted entries without an update time
+// are dated by their last candle.
+func (s *fixtureSet) add(symbol string, entry CacheEntry) {
+	entry.Symbol = symbol
+	entry.Stale = false
+	if entry.LastUpdate.IsZero() && entry.Candles.Len() > 0 {
+		entry.LastUpdate = time.UnixMilli(entry.Candles.At(entry.Candles.Len() - 1).Timestamp).UTC()
+	}
+	if entry.LastUpdate.After(s.lastUpdate) {
+		s.lastUpdate = entry.LastUpdate
+	}
+	s.entries[symbol] = entry
+}
+
+// readFixture decodes an optional fixture file, reporting whether it exists
+func readFixture(path string, v interface{}) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return true, nil
+}
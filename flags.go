@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Feature flags gating subsystems that are still being rolled out
+const (
+	FlagTradeStream  = "trade_stream"  // Trade WebSocket and sub-minute candles
+	FlagCandleStream = "candle_stream" // Candle WebSocket updating the in-progress candle
+	FlagDailyRollup  = "daily_rollup"  // Daily history store and its backfill
+	FlagAlerts       = "alerts"        // Price alert evaluation
+	FlagLiveMids     = "live_mids"     // allMids polling and ?live=true
+	FlagPushWebhooks = "push_webhooks" // Cycle push webhooks
+)
+
+// flagSpec describes a flag. Runtime flags can be toggled on the admin port;
+// the others only decide what is started at boot.
+type flagSpec struct {
+	Default     bool
+	Runtime     bool
+	Description string
+}
+
+var flagSpecs = map[string]flagSpec{
+	FlagTradeStream:  {Default: true, Description: "Trade WebSocket feeding sub-minute candles (TRADE_CANDLE_SYMBOLS)"},
+	FlagCandleStream: {Default: true, Runtime: true, Description: "Candle WebSocket updating the in-progress candle between fetch cycles (CANDLE_STREAM_ENABLED)"},
+	FlagDailyRollup:  {Default: true, Description: "Daily history store and backfill (DAILY_ROLLUP_ENABLED)"},
+	FlagAlerts:       {Default: true, Runtime: true, Description: "Price alert evaluation (ALERTS_ENABLED)"},
+	FlagLiveMids:     {Default: true, Runtime: true, Description: "allMids polling and ?live=true candles (MIDS_POLL_SEC)"},
+	FlagPushWebhooks: {Default: true, Runtime: true, Description: "Push webhooks after each fetch cycle"},
+}
+
+// FeatureFlag is a flag's current state
+type FeatureFlag struct {
+	Name        string `json:"name"`
+	Enabled     bool   `json:"enabled"`
+	Runtime     bool   `json:"runtime"` // Can be toggled without a restart
+	Source      string `json:"source"`  // default, file, env or runtime
+	Description string `json:"description"`
+}
+
+// FeatureFlags holds the state of every flag. Flags only narrow what the
+// subsystem's own settings enable: a subsystem that isn't configured stays
+// off whatever its flag says.
+type FeatureFlags struct {
+	mu      sync.RWMutex
+	enabled map[string]bool
+	source  map[string]string
+}
+
+// features starts at the defaults so code running before main loads the
+// flags sees them
+var features = NewFeatureFlags()
+
+// NewFeatureFlags creates flags at their defaults
+func NewFeatureFlags() *FeatureFlags {
+	f := &FeatureFlags{
+		enabled: make(map[string]bool, len(flagSpecs)),
+		source:  make(map[string]string, len(flagSpecs)),
+	}
+	for name, spec := range flagSpecs {
+		f.enabled[name] = spec.Default
+		f.source[name] = "default"
+	}
+	return f
+}
+
+// LoadFeatureFlags applies path, a JSON object of flag names to booleans,
+// then overrides, a comma-separated list of name=on|off
+func LoadFeatureFlags(path, overrides string) (*FeatureFlags, error) {
+	f := NewFeatureFlags()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read feature flags: %w", err)
+		}
+		var values map[string]bool
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("failed to parse feature flags %s: %w", path, err)
+		}
+		for name, enabled := range values {
+			if err := f.apply(name, enabled, "file"); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+	for _, item := range strings.Split(overrides, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, raw, ok := strings.Cut(item, "=")
+		enabled, err := parseFlagValue(raw)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid feature flag %q: use name=on or name=off", item)
+		}
+		if err := f.apply(strings.TrimSpace(name), enabled, "env"); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func parseFlagValue(raw string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return strconv.ParseBool(strings.TrimSpace(raw))
+}
+
+// sortedKeys returns m's keys in order, e.g. to list known names
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *FeatureFlags) apply(name string, enabled bool, source string) error {
+	if _, ok := flagSpecs[name]; !ok {
+		return fmt.Errorf("unknown feature flag %q (known: %s)", name, strings.Join(sortedKeys(flagSpecs), ", "))
+	}
+	f.enabled[name] = enabled
+	f.source[name] = source
+	return nil
+}
+
+// Enabled reports whether a flag is on
+func (f *FeatureFlags) Enabled(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.enabled[name]
+}
+
+// Set toggles a runtime flag. Toggles aren't persisted: a restart goes back
+// to the file and environment.
+func (f *FeatureFlags) Set(name string, enabled bool) error {
+	spec, ok := flagSpecs[name]
+	if !ok {
+		return fmt.Errorf("unknown feature flag %q", name)
+	}
+	if !spec.Runtime {
+		return fmt.Errorf("%s only applies at startup: set it in FEATURE_FLAGS and restart", name)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.enabled[name] = enabled
+	f.source[name] = "runtime"
+	f.publishLocked()
+	return nil
+}
+
+// List returns every flag by name
+func (f *FeatureFlags) List() []FeatureFlag {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	flags := make([]FeatureFlag, 0, len(flagSpecs))
+	for _, name := range sortedKeys(flagSpecs) {
+		spec := flagSpecs[name]
+		flags = append(flags, FeatureFlag{
+			Name:        name,
+			Enabled:     f.enabled[name],
+			Runtime:     spec.Runtime,
+			Source:      f.source[name],
+			Description: spec.Description,
+		})
+	}
+	return flags
+}
+
+// publish exports the flags as the feature_flag_enabled gauge
+func (f *FeatureFlags) publish() {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	f.publishLocked()
+}
+
+func (f *FeatureFlags) publishLocked() {
+	for name, enabled := range f.enabled {
+		value := 0.0
+		if enabled {
+			value = 1
+		}
+		metrics.Set("feature_flag_enabled", value, "flag", name)
+	}
+}
+
+// handleAdminFlags lists the feature flags, or toggles a runtime flag with
+// POST ?name=alerts&enabled=false
+func handleAdminFlags(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		name := r.URL.Query().Get("name")
+		enabled, err := parseFlagValue(r.URL.Query().Get("enabled"))
+		if err != nil {
+			http.Error(w, "Invalid enabled: use true or false", http.StatusBadRequest)
+			return
+		}
+		if err := features.Set(name, enabled); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[Flags] %s set to %v at runtime", name, enabled)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(features.List()); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
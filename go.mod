@@ -1,12 +1,29 @@
 module hyperliquid-backend
 
-go 1.21
+go 1.22
 
-require github.com/anthdm/hollywood v1.0.4
+require (
+	github.com/anthdm/hollywood v1.0.4
+	github.com/bytedance/sonic v1.15.0
+	github.com/eclipse/paho.mqtt.golang v1.4.3
+	github.com/gorilla/websocket v1.5.3
+	github.com/json-iterator/go v1.1.12
+	golang.org/x/net v0.25.0
+	golang.org/x/sync v0.8.0
+)
 
 require (
 	github.com/DataDog/gostackparse v0.7.0 // indirect
-	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
+	github.com/bytedance/gopkg v0.1.3 // indirect
+	github.com/bytedance/sonic/loader v0.5.0 // indirect
+	github.com/cloudwego/base64x v0.1.6 // indirect
+	github.com/klauspost/cpuid/v2 v2.2.9 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/zeebo/xxh3 v1.0.2 // indirect
+	golang.org/x/arch v0.0.0-20210923205945-b76863e36670 // indirect
+	golang.org/x/sys v0.22.0 // indirect
+	golang.org/x/text v0.15.0 // indirect
 	google.golang.org/protobuf v1.32.0 // indirect
 )
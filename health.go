@@ -0,0 +1,211 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// Health statuses, from best to worst
+const (
+	HealthHealthy   = "healthy"
+	HealthStale     = "stale"
+	HealthDegraded  = "degraded"
+	HealthUnhealthy = "unhealthy"
+)
+
+// startTime anchors checks that need a grace period after startup
+var startTime = time.Now()
+
+var healthSeverity = map[string]int{
+	HealthHealthy:   0,
+	HealthStale:     1,
+	HealthDegraded:  2,
+	HealthUnhealthy: 3,
+}
+
+// UpstreamStatus is the latest outcome of calls to one upstream API
+type UpstreamStatus struct {
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// UpstreamTracker records the last success and error per upstream
+type UpstreamTracker struct {
+	mu       sync.RWMutex
+	statuses map[string]UpstreamStatus
+}
+
+var upstreams = &UpstreamTracker{statuses: make(map[string]UpstreamStatus)}
+
+// Record stores the outcome of one upstream call; a nil err is a success
+func (t *UpstreamTracker) Record(name string, err error) {
+	now := time.Now().UTC()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := t.statuses[name]
+	if err == nil {
+		status.LastSuccess = &now
+	} else {
+		status.LastError = err.Error()
+		status.LastErrorAt = &now
+	}
+	t.statuses[name] = status
+}
+
+// Snapshot returns a copy of all upstream statuses
+func (t *UpstreamTracker) Snapshot() map[string]UpstreamStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	result := make(map[string]UpstreamStatus, len(t.statuses))
+	for name, status := range t.statuses {
+		result[name] = status
+	}
+	return result
+}
+
+// HealthCheck is the result of one dependency check
+type HealthCheck struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// HealthRules holds the thresholds used to compute the overall status
+type HealthRules struct {
+	UpstreamMaxAge time.Duration // No upstream success for this long is unhealthy
+	CacheMaxAge    time.Duration // No cache update for this long is degraded
+}
+
+// checkUpstream rates an upstream: erroring more recently than it succeeded
+// is degraded, no success within maxAge (after startup) is unhealthy
+func checkUpstream(status UpstreamStatus, maxAge time.Duration, started time.Time) HealthCheck {
+	now := time.Now()
+	if maxAge > 0 && now.Sub(started) > maxAge && (status.LastSuccess == nil || now.Sub(*status.LastSuccess) > maxAge) {
+		return HealthCheck{Status: HealthUnhealthy, Detail: "no successful call within " + maxAge.String()}
+	}
+	if status.LastErrorAt != nil && (status.LastSuccess == nil || status.LastErrorAt.After(*status.LastSuccess)) {
+		return HealthCheck{Status: HealthDegraded, Detail: status.LastError}
+	}
+	return HealthCheck{Status: HealthHealthy}
+}
+
+// checkStorage verifies that a store's file can be written. Stores create
+// missing directories on save, so the nearest existing ancestor is probed.
+func checkStorage(path string) HealthCheck {
+	dir := filepath.Dir(path)
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	f, err := os.CreateTemp(dir, ".healthcheck-*")
+	if err != nil {
+		return HealthCheck{Status: HealthUnhealthy, Detail: err.Error()}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return HealthCheck{Status: HealthHealthy}
+}
+
+// checkActor reports whether an actor is still registered with the engine
+// and, for watched actors, whether its heartbeat is current
+func checkActor(pid *actor.PID) HealthCheck {
+	kind, id, _ := strings.Cut(pid.ID, "/")
+	if engine.Registry.GetPID(kind, id) == nil {
+		return HealthCheck{Status: HealthUnhealthy, Detail: "not running"}
+	}
+	if check, ok := watchdog.Check(pid); ok {
+		return check
+	}
+	return HealthCheck{Status: HealthHealthy}
+}
+
+// worseStatus returns the more severe of two statuses
+func worseStatus(a, b string) string {
+	if healthSeverity[b] > healthSeverity[a] {
+		return b
+	}
+	return a
+}
+
+// evaluateHealth runs the dependency checks and folds them, together with
+// cache staleness, into the overall status
+func evaluateHealth(health *HealthResponse, rules HealthRules) {
+	health.Status = HealthHealthy
+	if health.StaleCount > 0 {
+		health.Status = HealthStale
+	}
+	health.Checks = make(map[string]HealthCheck)
+
+	// Snapshot readers and followers never call upstream; the cache check covers them
+	health.Upstreams = upstreams.Snapshot()
+	if !config.MirrorsCache() {
+		health.Checks["upstream:hyperliquid"] = checkUpstream(health.Upstreams["hyperliquid"], rules.UpstreamMaxAge, startTime)
+	}
+
+	if skew, ok := clockSkew.Skew(); ok {
+		check := HealthCheck{Status: HealthHealthy, Detail: "local clock " + skewDirection(skew) + " Hyperliquid by " + skew.Abs().Round(time.Millisecond).String()}
+		if clockSkew.Exceeded() {
+			check.Status = HealthDegraded
+		}
+		health.Checks["clock"] = check
+	}
+
+	if rules.CacheMaxAge > 0 && time.Since(startTime) > rules.CacheMaxAge {
+		check := HealthCheck{Status: HealthHealthy}
+		if time.Since(health.LastUpdate) > rules.CacheMaxAge {
+			check = HealthCheck{Status: HealthDegraded, Detail: "no cache update within " + rules.CacheMaxAge.String()}
+		}
+		health.Checks["cache"] = check
+	}
+
+	for name, path := range map[string]string{
+		"storage:snapshot": config.SnapshotPath,
+		"storage:daily":    config.DailyStorePath,
+		"storage:alerts":   config.AlertsPath,
+	} {
+		if path != "" {
+			health.Checks[name] = checkStorage(path)
+		}
+	}
+
+	for name, pid := range map[string]*actor.PID{
+		"actor:symbolFetcher":  loadPID(&symbolFetcherPID),
+		"actor:candleFetcher":  loadPID(&candleFetcherPID),
+		"actor:dailyRollup":    loadPID(&dailyRollupPID),
+		"actor:tradeCandles":   tradeCandlePID,
+		"actor:alerts":         alertPID,
+		"actor:sharedSnapshot": loadPID(&sharedSnapshotPID),
+	} {
+		if pid != nil {
+			health.Checks[name] = checkActor(pid)
+		}
+	}
+	for _, p := range pipelines {
+		health.Checks["actor:pipeline:"+p.Name] = checkActor(p.candlesPID)
+	}
+
+	// Upstream errors and an aging cache are expected during maintenance
+	if health.Exchange != nil && health.Exchange.Maintenance {
+		detail := "expected during exchange maintenance"
+		for _, name := range []string{"upstream:hyperliquid", "cache"} {
+			if check, ok := health.Checks[name]; ok && healthSeverity[check.Status] > healthSeverity[HealthStale] {
+				health.Checks[name] = HealthCheck{Status: HealthStale, Detail: detail + ": " + check.Detail}
+			}
+		}
+		health.Checks["exchange"] = HealthCheck{Status: HealthStale, Detail: "maintenance: " + health.Exchange.Detail}
+	}
+
+	for _, check := range health.Checks {
+		health.Status = worseStatus(health.Status, check.Status)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// heatmapWindows are the supported change windows for /api/heatmap
+var heatmapWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
+// HeatmapCell is one symbol tile in the heat map
+type HeatmapCell struct {
+	Symbol    string  `json:"symbol"`
+	Change    float64 `json:"change"`     // Percent over the window
+	VolumeUSD float64 `json:"volume_usd"` // Notional volume over the window
+}
+
+// HeatmapCategory groups cells for the treemap's top level
+type HeatmapCategory struct {
+	Category  string        `json:"category"`
+	VolumeUSD float64       `json:"volume_usd"`
+	Symbols   []HeatmapCell `json:"symbols"`
+	rounded   bool          // Whether every cell's volume was rounded
+	decimals  int           // Most decimals among the cells' volumes
+}
+
+// buildHeatmap computes change and notional volume per symbol over window,
+// bucketed by category and ordered by volume. Notional volumes are rounded
+// to the decimals of price times size unless full is set.
+func buildHeatmap(all map[string]CacheEntry, window time.Duration, categories *Categories, full bool) []HeatmapCategory {
+	byCategory := make(map[string]*HeatmapCategory)
+
+	for symbol, entry := range all {
+		candles := entry.Candles
+		n := candles.Len()
+		if n == 0 {
+			continue
+		}
+		change := percentChange(candles, window)
+		if change == nil {
+			continue
+		}
+
+		start := candles.SearchAfter(candles.Timestamp(n-1) - window.Milliseconds())
+		cell := HeatmapCell{Symbol: symbol, Change: *change}
+		// Notional is a product of two decimals, so it isn't summed in ticks
+		volumes := candles.Volumes[start:]
+		for i, close := range candles.Closes[start:] {
+			cell.VolumeUSD += volumes[i] * close
+		}
+		p, round := cache.Precision(symbol)
+		round = round && !full
+		if round {
+			cell.VolumeUSD = roundTo(cell.VolumeUSD, p.Price+p.Size)
+		}
+
+		category := categories.Of(symbol)
+		group, ok := byCategory[category]
+		if !ok {
+			group = &HeatmapCategory{Category: category, rounded: true}
+			byCategory[category] = group
+		}
+		group.Symbols = append(group.Symbols, cell)
+		group.VolumeUSD += cell.VolumeUSD
+		group.rounded = group.rounded && round
+		group.decimals = max(group.decimals, p.Price+p.Size)
+	}
+
+	result := make([]HeatmapCategory, 0, len(byCategory))
+	for _, group := range byCategory {
+		if group.rounded {
+			group.VolumeUSD = roundTo(group.VolumeUSD, group.decimals)
+		}
+		sort.Slice(group.Symbols, func(i, j int) bool { return group.Symbols[i].VolumeUSD > group.Symbols[j].VolumeUSD })
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].VolumeUSD > result[j].VolumeUSD })
+	return result
+}
+
+func handleGetHeatmap(w http.ResponseWriter, r *http.Request) {
+	windowName := r.URL.Query().Get("window")
+	if windowName == "" {
+		windowName = "24h"
+	}
+	window, ok := heatmapWindows[windowName]
+	if !ok {
+		http.Error(w, "Invalid window: use 1h, 24h or 7d", http.StatusBadRequest)
+		return
+	}
+
+	setOmittedHeader(w, cache)
+	if setETag(w, r, generateETag(cache.GetLastUpdate())) {
+		return
+	}
+
+	groups := buildHeatmap(cache.GetAll(), window, categories, r.URL.Query().Get("precision") == "full")
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := writeJSON(r.Context(), w, map[string]interface{}{
+		"window":     windowName,
+		"categories": groups,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// Archive file names are their save time, so listing the directory is enough
+// to find the snapshot in effect at a given time
+const snapshotArchiveLayout = "20060102T150405Z"
+
+// snapshotHistoryDir is where snapshots of the cache are archived, next to
+// SNAPSHOT_PATH
+func snapshotHistoryDir(snapshotPath string) string {
+	return snapshotPath + ".history"
+}
+
+// snapshotHistoryEnabled reports whether /asof has archives to serve
+func snapshotHistoryEnabled() bool {
+	return config.SnapshotPath != "" && (config.SnapshotHistoryIntervalMin > 0 || config.Schedules[TaskArchive] != "")
+}
+
+// archiveSnapshot writes the cache to dir as a gzipped snapshot named after
+// its save time
+func archiveSnapshot(dir string, c *Cache) (string, error) {
+	snapshot := c.Snapshot()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create snapshot history dir: %w", err)
+	}
+	path := filepath.Join(dir, snapshot.SavedAt.UTC().Format(snapshotArchiveLayout)+".json.gz")
+
+	tmp, err := os.CreateTemp(dir, ".archive.tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	gz := gzip.NewWriter(tmp)
+	if err := json.NewEncoder(gz).Encode(snapshot); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to compress snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to store snapshot: %w", err)
+	}
+	return path, nil
+}
+
+// snapshotArchive is one archived snapshot on disk
+type snapshotArchive struct {
+	Path    string
+	SavedAt time.Time
+}
+
+// listSnapshotArchives returns the archives in dir, oldest first. Files
+// that aren't archives are ignored.
+func listSnapshotArchives(dir string) ([]snapshotArchive, error) {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var archives []snapshotArchive
+	for _, f := range files {
+		name, ok := strings.CutSuffix(f.Name(), ".json.gz")
+		if !ok || f.IsDir() {
+			continue
+		}
+		savedAt, err := time.Parse(snapshotArchiveLayout, name)
+		if err != nil {
+			continue
+		}
+		archives = append(archives, snapshotArchive{Path: filepath.Join(dir, f.Name()), SavedAt: savedAt})
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].SavedAt.Before(archives[j].SavedAt) })
+	return archives, nil
+}
+
+// pruneSnapshotArchives deletes archives saved before cutoff
+func pruneSnapshotArchives(dir string, cutoff time.Time) int {
+	archives, err := listSnapshotArchives(dir)
+	if err != nil {
+		log.Printf("[History] ERROR: Failed to list snapshot archives: %v", err)
+		errorTrace.Record(SubsystemStorage, "prune", err)
+		return 0
+	}
+	removed := 0
+	for _, a := range archives {
+		if !a.SavedAt.Before(cutoff) {
+			break
+		}
+		if err := os.Remove(a.Path); err != nil {
+			log.Printf("[History] ERROR: Failed to remove %s: %v", a.Path, err)
+			errorTrace.Record(SubsystemStorage, "prune", err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
+
+// readArchivedEntries decodes every entry of an archive, keyed by upper
+// case symbol so lookups ignore case
+func readArchivedEntries(path string) (map[string]CacheEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", filepath.Base(path), err)
+	}
+	defer gz.Close()
+
+	var snapshot struct {
+		Entries map[string]CacheEntry `json:"entries"`
+	}
+	if err := json.NewDecoder(gz).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", filepath.Base(path), err)
+	}
+	entries := make(map[string]CacheEntry, len(snapshot.Entries))
+	for symbol, entry := range snapshot.Entries {
+		entries[strings.ToUpper(symbol)] = entry
+	}
+	return entries, nil
+}
+
+// archivesKeptDecoded is how many archives /asof keeps decoded in memory.
+// Each holds a whole cache, so only the most recently read are kept.
+const archivesKeptDecoded = 2
+
+// archiveIndex serves /asof lookups without listing the history directory
+// and gunzipping a whole archive on every request: the listing is reused
+// until the directory changes, and the last archives read stay decoded.
+// Loads run one at a time, so a burst of requests decodes each archive once.
+type archiveIndex struct {
+	mu       sync.Mutex
+	dir      string
+	modTime  time.Time
+	archives []snapshotArchive
+	decoded  []decodedArchive // Most recently used last
+}
+
+type decodedArchive struct {
+	path    string
+	entries map[string]CacheEntry
+}
+
+var asOfArchives = &archiveIndex{}
+
+// list returns dir's archives, oldest first
+func (x *archiveIndex) list(dir string) ([]snapshotArchive, error) {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.dir == dir && info.ModTime().Equal(x.modTime) {
+		return x.archives, nil
+	}
+	archives, err := listSnapshotArchives(dir)
+	if err != nil {
+		return nil, err
+	}
+	x.dir, x.modTime, x.archives = dir, info.ModTime(), archives
+	return archives, nil
+}
+
+// entry returns symbol's entry in the archive at path
+func (x *archiveIndex) entry(path, symbol string) (CacheEntry, bool, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for i, d := range x.decoded {
+		if d.path == path {
+			// Move to the most recently used end
+			x.decoded = append(append(x.decoded[:i:i], x.decoded[i+1:]...), d)
+			entry, ok := d.entries[strings.ToUpper(symbol)]
+			return entry, ok, nil
+		}
+	}
+
+	entries, err := readArchivedEntries(path)
+	if err != nil {
+		return CacheEntry{}, false, err
+	}
+	metrics.Inc("snapshot_archive_loads_total")
+	x.decoded = append(x.decoded, decodedArchive{path: path, entries: entries})
+	if len(x.decoded) > archivesKeptDecoded {
+		x.decoded = x.decoded[len(x.decoded)-archivesKeptDecoded:]
+	}
+	entry, ok := entries[strings.ToUpper(symbol)]
+	return entry, ok, nil
+}
+
+// CandleRevision is a candle whose values differ between two points in time
+type CandleRevision struct {
+	Timestamp int64   `json:"timestamp"`
+	Then      *Candle `json:"then,omitempty"`
+	Now       *Candle `json:"now,omitempty"`
+}
+
+// SeriesDiff summarises how a series changed since an archived snapshot.
+// Added and removed candles are mostly the lookback window moving forward;
+// revised ones are candles Hyperliquid (or the cache) changed after the fact.
+// The archived series' last candle was usually still open, so its close
+// differing is expected.
+type SeriesDiff struct {
+	Added     int              `json:"added"`
+	Removed   int              `json:"removed"`
+	Revised   int              `json:"revised"`
+	Revisions []CandleRevision `json:"revisions,omitempty"`
+}
+
+// diffAsOf compares an archived series with the current one
+func diffAsOf(then, now CandleSeries) SeriesDiff {
+	var d SeriesDiff
+	nowAt := make(map[int64]Candle, now.Len())
+	for i := 0; i < now.Len(); i++ {
+		c := now.At(i)
+		nowAt[c.Timestamp] = c
+	}
+	for i := 0; i < then.Len(); i++ {
+		c := then.At(i)
+		n, ok := nowAt[c.Timestamp]
+		delete(nowAt, c.Timestamp)
+		switch {
+		case !ok:
+			d.Removed++
+		case !candlesEqual(c, n):
+			d.Revised++
+			if len(d.Revisions) < maxVerifyExamples {
+				d.Revisions = append(d.Revisions, CandleRevision{Timestamp: c.Timestamp, Then: &c, Now: &n})
+			}
+		}
+	}
+	d.Added = len(nowAt)
+	return d
+}
+
+// parseAsOf accepts a Unix timestamp in milliseconds or an RFC3339 time
+func parseAsOf(raw string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("Invalid ts: use Unix milliseconds or RFC3339")
+}
+
+// handleGetCandlesAsOf serves symbol's series from the newest archived
+// snapshot saved at or before ?ts=. ?diff=true adds what has changed since.
+func handleGetCandlesAsOf(w http.ResponseWriter, r *http.Request) {
+	symbol := r.PathValue("symbol")
+	if !snapshotHistoryEnabled() {
+		http.Error(w, "Snapshot history is disabled: set SNAPSHOT_PATH and SNAPSHOT_HISTORY_INTERVAL_MINUTES", http.StatusNotFound)
+		return
+	}
+	raw := r.URL.Query().Get("ts")
+	if raw == "" {
+		http.Error(w, "ts required", http.StatusBadRequest)
+		return
+	}
+	ts, err := parseAsOf(raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	withDiff := r.URL.Query().Get("diff") == "true"
+
+	archives, err := asOfArchives.list(snapshotHistoryDir(config.SnapshotPath))
+	if err != nil {
+		log.Printf("[History] ERROR: Failed to list snapshot archives: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	i := sort.Search(len(archives), func(i int) bool { return archives[i].SavedAt.After(ts) }) - 1
+	if i < 0 {
+		msg := "No snapshot archived yet"
+		if len(archives) > 0 {
+			msg = fmt.Sprintf("No snapshot at or before ts: the oldest is from %s", archives[0].SavedAt.Format(time.RFC3339))
+		}
+		http.Error(w, msg, http.StatusNotFound)
+		return
+	}
+	archive := archives[i]
+
+	current, _ := cache.Get(cache.CanonicalSymbol(symbol))
+	etagTime := archive.SavedAt
+	if withDiff && current.LastUpdate.After(etagTime) {
+		etagTime = current.LastUpdate
+	}
+	if setETag(w, r, generateETag(etagTime)) {
+		return
+	}
+
+	entry, ok, err := asOfArchives.entry(archive.Path, symbol)
+	if err != nil {
+		log.Printf("[History] ERROR: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Symbol not in the snapshot at ts", http.StatusNotFound)
+		return
+	}
+
+	response := struct {
+		CacheEntry
+		AsOf       time.Time   `json:"as_of"`
+		SnapshotAt time.Time   `json:"snapshot_at"`
+		Diff       *SeriesDiff `json:"diff,omitempty"`
+	}{AsOf: ts.UTC(), SnapshotAt: archive.SavedAt}
+	if withDiff {
+		diff := diffAsOf(entry.Candles, current.Candles)
+		response.Diff = &diff
+	}
+	applyPrecision(&entry, r.URL.Query())
+	response.CacheEntry = entry
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// SnapshotHistoryActor archives the cache periodically so /asof can serve
+// past versions of a series, and deletes archives older than keep
+type SnapshotHistoryActor struct {
+	cache    *Cache
+	dir      string
+	interval time.Duration
+	keep     time.Duration
+}
+
+// NewSnapshotHistoryActor creates a new snapshot history actor
+func NewSnapshotHistoryActor(cache *Cache, dir string, interval, keep time.Duration) *SnapshotHistoryActor {
+	return &SnapshotHistoryActor{cache: cache, dir: dir, interval: interval, keep: keep}
+}
+
+func (a *SnapshotHistoryActor) Receive(ctx *actor.Context) {
+	switch ctx.Message().(type) {
+	case actor.Started:
+		log.Printf("[History] Actor started, archiving to %s", a.dir)
+		scheduler.Add(TaskArchive, a.interval, ctx.PID(), ArchiveSnapshotMsg{})
+		if a.keep > 0 {
+			// Without an archive interval, prune hourly unless scheduled
+			prune := a.interval
+			if prune <= 0 {
+				prune = time.Hour
+			}
+			scheduler.Add(TaskPrune, prune, ctx.PID(), PruneSnapshotsMsg{})
+		}
+
+	case ArchiveSnapshotMsg:
+		// Nothing worth keeping until the first cycle has filled the cache
+		if a.cache.GetLastUpdate().IsZero() {
+			return
+		}
+		// Queued as a job so a failed archive is retried and shows on /admin/jobs
+		if _, _, err := jobQueue.Submit("archive", map[string]string{"dir": a.dir}, ""); err != nil {
+			log.Printf("[History] ERROR: %v", err)
+		}
+
+	case PruneSnapshotsMsg:
+		if removed := pruneSnapshotArchives(a.dir, time.Now().Add(-a.keep)); removed > 0 {
+			log.Printf("[History] Removed %d archives older than %v", removed, a.keep)
+		}
+
+	case actor.Stopped:
+		scheduler.Remove(TaskArchive, ctx.PID())
+		scheduler.Remove(TaskPrune, ctx.PID())
+		log.Println("[History] Actor stopped")
+	}
+}
+
+// runArchiveJob archives the cache to params' dir. Expired archives are
+// deleted by the prune task.
+func runArchiveJob(params map[string]string) (interface{}, error) {
+	start := time.Now()
+	path, err := archiveSnapshot(params["dir"], cache)
+	if err != nil {
+		metrics.Inc("snapshot_archive_errors_total")
+		errorTrace.Record(SubsystemStorage, "archive", err)
+		return nil, err
+	}
+	log.Printf("[History] Archived %s in %v", filepath.Base(path), time.Since(start).Round(time.Millisecond))
+	return map[string]interface{}{"archive": filepath.Base(path)}, nil
+}
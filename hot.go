@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Shared header values for pre-rendered responses, so serving one doesn't
+// allocate header slices. net/http never modifies them.
+var (
+	hotContentType  = []string{"application/json"}
+	hotCacheControl = []string{"no-cache"}
+	hotGzip         = []string{"gzip"}
+	hotVary         = []string{"Accept-Encoding"}
+)
+
+// hotBlob is a fully rendered response: the JSON body, its gzipped form and
+// the header values that go with them
+type hotBlob struct {
+	body          []byte
+	gzipped       []byte
+	etag          []string
+	contentLength []string
+	gzipLength    []string
+}
+
+func newHotBlob(body []byte) *hotBlob {
+	blob := &hotBlob{
+		body:          body,
+		etag:          []string{contentETag(body)},
+		contentLength: []string{strconv.Itoa(len(body))},
+	}
+	if len(body) >= gzipMinSize {
+		var buf bytes.Buffer
+		gz := getGzipWriter(gzip.BestSpeed)
+		gz.Reset(&buf)
+		gz.Write(body)
+		gz.Close()
+		putGzipWriter(gzip.BestSpeed, gz)
+		blob.gzipped = buf.Bytes()
+		blob.gzipLength = []string{strconv.Itoa(len(blob.gzipped))}
+	}
+	return blob
+}
+
+// hotResponses keeps pre-rendered bodies for the smallest, most requested
+// endpoints: the newest candle and the latest close of every symbol. A cache
+// write only re-renders the written symbol's fragments; the bodies are
+// assembled from them on the first request after a change and swapped in
+// atomically, so other requests only copy bytes.
+type hotResponses struct {
+	mu        sync.Mutex
+	symbols   []string // Sorted, matching how encoding/json writes a map
+	fragments map[string]hotFragment
+	precision map[string]Precision
+	rounded   hotBodies
+	full      hotBodies // For ?precision=full, assembled only once asked for
+}
+
+// hotBodies is one rendering of the two bodies
+type hotBodies struct {
+	dirty  atomic.Bool // Fragments changed since the bodies were assembled
+	latest atomic.Pointer[hotBlob]
+	mids   atomic.Pointer[hotBlob]
+}
+
+// hotFragment is one symbol's rendered members of the two bodies
+type hotFragment struct {
+	latest []byte // "BTC":{...candle...}
+	mids   []byte // "BTC":12.5
+	// Unrounded members, only set when rounding changed the candle
+	latestFull, midsFull []byte
+}
+
+func newHotResponses() *hotResponses {
+	h := &hotResponses{fragments: make(map[string]hotFragment)}
+	h.renderLocked(&h.rounded, false)
+	h.renderLocked(&h.full, true)
+	return h
+}
+
+// update records symbol's newest candle, or its removal when series is empty
+func (h *hotResponses) update(symbol string, series CandleSeries) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.setLocked(symbol, series)
+}
+
+// updateAll records the newest candle of several symbols under one lock
+func (h *hotResponses) updateAll(series map[string]CandleSeries) {
+	if len(series) == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for symbol, s := range series {
+		h.setLocked(symbol, s)
+	}
+}
+
+// replace rebuilds the fragments from a whole set of entries, rounding to
+// precision (nil keeps full precision)
+func (h *hotResponses) replace(entries map[string]CacheEntry, precision map[string]Precision) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.precision = precision
+	h.symbols = h.symbols[:0]
+	h.fragments = make(map[string]hotFragment, len(entries))
+	for symbol, entry := range entries {
+		h.setLocked(symbol, entry.Candles)
+	}
+	h.changedLocked()
+}
+
+// changedLocked marks both renderings for reassembly. Callers must hold h.mu.
+func (h *hotResponses) changedLocked() {
+	h.rounded.dirty.Store(true)
+	h.full.dirty.Store(true)
+}
+
+func (h *hotResponses) setLocked(symbol string, series CandleSeries) {
+	i, found := slices.BinarySearch(h.symbols, symbol)
+	n := series.Len()
+	if n == 0 {
+		if found {
+			h.symbols = slices.Delete(h.symbols, i, i+1)
+			delete(h.fragments, symbol)
+			h.changedLocked()
+		}
+		return
+	}
+
+	key, _ := json.Marshal(symbol)
+	full := series.At(n - 1)
+	candle := full
+	if p, ok := h.precision[symbol]; ok {
+		candle = full.Rounded(p)
+	}
+	var fragment hotFragment
+	var err error
+	if fragment.latest, fragment.mids, err = renderHotMembers(key, candle); err != nil {
+		log.Printf("[Cache] WARNING: Not rendering latest candle of %s: %v", symbol, err)
+		return
+	}
+	if candle != full {
+		if fragment.latestFull, fragment.midsFull, err = renderHotMembers(key, full); err != nil {
+			log.Printf("[Cache] WARNING: Not rendering latest candle of %s: %v", symbol, err)
+			return
+		}
+	}
+	if !found {
+		h.symbols = slices.Insert(h.symbols, i, symbol)
+	}
+	h.fragments[symbol] = fragment
+	h.changedLocked()
+}
+
+// renderHotMembers renders candle as the members keyed by key of the latest
+// and mids bodies
+func renderHotMembers(key []byte, candle Candle) (latest, mids []byte, err error) {
+	if latest, err = appendCandleJSON(append(append([]byte{}, key...), ':'), candle); err != nil {
+		return nil, nil, err
+	}
+	if mids, err = appendJSONFloat(append(append([]byte{}, key...), ':'), candle.Close); err != nil {
+		return nil, nil, err
+	}
+	return latest, mids, nil
+}
+
+// blobs returns the current bodies, at full precision when full is set,
+// assembling them first when a write changed the fragments
+func (h *hotResponses) blobs(full bool) (latest, mids *hotBlob) {
+	bodies := &h.rounded
+	if full {
+		bodies = &h.full
+	}
+	if bodies.dirty.Load() {
+		h.mu.Lock()
+		if bodies.dirty.Load() {
+			h.renderLocked(bodies, full)
+		}
+		h.mu.Unlock()
+	}
+	return bodies.latest.Load(), bodies.mids.Load()
+}
+
+// renderLocked assembles bodies from the fragments, unrounded when full is
+// set. Callers must hold h.mu.
+func (h *hotResponses) renderLocked(bodies *hotBodies, full bool) {
+	latest := make([]byte, 0, 2+len(h.symbols)*128)
+	mids := make([]byte, 0, 2+len(h.symbols)*32)
+	latest = append(latest, '{')
+	mids = append(mids, '{')
+	for i, symbol := range h.symbols {
+		if i > 0 {
+			latest = append(latest, ',')
+			mids = append(mids, ',')
+		}
+		fragment := h.fragments[symbol]
+		if full && fragment.latestFull != nil {
+			latest = append(latest, fragment.latestFull...)
+			mids = append(mids, fragment.midsFull...)
+			continue
+		}
+		latest = append(latest, fragment.latest...)
+		mids = append(mids, fragment.mids...)
+	}
+	bodies.latest.Store(newHotBlob(append(latest, '}', '\n')))
+	bodies.mids.Store(newHotBlob(append(mids, '}', '\n')))
+	bodies.dirty.Store(false)
+}
+
+// serveHotBlob writes a pre-rendered response, gzipped when the client
+// accepts it. Signed responses are always served uncompressed so the
+// signature covers the JSON.
+func serveHotBlob(w http.ResponseWriter, r *http.Request, blob *hotBlob) {
+	h := w.Header()
+	for key, value := range allSurrogateKeys() {
+		h[key] = value
+	}
+	h["Etag"] = blob.etag
+	h["Cache-Control"] = hotCacheControl
+	h["Vary"] = hotVary
+	if etagMatches(r.Header.Get("If-None-Match"), blob.etag[0]) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body, length := blob.body, blob.contentLength
+	if blob.gzipped != nil && responseSigner == nil && acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		body, length = blob.gzipped, blob.gzipLength
+		h["Content-Encoding"] = hotGzip
+	}
+	h["Content-Type"] = hotContentType
+	h["Content-Length"] = length
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(body)
+}
+
+// handleGetLatestCandles returns the newest candle of every cached symbol,
+// unrounded with ?precision=full
+func handleGetLatestCandles(w http.ResponseWriter, r *http.Request) {
+	latest, _ := cache.hot.blobs(r.URL.Query().Get("precision") == "full")
+	serveHotBlob(w, r, latest)
+}
+
+// handleGetMids returns the latest close of every cached symbol, unrounded
+// with ?precision=full
+func handleGetMids(w http.ResponseWriter, r *http.Request) {
+	_, mids := cache.hot.blobs(r.URL.Query().Get("precision") == "full")
+	serveHotBlob(w, r, mids)
+}
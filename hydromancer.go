@@ -29,63 +29,183 @@ func NewHydromancerClient(apiKey string) *HydromancerClient {
 	}
 }
 
-// MetaResponse represents the response from Hyperliquid's meta endpoint
-type MetaResponse struct {
-	Universe []struct {
-		Name       string `json:"name"`
-		IsDelisted bool   `json:"isDelisted,omitempty"`
-	} `json:"universe"`
+// FetchPerpetualMetadata fetches perpetual symbols along with their asset
+// contexts (volume, open interest, prices) in a single call
+func (c *HydromancerClient) FetchPerpetualMetadata() ([]SymbolMeta, error) {
+	body, err := c.postInfo(map[string]interface{}{
+		"type": "metaAndAssetCtxs",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Response is a two-element array: [meta, assetCtxs]
+	var raw []json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil || len(raw) != 2 {
+		return nil, fmt.Errorf("failed to parse response: unexpected shape")
+	}
+
+	var meta struct {
+		Universe []struct {
+			Name        string `json:"name"`
+			SzDecimals  int    `json:"szDecimals"`
+			MaxLeverage int    `json:"maxLeverage"`
+			IsDelisted  bool   `json:"isDelisted,omitempty"`
+		} `json:"universe"`
+	}
+	var ctxs []AssetCtx
+	if err := json.Unmarshal(raw[0], &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse meta: %w", err)
+	}
+	if err := json.Unmarshal(raw[1], &ctxs); err != nil {
+		return nil, fmt.Errorf("failed to parse asset contexts: %w", err)
+	}
+
+	// Asset contexts are index-aligned with the universe
+	result := make([]SymbolMeta, 0, len(meta.Universe))
+	for i, item := range meta.Universe {
+		if item.Name == "" || item.IsDelisted {
+			continue
+		}
+		sm := SymbolMeta{
+			Name:        item.Name,
+			Market:      MarketPerp,
+			SzDecimals:  item.SzDecimals,
+			MaxLeverage: item.MaxLeverage,
+		}
+		if i < len(ctxs) {
+			sm.applyCtx(ctxs[i])
+		}
+		result = append(result, sm)
+	}
+
+	return result, nil
 }
 
-// FetchPerpetualSymbols fetches all active perpetual symbols from Hyperliquid
-func (c *HydromancerClient) FetchPerpetualSymbols() ([]string, error) {
-	// Use Hyperliquid's meta endpoint to get all symbols
-	reqBody := map[string]interface{}{
-		"type": "meta",
+// FetchSpotMetadata fetches spot pairs along with their asset contexts
+func (c *HydromancerClient) FetchSpotMetadata() ([]SymbolMeta, error) {
+	body, err := c.postInfo(map[string]interface{}{
+		"type": "spotMetaAndAssetCtxs",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil || len(raw) != 2 {
+		return nil, fmt.Errorf("failed to parse response: unexpected shape")
+	}
+
+	var meta struct {
+		Universe []struct {
+			Name   string `json:"name"`
+			Tokens []int  `json:"tokens"`
+			Index  int    `json:"index"`
+		} `json:"universe"`
+		Tokens []struct {
+			Name       string `json:"name"`
+			SzDecimals int    `json:"szDecimals"`
+			Index      int    `json:"index"`
+		} `json:"tokens"`
+	}
+	var ctxs []AssetCtx
+	if err := json.Unmarshal(raw[0], &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse spot meta: %w", err)
+	}
+	if err := json.Unmarshal(raw[1], &ctxs); err != nil {
+		return nil, fmt.Errorf("failed to parse spot asset contexts: %w", err)
 	}
 
+	tokens := make(map[int]int, len(meta.Tokens)) // token index -> position in meta.Tokens
+	for i, t := range meta.Tokens {
+		tokens[t.Index] = i
+	}
+	ctxByCoin := make(map[string]AssetCtx, len(ctxs))
+	for _, ctx := range ctxs {
+		ctxByCoin[ctx.Coin] = ctx
+	}
+
+	result := make([]SymbolMeta, 0, len(meta.Universe))
+	for _, pair := range meta.Universe {
+		if pair.Name == "" {
+			continue
+		}
+		sm := SymbolMeta{
+			Name:        pair.Name,
+			DisplayName: pair.Name,
+			Market:      MarketSpot,
+		}
+		// Non-canonical pairs are named "@<index>"; build a readable BASE/QUOTE name
+		if len(pair.Tokens) == 2 {
+			base, okBase := tokens[pair.Tokens[0]]
+			quote, okQuote := tokens[pair.Tokens[1]]
+			if okBase && okQuote {
+				sm.DisplayName = meta.Tokens[base].Name + "/" + meta.Tokens[quote].Name
+				sm.SzDecimals = meta.Tokens[base].SzDecimals
+			}
+		}
+		if ctx, ok := ctxByCoin[pair.Name]; ok {
+			sm.applyCtx(ctx)
+		}
+		result = append(result, sm)
+	}
+
+	return result, nil
+}
+
+// postInfo sends a request to the Hyperliquid info endpoint and returns the raw body.
+// It isn't skipped in a dry run: the planned fetches depend on the live
+// symbol list, so symbol discovery keeps calling upstream.
+func (c *HydromancerClient) postInfo(reqBody map[string]interface{}) ([]byte, error) {
+	return postHyperliquidInfo(c.httpClient, reqBody)
+}
+
+// postHyperliquidInfo sends a request to the Hyperliquid info endpoint with
+// httpClient, records it against the source, budget and upstream health, and
+// returns the raw body
+func postHyperliquidInfo(httpClient *http.Client, reqBody map[string]interface{}) ([]byte, error) {
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Use Hyperliquid API directly (not Hydromancer for this)
-	req, err := http.NewRequest("POST", "https://api.hyperliquid.xyz/info", bytes.NewBuffer(jsonData))
+	source, baseURL := hyperliquidSources.Primary()
+	req, err := http.NewRequest("POST", baseURL+hyperliquidInfoPath, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	reqType, _ := reqBody["type"].(string)
+	start := time.Now()
+	resp, err := httpClient.Do(req)
 	if err != nil {
+		hyperliquidSources.Record(source, err, 0)
+		requestBudget.Record(reqType, infoWeight(reqType, 0), false)
+		upstreams.Record("hyperliquid", err)
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
+	clockSkew.ObserveResponse(resp, start)
+	requestBudget.Record(reqType, infoWeight(reqType, 0), resp.StatusCode == http.StatusTooManyRequests)
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		hyperliquidSources.Record(source, sourceFailure(resp.StatusCode, nil), time.Since(start))
+		err := fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		upstreams.Record("hyperliquid", err)
+		return nil, err
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
+		hyperliquidSources.Record(source, err, 0)
+		upstreams.Record("hyperliquid", err)
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
-
-	var response MetaResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	// Extract symbol names from universe (exclude delisted symbols)
-	symbols := make([]string, 0, len(response.Universe))
-	for _, item := range response.Universe {
-		if item.Name != "" && !item.IsDelisted {
-			symbols = append(symbols, item.Name)
-		}
-	}
-
-	return symbols, nil
+	hyperliquidSources.Record(source, nil, time.Since(start))
+	upstreams.Record("hyperliquid", nil)
+	return body, nil
 }
-
@@ -3,19 +3,23 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
-)
 
-const (
-	hyperliquidURL = "https://api.hyperliquid.xyz/info"
+	"golang.org/x/sync/singleflight"
 )
 
+// hyperliquidInfoPath is the info endpoint under each source's base URL
+const hyperliquidInfoPath = "/info"
+
 // HyperliquidClient handles API calls to Hyperliquid
 type HyperliquidClient struct {
 	httpClient *http.Client
+	fetchGroup singleflight.Group // Deduplicates concurrent identical candle fetches
 }
 
 // NewHyperliquidClient creates a new Hyperliquid client
@@ -27,8 +31,25 @@ func NewHyperliquidClient() *HyperliquidClient {
 	}
 }
 
+// FetchStats describes the upstream traffic behind a candle fetch
+type FetchStats struct {
+	Attempts    int     `json:"attempts"`
+	Bytes       int64   `json:"bytes"`
+	RateLimited int     `json:"rate_limited"` // 429 responses
+	LatencyMs   float64 `json:"latency_ms"`   // Round trip of the last attempt
+}
+
 // FetchCandles fetches candle data for a specific symbol
 func (c *HyperliquidClient) FetchCandles(symbol, interval string, startTime, endTime int64) ([]Candle, error) {
+	return c.fetchCandles(symbol, interval, startTime, endTime, &FetchStats{})
+}
+
+// fetchCandles fetches candles, adding the request's traffic to stats
+func (c *HyperliquidClient) fetchCandles(symbol, interval string, startTime, endTime int64, stats *FetchStats) ([]Candle, error) {
+	if dryRun() {
+		return nil, dryRunFetch(symbol, interval, startTime, endTime, stats)
+	}
+	
 	reqBody := map[string]interface{}{
 		"type": "candleSnapshot",
 		"req": map[string]interface{}{
@@ -44,31 +65,57 @@ func (c *HyperliquidClient) FetchCandles(symbol, interval string, startTime, end
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", hyperliquidURL, bytes.NewBuffer(jsonData))
+	source, baseURL := hyperliquidSources.Primary()
+	req, err := http.NewRequest("POST", baseURL+hyperliquidInfoPath, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
+	stats.Attempts++
+	start := time.Now()
+	defer func() {
+		stats.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	}()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		hyperliquidSources.Record(source, err, 0)
+		requestBudget.Record("candleSnapshot", infoWeight("candleSnapshot", 0), false)
+		upstreams.Record("hyperliquid", err)
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
+	clockSkew.ObserveResponse(resp, start)
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		stats.Bytes += int64(len(body))
+		if resp.StatusCode == http.StatusTooManyRequests {
+			stats.RateLimited++
+		}
+		hyperliquidSources.Record(source, sourceFailure(resp.StatusCode, nil), time.Since(start))
+		requestBudget.Record("candleSnapshot", infoWeight("candleSnapshot", 0), resp.StatusCode == http.StatusTooManyRequests)
+		err := fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		upstreams.Record("hyperliquid", err)
+		return nil, err
 	}
 
 	body, err := io.ReadAll(resp.Body)
+	stats.Bytes += int64(len(body))
 	if err != nil {
+		hyperliquidSources.Record(source, err, 0)
+		requestBudget.Record("candleSnapshot", infoWeight("candleSnapshot", 0), false)
+		upstreams.Record("hyperliquid", err)
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
+	hyperliquidSources.Record(source, nil, time.Since(start))
+	upstreams.Record("hyperliquid", nil)
 
 	var rawCandles []HyperliquidCandle
-	if err := json.Unmarshal(body, &rawCandles); err != nil {
+	err = json.Unmarshal(body, &rawCandles)
+	requestBudget.Record("candleSnapshot", infoWeight("candleSnapshot", len(rawCandles)), false)
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
@@ -88,15 +135,51 @@ func (c *HyperliquidClient) FetchCandles(symbol, interval string, startTime, end
 	return candles, nil
 }
 
-// FetchCandlesWithRetry fetches candles with exponential backoff retry
+// FetchCandlesWithRetry fetches candles with exponential backoff retry.
+// Concurrent calls for the same symbol, interval and window (from the
+// periodic cycle, on-demand fills, or stream-triggered refreshes) share a
+// single upstream request; the returned slice must not be modified.
 func (c *HyperliquidClient) FetchCandlesWithRetry(symbol, interval string, startTime, endTime int64, maxRetries int) ([]Candle, error) {
+	candles, _, err := c.FetchCandlesWithStats(symbol, interval, startTime, endTime, maxRetries)
+	return candles, err
+}
+
+// FetchCandlesWithStats is FetchCandlesWithRetry that also reports the
+// upstream traffic. A caller that joined another's in-flight request gets
+// that request's stats.
+func (c *HyperliquidClient) FetchCandlesWithStats(symbol, interval string, startTime, endTime int64, maxRetries int) ([]Candle, FetchStats, error) {
+	type fetched struct {
+		candles []Candle
+		stats   FetchStats
+	}
+	key := fmt.Sprintf("%s|%s|%d|%d", symbol, interval, startTime, endTime)
+	v, err, shared := c.fetchGroup.Do(key, func() (interface{}, error) {
+		var f fetched
+		var err error
+		f.candles, err = c.fetchCandlesWithRetry(symbol, interval, startTime, endTime, maxRetries, &f.stats)
+		return f, err
+	})
+	if shared {
+		metrics.Inc("candle_fetch_deduplicated_total")
+	}
+	f := v.(fetched)
+	if err != nil {
+		return nil, f.stats, err
+	}
+	return f.candles, f.stats, nil
+}
+
+func (c *HyperliquidClient) fetchCandlesWithRetry(symbol, interval string, startTime, endTime int64, maxRetries int, stats *FetchStats) ([]Candle, error) {
 	var lastErr error
 	
 	for attempt := 0; attempt < maxRetries; attempt++ {
-		candles, err := c.FetchCandles(symbol, interval, startTime, endTime)
+		candles, err := c.fetchCandles(symbol, interval, startTime, endTime, stats)
 		if err == nil {
 			return candles, nil
 		}
+		if errors.Is(err, errDryRun) {
+			return nil, err
+		}
 		
 		lastErr = err
 		if attempt < maxRetries-1 {
@@ -109,3 +192,91 @@ func (c *HyperliquidClient) FetchCandlesWithRetry(symbol, interval string, start
 	return nil, fmt.Errorf("failed after %d retries: %w", maxRetries, lastErr)
 }
 
+// FetchAllMids fetches the current mid price of every coin
+func (c *HyperliquidClient) FetchAllMids() (map[string]float64, error) {
+	jsonData, err := json.Marshal(map[string]string{"type": "allMids"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	source, baseURL := hyperliquidSources.Primary()
+	start := time.Now()
+	resp, err := c.httpClient.Post(baseURL+hyperliquidInfoPath, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		hyperliquidSources.Record(source, err, 0)
+		requestBudget.Record("allMids", infoWeight("allMids", 0), false)
+		upstreams.Record("hyperliquid", err)
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	clockSkew.ObserveResponse(resp, start)
+
+	body, err := io.ReadAll(resp.Body)
+	requestBudget.Record("allMids", infoWeight("allMids", 0), resp.StatusCode == http.StatusTooManyRequests)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		hyperliquidSources.Record(source, sourceFailure(resp.StatusCode, nil), time.Since(start))
+		upstreams.Record("hyperliquid", err)
+		return nil, err
+	}
+	if err != nil {
+		hyperliquidSources.Record(source, err, 0)
+		upstreams.Record("hyperliquid", err)
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	hyperliquidSources.Record(source, nil, time.Since(start))
+	upstreams.Record("hyperliquid", nil)
+
+	// Prices come as decimal strings keyed by coin
+	var raw map[string]string
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	mids := make(map[string]float64, len(raw))
+	for coin, price := range raw {
+		if mid, err := strconv.ParseFloat(price, 64); err == nil && mid > 0 {
+			mids[coin] = mid
+		}
+	}
+	return mids, nil
+}
+
+// FundingRate is one hourly funding payment of a perp
+type FundingRate struct {
+	Time    int64     `json:"time"`
+	Rate    flexFloat `json:"fundingRate"`
+	Premium flexFloat `json:"premium"`
+}
+
+// fundingHistoryPageSize is the most rows Hyperliquid returns per request
+const fundingHistoryPageSize = 500
+
+// FetchFundingHistory fetches symbol's funding payments from startTime on,
+// following pages until the response is short
+func (c *HyperliquidClient) FetchFundingHistory(symbol string, startTime int64) ([]FundingRate, error) {
+	if dryRun() {
+		return nil, nil
+	}
+
+	var rates []FundingRate
+	for {
+		body, err := postHyperliquidInfo(c.httpClient, map[string]interface{}{
+			"type":      "fundingHistory",
+			"coin":      symbol,
+			"startTime": startTime,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var page []FundingRate
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		rates = append(rates, page...)
+		if len(page) < fundingHistoryPageSize {
+			return rates, nil
+		}
+		startTime = page[len(page)-1].Time + 1
+	}
+}
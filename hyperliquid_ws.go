@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	hyperliquidWSURL = "wss://api.hyperliquid.xyz/ws"
+
+	// Hyperliquid closes connections that stay silent for 60s
+	wsPingInterval = 50 * time.Second
+	// A connection that delivers nothing, not even a pong, for this long is
+	// dead even if TCP hasn't noticed
+	wsReadTimeout = wsPingInterval + 30*time.Second
+
+	// Reconnect delays double from min to max; a connection that stays up
+	// for wsStableAfter resets them
+	wsReconnectMin = time.Second
+	wsReconnectMax = time.Minute
+	wsStableAfter  = time.Minute
+)
+
+// WSMessage is the envelope Hyperliquid uses for every pushed message
+type WSMessage struct {
+	Channel string          `json:"channel"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// HyperliquidWSClient keeps a WebSocket connection to Hyperliquid open and
+// hands every received message to the handler. Dropped connections are
+// retried with exponential backoff, subscriptions are replayed whenever the
+// connection is re-established, and the reconnect handler is told which
+// window was missed so it can be filled from REST.
+type HyperliquidWSClient struct {
+	name        string // Labels the connection's logs and metrics
+	url         string
+	handler     func(WSMessage)
+	onReconnect func(gapStart, gapEnd time.Time)
+
+	mu            sync.Mutex
+	conn          *websocket.Conn
+	subscriptions []map[string]interface{}
+	closed        bool
+	closing       chan struct{} // Closed by Close, to cut a backoff short
+}
+
+// NewHyperliquidWSClient creates a new WebSocket client named for what it
+// streams
+func NewHyperliquidWSClient(name string, handler func(WSMessage)) *HyperliquidWSClient {
+	return &HyperliquidWSClient{
+		name:    name,
+		url:     hyperliquidWSURL,
+		handler: handler,
+		closing: make(chan struct{}),
+	}
+}
+
+// OnReconnect sets a handler called after every reconnect with the window
+// during which no messages were received. Set it before Run.
+func (c *HyperliquidWSClient) OnReconnect(fn func(gapStart, gapEnd time.Time)) {
+	c.onReconnect = fn
+}
+
+// Subscribe registers a subscription and sends it if the connection is up
+func (c *HyperliquidWSClient) Subscribe(subscription map[string]interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.subscriptions = append(c.subscriptions, subscription)
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.WriteJSON(map[string]interface{}{
+		"method":       "subscribe",
+		"subscription": subscription,
+	})
+}
+
+// Unsubscribe drops a subscription and cancels it if the connection is up
+func (c *HyperliquidWSClient) Unsubscribe(subscription map[string]interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.subscriptions = slices.DeleteFunc(c.subscriptions, func(sub map[string]interface{}) bool {
+		return maps.Equal(sub, subscription)
+	})
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.WriteJSON(map[string]interface{}{
+		"method":       "unsubscribe",
+		"subscription": subscription,
+	})
+}
+
+// Run connects and reads until Close is called, reconnecting on failure
+func (c *HyperliquidWSClient) Run() {
+	delay := wsReconnectMin
+	var lostAt time.Time // Last message before the connection dropped
+	for {
+		if c.isClosed() {
+			return
+		}
+		connectedAt, lastMessage, err := c.connectAndRead(lostAt)
+		if c.isClosed() {
+			return
+		}
+		metrics.Set("ws_connected", 0, "stream", c.name)
+		if !connectedAt.IsZero() {
+			lostAt = lastMessage
+			if time.Since(connectedAt) > wsStableAfter {
+				delay = wsReconnectMin
+			}
+		}
+
+		// Up to 20% jitter so instances don't reconnect in lockstep
+		wait := delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+		log.Printf("[HyperliquidWS] ERROR: %s stream: %v, reconnecting in %v", c.name, err, wait.Round(time.Millisecond))
+		errorTrace.Record(SubsystemWS, c.name, err)
+		metrics.Inc("ws_disconnects_total", "stream", c.name)
+		select {
+		case <-c.closing:
+			return
+		case <-time.After(wait):
+		}
+		delay = min(delay*2, wsReconnectMax)
+	}
+}
+
+// Close shuts down the connection and stops reconnecting
+func (c *HyperliquidWSClient) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.closing)
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+func (c *HyperliquidWSClient) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// connectAndRead connects, replays the subscriptions and reads until the
+// connection fails. lostAt is when the previous connection last received a
+// message (zero on the first connect). It returns when this connection was
+// established (zero if it never was) and when it last received a message.
+func (c *HyperliquidWSClient) connectAndRead(lostAt time.Time) (time.Time, time.Time, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(c.url, nil)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("dial failed: %w", err)
+	}
+	defer conn.Close()
+
+	c.mu.Lock()
+	c.conn = conn
+	for _, sub := range c.subscriptions {
+		if err := conn.WriteJSON(map[string]interface{}{
+			"method":       "subscribe",
+			"subscription": sub,
+		}); err != nil {
+			c.conn = nil
+			c.mu.Unlock()
+			return time.Time{}, time.Time{}, fmt.Errorf("subscribe failed: %w", err)
+		}
+	}
+	subCount := len(c.subscriptions)
+	c.mu.Unlock()
+
+	connectedAt := time.Now()
+	metrics.Set("ws_connected", 1, "stream", c.name)
+	if lostAt.IsZero() {
+		log.Printf("[HyperliquidWS] %s stream connected, %d subscriptions active", c.name, subCount)
+	} else {
+		gap := connectedAt.Sub(lostAt)
+		log.Printf("[HyperliquidWS] %s stream reconnected after %v, %d subscriptions replayed", c.name, gap.Round(time.Millisecond), subCount)
+		metrics.Inc("ws_reconnects_total", "stream", c.name)
+		metrics.Set("ws_last_gap_seconds", gap.Seconds(), "stream", c.name)
+		if c.onReconnect != nil {
+			c.onReconnect(lostAt, connectedAt)
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go c.keepAlive(conn, done)
+
+	lastMessage := connectedAt
+	for {
+		conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+		var msg WSMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			c.mu.Lock()
+			c.conn = nil
+			c.mu.Unlock()
+			return connectedAt, lastMessage, fmt.Errorf("read failed: %w", err)
+		}
+		lastMessage = time.Now()
+		if msg.Channel == "pong" || msg.Channel == "subscriptionResponse" {
+			continue
+		}
+		c.handler(msg)
+	}
+}
+
+func (c *HyperliquidWSClient) keepAlive(conn *websocket.Conn, done chan struct{}) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			err := conn.WriteJSON(map[string]string{"method": "ping"})
+			c.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
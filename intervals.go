@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultLookbackDays is the history depth fetched per candle interval when
+// neither CANDLE_DAYS nor a per-interval override is configured. Depths are
+// chosen so each series stays well under Hyperliquid's 5000-candle response cap.
+var defaultLookbackDays = map[string]int{
+	"1m":  2,
+	"3m":  5,
+	"5m":  7,
+	"15m": 14,
+	"30m": 21,
+	"1h":  30,
+	"2h":  60,
+	"4h":  90,
+	"8h":  180,
+	"12h": 180,
+	"1d":  365,
+	"3d":  730,
+	"1w":  1460,
+	"1M":  3650,
+}
+
+// intervalDurations maps Hyperliquid candle intervals to their length.
+// Months are approximated as 30 days.
+var intervalDurations = map[string]time.Duration{
+	"1m":  time.Minute,
+	"3m":  3 * time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"30m": 30 * time.Minute,
+	"1h":  time.Hour,
+	"2h":  2 * time.Hour,
+	"4h":  4 * time.Hour,
+	"8h":  8 * time.Hour,
+	"12h": 12 * time.Hour,
+	"1d":  24 * time.Hour,
+	"3d":  3 * 24 * time.Hour,
+	"1w":  7 * 24 * time.Hour,
+	"1M":  30 * 24 * time.Hour,
+}
+
+// intervalDuration returns the length of a candle interval
+func intervalDuration(interval string) (time.Duration, bool) {
+	d, ok := intervalDurations[interval]
+	return d, ok
+}
+
+// candleClose returns when the candle of interval opening at ts (Unix
+// milliseconds) closes. Monthly candles end with the calendar month rather
+// than after a fixed length.
+func candleClose(interval string, ts int64) int64 {
+	if interval == "1M" {
+		return time.UnixMilli(ts).UTC().AddDate(0, 1, 0).UnixMilli()
+	}
+	d, _ := intervalDuration(interval)
+	return ts + d.Milliseconds()
+}
+
+// candleIntervals returns the Hyperliquid candle intervals, shortest first
+func candleIntervals() []string {
+	intervals := make([]string, 0, len(intervalDurations))
+	for interval := range intervalDurations {
+		intervals = append(intervals, interval)
+	}
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervalDurations[intervals[i]] < intervalDurations[intervals[j]]
+	})
+	return intervals
+}
+
+// intervalUnits maps the unit spellings accepted in intervals to their
+// duration. Months are handled separately.
+var intervalUnits = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour, "hourly": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour, "daily": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "wk": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour, "weekly": 7 * 24 * time.Hour,
+}
+
+// monthUnits are the spellings of a month; a bare "M" is only a month in
+// upper case, since "1m" is a minute
+var monthUnits = map[string]bool{"mo": true, "mon": true, "month": true, "months": true, "monthly": true}
+
+// normalizeInterval resolves common interval spellings ("60m", "1day",
+// "4hr", "1week") to the canonical Hyperliquid name ("1h", "1d", "4h",
+// "1w"). Sub-minute intervals come back as whole seconds ("5s") for the
+// trade candle builder; whether one is actually served is up to the caller.
+func normalizeInterval(raw string) (string, error) {
+	s := strings.TrimSpace(raw)
+	digits := len(s) - len(strings.TrimLeft(s, "0123456789"))
+	n := int64(1)
+	if digits > 0 {
+		var err error
+		if n, err = strconv.ParseInt(s[:digits], 10, 64); err != nil || n <= 0 {
+			return "", unsupportedInterval(raw)
+		}
+	}
+	unit := strings.TrimSpace(s[digits:])
+
+	if unit == "M" || monthUnits[strings.ToLower(unit)] {
+		if n != 1 {
+			return "", unsupportedInterval(raw)
+		}
+		return "1M", nil
+	}
+	size, ok := intervalUnits[strings.ToLower(unit)]
+	if !ok || n > int64(365*24*time.Hour/size) {
+		return "", unsupportedInterval(raw)
+	}
+
+	d := time.Duration(n) * size
+	if d < time.Minute {
+		return strconv.FormatInt(int64(d/time.Second), 10) + "s", nil
+	}
+	for interval, length := range intervalDurations {
+		if length == d && interval != "1M" {
+			return interval, nil
+		}
+	}
+	return "", unsupportedInterval(raw)
+}
+
+func unsupportedInterval(raw string) error {
+	return fmt.Errorf("unsupported interval %q (supported: %s)", raw, strings.Join(candleIntervals(), ", "))
+}
+
+// normalizeIntervals rewrites the configured intervals to their canonical
+// names, so CANDLE_INTERVAL=60m behaves exactly like 1h
+func (c *Config) normalizeIntervals() error {
+	interval, err := normalizeInterval(c.CandleInterval)
+	if err != nil {
+		return fmt.Errorf("CANDLE_INTERVAL: %w", err)
+	}
+	if _, ok := intervalDuration(interval); !ok {
+		return fmt.Errorf("CANDLE_INTERVAL: %q is below one minute; use TRADE_CANDLE_INTERVALS for sub-minute candles", c.CandleInterval)
+	}
+	c.CandleInterval = interval
+
+	lookback := make(map[string]int, len(c.CandleLookbackDays))
+	for raw, days := range c.CandleLookbackDays {
+		interval, err := normalizeInterval(raw)
+		if err != nil {
+			return fmt.Errorf("CANDLE_LOOKBACK_DAYS: %w", err)
+		}
+		lookback[interval] = days
+	}
+	c.CandleLookbackDays = lookback
+
+	for i, raw := range c.TradeCandleIntervals {
+		interval, err := normalizeInterval(raw)
+		if err != nil {
+			return fmt.Errorf("TRADE_CANDLE_INTERVALS: %w", err)
+		}
+		c.TradeCandleIntervals[i] = interval
+	}
+	return nil
+}
+
+// IntervalInfo describes an interval the API serves
+type IntervalInfo struct {
+	Interval       string `json:"interval"`
+	Seconds        int64  `json:"seconds"`
+	Source         string `json:"source"` // "candles" (Hyperliquid candle cache), "trades" (built from the trade stream) or "resampled" (from the candle cache)
+	MaxLookbackSec int64  `json:"max_lookback_sec"`
+}
+
+// handleGetIntervals lists the intervals accepted by ?interval= on
+// /api/candles/:symbol, with how far back each goes
+func handleGetIntervals(w http.ResponseWriter, r *http.Request) {
+	var intervals []IntervalInfo
+	if tradeCandles != nil {
+		for interval, bucketMs := range tradeCandles.Intervals() {
+			intervals = append(intervals, IntervalInfo{
+				Interval:       interval,
+				Seconds:        bucketMs / 1000,
+				Source:         "trades",
+				MaxLookbackSec: bucketMs / 1000 * int64(tradeCandles.maxCandles),
+			})
+		}
+	}
+	d, _ := intervalDuration(config.CandleInterval)
+	intervals = append(intervals, IntervalInfo{
+		Interval:       config.CandleInterval,
+		Seconds:        int64(d / time.Second),
+		Source:         "candles",
+		MaxLookbackSec: int64(config.LookbackDays(config.CandleInterval)) * 24 * 3600,
+	})
+	for _, target := range candleIntervals() {
+		if canResample(config.CandleInterval, target) {
+			d, _ := intervalDuration(target)
+			lookbackDays := config.LookbackDays(config.CandleInterval)
+			// Weeks and months in UTC are built from the daily history
+			if target != "1d" && dailyStore != nil && exchangeLocation.String() == "UTC" {
+				lookbackDays = max(lookbackDays, config.DailyBackfillDays)
+			}
+			intervals = append(intervals, IntervalInfo{
+				Interval:       target,
+				Seconds:        int64(d / time.Second),
+				Source:         "resampled",
+				MaxLookbackSec: int64(lookbackDays) * 24 * 3600,
+			})
+		}
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].Seconds < intervals[j].Seconds })
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"default":          config.CandleInterval,
+		"intervals":        intervals,
+		"symbol_overrides": symbolOverrides.All(),
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// fallbackLookbackDays is used for intervals missing from defaultLookbackDays
+const fallbackLookbackDays = 7
+
+// checkSnapshotCap reports an error when days of interval candles don't fit
+// in one candleSnapshot response, which is all a series is fetched with
+func checkSnapshotCap(interval string, days int) error {
+	d, ok := intervalDuration(interval)
+	if !ok {
+		return nil
+	}
+	if n := int(time.Duration(days) * 24 * time.Hour / d); n > maxCandlesPerSnapshot {
+		return fmt.Errorf("%d days of %s candles is %d candles, over the %d Hyperliquid returns per request", days, interval, n, maxCandlesPerSnapshot)
+	}
+	return nil
+}
+
+// LookbackDays resolves how many days of history to fetch for an interval.
+// Per-interval overrides win, then the global CANDLE_DAYS, then the defaults.
+func (c *Config) LookbackDays(interval string) int {
+	if days, ok := c.CandleLookbackDays[interval]; ok && days > 0 {
+		return days
+	}
+	if c.CandleDays > 0 {
+		return c.CandleDays
+	}
+	if days, ok := defaultLookbackDays[interval]; ok {
+		return days
+	}
+	return fallbackLookbackDays
+}
+
+// parseIntMap parses "key=value" pairs separated by commas, e.g. "1m=2,1h=30".
+// Malformed pairs are skipped.
+func parseIntMap(s string) map[string]int {
+	result := make(map[string]int)
+	for _, pair := range strings.Split(s, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		i, err := strconv.Atoi(strings.TrimSpace(val))
+		if err != nil {
+			continue
+		}
+		result[strings.TrimSpace(key)] = i
+	}
+	return result
+}
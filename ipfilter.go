@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// IPFilter allows or denies requests by the connecting peer's address.
+// Deny entries win; when the allowlist is non-empty a peer must match it.
+type IPFilter struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// NewIPFilter builds a filter from CIDRs or bare IPs
+func NewIPFilter(allow, deny []string) (*IPFilter, error) {
+	f := &IPFilter{}
+	var err error
+	if f.allow, err = parsePrefixes(allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = parsePrefixes(deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Empty reports whether the filter has no rules
+func (f *IPFilter) Empty() bool {
+	return len(f.allow) == 0 && len(f.deny) == 0
+}
+
+// Allowed reports whether addr may connect
+func (f *IPFilter) Allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range f.deny {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, p := range f.allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipFilterChain combines the global filter with a route group's own: a peer
+// must pass every allowlist and match no denylist
+type ipFilterChain []*IPFilter
+
+func (c ipFilterChain) Allowed(addr netip.Addr) bool {
+	for _, f := range c {
+		if !f.Allowed(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c ipFilterChain) Empty() bool {
+	for _, f := range c {
+		if !f.Empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// ipFilterMiddleware rejects peers the filter doesn't allow with 403. Unix
+// socket peers have no address and are always allowed, since filesystem
+// permissions already gate them.
+func ipFilterMiddleware(group string, filter ipFilterChain, next http.Handler) http.Handler {
+	if filter.Empty() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			// Unix sockets report "@" or an empty address
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !filter.Allowed(addr) {
+			log.Printf("[IPFilter] Denied %s %s from %s (%s)", r.Method, r.URL.Path, addr, group)
+			metrics.Inc("ip_filter_denied_total", "group", group)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP %q: %w", entry, err)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// Job states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+const (
+	// maxJobs is how many jobs are kept for polling; the oldest finished
+	// ones are dropped first, and their idempotency keys with them
+	maxJobs = 1000
+	// jobTimeout fails an attempt whose actor never answered, e.g. because
+	// the watchdog restarted it
+	jobTimeout = 30 * time.Minute
+	// jobRetryDelay is the wait before a failed job's second attempt,
+	// doubling for each attempt after that
+	jobRetryDelay = 30 * time.Second
+	// jobPollInterval is how often the runner looks for retries that are due
+	jobPollInterval = 5 * time.Second
+)
+
+// errIdempotencyMismatch is returned when an idempotency key is reused for
+// a different request
+var errIdempotencyMismatch = errors.New("Idempotency-Key was already used for a different request")
+
+// JobFunc runs one attempt at a job. Jobs are persisted by kind and params
+// alone, so everything the attempt needs must be in params.
+type JobFunc func(params map[string]string) (interface{}, error)
+
+// jobKinds maps each job kind to the function that runs it
+var jobKinds = map[string]JobFunc{
+	"refresh":  runRefreshJob,
+	"backfill": runBackfillJob,
+	"purge":    runPurgeJob,
+	"verify":   runVerifyJob,
+	"export":   runExportJob,
+	"archive":  runArchiveJob,
+	"listings": runListingsJob,
+}
+
+// permanentError marks a job error that retrying won't fix
+type permanentError struct{ error }
+
+func (e permanentError) Unwrap() error { return e.error }
+
+// permanent stops a job from being retried after err
+func permanent(err error) error {
+	return permanentError{err}
+}
+
+// Job is a unit of background work run by the JobRunner, polled at
+// /admin/jobs/{id}
+type Job struct {
+	ID             string            `json:"id"`
+	Kind           string            `json:"kind"`
+	Params         map[string]string `json:"params,omitempty"`
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	Status         string            `json:"status"`
+	Attempts       int               `json:"attempts"`
+	MaxAttempts    int               `json:"max_attempts"`
+	Error          string            `json:"error,omitempty"` // The last attempt's error
+	Result         interface{}       `json:"result,omitempty"`
+	Created        time.Time         `json:"created"`
+	Started        *time.Time        `json:"started,omitempty"` // The last attempt's start
+	Finished       *time.Time        `json:"finished,omitempty"`
+	NextAttempt    *time.Time        `json:"next_attempt,omitempty"`
+}
+
+// JobQueue holds queued, running and recent jobs by ID and idempotency key,
+// persisted to path when set
+type JobQueue struct {
+	mu    sync.Mutex
+	path  string
+	byID  map[string]*Job
+	byKey map[string]string // Idempotency key to job ID
+	order []string          // IDs, oldest first
+}
+
+var jobQueue = NewJobQueue("")
+
+// NewJobQueue creates an empty job queue persisted to path
+func NewJobQueue(path string) *JobQueue {
+	return &JobQueue{
+		path:  path,
+		byID:  make(map[string]*Job),
+		byKey: make(map[string]string),
+	}
+}
+
+// Load reads the queue's file. Jobs that were running when the process
+// stopped are queued again; a missing file is not an error.
+func (q *JobQueue) Load() error {
+	if q.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read jobs: %w", err)
+	}
+
+	var jobs []*Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return fmt.Errorf("failed to decode jobs: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pending := 0
+	for _, job := range jobs {
+		if _, ok := jobKinds[job.Kind]; !ok && job.Status != JobSucceeded && job.Status != JobFailed {
+			finished := time.Now().UTC()
+			job.Status, job.Error, job.Finished = JobFailed, "unknown job kind "+job.Kind, &finished
+		}
+		if job.Status == JobRunning {
+			job.Status = JobQueued
+		}
+		if job.Status == JobQueued {
+			pending++
+		}
+		q.byID[job.ID] = job
+		if job.IdempotencyKey != "" {
+			q.byKey[job.IdempotencyKey] = job.ID
+		}
+		q.order = append(q.order, job.ID)
+	}
+	log.Printf("[Jobs] Loaded %d jobs from %s, %d pending", len(jobs), q.path, pending)
+	return nil
+}
+
+// saveLocked writes all jobs to the queue's file. Callers must hold q.mu.
+func (q *JobQueue) saveLocked() {
+	if q.path == "" {
+		return
+	}
+	jobs := make([]*Job, 0, len(q.order))
+	for _, id := range q.order {
+		jobs = append(jobs, q.byID[id])
+	}
+	data, err := json.Marshal(jobs)
+	if err != nil {
+		log.Printf("[Jobs] ERROR: Failed to encode jobs: %v", err)
+		errorTrace.Record(SubsystemStorage, "jobs", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		log.Printf("[Jobs] ERROR: Failed to create jobs dir: %v", err)
+		errorTrace.Record(SubsystemStorage, "jobs", err)
+		return
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("[Jobs] ERROR: Failed to write jobs: %v", err)
+		errorTrace.Record(SubsystemStorage, "jobs", err)
+		return
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		log.Printf("[Jobs] ERROR: Failed to replace jobs: %v", err)
+		errorTrace.Record(SubsystemStorage, "jobs", err)
+	}
+}
+
+// Submit queues a job and wakes the runner. With an idempotency key that
+// was used before, nothing is queued and the earlier job is returned with
+// replayed set, or errIdempotencyMismatch if it was for another request.
+func (q *JobQueue) Submit(kind string, params map[string]string, key string) (job Job, replayed bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if id, ok := q.byKey[key]; ok && key != "" {
+		prev := q.byID[id]
+		if prev.Kind != kind || !maps.Equal(prev.Params, params) {
+			return Job{}, false, errIdempotencyMismatch
+		}
+		metrics.Inc("jobs_replayed_total", "kind", kind)
+		return *prev, true, nil
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	queued := &Job{
+		ID:             hex.EncodeToString(id),
+		Kind:           kind,
+		Params:         params,
+		IdempotencyKey: key,
+		Status:         JobQueued,
+		MaxAttempts:    config.JobMaxAttempts,
+		Created:        time.Now().UTC(),
+	}
+	q.byID[queued.ID] = queued
+	if key != "" {
+		q.byKey[key] = queued.ID
+	}
+	q.order = append(q.order, queued.ID)
+	q.pruneLocked()
+	q.saveLocked()
+
+	if pid := loadPID(&jobRunnerPID); pid != nil {
+		engine.Send(pid, RunJobsMsg{})
+	}
+	return *queued, false, nil
+}
+
+// pruneLocked drops the oldest finished jobs past maxJobs
+func (q *JobQueue) pruneLocked() {
+	for i := 0; len(q.order) > maxJobs && i < len(q.order); {
+		job := q.byID[q.order[i]]
+		if job.Status == JobQueued || job.Status == JobRunning {
+			i++
+			continue
+		}
+		delete(q.byID, job.ID)
+		if job.IdempotencyKey != "" {
+			delete(q.byKey, job.IdempotencyKey)
+		}
+		q.order = append(q.order[:i], q.order[i+1:]...)
+	}
+}
+
+// next marks up to n queued jobs that are due as running, oldest first,
+// and returns them
+func (q *JobQueue) next(n int) []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now().UTC()
+	var jobs []Job
+	for _, id := range q.order {
+		if len(jobs) >= n {
+			break
+		}
+		job := q.byID[id]
+		if job.Status != JobQueued || (job.NextAttempt != nil && job.NextAttempt.After(now)) {
+			continue
+		}
+		started := now
+		job.Status, job.Started, job.NextAttempt = JobRunning, &started, nil
+		job.Attempts++
+		jobs = append(jobs, *job)
+	}
+	if len(jobs) > 0 {
+		q.saveLocked()
+	}
+	return jobs
+}
+
+// finish records the outcome of a job's attempt: done, failed for good, or
+// queued for a retry with backoff
+func (q *JobQueue) finish(id string, result interface{}, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.byID[id]
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	job.Result = result
+	switch {
+	case err == nil:
+		job.Status, job.Error, job.Finished = JobSucceeded, "", &now
+	case errors.As(err, new(permanentError)) || job.Attempts >= job.MaxAttempts:
+		job.Status, job.Error, job.Finished = JobFailed, err.Error(), &now
+		log.Printf("[Jobs] Job %s (%s) failed after %d attempts: %v", job.ID, job.Kind, job.Attempts, err)
+	default:
+		retry := now.Add(jobRetryDelay << (job.Attempts - 1))
+		job.Status, job.Error, job.NextAttempt = JobQueued, err.Error(), &retry
+		log.Printf("[Jobs] Job %s (%s) attempt %d failed, retrying at %s: %v", job.ID, job.Kind, job.Attempts, retry.Format(time.RFC3339), err)
+		metrics.Inc("job_retries_total", "kind", job.Kind)
+	}
+	if job.Status != JobQueued {
+		metrics.Inc("jobs_total", "kind", job.Kind, "status", job.Status)
+	}
+	q.saveLocked()
+}
+
+// Get returns the job with id
+func (q *JobQueue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.byID[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns the kept jobs, newest first
+func (q *JobQueue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, 0, len(q.order))
+	for i := len(q.order) - 1; i >= 0; i-- {
+		jobs = append(jobs, *q.byID[q.order[i]])
+	}
+	return jobs
+}
+
+// JobRunnerActor runs queued jobs on up to workers goroutines, so a slow
+// job doesn't block its submitter or the actor's mailbox
+type JobRunnerActor struct {
+	queue   *JobQueue
+	workers int
+	running map[string]bool // IDs of jobs this actor started
+}
+
+// NewJobRunnerActor creates a new job runner actor
+func NewJobRunnerActor(queue *JobQueue, workers int) *JobRunnerActor {
+	return &JobRunnerActor{queue: queue, workers: workers, running: make(map[string]bool)}
+}
+
+func (a *JobRunnerActor) Receive(ctx *actor.Context) {
+	switch msg := ctx.Message().(type) {
+	case actor.Started:
+		log.Printf("[Jobs] Runner started with %d workers", a.workers)
+		ctx.SendRepeat(ctx.PID(), RunJobsMsg{}, jobPollInterval)
+		a.dispatch(ctx)
+
+	case RunJobsMsg:
+		a.dispatch(ctx)
+
+	case JobFinishedMsg:
+		delete(a.running, msg.ID)
+		a.queue.finish(msg.ID, msg.Result, msg.Err)
+		a.dispatch(ctx)
+
+	case actor.Stopped:
+		log.Println("[Jobs] Runner stopped")
+	}
+}
+
+// dispatch starts due jobs while there are free workers
+func (a *JobRunnerActor) dispatch(ctx *actor.Context) {
+	free := a.workers - len(a.running)
+	if free <= 0 {
+		return
+	}
+	engine, pid := ctx.Engine(), ctx.PID()
+	for _, job := range a.queue.next(free) {
+		a.running[job.ID] = true
+		go func(job Job) {
+			result, err := runJob(job)
+			engine.Send(pid, JobFinishedMsg{ID: job.ID, Result: result, Err: err})
+		}(job)
+	}
+}
+
+// runJob runs one attempt at job
+func runJob(job Job) (interface{}, error) {
+	run, ok := jobKinds[job.Kind]
+	if !ok {
+		return nil, permanent(fmt.Errorf("unknown job kind %s", job.Kind))
+	}
+	return run(job.Params)
+}
+
+// submitJob queues a job for r, keyed by its Idempotency-Key header, and
+// answers 202 with the job. A replay answers with the earlier job and
+// Idempotent-Replayed: true.
+func submitJob(w http.ResponseWriter, r *http.Request, kind string, params map[string]string) {
+	key := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	job, replayed, err := jobQueue.Submit(kind, params, key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	} else {
+		log.Printf("[Admin] Job %s queued: %s %v", job.ID, kind, params)
+	}
+	w.Header().Set("Location", "/admin/jobs/"+job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// awaitActor sends msg to the actor held in *ref, as it is when called, and
+// waits for done to be closed
+func awaitActor(ref **actor.PID, msg any, done chan struct{}) error {
+	pid := loadPID(ref)
+	if pid == nil {
+		// Not spawned yet, or being restarted: a later attempt may find it
+		return fmt.Errorf("actor not running")
+	}
+	engine.Send(pid, msg)
+	select {
+	case <-done:
+		return nil
+	case <-time.After(jobTimeout):
+		return fmt.Errorf("no answer after %s", jobTimeout)
+	}
+}
+
+// handleAdminJobs lists recent jobs, newest first
+func handleAdminJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(jobQueue.List()); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleAdminJob returns one job for status polling
+func handleAdminJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := jobQueue.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
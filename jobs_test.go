@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// withJobConfig runs jobs with maxAttempts attempts for the test
+func withJobConfig(t *testing.T, maxAttempts int) {
+	prev := config
+	t.Cleanup(func() { config = prev })
+	config = &Config{JobMaxAttempts: maxAttempts}
+}
+
+func TestJobQueueIdempotency(t *testing.T) {
+	withJobConfig(t, 3)
+	q := NewJobQueue("")
+
+	first, replayed, err := q.Submit("refresh", map[string]string{"target": "candles"}, "key-1")
+	if err != nil || replayed {
+		t.Fatalf("first submit: replayed %v, err %v", replayed, err)
+	}
+	again, replayed, err := q.Submit("refresh", map[string]string{"target": "candles"}, "key-1")
+	if err != nil || !replayed || again.ID != first.ID {
+		t.Errorf("replay: got job %s, replayed %v, err %v; want job %s replayed", again.ID, replayed, err, first.ID)
+	}
+	if _, _, err := q.Submit("refresh", map[string]string{"target": "symbols"}, "key-1"); !errors.Is(err, errIdempotencyMismatch) {
+		t.Errorf("reused key for other params: err %v, want errIdempotencyMismatch", err)
+	}
+	if other, _, _ := q.Submit("refresh", map[string]string{"target": "candles"}, ""); other.ID == first.ID {
+		t.Error("a submit without a key replayed an earlier job")
+	}
+}
+
+func TestJobQueueRetryBackoff(t *testing.T) {
+	withJobConfig(t, 3)
+	q := NewJobQueue("")
+	job, _, _ := q.Submit("refresh", nil, "")
+	failure := errors.New("upstream down")
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		started := q.next(5)
+		if len(started) != 1 || started[0].Attempts != attempt {
+			t.Fatalf("attempt %d: next returned %+v", attempt, started)
+		}
+		before := time.Now()
+		q.finish(job.ID, nil, failure)
+
+		got, _ := q.Get(job.ID)
+		if got.Status != JobQueued || got.Error != failure.Error() || got.NextAttempt == nil {
+			t.Fatalf("attempt %d: got %+v, want queued for a retry", attempt, got)
+		}
+		// The delay doubles with each attempt
+		want := jobRetryDelay << (attempt - 1)
+		if delay := got.NextAttempt.Sub(before); delay < want-time.Second || delay > want+time.Second {
+			t.Errorf("attempt %d: retry in %v, want %v", attempt, delay, want)
+		}
+		if due := q.next(5); len(due) != 0 {
+			t.Fatalf("attempt %d: retry ran before it was due", attempt)
+		}
+
+		q.mu.Lock()
+		past := time.Now().Add(-time.Second)
+		q.byID[job.ID].NextAttempt = &past
+		q.mu.Unlock()
+	}
+
+	q.next(5)
+	q.finish(job.ID, nil, failure)
+	if got, _ := q.Get(job.ID); got.Status != JobFailed || got.Attempts != 3 || got.Finished == nil {
+		t.Errorf("after the last attempt: got %+v, want failed after 3 attempts", got)
+	}
+}
+
+func TestJobQueuePermanentFailure(t *testing.T) {
+	withJobConfig(t, 3)
+	q := NewJobQueue("")
+	job, _, _ := q.Submit("backfill", nil, "")
+
+	q.next(1)
+	q.finish(job.ID, nil, permanent(errors.New("daily rollup is disabled")))
+	if got, _ := q.Get(job.ID); got.Status != JobFailed || got.Attempts != 1 || got.NextAttempt != nil {
+		t.Errorf("got %+v, want failed without a retry", got)
+	}
+}
+
+func TestJobQueueSuccess(t *testing.T) {
+	withJobConfig(t, 3)
+	q := NewJobQueue("")
+	job, _, _ := q.Submit("refresh", nil, "")
+
+	q.next(1)
+	q.finish(job.ID, "done", nil)
+	got, _ := q.Get(job.ID)
+	if got.Status != JobSucceeded || got.Result != "done" || got.Error != "" {
+		t.Errorf("got %+v, want succeeded with its result", got)
+	}
+}
+
+func TestJobQueueWorkerLimit(t *testing.T) {
+	withJobConfig(t, 3)
+	q := NewJobQueue("")
+	for i := 0; i < 3; i++ {
+		q.Submit("refresh", nil, "")
+	}
+
+	if started := q.next(2); len(started) != 2 {
+		t.Fatalf("next(2) started %d jobs", len(started))
+	}
+	if started := q.next(2); len(started) != 1 {
+		t.Errorf("second next(2) started %d jobs, want the 1 still queued", len(started))
+	}
+}
+
+func TestJobQueueLoadRequeuesRunning(t *testing.T) {
+	withJobConfig(t, 3)
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	q := NewJobQueue(path)
+	running, _, _ := q.Submit("refresh", nil, "key-1")
+	done, _, _ := q.Submit("verify", nil, "")
+	q.next(2)
+	q.finish(done.ID, nil, nil)
+
+	loaded := NewJobQueue(path)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got, _ := loaded.Get(running.ID); got.Status != JobQueued {
+		t.Errorf("job running at shutdown: status %s, want queued", got.Status)
+	}
+	if got, _ := loaded.Get(done.ID); got.Status != JobSucceeded {
+		t.Errorf("finished job: status %s, want succeeded", got.Status)
+	}
+	if _, replayed, _ := loaded.Submit("refresh", nil, "key-1"); !replayed {
+		t.Error("idempotency key wasn't restored")
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencySamples is how many recent fetches per symbol the percentiles cover
+const latencySamples = 100
+
+// LatencyQuantiles summarises a set of upstream latencies in milliseconds
+type LatencyQuantiles struct {
+	P50     float64 `json:"p50"`
+	P95     float64 `json:"p95"`
+	P99     float64 `json:"p99"`
+	Samples int     `json:"samples"`
+}
+
+// quantilesOf computes nearest-rank percentiles; samples is sorted in place
+func quantilesOf(samples []float64) LatencyQuantiles {
+	if len(samples) == 0 {
+		return LatencyQuantiles{}
+	}
+	sort.Float64s(samples)
+	rank := func(p float64) float64 {
+		i := int(p*float64(len(samples))+0.5) - 1
+		return samples[min(max(i, 0), len(samples)-1)]
+	}
+	return LatencyQuantiles{P50: rank(0.50), P95: rank(0.95), P99: rank(0.99), Samples: len(samples)}
+}
+
+// latencyRing keeps the most recent latencySamples values
+type latencyRing struct {
+	samples []float64
+	next    int
+}
+
+func (r *latencyRing) add(v float64) {
+	if len(r.samples) < latencySamples {
+		r.samples = append(r.samples, v)
+		return
+	}
+	r.samples[r.next] = v
+	r.next = (r.next + 1) % latencySamples
+}
+
+// CycleTiming describes the most recent fetch cycle's duration
+type CycleTiming struct {
+	Finished        time.Time        `json:"finished"`
+	DurationSec     float64          `json:"duration_sec"`
+	RefreshInterval float64          `json:"refresh_interval_sec"`
+	OverlapRatio    float64          `json:"overlap_ratio"` // Duration / refresh interval; 1 means cycles run back to back
+	Latency         LatencyQuantiles `json:"latency_ms"`
+}
+
+// LatencyTracker records upstream fetch latency per symbol and per cycle, and
+// warns when cycles get close to overrunning the refresh interval
+type LatencyTracker struct {
+	mu        sync.RWMutex
+	symbols   map[string]*latencyRing
+	lastCycle CycleTiming
+	warnRatio float64
+}
+
+// NewLatencyTracker creates a tracker that warns once a cycle takes more than
+// warnRatio of the refresh interval; zero disables the warning
+func NewLatencyTracker(warnRatio float64) *LatencyTracker {
+	return &LatencyTracker{symbols: make(map[string]*latencyRing), warnRatio: warnRatio}
+}
+
+// CycleDone records a fetch cycle's outcomes and duration, updates the
+// latency gauges, and returns the cycle's latency percentiles
+func (t *LatencyTracker) CycleDone(outcomes []SymbolOutcome, duration, refreshInterval time.Duration) LatencyQuantiles {
+	cycle := make([]float64, 0, len(outcomes))
+	perSymbol := make(map[string]LatencyQuantiles, len(outcomes))
+
+	t.mu.Lock()
+	for _, o := range outcomes {
+		if o.Attempts == 0 {
+			continue
+		}
+		cycle = append(cycle, o.LatencyMs)
+		ring, ok := t.symbols[o.Symbol]
+		if !ok {
+			ring = &latencyRing{}
+			t.symbols[o.Symbol] = ring
+		}
+		ring.add(o.LatencyMs)
+		perSymbol[o.Symbol] = quantilesOf(append([]float64(nil), ring.samples...))
+	}
+	timing := CycleTiming{
+		Finished:        time.Now().UTC(),
+		DurationSec:     duration.Seconds(),
+		RefreshInterval: refreshInterval.Seconds(),
+		Latency:         quantilesOf(cycle),
+	}
+	if refreshInterval > 0 {
+		timing.OverlapRatio = duration.Seconds() / refreshInterval.Seconds()
+	}
+	t.lastCycle = timing
+	t.mu.Unlock()
+
+	for symbol, q := range perSymbol {
+		setLatencyGauges("candle_fetch_latency_ms", q, "symbol", symbol)
+	}
+	setLatencyGauges("candle_fetch_cycle_latency_ms", timing.Latency)
+	metrics.Set("candle_fetch_cycle_overlap_ratio", timing.OverlapRatio)
+
+	if t.warnRatio > 0 && timing.OverlapRatio >= t.warnRatio {
+		message := fmt.Sprintf("Candle fetch cycle took %v, %.0f%% of the %v refresh interval", duration.Round(time.Second), timing.OverlapRatio*100, refreshInterval)
+		log.Printf("[CandleFetcher] WARNING: %s", message)
+		metrics.Inc("candle_fetch_cycle_overlap_warnings_total")
+		notifier.Notify(EventCycleOverlap, message)
+	}
+	return timing.Latency
+}
+
+func setLatencyGauges(name string, q LatencyQuantiles, labels ...string) {
+	for _, p := range []struct {
+		quantile string
+		value    float64
+	}{{"0.5", q.P50}, {"0.95", q.P95}, {"0.99", q.P99}} {
+		metrics.Set(name, p.value, append(labels, "quantile", p.quantile)...)
+	}
+}
+
+// Snapshot returns the last cycle's timing and per-symbol percentiles,
+// optionally narrowed to one symbol
+func (t *LatencyTracker) Snapshot(symbol string) (CycleTiming, map[string]LatencyQuantiles) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	symbols := make(map[string]LatencyQuantiles, len(t.symbols))
+	for name, ring := range t.symbols {
+		if symbol != "" && name != symbol {
+			continue
+		}
+		symbols[name] = quantilesOf(append([]float64(nil), ring.samples...))
+	}
+	return t.lastCycle, symbols
+}
+
+// handleAdminLatency returns upstream latency percentiles. ?symbol=BTC
+func handleAdminLatency(w http.ResponseWriter, r *http.Request) {
+	symbol := r.URL.Query().Get("symbol")
+	if symbol != "" {
+		symbol = cache.CanonicalSymbol(symbol)
+	}
+
+	cycle, symbols := fetchLatency.Snapshot(symbol)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"cycle":   cycle,
+		"symbols": symbols,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// RenderLimiter caps how many responses of one kind render at once. Beyond
+// the cap requests are turned away immediately rather than queued, so a herd
+// of dashboards refreshing together can't hold many copies of a huge body in
+// memory. A nil limiter doesn't limit.
+type RenderLimiter struct {
+	name   string
+	slots  chan struct{}
+	active atomic.Int64
+}
+
+// NewRenderLimiter allows max concurrent renders; max <= 0 returns nil
+func NewRenderLimiter(name string, max int) *RenderLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &RenderLimiter{name: name, slots: make(chan struct{}, max)}
+}
+
+// Acquire takes a slot, or answers 503 with Retry-After and returns false
+// when all are in use. Callers that get true must call Release.
+func (l *RenderLimiter) Acquire(w http.ResponseWriter) bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		metrics.Set("render_limiter_active", float64(l.active.Add(1)), "endpoint", l.name)
+		return true
+	default:
+		metrics.Inc("render_limiter_rejected_total", "endpoint", l.name)
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many concurrent requests for this endpoint, retry shortly", http.StatusServiceUnavailable)
+		return false
+	}
+}
+
+// Release frees a slot taken by Acquire
+func (l *RenderLimiter) Release() {
+	if l == nil {
+		return
+	}
+	metrics.Set("render_limiter_active", float64(l.active.Add(-1)), "endpoint", l.name)
+	<-l.slots
+}
+
+// Limit wraps next, the whole handler chain of an endpoint, so the slot is
+// held while the response is encoded, compressed and signed, not only while
+// the data is gathered. HEAD requests render nothing and don't take one.
+func (l *RenderLimiter) Limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			if !l.Acquire(w) {
+				return
+			}
+			defer l.Release()
+		}
+		next(w, r)
+	}
+}
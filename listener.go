@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// overloadBody is the body of overloadResponse
+const overloadBody = "Server overloaded\r\n"
+
+// overloadResponse is written to plaintext connections rejected by
+// limitListener. It's a complete HTTP/1.1 response so clients see a clean
+// 503 rather than a reset.
+var overloadResponse = "HTTP/1.1 503 Service Unavailable\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Retry-After: 1\r\n" +
+	"Connection: close\r\n" +
+	fmt.Sprintf("Content-Length: %d\r\n", len(overloadBody)) +
+	"\r\n" +
+	overloadBody
+
+// connLimit caps concurrently open connections across every listener
+// sharing it. At the cap, the oldest idle keep-alive connection is closed to
+// make room when an idle tracker is set; otherwise new connections are
+// answered with a 503 and closed. The idle tracker follows the one
+// http.Server behind all the listeners, so the cap is shared with it.
+type connLimit struct {
+	max    int64
+	active atomic.Int64
+	idle   *idleConnTracker
+}
+
+// newConnLimit creates a limit of max connections; a max of zero or less
+// disables it and returns nil. idle may be nil to disable culling.
+func newConnLimit(max int, idle *idleConnTracker) *connLimit {
+	if max <= 0 {
+		return nil
+	}
+	return &connLimit{max: int64(max), idle: idle}
+}
+
+// limitListener applies a connLimit to one listener. TLS connections are
+// closed without an answer, as a plaintext 503 would only garble the
+// client's handshake.
+type limitListener struct {
+	net.Listener
+	limit *connLimit
+	tls   bool
+}
+
+// newLimitListener wraps l; a nil limit leaves it unlimited. tls tells
+// whether l's connections will be served over TLS.
+func newLimitListener(l net.Listener, limit *connLimit, tls bool) net.Listener {
+	if limit == nil {
+		return l
+	}
+	return &limitListener{Listener: l, limit: limit, tls: tls}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	limit := l.limit
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		// Closing a culled connection releases its slot synchronously
+		if limit.active.Add(1) > limit.max && (limit.idle == nil || !limit.idle.CullOldest()) {
+			limit.active.Add(-1)
+			go rejectConn(conn, l.tls)
+			continue
+		}
+
+		return &limitedConn{Conn: conn, release: func() { limit.active.Add(-1) }}, nil
+	}
+}
+
+func rejectConn(conn net.Conn, tls bool) {
+	if !tls {
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		conn.Write([]byte(overloadResponse))
+	}
+	conn.Close()
+	log.Printf("Rejected connection from %s: connection limit reached", conn.RemoteAddr())
+}
+
+// limitedConn releases its slot exactly once when closed
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// idleConnTracker follows connection states reported by http.Server so
+// idle keep-alive connections can be reclaimed under pressure
+type idleConnTracker struct {
+	mu   sync.Mutex
+	idle map[net.Conn]time.Time
+}
+
+func newIdleConnTracker() *idleConnTracker {
+	return &idleConnTracker{idle: make(map[net.Conn]time.Time)}
+}
+
+// ConnState is installed as http.Server.ConnState
+func (t *idleConnTracker) ConnState(conn net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if state == http.StateIdle {
+		t.idle[conn] = time.Now()
+	} else {
+		delete(t.idle, conn)
+	}
+}
+
+// CullOldest closes the longest-idle connection, reporting whether one existed
+func (t *idleConnTracker) CullOldest() bool {
+	t.mu.Lock()
+	var oldest net.Conn
+	var oldestAt time.Time
+	for conn, at := range t.idle {
+		if oldest == nil || at.Before(oldestAt) {
+			oldest, oldestAt = conn, at
+		}
+	}
+	if oldest != nil {
+		delete(t.idle, oldest)
+	}
+	t.mu.Unlock()
+
+	if oldest == nil {
+		return false
+	}
+	oldest.Close()
+	metrics.Inc("idle_connections_culled_total")
+	return true
+}
+
+// bodyReadGrace is how long a request body may take before its read rate is enforced
+const bodyReadGrace = 5 * time.Second
+
+// minRateReader fails reads once the average upload rate since the first
+// read drops below minRate bytes/second, after a grace period
+type minRateReader struct {
+	io.ReadCloser
+	minRate int64
+	grace   time.Duration
+	start   time.Time
+	read    int64
+}
+
+func newMinRateReader(body io.ReadCloser, minRate int64, grace time.Duration) *minRateReader {
+	return &minRateReader{ReadCloser: body, minRate: minRate, grace: grace}
+}
+
+func (r *minRateReader) Read(p []byte) (int, error) {
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+
+	if elapsed := time.Since(r.start); err == nil && elapsed > r.grace {
+		if r.read < int64(elapsed.Seconds()*float64(r.minRate)) {
+			metrics.Inc("slow_request_bodies_total")
+			return n, fmt.Errorf("request body read rate below %d bytes/s", r.minRate)
+		}
+	}
+	return n, err
+}
+
+// openListeners opens one listener per address. Addresses prefixed with
+// "unix:" are unix domain sockets; anything else is a TCP host:port, which
+// may be prefixed with "tcp4:" or "tcp6:" to pin the IP family. A wildcard
+// tcp6 address ("tcp6:[::]:3000") is IPv6-only; plain ":3000" is dual-stack.
+func openListeners(addrs []string, socketMode os.FileMode) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		ln, err := openListener(addr, socketMode)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+func openListener(addr string, socketMode os.FileMode) (net.Listener, error) {
+	path, isUnix := strings.CutPrefix(addr, "unix:")
+	if !isUnix {
+		network, hostPort := splitNetwork(addr)
+		ln, err := net.Listen(network, hostPort)
+		if err != nil {
+			return nil, fmt.Errorf("listen on %s: %w", addr, err)
+		}
+		return ln, nil
+	}
+
+	// Remove a stale socket left behind by an unclean shutdown
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("remove stale socket %s: %w", path, err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", addr, err)
+	}
+	if err := os.Chmod(path, socketMode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("chmod socket %s: %w", path, err)
+	}
+	return ln, nil
+}
+
+// splitNetwork separates an optional tcp4:/tcp6: family prefix from a TCP address
+func splitNetwork(addr string) (network, hostPort string) {
+	for _, network := range []string{"tcp4", "tcp6"} {
+		if hostPort, ok := strings.CutPrefix(addr, network+":"); ok {
+			return network, hostPort
+		}
+	}
+	return "tcp", addr
+}
+
+// defaultListenAddr builds the listen address from BIND_HOST, PORT and
+// IP_FAMILY (dual, ipv4 or ipv6)
+func defaultListenAddr(host, port, family string) (string, error) {
+	addr := net.JoinHostPort(host, port)
+	switch strings.ToLower(family) {
+	case "", "dual":
+		return addr, nil
+	case "ipv4":
+		return "tcp4:" + addr, nil
+	case "ipv6":
+		if host == "" {
+			addr = net.JoinHostPort("::", port)
+		}
+		return "tcp6:" + addr, nil
+	default:
+		return "", fmt.Errorf("invalid IP_FAMILY %q: use dual, ipv4 or ipv6", family)
+	}
+}
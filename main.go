@@ -1,10 +1,16 @@
 package main
 
 import (
+	"bufio"
 	"compress/gzip"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"fmt"
+	"hash/fnv"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,37 +20,368 @@ import (
 	"time"
 
 	"github.com/anthdm/hollywood/actor"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 var (
-	cache             *Cache
-	engine            *actor.Engine
-	symbolFetcherPID  *actor.PID
-	candleFetcherPID  *actor.PID
+	config              *Config
+	cache               *Cache
+	engine              *actor.Engine
+	symbolFetcherPID    *actor.PID
+	candleFetcherPID    *actor.PID
+	tradeCandlePID      *actor.PID
+	candleStreamPID     *actor.PID
+	tradeCandles        *TradeCandleStore
+	onDemand            *OnDemandFetcher
+	dailyStore          *DailyStore
+	dailyRollupPID      *actor.PID
+	marketDataPID       *actor.PID
+	fxRatePID           *actor.PID
+	snapshotHistoryPID  *actor.PID
+	fxRates             *FXRates
+	midPollerPID        *actor.PID
+	exchangeStatusPID   *actor.PID
+	midStore            *MidStore            // Nil when mids aren't polled
+	symbolOverrides     *SymbolOverrides     // Nil without SYMBOL_OVERRIDES
+	fundingHistory      *FundingHistory      // Nil outside the server
+	openInterestHistory *OpenInterestHistory // Nil outside the server
+	candleDumpLimiter   *RenderLimiter       // Nil (unlimited) outside the server, e.g. serve-fixtures
+	accessStats         *AccessStats         // Nil outside the server
+	notifier            *Notifier
+	stalenessWatchPID   *actor.PID
+	alertPID            *actor.PID
+	alertStore          *AlertStore
+	mqttPID             *actor.PID
+	pushWebhookPID      *actor.PID
+	pushWebhooks        *PushWebhookRegistry
+	responseSigner      *ResponseSigner
+	watchdog            *Watchdog
+	auditLog            *AuditLog
+	fetchLatency        *LatencyTracker
+	watchdogPID         *actor.PID
+	sharedSnapshotPID   *actor.PID
+	replicationPID      *actor.PID
+	shardMemberPID      *actor.PID
+	categories          *Categories
+	cdnPurger           *CDNPurger
+	cdnPurgePID         *actor.PID
+	jobRunnerPID        *actor.PID
 )
 
 // Config holds application configuration
 type Config struct {
-	Port                      string
-	HydromancerAPIKey         string
-	CandleInterval            string
-	CandleDays                int
-	RefreshIntervalMin        int
-	SymbolRefreshIntervalMin  int
+	Port                       string
+	HydromancerAPIKey          string
+	CandleInterval             string
+	CandleDays                 int            // Global history override; 0 uses per-interval defaults
+	CandleLookbackDays         map[string]int // Per-interval history overrides
+	RefreshIntervalMin         int
+	SymbolRefreshIntervalMin   int
+	CandleStreamEnabled        bool     // Update the in-progress candle from the candle WebSocket between fetch cycles
+	TradeCandleSymbols         []string // Symbols to build sub-minute candles for from the trade stream
+	TradeCandleIntervals       []string
+	TradeCandleMax             int // Candles retained per symbol and sub-minute interval
+	JSONEncoder                string
+	GzipCacheMB                int            // Compressed responses kept between refreshes; 0 disables
+	RoundPrices                bool           // Round response prices to each symbol's tick precision
+	PriceDecimals              map[string]int // Per-symbol price decimal overrides
+	ReadTimeoutSec             int
+	ReadHeaderTimeoutSec       int
+	WriteTimeoutSec            int
+	IdleTimeoutSec             int
+	MaxHeaderBytes             int
+	MaxRequestBodyBytes        int64
+	MaxHeaderCount             int
+	MinBodyReadRate            int64 // Bytes/second; slower uploads are aborted
+	CullIdleConns              bool  // Close idle keep-alive conns instead of rejecting at MAX_CONNECTIONS
+	TLSCertFile                string
+	TLSKeyFile                 string
+	HTTP2Enabled               bool     // Serve h2 over TLS
+	H2CEnabled                 bool     // Serve cleartext h2 (behind a proxy that speaks h2c)
+	MaxConnections             int      // 0 disables the limit
+	MaxConcurrentDumps         int      // Full /api/candles renders at once; more get 503 (0 = unlimited)
+	ListenAddrs                []string // TCP addresses and/or unix:/path sockets
+	UnixSocketMode             os.FileMode
+	AdminAddr                  string   // Admin/metrics/pprof listener; empty disables it
+	ClusterAddr                string   // Listener serving only replication endpoints; empty disables it
+	ReadOnly                   bool     // SERVER_MODE=public: no admin or mutation routes
+	HealthUpstreamMaxAgeMin    int      // No successful upstream call for this long is unhealthy (0 disables)
+	HealthCacheMaxAgeMin       int      // No cache update for this long is degraded (0 disables)
+	HealthFailStatus           bool     // Return 503 from /health when unhealthy
+	WatchdogTimeoutMin         int      // Restart actors without a heartbeat for this long (0 disables)
+	IPAllowlist                []string // CIDRs applied to every listener
+	IPDenylist                 []string
+	APIIPAllowlist             []string // CIDRs for the public API listener only
+	APIIPDenylist              []string
+	AdminIPAllowlist           []string // CIDRs for the admin listener only
+	AdminIPDenylist            []string
+	SnapshotPath               string // Cache snapshot written on shutdown and loaded on boot; empty disables
+	SnapshotHistoryIntervalMin int    // Archive the cache this often for /asof; 0 disables
+	SnapshotHistoryKeepHours   int
+	Schedules                  map[string]string // Cron expressions by task, replacing the task's interval
+	PeerSeedURL                string            // Instance whose /api/candles seeds the cache on boot; empty disables
+	PeerSeedTimeoutSec         int
+	ExchangeTimezone           string // Default day/week boundary for resampled candles
+	SharedSnapshotMode         string // off, writer (fetch and publish) or reader (serve the writer's snapshot)
+	SharedSnapshotPath         string
+	SharedSnapshotPollSec      int
+	HyperliquidAPIURLs         string // Comma-separated REST base URLs, in order of preference
+	WeightBudgetPerMin         int    // Hyperliquid request weight allowed per minute, for /admin/budget
+	DryRun                     bool   // Log and budget candle fetches without sending them
+	ShardIndex                 int    // This instance's shard, from 0
+	ShardCount                 int    // Instances splitting the symbols between them; 1 disables sharding
+	ShardCoordinator           bool   // Track fetcher nodes and hand out shards on /admin/shards
+	ShardCoordinatorURL        string // Coordinator's admin listener; overrides SHARD_INDEX/SHARD_COUNT
+	ShardNodeID                string // This node's ID with the coordinator; shards follow ID order
+	ShardNodeURL               string // Admin listener URL followers replicate this node from
+	ReplicationMode            string // off, leader (fetch and stream to followers) or follower (mirror the leader)
+	ReplicationLeaderURL       string // Leader's admin listener, for followers
+	ReplicationToken           string // Bearer token followers present; empty relies on the admin IP filter
+	CacheMemoryBudgetMB        int    // Evict least recently requested series past this; 0 disables
+	BatchSize                  int
+	BatchDelayMs               int
+	WarmupBatchSize            int // Used for the first fetch cycle only
+	WarmupBatchDelayMs         int
+	RevisionWindow             int      // Recent closed candles compared each cycle to detect upstream revisions
+	AccessHalfLifeMin          int      // Per-symbol request scores halve this often
+	PriorityHotSymbols         int      // Most requested symbols fetched every cycle
+	PriorityWarmEvery          int      // Fetch cycles between refreshes of other requested symbols
+	PriorityColdEvery          int      // Fetch cycles between refreshes of unrequested symbols
+	FetchMode                  string   // eager (every symbol) or lazy (priority symbols, the rest on request)
+	PrioritySymbols            []string // Always fetched in lazy mode
+	LazyTTLMin                 int      // Lazy mode keeps requested symbols warm this long after the last request
+	OnDemandWaitMs             int      // How long a cache-miss request waits for its on-demand fetch
+	DailyRollupEnabled         bool
+	DailyStorePath             string // Persists the daily series across restarts; empty keeps it in memory
+	DailyBackfillDays          int
+	DailyBackfillPerTick       int
+	SymbolCategories           map[string]string // symbol -> category
+	SymbolCategoriesSource     string            // JSON file path or http(s) URL
+	CoinGeckoEnabled           bool
+	CoinGeckoAPIKey            string
+	CoinGeckoBaseURL           string
+	CoinGeckoRefreshMin        int
+	CoinGeckoPages             int
+	FXRatesURL                 string
+	FXRatesRefreshMin          int
+	MidsPollSec                int // allMids poll for ?live=true candles; 0 disables
+	ExchangeStatusPollSec      int // Maintenance detection; 0 disables
+	ClockSkewWarnMs            int // Warn when the local clock is this far from Hyperliquid's; 0 disables
+	AnomalyZScore              float64
+	AnomalyWindow              int // Trailing candles the latest one is compared against
+	BetaBenchmark              string
+	BetaWindow                 int // Candle returns behind each beta
+	WebhookURLs                []string
+	WebhookFailureRatio        float64
+	WebhookStaleMinutes        int
+	WebhookCooldownMinutes     int
+	CycleOverlapWarnRatio      float64 // Warn when a fetch cycle takes this share of the refresh interval
+	AlertsEnabled              bool
+	AlertsPath                 string
+	AlertsToken                string // Bearer token required on /api/alerts
+	AlertsMaxRules             int
+	SymbolEventsPath           string // Listing/delisting events are persisted here; empty keeps them in memory
+	JobsPath                   string // Background jobs are persisted here; empty keeps them in memory
+	JobWorkers                 int
+	JobMaxAttempts             int
+	ExportDir                  string // Export jobs write their files here; empty disables /admin/export
+	ErrorTraceSize             int    // Recent errors kept per subsystem for /admin/errors
+	StreamMaxClients           int    // Connections to /api/stream and /ws/candles
+	StreamMaxClientsPerIP      int    // Of StreamMaxClients, from one remote IP
+	StreamMaxSubscriptions     int    // Symbol and interval pairs per stream connection
+	LogFile                    string // Also write logs here; empty logs to stderr only
+	LogMaxMB                   int
+	LogRotateHours             int
+	LogKeep                    int
+	LogRetentionDays           int
+	LogStderr                  bool
+	AuditLogPath               string // Fetch cycle audit log; empty disables
+	AuditLogMaxMB              int
+	AuditLogKeep               int
+	MQTTBrokerURL              string
+	MQTTClientID               string
+	MQTTUsername               string
+	MQTTPassword               string
+	MQTTTopicPrefix            string
+	MQTTQoS                    int
+	MQTTRetain                 bool
+	PushWebhookURLs            []string
+	PushWebhookMode            string
+	CDNPurgeProvider           string // fastly, cloudflare or webhook; empty disables purging
+	CDNPurgeURL                string
+	CDNPurgeToken              string
+	SigningAlgorithm           string // hmac-sha256 or ed25519; empty disables signing
+	SigningKey                 string
+	FeatureFlags               string // name=on|off overrides of FeatureFlagsFile
+	FeatureFlagsFile           string
+	Pipelines                  string // Extra [name=]market@interval[/days] pipelines
+	SymbolOverrides            string // SYMBOL=interval[/days] for the main pipeline
 }
 
 func loadConfig() *Config {
-	return &Config{
-		Port:                      getEnv("PORT", "3000"),
-		HydromancerAPIKey:         getEnv("HYDROMANCER_API_KEY", "sk_nNhuLkdGdW5sxnYec33C2FBPzLjXBnEd"),
-		CandleInterval:            getEnv("CANDLE_INTERVAL", "1h"),
-		CandleDays:                getEnvInt("CANDLE_DAYS", 7),
-		RefreshIntervalMin:        getEnvInt("REFRESH_INTERVAL_MIN", 5),
-		SymbolRefreshIntervalMin:  getEnvInt("SYMBOL_REFRESH_INTERVAL_MIN", 60),
+	cfg := &Config{
+		Port:                       getEnv("PORT", "3000"),
+		HydromancerAPIKey:          getEnv("HYDROMANCER_API_KEY", "sk_nNhuLkdGdW5sxnYec33C2FBPzLjXBnEd"),
+		CandleInterval:             getEnv("CANDLE_INTERVAL", "1h"),
+		CandleDays:                 getEnvInt("CANDLE_DAYS", 0),
+		CandleLookbackDays:         parseIntMap(getEnv("CANDLE_LOOKBACK_DAYS", "")),
+		RefreshIntervalMin:         getEnvInt("REFRESH_INTERVAL_MIN", 5),
+		SymbolRefreshIntervalMin:   getEnvInt("SYMBOL_REFRESH_INTERVAL_MIN", 60),
+		CandleStreamEnabled:        getEnvBool("CANDLE_STREAM_ENABLED", true),
+		TradeCandleSymbols:         getEnvList("TRADE_CANDLE_SYMBOLS", ""),
+		TradeCandleIntervals:       getEnvList("TRADE_CANDLE_INTERVALS", "1s,5s,15s"),
+		TradeCandleMax:             getEnvInt("TRADE_CANDLE_MAX", 1000),
+		JSONEncoder:                getEnv("JSON_ENCODER", "std"),
+		GzipCacheMB:                getEnvInt("GZIP_CACHE_MB", 64),
+		RoundPrices:                getEnvBool("ROUND_PRICES", true),
+		PriceDecimals:              parseIntMap(getEnv("PRICE_DECIMALS", "")),
+		ReadTimeoutSec:             getEnvInt("READ_TIMEOUT_SEC", 15),
+		ReadHeaderTimeoutSec:       getEnvInt("READ_HEADER_TIMEOUT_SEC", 5),
+		WriteTimeoutSec:            getEnvInt("WRITE_TIMEOUT_SEC", 60),
+		IdleTimeoutSec:             getEnvInt("IDLE_TIMEOUT_SEC", 60),
+		MaxHeaderBytes:             getEnvInt("MAX_HEADER_BYTES", http.DefaultMaxHeaderBytes),
+		MaxRequestBodyBytes:        int64(getEnvInt("MAX_REQUEST_BODY_BYTES", 1<<20)),
+		MaxHeaderCount:             getEnvInt("MAX_HEADER_COUNT", 100),
+		MinBodyReadRate:            int64(getEnvInt("MIN_BODY_READ_RATE", 1024)),
+		CullIdleConns:              getEnvBool("CULL_IDLE_CONNECTIONS", true),
+		TLSCertFile:                getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:                 getEnv("TLS_KEY_FILE", ""),
+		HTTP2Enabled:               getEnvBool("HTTP2_ENABLED", true),
+		H2CEnabled:                 getEnvBool("H2C_ENABLED", false),
+		MaxConnections:             getEnvInt("MAX_CONNECTIONS", 0),
+		MaxConcurrentDumps:         getEnvInt("MAX_CONCURRENT_DUMPS", 4),
+		UnixSocketMode:             os.FileMode(getEnvOctal("UNIX_SOCKET_MODE", 0660)),
+		AdminAddr:                  getEnv("ADMIN_ADDR", "127.0.0.1:9090"),
+		ClusterAddr:                getEnv("CLUSTER_ADDR", ""),
+		ReadOnly:                   strings.EqualFold(getEnv("SERVER_MODE", "full"), "public"),
+		HealthUpstreamMaxAgeMin:    getEnvInt("HEALTH_UPSTREAM_MAX_AGE_MINUTES", 15),
+		HealthCacheMaxAgeMin:       getEnvInt("HEALTH_CACHE_MAX_AGE_MINUTES", 30),
+		HealthFailStatus:           getEnvBool("HEALTH_FAIL_STATUS", false),
+		WatchdogTimeoutMin:         getEnvInt("WATCHDOG_TIMEOUT_MINUTES", 15),
+		IPAllowlist:                getEnvList("IP_ALLOWLIST", ""),
+		IPDenylist:                 getEnvList("IP_DENYLIST", ""),
+		APIIPAllowlist:             getEnvList("API_IP_ALLOWLIST", ""),
+		APIIPDenylist:              getEnvList("API_IP_DENYLIST", ""),
+		AdminIPAllowlist:           getEnvList("ADMIN_IP_ALLOWLIST", ""),
+		AdminIPDenylist:            getEnvList("ADMIN_IP_DENYLIST", ""),
+		SnapshotPath:               getEnv("SNAPSHOT_PATH", ""),
+		SnapshotHistoryIntervalMin: getEnvInt("SNAPSHOT_HISTORY_INTERVAL_MINUTES", 0),
+		SnapshotHistoryKeepHours:   getEnvInt("SNAPSHOT_HISTORY_KEEP_HOURS", 72),
+		Schedules: map[string]string{
+			RefreshCandles: getEnv("CANDLE_REFRESH_SCHEDULE", ""),
+			RefreshSymbols: getEnv("SYMBOL_REFRESH_SCHEDULE", ""),
+			TaskArchive:    getEnv("SNAPSHOT_HISTORY_SCHEDULE", ""),
+			TaskPrune:      getEnv("SNAPSHOT_PRUNE_SCHEDULE", ""),
+		},
+		PeerSeedURL:            getEnv("PEER_SEED_URL", ""),
+		PeerSeedTimeoutSec:     getEnvInt("PEER_SEED_TIMEOUT_SEC", 30),
+		ExchangeTimezone:       getEnv("EXCHANGE_TIMEZONE", "UTC"),
+		SharedSnapshotMode:     getEnv("SHARED_SNAPSHOT_MODE", "off"),
+		SharedSnapshotPath:     getEnv("SHARED_SNAPSHOT_PATH", "/dev/shm/hyperliquid-candles.snap"),
+		SharedSnapshotPollSec:  getEnvInt("SHARED_SNAPSHOT_POLL_SEC", 2),
+		HyperliquidAPIURLs:     getEnv("HYPERLIQUID_API_URLS", "https://api.hyperliquid.xyz"),
+		WeightBudgetPerMin:     getEnvInt("HYPERLIQUID_WEIGHT_BUDGET_PER_MIN", defaultWeightBudgetPerMin),
+		DryRun:                 getEnvBool("DRY_RUN", false),
+		ShardIndex:             getEnvInt("SHARD_INDEX", 0),
+		ShardCount:             getEnvInt("SHARD_COUNT", 1),
+		ShardCoordinator:       getEnvBool("SHARD_COORDINATOR", false),
+		ShardCoordinatorURL:    getEnv("SHARD_COORDINATOR_URL", ""),
+		ShardNodeID:            getEnv("SHARD_NODE_ID", ""),
+		ShardNodeURL:           getEnv("SHARD_NODE_URL", ""),
+		ReplicationMode:        getEnv("REPLICATION_MODE", "off"),
+		ReplicationLeaderURL:   getEnv("REPLICATION_LEADER_URL", ""),
+		ReplicationToken:       getEnv("REPLICATION_TOKEN", ""),
+		CacheMemoryBudgetMB:    getEnvInt("CACHE_MEMORY_BUDGET_MB", 0),
+		BatchSize:              getEnvInt("BATCH_SIZE", 10),
+		BatchDelayMs:           getEnvInt("BATCH_DELAY_MS", 200),
+		WarmupBatchSize:        getEnvInt("WARMUP_BATCH_SIZE", 20),
+		WarmupBatchDelayMs:     getEnvInt("WARMUP_BATCH_DELAY_MS", 100),
+		RevisionWindow:         getEnvInt("REVISION_WINDOW_CANDLES", 10),
+		AccessHalfLifeMin:      getEnvInt("ACCESS_HALF_LIFE_MINUTES", 60),
+		PriorityHotSymbols:     getEnvInt("PRIORITY_HOT_SYMBOLS", 20),
+		PriorityWarmEvery:      getEnvInt("PRIORITY_WARM_EVERY", 1),
+		PriorityColdEvery:      getEnvInt("PRIORITY_COLD_EVERY", 1),
+		FetchMode:              getEnv("FETCH_MODE", FetchModeEager),
+		PrioritySymbols:        getEnvList("PRIORITY_SYMBOLS", "BTC,ETH"),
+		LazyTTLMin:             getEnvInt("LAZY_TTL_MINUTES", 60),
+		OnDemandWaitMs:         getEnvInt("ON_DEMAND_WAIT_MS", 2000),
+		DailyRollupEnabled:     getEnvBool("DAILY_ROLLUP_ENABLED", true),
+		DailyStorePath:         getEnv("DAILY_STORE_PATH", ""),
+		DailyBackfillDays:      getEnvInt("DAILY_BACKFILL_DAYS", 3650),
+		DailyBackfillPerTick:   getEnvInt("DAILY_BACKFILL_PER_TICK", 10),
+		SymbolCategories:       parseStringMap(getEnv("SYMBOL_CATEGORIES", "")),
+		SymbolCategoriesSource: getEnv("SYMBOL_CATEGORIES_SOURCE", ""),
+		CoinGeckoEnabled:       getEnvBool("COINGECKO_ENABLED", false),
+		CoinGeckoAPIKey:        getEnv("COINGECKO_API_KEY", ""),
+		CoinGeckoBaseURL:       getEnv("COINGECKO_BASE_URL", "https://api.coingecko.com/api/v3"),
+		CoinGeckoRefreshMin:    getEnvInt("COINGECKO_REFRESH_INTERVAL_MINUTES", 60),
+		CoinGeckoPages:         getEnvInt("COINGECKO_PAGES", 4),
+		FXRatesURL:             getEnv("FX_RATES_URL", ""),
+		FXRatesRefreshMin:      getEnvInt("FX_RATES_REFRESH_INTERVAL_MINUTES", 60),
+		MidsPollSec:            getEnvInt("MIDS_POLL_SEC", 5),
+		ExchangeStatusPollSec:  getEnvInt("EXCHANGE_STATUS_POLL_SEC", 60),
+		ClockSkewWarnMs:        getEnvInt("CLOCK_SKEW_WARN_MS", 2000),
+		AnomalyZScore:          getEnvFloat("ANOMALY_ZSCORE", 3),
+		AnomalyWindow:          max(getEnvInt("ANOMALY_WINDOW", 100), 2),
+		BetaBenchmark:          getEnv("BETA_BENCHMARK", "BTC"),
+		BetaWindow:             max(getEnvInt("BETA_WINDOW", 72), 2),
+		WebhookURLs:            getEnvList("WEBHOOK_URLS", ""),
+		WebhookFailureRatio:    getEnvFloat("WEBHOOK_FAILURE_RATIO", 0.5),
+		WebhookStaleMinutes:    getEnvInt("WEBHOOK_STALE_MINUTES", 30),
+		WebhookCooldownMinutes: getEnvInt("WEBHOOK_COOLDOWN_MINUTES", 15),
+		CycleOverlapWarnRatio:  getEnvFloat("CYCLE_OVERLAP_WARN_RATIO", 0.8),
+		AlertsEnabled:          getEnvBool("ALERTS_ENABLED", false),
+		AlertsPath:             getEnv("ALERTS_PATH", ""),
+		AlertsToken:            getEnv("ALERTS_TOKEN", ""),
+		AlertsMaxRules:         getEnvInt("ALERTS_MAX_RULES", 100),
+		SymbolEventsPath:       getEnv("SYMBOL_EVENTS_PATH", ""),
+		JobsPath:               getEnv("JOBS_PATH", ""),
+		JobWorkers:             getEnvInt("JOB_WORKERS", 2),
+		JobMaxAttempts:         getEnvInt("JOB_MAX_ATTEMPTS", 3),
+		ExportDir:              getEnv("EXPORT_DIR", ""),
+		ErrorTraceSize:         getEnvInt("ERROR_TRACE_SIZE", 50),
+		StreamMaxClients:       getEnvInt("STREAM_MAX_CLIENTS", 1000),
+		StreamMaxClientsPerIP:  getEnvInt("STREAM_MAX_CLIENTS_PER_IP", 20),
+		StreamMaxSubscriptions: getEnvInt("STREAM_MAX_SUBSCRIPTIONS", 100),
+		LogFile:                getEnv("LOG_FILE", ""),
+		LogMaxMB:               getEnvInt("LOG_MAX_MB", 100),
+		LogRotateHours:         getEnvInt("LOG_ROTATE_HOURS", 24),
+		LogKeep:                getEnvInt("LOG_KEEP", 7),
+		LogRetentionDays:       getEnvInt("LOG_RETENTION_DAYS", 0),
+		LogStderr:              getEnvBool("LOG_STDERR", true),
+		AuditLogPath:           getEnv("AUDIT_LOG_PATH", ""),
+		AuditLogMaxMB:          getEnvInt("AUDIT_LOG_MAX_MB", 10),
+		AuditLogKeep:           getEnvInt("AUDIT_LOG_KEEP", 5),
+		MQTTBrokerURL:          getEnv("MQTT_BROKER_URL", ""),
+		MQTTClientID:           getEnv("MQTT_CLIENT_ID", "hyperliquid-backend"),
+		MQTTUsername:           getEnv("MQTT_USERNAME", ""),
+		MQTTPassword:           getEnv("MQTT_PASSWORD", ""),
+		MQTTTopicPrefix:        getEnv("MQTT_TOPIC_PREFIX", "hyperliquid"),
+		MQTTQoS:                min(max(getEnvInt("MQTT_QOS", 0), 0), 2),
+		MQTTRetain:             getEnvBool("MQTT_RETAIN", true),
+		PushWebhookURLs:        getEnvList("PUSH_WEBHOOK_URLS", ""),
+		PushWebhookMode:        getEnv("PUSH_WEBHOOK_MODE", PushModeChanges),
+		CDNPurgeProvider:       getEnv("CDN_PURGE_PROVIDER", ""),
+		CDNPurgeURL:            getEnv("CDN_PURGE_URL", ""),
+		CDNPurgeToken:          getEnv("CDN_PURGE_TOKEN", ""),
+		SigningAlgorithm:       getEnv("SIGNING_ALGORITHM", ""),
+		SigningKey:             getEnv("SIGNING_KEY", ""),
+		FeatureFlags:           getEnv("FEATURE_FLAGS", ""),
+		FeatureFlagsFile:       getEnv("FEATURE_FLAGS_FILE", ""),
+		Pipelines:              getEnv("PIPELINES", ""),
+		SymbolOverrides:        getEnv("SYMBOL_OVERRIDES", ""),
+	}
+	defaultAddr, err := defaultListenAddr(getEnv("BIND_HOST", ""), cfg.Port, getEnv("IP_FAMILY", "dual"))
+	if err != nil {
+		envErrors = append(envErrors, "BIND_HOST/IP_FAMILY: "+err.Error())
 	}
+	cfg.ListenAddrs = getEnvList("LISTEN_ADDRS", defaultAddr)
+	return cfg
 }
 
 func getEnv(key, defaultVal string) string {
+	noteEnv(key, defaultVal)
 	if val := os.Getenv(key); val != "" {
 		return val
 	}
@@ -52,78 +389,609 @@ func getEnv(key, defaultVal string) string {
 }
 
 func getEnvInt(key string, defaultVal int) int {
+	noteEnv(key, strconv.Itoa(defaultVal))
 	if val := os.Getenv(key); val != "" {
 		if i, err := strconv.Atoi(val); err == nil {
 			return i
 		}
+		badEnv(key, val, "an integer")
+	}
+	return defaultVal
+}
+
+func getEnvFloat(key string, defaultVal float64) float64 {
+	noteEnv(key, strconv.FormatFloat(defaultVal, 'g', -1, 64))
+	if val := os.Getenv(key); val != "" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
+		badEnv(key, val, "a number")
+	}
+	return defaultVal
+}
+
+func getEnvBool(key string, defaultVal bool) bool {
+	noteEnv(key, strconv.FormatBool(defaultVal))
+	if val := os.Getenv(key); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+		badEnv(key, val, "a boolean")
+	}
+	return defaultVal
+}
+
+func getEnvOctal(key string, defaultVal int) int {
+	noteEnv(key, fmt.Sprintf("%04o", defaultVal))
+	if val := os.Getenv(key); val != "" {
+		if i, err := strconv.ParseInt(val, 8, 32); err == nil {
+			return int(i)
+		}
+		badEnv(key, val, "an octal mode")
 	}
 	return defaultVal
 }
 
+func getEnvList(key, defaultVal string) []string {
+	var result []string
+	for _, item := range strings.Split(getEnv(key, defaultVal), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	
-	config := loadConfig()
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := runBench(os.Args[2:]); err != nil {
+			log.Fatalf("[Bench] %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve-fixtures" {
+		if err := runServeFixtures(os.Args[2:]); err != nil {
+			log.Fatalf("[Fixtures] %v", err)
+		}
+		return
+	}
+	
+	config = loadConfig()
+	if err := config.Validate(); err != nil {
+		log.Fatalf("Invalid configuration, %v", err)
+	}
+	scheduler = NewScheduler(config.Schedules)
+	errorTrace = NewErrorTrace(config.ErrorTraceSize)
+	streamHub = NewStreamHub(config.StreamMaxClients, config.StreamMaxClientsPerIP)
+	
+	var err error
+	if exchangeLocation, err = time.LoadLocation(config.ExchangeTimezone); err != nil {
+		log.Fatalf("Invalid EXCHANGE_TIMEZONE %q: %v", config.ExchangeTimezone, err)
+	}
+	if config.LogFile != "" {
+		logFile, err := openRotatingFile(config.LogFile, rotationPolicy{
+			MaxSize:  int64(config.LogMaxMB) << 20,
+			Interval: time.Duration(config.LogRotateHours) * time.Hour,
+			Keep:     config.LogKeep,
+			MaxAge:   time.Duration(config.LogRetentionDays) * 24 * time.Hour,
+		})
+		if err != nil {
+			log.Fatalf("Failed to open log file: %v", err)
+		}
+		if config.LogStderr {
+			log.SetOutput(io.MultiWriter(os.Stderr, logFile))
+		} else {
+			log.SetOutput(logFile)
+		}
+		log.Printf("Logging to %s", config.LogFile)
+	}
+	
+	jsonEncoder, err = newJSONEncoder(config.JSONEncoder)
+	if err != nil {
+		log.Fatalf("Invalid JSON encoder config: %v", err)
+	}
+	if config.GzipCacheMB > 0 {
+		gzipCache = NewGzipCache(config.GzipCacheMB << 20)
+	}
+	
+	if features, err = LoadFeatureFlags(config.FeatureFlagsFile, config.FeatureFlags); err != nil {
+		log.Fatalf("Invalid feature flags: %v", err)
+	}
+	features.publish()
+	
+	candleDumpLimiter = NewRenderLimiter("candles", config.MaxConcurrentDumps)
+	accessStats = NewAccessStats(time.Duration(config.AccessHalfLifeMin) * time.Minute)
+	clockSkew.SetThreshold(time.Duration(config.ClockSkewWarnMs) * time.Millisecond)
 	
-	// Initialize cache
+	// Initialize cache, warm from the last snapshot when available
 	cache = NewCache()
+	// Set before restoring so an oversized snapshot is trimmed on load
+	if config.CacheMemoryBudgetMB > 0 && config.SharedSnapshotMode != "reader" {
+		cache.SetBudget(int64(config.CacheMemoryBudgetMB) << 20)
+		log.Printf("Cache memory budget: %d MB", config.CacheMemoryBudgetMB)
+	}
+	cache.Watch(streamHub.Notify)
+	if config.SnapshotPath != "" {
+		if err := loadSnapshot(config.SnapshotPath, cache); err != nil {
+			log.Printf("[Snapshot] ERROR: %v, starting cold", err)
+			errorTrace.Record(SubsystemStorage, "snapshot", err)
+		}
+	}
+	// A running peer is fresher than our own snapshot, so it's applied on top
+	if config.PeerSeedURL != "" && !config.MirrorsCache() {
+		if err := seedFromPeer(config.PeerSeedURL, cache, time.Duration(config.PeerSeedTimeoutSec)*time.Second); err != nil {
+			log.Printf("[Peer] ERROR: Seeding failed: %v", err)
+		}
+	}
 	
 	// Initialize API clients
 	hydromancerClient := NewHydromancerClient(config.HydromancerAPIKey)
 	hyperliquidClient := NewHyperliquidClient()
 	
+	if config.SigningAlgorithm != "" {
+		responseSigner, err = NewResponseSigner(config.SigningAlgorithm, config.SigningKey)
+		if err != nil {
+			log.Fatalf("Invalid response signing config: %v", err)
+		}
+		log.Printf("Signing responses with %s", config.SigningAlgorithm)
+	}
+	if config.AuditLogPath != "" {
+		auditLog, err = NewAuditLog(config.AuditLogPath, int64(config.AuditLogMaxMB)<<20, config.AuditLogKeep)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		log.Printf("[Audit] Writing fetch cycle records to %s", config.AuditLogPath)
+	}
+	fetchLatency = NewLatencyTracker(config.CycleOverlapWarnRatio)
+	requestBudget = NewRequestBudget(config.WeightBudgetPerMin)
+	hyperliquidSources, err = NewSourcePool(config.HyperliquidAPIURLs)
+	if err != nil {
+		log.Fatalf("Invalid HYPERLIQUID_API_URLS: %v", err)
+	}
+	hyperliquidSources.publish()
+	if config.DryRun {
+		log.Println("[DryRun] DRY_RUN is set: candle fetches are logged and counted on /admin/budget, not sent")
+	}
+	notifier = NewNotifier(config.WebhookURLs, time.Duration(config.WebhookCooldownMinutes)*time.Minute, config.WebhookFailureRatio)
+	categoryMapping, err := resolveCategories(config.SymbolCategoriesSource, config.SymbolCategories)
+	if err != nil {
+		log.Printf("WARNING: %v, using SYMBOL_CATEGORIES only", err)
+		categoryMapping = config.SymbolCategories
+	}
+	categories = NewCategories(categoryMapping)
+	overrides, err := parseSymbolOverrides(config.SymbolOverrides)
+	if err != nil {
+		log.Fatalf("Invalid SYMBOL_OVERRIDES: %v", err)
+	}
+	symbolOverrides = NewSymbolOverrides(overrides, config.CandleInterval)
+	for symbol, override := range symbolOverrides.All() {
+		log.Printf("Symbol override: %s at %s over %dd", symbol, override.Interval, override.Days)
+	}
+	onDemand = NewOnDemandFetcher(cache, hyperliquidClient, config.CandleInterval, config.LookbackDays(config.CandleInterval))
+	fundingHistory = NewFundingHistory(hyperliquidClient)
+	openInterestHistory = NewOpenInterestHistory(config.CandleInterval, config.LookbackDays(config.CandleInterval))
+	symbolEvents = NewSymbolEventLog(config.SymbolEventsPath)
+	if err := symbolEvents.Load(); err != nil {
+		log.Printf("WARNING: %v, starting with no symbol events", err)
+	}
+	
 	// Initialize Hollywood actor engine
-	var err error
 	engine, err = actor.NewEngine(actor.EngineConfig{})
 	if err != nil {
 		log.Fatalf("Failed to create actor engine: %v", err)
 	}
 	
-	// Spawn symbol fetcher actor
-	symbolFetcherPID = engine.Spawn(
+	// Jobs may be queued from here on; they run once the runner is spawned
+	jobQueue = NewJobQueue(config.JobsPath)
+	if err := jobQueue.Load(); err != nil {
+		log.Printf("[Jobs] ERROR: %v", err)
+	}
+	
+	prioritySymbols := make(map[string]bool, len(config.PrioritySymbols))
+	if config.FetchMode == FetchModeLazy {
+		for _, symbol := range config.PrioritySymbols {
+			prioritySymbols[strings.ToUpper(symbol)] = true
+		}
+		if config.SharedSnapshotMode == "writer" || config.ReplicationMode == ReplicationLeader {
+			log.Println("WARNING: FETCH_MODE=lazy only keeps symbols requested from this instance warm; readers and followers see just those")
+		}
+	}
+	if config.ShardCoordinator {
+		shardCoordinator = NewShardCoordinator()
+	}
+	var shards *shardClient
+	if config.ShardCoordinatorURL != "" || config.ShardCoordinator {
+		shards = newShardClient(config.ShardCoordinatorURL, config.ReplicationToken)
+	}
+	readerMode := config.MirrorsCache()
+	if shards != nil && !readerMode {
+		// Join before the fetchers start so the first cycle covers only our shard
+		if config.ShardNodeURL == "" {
+			log.Fatal("SHARD_NODE_URL is required to join a shard coordinator")
+		}
+		if config.ShardNodeID == "" {
+			config.ShardNodeID, _ = os.Hostname()
+		}
+		if !joinShards(shards, config.ShardNodeID, config.ShardNodeURL) {
+			log.Printf("[Shards] WARNING: Coordinator unreachable, using SHARD_INDEX/SHARD_COUNT until it answers")
+		}
+	} else if config.ShardCount > 1 {
+		log.Printf("Fetching shard %d of %d", config.ShardIndex, config.ShardCount)
+	}
+	if readerMode {
+		// Another process fetches; never call upstream from here
+		onDemand = nil
+	}
+	if !readerMode && config.FetchMode == FetchModeLazy {
+		log.Printf("Lazy fetch mode: %s kept warm, other symbols for %dm after a request", strings.Join(config.PrioritySymbols, ", "), config.LazyTTLMin)
+	}
+	
+	watchdog = NewWatchdog(time.Duration(config.WatchdogTimeoutMin) * time.Minute)
+	if config.ReplicationMode == ReplicationFollower {
+		// Mirror the leader's cache instead of fetching
+		watchdog.Spawn(
+			&replicationPID,
+			func() actor.Receiver {
+				// Explicit leaders win over discovery
+				coordinator := shards
+				if config.ReplicationLeaderURL != "" {
+					coordinator = nil
+				}
+				return NewReplicationFollowerActor(cache, config.ReplicationLeaderURL, coordinator, config.ReplicationToken)
+			},
+			"replication",
+		)
+	} else if readerMode {
+		// Serve candles from the writer's snapshot instead of fetching
+		watchdog.Spawn(
+			&sharedSnapshotPID,
+			func() actor.Receiver {
+				return NewSharedSnapshotReaderActor(cache, config.SharedSnapshotPath, time.Duration(config.SharedSnapshotPollSec)*time.Second)
+			},
+			"sharedSnapshot",
+		)
+	} else {
+		// Spawn symbol fetcher actor
+		watchdog.Spawn(
+			&symbolFetcherPID,
+			func() actor.Receiver {
+				return NewSymbolFetcherActor(
+					cache,
+					hydromancerClient,
+					time.Duration(config.SymbolRefreshIntervalMin)*time.Minute,
+					categories,
+					config.SymbolCategoriesSource,
+					config.SymbolCategories,
+				)
+			},
+			"symbolFetcher",
+		)
+		
+		// Spawn candle fetcher actor
+		watchdog.Spawn(
+			&candleFetcherPID,
+			func() actor.Receiver {
+				return NewCandleFetcherActor(
+					cache,
+					hyperliquidClient,
+					time.Duration(config.RefreshIntervalMin)*time.Minute,
+					config.CandleInterval,
+					config.LookbackDays(config.CandleInterval),
+					FetchProfile{
+						BatchSize:  config.BatchSize,
+						BatchDelay: time.Duration(config.BatchDelayMs) * time.Millisecond,
+					},
+					FetchProfile{
+						BatchSize:  config.WarmupBatchSize,
+						BatchDelay: time.Duration(config.WarmupBatchDelayMs) * time.Millisecond,
+					},
+					config.RevisionWindow,
+					accessStats,
+					PriorityProfile{
+						HotSymbols: config.PriorityHotSymbols,
+						WarmEvery:  config.PriorityWarmEvery,
+						ColdEvery:  config.PriorityColdEvery,
+					},
+					LazyProfile{
+						Enabled:  config.FetchMode == FetchModeLazy,
+						Priority: prioritySymbols,
+						TTL:      time.Duration(config.LazyTTLMin) * time.Minute,
+					},
+					symbolOverrides,
+				)
+			},
+			"candleFetcher",
+		)
+	}
+	
+	// Spawn the extra candle pipelines
+	if pipelines, err = parsePipelines(config.Pipelines); err != nil {
+		log.Fatalf("Invalid PIPELINES: %v", err)
+	}
+	if len(pipelines) > 0 && readerMode {
+		// Pipelines aren't in the shared snapshot or the replication stream
+		log.Println("WARNING: PIPELINES are only fetched by instances that fetch the main pipeline, ignoring them")
+		pipelines = nil
+	}
+	for _, p := range pipelines {
+		p.Start(hydromancerClient, hyperliquidClient)
+	}
+	
+	// Publish the cache for reader processes on this host
+	if config.SharedSnapshotMode == "writer" {
+		sharedSnapshotPID = engine.Spawn(
+			func() actor.Receiver {
+				return NewSharedSnapshotWriterActor(cache, config.SharedSnapshotPath)
+			},
+			"sharedSnapshot",
+		)
+	}
+	
+	// Keep our shard assignment current as fetcher nodes join and leave
+	if shards != nil && !readerMode {
+		watchdog.Spawn(
+			&shardMemberPID,
+			func() actor.Receiver {
+				return NewShardMemberActor(shards, config.ShardNodeID, config.ShardNodeURL)
+			},
+			"shardMember",
+		)
+	}
+	
+	// Stream cache updates to followers on other hosts
+	if config.ReplicationMode == ReplicationLeader {
+		replicationPID = engine.Spawn(
+			func() actor.Receiver {
+				return NewReplicationLeaderActor(cache, replication)
+			},
+			"replication",
+		)
+	}
+	
+	// Stream the in-progress candle; the fetcher's cycle reconciles it
+	if config.CandleStreamEnabled && !readerMode && !config.DryRun {
+		candleStreamPID = engine.Spawn(
+			func() actor.Receiver {
+				return NewCandleStreamActor(cache, hyperliquidClient, config.CandleInterval)
+			},
+			"candleStream",
+		)
+	}
+	
+	// Spawn trade candle actor for sub-minute intervals
+	if len(config.TradeCandleSymbols) > 0 && features.Enabled(FlagTradeStream) && !config.DryRun {
+		tradeCandles, err = NewTradeCandleStore(config.TradeCandleIntervals, config.TradeCandleMax)
+		if err != nil {
+			log.Fatalf("Invalid trade candle config: %v", err)
+		}
+		tradeCandlePID = engine.Spawn(
+			func() actor.Receiver {
+				return NewTradeCandleActor(tradeCandles, config.TradeCandleSymbols)
+			},
+			"tradeCandles",
+		)
+	}
+	
+	// Spawn daily rollup actor; intervals above 1d can't be rolled up into days
+	if d, ok := intervalDuration(config.CandleInterval); config.DailyRollupEnabled && features.Enabled(FlagDailyRollup) && !readerMode && ok && d <= 24*time.Hour {
+		dailyStore = NewDailyStore()
+		if config.DailyStorePath != "" {
+			if err := dailyStore.Load(config.DailyStorePath); err != nil {
+				log.Printf("[DailyRollup] ERROR: %v", err)
+			}
+		}
+		watchdog.Spawn(
+			&dailyRollupPID,
+			func() actor.Receiver {
+				return NewDailyRollupActor(
+					cache,
+					dailyStore,
+					hyperliquidClient,
+					time.Duration(config.RefreshIntervalMin)*time.Minute,
+					config.DailyBackfillPerTick,
+					config.DailyBackfillDays,
+					config.DailyStorePath,
+				)
+			},
+			"dailyRollup",
+		)
+	}
+	
+	// Spawn market data enrichment actor
+	if config.CoinGeckoEnabled {
+		coinGeckoClient := NewCoinGeckoClient(config.CoinGeckoBaseURL, config.CoinGeckoAPIKey)
+		marketDataPID = engine.Spawn(
+			func() actor.Receiver {
+				return NewMarketDataActor(
+					cache,
+					coinGeckoClient,
+					time.Duration(config.CoinGeckoRefreshMin)*time.Minute,
+					config.CoinGeckoPages,
+				)
+			},
+			"marketData",
+		)
+	}
+	
+	// Spawn snapshot history actor for /api/candles/{symbol}/asof
+	if snapshotHistoryEnabled() && !config.DryRun {
+		snapshotHistoryPID = engine.Spawn(
+			func() actor.Receiver {
+				return NewSnapshotHistoryActor(cache, snapshotHistoryDir(config.SnapshotPath),
+					time.Duration(config.SnapshotHistoryIntervalMin)*time.Minute,
+					time.Duration(config.SnapshotHistoryKeepHours)*time.Hour)
+			},
+			"snapshotHistory",
+		)
+	}
+
+	// Spawn FX rate actor for fiat quote conversion
+	if config.FXRatesURL != "" {
+		fxRates = NewFXRates()
+		fxRatePID = engine.Spawn(
+			func() actor.Receiver {
+				return NewFXRateActor(fxRates, config.FXRatesURL, time.Duration(config.FXRatesRefreshMin)*time.Minute)
+			},
+			"fxRates",
+		)
+	}
+	
+	// Spawn mid poller for ?live=true candles
+	if config.MidsPollSec > 0 && !readerMode && !config.DryRun {
+		midStore = NewMidStore(config.CandleInterval)
+		midPollerPID = engine.Spawn(
+			func() actor.Receiver {
+				return NewMidPollerActor(hyperliquidClient, midStore, time.Duration(config.MidsPollSec)*time.Second)
+			},
+			"mids",
+		)
+	}
+	
+	// Spawn exchange status poller for maintenance detection
+	if config.ExchangeStatusPollSec > 0 && !readerMode && !config.DryRun {
+		exchangeStatusPID = engine.Spawn(
+			func() actor.Receiver {
+				return NewExchangeStatusActor(hyperliquidClient, time.Duration(config.ExchangeStatusPollSec)*time.Second)
+			},
+			"exchangeStatus",
+		)
+	}
+	
+	// Spawn staleness watch for webhook notifications
+	if len(config.WebhookURLs) > 0 && config.WebhookStaleMinutes > 0 {
+		stalenessWatchPID = engine.Spawn(
+			func() actor.Receiver {
+				return NewStalenessWatchActor(cache, notifier, time.Duration(config.WebhookStaleMinutes)*time.Minute)
+			},
+			"stalenessWatch",
+		)
+	}
+	
+	// Spawn price alert evaluator
+	if config.AlertsEnabled && !config.ReadOnly {
+		alertStore = NewAlertStore(config.AlertsPath, config.AlertsMaxRules)
+		if err := alertStore.Load(); err != nil {
+			log.Printf("[Alerts] ERROR: %v", err)
+		}
+		alertPID = engine.Spawn(
+			func() actor.Receiver {
+				return NewAlertActor(cache, alertStore)
+			},
+			"alerts",
+		)
+	}
+	
+	// Spawn MQTT publisher
+	if config.MQTTBrokerURL != "" {
+		mqttPID = engine.Spawn(
+			func() actor.Receiver {
+				return NewMQTTPublisherActor(cache, MQTTConfig{
+					BrokerURL:   config.MQTTBrokerURL,
+					ClientID:    config.MQTTClientID,
+					Username:    config.MQTTUsername,
+					Password:    config.MQTTPassword,
+					TopicPrefix: config.MQTTTopicPrefix,
+					QoS:         byte(config.MQTTQoS),
+					Retain:      config.MQTTRetain,
+				})
+			},
+			"mqtt",
+		)
+	}
+	
+	// Spawn push webhook actor; more webhooks can be registered on the admin port
+	pushWebhooks = NewPushWebhookRegistry(config.PushWebhookURLs, config.PushWebhookMode)
+	pushWebhookPID = engine.Spawn(
 		func() actor.Receiver {
-			return NewSymbolFetcherActor(
-				cache,
-				hydromancerClient,
-				time.Duration(config.SymbolRefreshIntervalMin)*time.Minute,
-			)
+			return NewPushWebhookActor(cache, pushWebhooks, config.CandleInterval)
 		},
-		"symbolFetcher",
+		"pushWebhooks",
 	)
 	
-	// Spawn candle fetcher actor
-	candleFetcherPID = engine.Spawn(
+	// Purge changed symbols at the CDN after each cycle
+	cdnPurger, err = NewCDNPurger(config.CDNPurgeProvider, config.CDNPurgeURL, config.CDNPurgeToken)
+	if err != nil {
+		log.Fatalf("Invalid CDN purge config: %v", err)
+	}
+	if cdnPurger != nil && !readerMode {
+		cdnPurgePID = engine.Spawn(
+			func() actor.Receiver {
+				return NewCDNPurgeActor(cdnPurger)
+			},
+			"cdnPurge",
+		)
+	}
+	
+	// Spawn the job runner after every actor its jobs send to, so restored
+	// jobs don't run before their target exists
+	storePID(&jobRunnerPID, engine.Spawn(
 		func() actor.Receiver {
-			return NewCandleFetcherActor(
-				cache,
-				hyperliquidClient,
-				time.Duration(config.RefreshIntervalMin)*time.Minute,
-				config.CandleInterval,
-				config.CandleDays,
-			)
+			return NewJobRunnerActor(jobQueue, config.JobWorkers)
 		},
-		"candleFetcher",
+		"jobRunner",
+	))
+	
+	// Spawn watchdog for the actors above
+	watchdogPID = engine.Spawn(
+		func() actor.Receiver {
+			return NewWatchdogActor(watchdog)
+		},
+		"watchdog",
 	)
 	
 	// Setup HTTP server
-	mux := http.NewServeMux()
+	mux := newAPIMux()
 	
-	// API endpoints
-	mux.HandleFunc("/api/candles", logRequest(gzipHandler(handleGetAllCandles)))
-	mux.HandleFunc("/api/candles/", logRequest(gzipHandler(handleGetSymbolCandles)))
-	mux.HandleFunc("/api/symbols", logRequest(gzipHandler(handleGetSymbols)))
-	mux.HandleFunc("/health", logRequest(handleHealth))
+	// Wrap with CORS and request body limits
+	handler := corsMiddleware(maxBodyMiddleware(config.MaxRequestBodyBytes, requestLimitsMiddleware(config.MaxHeaderCount, config.MinBodyReadRate, mux)))
+	if config.ReadOnly {
+		log.Println("Running in public read-only mode: admin and mutation routes disabled")
+		handler = readOnlyMiddleware(handler)
+	}
 	
-	// Wrap with CORS
-	handler := corsMiddleware(mux)
+	// CIDR allow/deny lists, global plus per listener
+	globalFilter := mustIPFilter("IP", config.IPAllowlist, config.IPDenylist)
+	apiFilter := mustIPFilter("API_IP", config.APIIPAllowlist, config.APIIPDenylist)
+	adminFilter := mustIPFilter("ADMIN_IP", config.AdminIPAllowlist, config.AdminIPDenylist)
+	handler = ipFilterMiddleware("api", ipFilterChain{globalFilter, apiFilter}, handler)
+	if config.H2CEnabled {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
 	
 	// Start server
 	server := &http.Server{
-		Addr:         ":" + config.Port,
-		Handler:      handler,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Handler:           handler,
+		ReadTimeout:       time.Duration(config.ReadTimeoutSec) * time.Second,
+		ReadHeaderTimeout: time.Duration(config.ReadHeaderTimeoutSec) * time.Second,
+		WriteTimeout:      time.Duration(config.WriteTimeoutSec) * time.Second,
+		IdleTimeout:       time.Duration(config.IdleTimeoutSec) * time.Second,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+	}
+	
+	// Track idle keep-alive connections so the connection cap can reclaim them
+	var idleConns *idleConnTracker
+	if config.CullIdleConns && config.MaxConnections > 0 {
+		idleConns = newIdleConnTracker()
+		server.ConnState = idleConns.ConnState
+	}
+	
+	// Admin server has no write timeout so pprof profiles can run their full duration
+	adminServer := &http.Server{
+		Handler:           ipFilterMiddleware("admin", ipFilterChain{globalFilter, adminFilter}, newAdminMux(config.ReadOnly)),
+		ReadHeaderTimeout: time.Duration(config.ReadHeaderTimeoutSec) * time.Second,
+		IdleTimeout:       time.Duration(config.IdleTimeoutSec) * time.Second,
+	}
+	// Replication streams run indefinitely, so no write timeout here either
+	clusterServer := &http.Server{
+		Handler:           ipFilterMiddleware("cluster", ipFilterChain{globalFilter}, newClusterMux()),
+		ReadHeaderTimeout: time.Duration(config.ReadHeaderTimeoutSec) * time.Second,
+		IdleTimeout:       time.Duration(config.IdleTimeoutSec) * time.Second,
+	}
+	if !config.HTTP2Enabled {
+		// A non-nil empty map disables the automatic h2 upgrade over TLS
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
 	}
 	
 	// Graceful shutdown
@@ -134,23 +1002,131 @@ func main() {
 		
 		log.Println("Shutting down gracefully...")
 		
-		// Stop actors
-		engine.Poison(symbolFetcherPID)
-		engine.Poison(candleFetcherPID)
+		// Stop actors, the watchdog first so it doesn't respawn anything
+		<-engine.Poison(watchdogPID).Done()
+		if pid := loadPID(&symbolFetcherPID); pid != nil {
+			engine.Poison(pid)
+			engine.Poison(loadPID(&candleFetcherPID))
+		}
+		for _, p := range pipelines {
+			p.Stop()
+		}
+		if pid := loadPID(&sharedSnapshotPID); pid != nil {
+			engine.Poison(pid)
+		}
+		if replicationPID != nil {
+			engine.Poison(replicationPID)
+		}
+		if shardMemberPID != nil {
+			engine.Poison(shardMemberPID)
+		}
+		if tradeCandlePID != nil {
+			engine.Poison(tradeCandlePID)
+		}
+		if candleStreamPID != nil {
+			engine.Poison(candleStreamPID)
+		}
+		if marketDataPID != nil {
+			engine.Poison(marketDataPID)
+		}
+		if snapshotHistoryPID != nil {
+			engine.Poison(snapshotHistoryPID)
+		}
+		if fxRatePID != nil {
+			engine.Poison(fxRatePID)
+		}
+		if midPollerPID != nil {
+			engine.Poison(midPollerPID)
+		}
+		if exchangeStatusPID != nil {
+			engine.Poison(exchangeStatusPID)
+		}
+		if stalenessWatchPID != nil {
+			engine.Poison(stalenessWatchPID)
+		}
+		if alertPID != nil {
+			engine.Poison(alertPID)
+		}
+		if mqttPID != nil {
+			engine.Poison(mqttPID)
+		}
+		engine.Poison(pushWebhookPID)
+		if cdnPurgePID != nil {
+			engine.Poison(cdnPurgePID)
+		}
+		engine.Poison(jobRunnerPID)
+		if pid := loadPID(&dailyRollupPID); pid != nil {
+			<-engine.Poison(pid).Done()
+		}
+		
+		// A dry run's empty series must not replace a real snapshot
+		if config.SnapshotPath != "" && !config.DryRun {
+			if err := saveSnapshot(config.SnapshotPath, cache); err != nil {
+				log.Printf("[Snapshot] ERROR: %v", err)
+				errorTrace.Record(SubsystemStorage, "snapshot", err)
+			}
+		}
 		
 		// Shutdown HTTP server
 		if err := server.Close(); err != nil {
 			log.Printf("Error shutting down server: %v", err)
 		}
+		adminServer.Close()
+		clusterServer.Close()
 		
 		os.Exit(0)
 	}()
 	
-	log.Printf("Server started on port %s", config.Port)
-	log.Printf("Candle interval: %s, History: %d days", config.CandleInterval, config.CandleDays)
+	listeners, err := openListeners(config.ListenAddrs, config.UnixSocketMode)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	
+	log.Printf("Server started on %s", strings.Join(config.ListenAddrs, ", "))
+	log.Printf("Candle interval: %s, History: %d days", config.CandleInterval, config.LookbackDays(config.CandleInterval))
 	log.Printf("Refresh intervals - Candles: %dm, Symbols: %dm", config.RefreshIntervalMin, config.SymbolRefreshIntervalMin)
+	log.Printf("JSON encoder: %s", jsonEncoder.Name())
+	
+	// Serve every listener with the same server, under one connection cap;
+	// the first failure is fatal
+	connCap := newConnLimit(config.MaxConnections, idleConns)
+	errChan := make(chan error, len(listeners)+1)
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			// TLS only applies to network listeners, unix sockets stay local plaintext
+			useTLS := config.TLSCertFile != "" && ln.Addr().Network() != "unix"
+			ln = newLimitListener(ln, connCap, useTLS)
+			if useTLS {
+				errChan <- server.ServeTLS(ln, config.TLSCertFile, config.TLSKeyFile)
+			} else {
+				errChan <- server.Serve(ln)
+			}
+		}(ln)
+	}
 	
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if config.AdminAddr != "" {
+		adminLn, err := openListener(config.AdminAddr, config.UnixSocketMode)
+		if err != nil {
+			log.Fatalf("Failed to listen for admin: %v", err)
+		}
+		log.Printf("Admin server started on %s", config.AdminAddr)
+		go func() {
+			errChan <- adminServer.Serve(adminLn)
+		}()
+	}
+	
+	if config.ClusterAddr != "" && !config.ReadOnly {
+		clusterLn, err := openListener(config.ClusterAddr, config.UnixSocketMode)
+		if err != nil {
+			log.Fatalf("Failed to listen for cluster: %v", err)
+		}
+		log.Printf("Cluster server started on %s", config.ClusterAddr)
+		go func() {
+			errChan <- clusterServer.Serve(clusterLn)
+		}()
+	}
+	
+	if err := <-errChan; err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
@@ -158,17 +1134,23 @@ func main() {
 // HTTP Handlers
 
 func handleGetAllCandles(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	setOmittedHeader(w, requestCache(r))
+	setSurrogateKeys(w, surrogateKeyCandles, surrogateKeyAll, intervalSurrogateKey(requestInterval(r)))
+	if setValidators(w, r, requestCache(r).GetLastUpdate()) {
 		return
 	}
-	
-	allCandles := cache.GetAll()
-	
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("ETag", generateETag(cache.GetLastUpdate()))
+	if r.Method == http.MethodHead {
+		return // headLengthHandler fills in the last rendered length
+	}
+	
+	allCandles := requestCache(r).GetAll()
+	for symbol, entry := range allCandles {
+		applyPrecision(&entry, r.URL.Query())
+		allCandles[symbol] = entry
+	}
 	
-	if err := json.NewEncoder(w).Encode(allCandles); err != nil {
+	if err := writeJSON(r.Context(), w, allCandles); err != nil {
 		log.Printf("Error encoding response: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -176,30 +1158,199 @@ func handleGetAllCandles(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleGetSymbolCandles(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	symbol := strings.ToUpper(r.PathValue("symbol"))
+	
+	// Extra pipelines serve their own cache only: no trade stream, on-demand
+	// fetches, live mids or daily history
+	pipeline := requestPipeline(r)
+	candleCache := requestCache(r)
 	
-	// Extract symbol from path: /api/candles/BTC -> BTC
-	path := strings.TrimPrefix(r.URL.Path, "/api/candles/")
-	symbol := strings.ToUpper(path)
+	// Sub-minute intervals are served from the trade stream builder
+	var entry CacheEntry
+	var exists bool
+	cachedInterval := requestInterval(r)
+	interval := cachedInterval
+	resampleTo := "" // Calendar interval built from the cached series
 	
-	if symbol == "" {
-		http.Error(w, "Symbol required", http.StatusBadRequest)
+	// Overridden symbols are served at their own interval unless another is asked for
+	var override SymbolOverride
+	var useOverride, requireOverride bool
+	if pipeline == nil {
+		override, useOverride = symbolOverrides.Separate(symbol)
+	}
+	if requested := r.URL.Query().Get("interval"); requested != "" {
+		normalized, err := normalizeInterval(requested)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		useOverride = useOverride && normalized == override.Interval
+		requireOverride = useOverride
+		switch {
+		case normalized == interval:
+		case useOverride:
+		case pipeline == nil && tradeCandles != nil && tradeCandles.HasInterval(normalized):
+			interval = normalized
+		case canResample(interval, normalized):
+			resampleTo = normalized
+		default:
+			http.Error(w, fmt.Sprintf("Interval %s is not served; see /api/intervals", normalized), http.StatusBadRequest)
+			return
+		}
+	}
+	loc, err := requestLocation(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	
-	entry, exists := cache.Get(symbol)
+	if r.URL.Query().Get("tz") != "" && resampleTo == "" {
+		http.Error(w, "tz applies to resampled intervals only: use interval=1d, 1w or 1M", http.StatusBadRequest)
+		return
+	}
+	barType, barSize, err := parseBarQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if barType != "" && resampleTo != "" {
+		http.Error(w, "type=renko|range can't be combined with a resampled interval", http.StatusBadRequest)
+		return
+	}
+	page, err := parseCandlePage(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	symbol = candleCache.CanonicalSymbol(symbol)
+	if interval != cachedInterval {
+		entry, exists = tradeCandles.Get(symbol, interval)
+	} else {
+		candleCache.Touch(symbol)
+		// Only listed symbols are ranked, so made-up names can't grow the stats
+		if pipeline == nil && cache.HasSymbol(symbol) {
+			accessStats.Record(symbol)
+		}
+		entry, exists = candleCache.Get(symbol)
+		
+		// Valid but not yet cached (e.g. newly listed or evicted): fetch it now
+		if !exists && pipeline == nil && cache.HasSymbol(symbol) && inShard(symbol) && onDemand != nil {
+			entry, exists = onDemand.Fetch(symbol, time.Duration(config.OnDemandWaitMs)*time.Millisecond)
+			if !exists {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Retry-After", "2")
+				w.WriteHeader(http.StatusAccepted)
+				json.NewEncoder(w).Encode(map[string]string{
+					"status": "pending",
+					"symbol": symbol,
+				})
+				return
+			}
+		}
+	}
 	if !exists {
 		http.Error(w, "Symbol not found", http.StatusNotFound)
 		return
 	}
+	if useOverride {
+		// Until the override series is fetched the main one stands in
+		if series, ok := symbolOverrides.Series(symbol); ok {
+			entry = series
+			entry.Interval = override.Interval
+			interval = override.Interval
+		} else if requireOverride {
+			http.Error(w, fmt.Sprintf("%s %s candles are not fetched yet", symbol, override.Interval), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	
+	// ?live=true brings the last candle up to date with the polled mids
+	var liveUpdate time.Time
+	if r.URL.Query().Get("live") == "true" && pipeline == nil && interval == cachedInterval && features.Enabled(FlagLiveMids) {
+		if candles, ok := midStore.Overlay(symbol, entry.Candles, entry.LastUpdate); ok {
+			entry.Candles = candles
+			entry.Live = true
+			liveUpdate = midStore.Updated()
+		}
+	}
 	
+	// Weeks and months come from the long daily history when the bucket
+	// boundaries are UTC days, which is how the daily store is kept
+	if (resampleTo == "1w" || resampleTo == "1M") && loc.String() == "UTC" && dailyStore != nil && pipeline == nil {
+		if daily, ok := dailyStore.Get(symbol); ok {
+			entry, interval = daily, "1d"
+		}
+	}
+	
+	candles, err := filterCandles(entry.Candles, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	entry.Candles = candles
+	
+	// Converted prices also change when the reference series or rates do
+	etagTime := entry.LastUpdate
+	if liveUpdate.After(etagTime) {
+		etagTime = liveUpdate
+	}
+	keys := []string{surrogateKeyCandles, symbolSurrogateKey(symbol)}
+	if quote := strings.ToUpper(r.URL.Query().Get("quote")); quote != "" && quote != "USD" {
+		if pipeline != nil {
+			http.Error(w, "quote is only served by the main pipeline", http.StatusBadRequest)
+			return
+		}
+		converted, refUpdate, err := convertQuote(entry.Candles, quote)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entry.Candles = converted
+		entry.Quote = quote
+		if refUpdate.After(etagTime) {
+			etagTime = refUpdate
+		}
+		if cache.HasSymbol(cache.CanonicalSymbol(quote)) {
+			keys = append(keys, symbolSurrogateKey(cache.CanonicalSymbol(quote)))
+		}
+	}
+	
+	// Resample after quote conversion, which works candle by candle
+	if resampleTo != "" {
+		buckets, err := resample(entry.Candles, interval, resampleTo, loc)
+		if err != nil {
+			http.Error(w, err.Error()+"; use a shorter CANDLE_INTERVAL", http.StatusBadRequest)
+			return
+		}
+		entry.Candles = NewCandleSeries(buckets)
+		entry.Interval = resampleTo
+		entry.Timezone = loc.String()
+		interval = resampleTo
+	}
+	keys = append(keys, intervalSurrogateKey(interval))
+	
+	if barType != "" {
+		bars, err := buildPriceBars(entry.Candles, barType, barSize)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entry.Candles = NewCandleSeries(bars)
+		entry.Type = barType
+		entry.BarSize = barSize
+	}
+	entry.Candles = page.apply(entry.Candles)
+	applyPrecision(&entry, r.URL.Query())
+	
+	setSurrogateKeys(w, keys...)
+	if setValidators(w, r, etagTime) {
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("ETag", generateETag(entry.LastUpdate))
+	if r.Method == http.MethodHead {
+		return
+	}
 	
-	if err := json.NewEncoder(w).Encode(entry); err != nil {
+	if err := writeJSON(r.Context(), w, entry); err != nil {
 		log.Printf("Error encoding response: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -207,19 +1358,49 @@ func handleGetSymbolCandles(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleGetSymbols(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	q, err := parseSymbolQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	
-	symbols := cache.GetSymbols()
+	// Symbols and their metadata only change when the symbol list or market
+	// data is refreshed, but grouped stats also follow the candle cache
+	group := r.URL.Query().Get("group") == "true"
+	symbolCache := requestCache(r)
+	etagTime := symbolCache.GetSymbolUpdate()
+	if marketDataUpdate := symbolCache.GetMarketDataUpdate(); marketDataUpdate.After(etagTime) {
+		etagTime = marketDataUpdate
+	}
+	if lastUpdate := symbolCache.GetLastUpdate(); group && lastUpdate.After(etagTime) {
+		etagTime = lastUpdate
+	}
+	if setETag(w, r, generateETag(etagTime)) {
+		return
+	}
 	
-	w.Header().Set("Content-Type", "application/json")
+	assets := selectSymbols(symbolCache.GetMetadata(), symbolCache.GetSymbols(), q)
+	symbols := make([]string, len(assets))
+	for i := range assets {
+		symbols[i] = assets[i].Name
+		assets[i].Category = categories.Of(assets[i].Name)
+	}
 	
-	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+	response := map[string]interface{}{
 		"symbols": symbols,
 		"count":   len(symbols),
-	}); err != nil {
+	}
+	if r.URL.Query().Get("details") == "true" {
+		response["assets"] = assets
+	}
+	if group {
+		response["groups"] = categories.Groups(symbols)
+		response["categories"] = categoryStats(symbolCache.GetAll(), categories, r.URL.Query().Get("precision") == "full")
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	
+	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("Error encoding response: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -227,19 +1408,38 @@ func handleGetSymbols(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleHealth(w http.ResponseWriter, r *http.Request) {
-	symbols := cache.GetSymbols()
-	lastUpdate := cache.GetLastUpdate()
-	symbolUpdate := cache.GetSymbolUpdate()
-	
 	health := HealthResponse{
-		Status:       "healthy",
-		SymbolCount:  len(symbols),
-		LastUpdate:   lastUpdate,
-		SymbolUpdate: symbolUpdate,
+		SymbolCount:  len(cache.GetSymbols()),
+		LastUpdate:   cache.GetLastUpdate(),
+		SymbolUpdate: cache.GetSymbolUpdate(),
+		StaleCount:   cache.StaleCount(),
+		NextRefresh:  scheduler.All(time.Now()),
+	}
+	if status, ok := exchangeStatus.Get(); ok {
+		health.Exchange = &status
+	}
+	evaluateHealth(&health, HealthRules{
+		UpstreamMaxAge: time.Duration(config.HealthUpstreamMaxAgeMin) * time.Minute,
+		CacheMaxAge:    time.Duration(config.HealthCacheMaxAgeMin) * time.Minute,
+	})
+	
+	body, err := json.Marshal(health)
+	if err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	
+	// Checks are live, so the ETag follows the content rather than update times
+	if setETag(w, r, contentETag(body)) {
+		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(health)
+	if health.Status == HealthUnhealthy && config.HealthFailStatus {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(append(body, '\n'))
 }
 
 // Middleware
@@ -247,18 +1447,140 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		if config.ReadOnly {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+		} else {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		}
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Signature, X-Signature-Algorithm, X-Next-Cursor, X-Symbols-Omitted")
 		
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
+		// Preflights are answered by the router with the route's methods
+		next.ServeHTTP(w, r)
+	})
+}
+
+// mustIPFilter builds an IP filter from <prefix>_ALLOWLIST/_DENYLIST,
+// exiting on invalid entries
+func mustIPFilter(prefix string, allow, deny []string) *IPFilter {
+	filter, err := NewIPFilter(allow, deny)
+	if err != nil {
+		log.Fatalf("Invalid %s_ALLOWLIST/%s_DENYLIST: %v", prefix, prefix, err)
+	}
+	return filter
+}
+
+// readOnlyMiddleware rejects anything but safe methods, backing up the
+// route-level exclusion of mutation endpoints in public mode
+func readOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// maxBodyMiddleware caps how many bytes a handler can read from a request body
+func maxBodyMiddleware(limit int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
 			return
 		}
-		
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestLimitsMiddleware rejects requests with too many header fields and
+// aborts bodies uploaded slower than minRate bytes/second after a grace
+// period, so slow clients can't pin handlers and connections
+func requestLimitsMiddleware(maxHeaders int, minRate int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if maxHeaders > 0 && len(r.Header) > maxHeaders {
+			http.Error(w, "Too many request headers", http.StatusRequestHeaderFieldsTooLarge)
+			return
+		}
+		if minRate > 0 && r.Body != nil && r.Body != http.NoBody {
+			r.Body = newMinRateReader(r.Body, minRate, bodyReadGrace)
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// newAPIMux builds the handler for the public API routes
+func newAPIMux() *Router {
+	mux := NewRouter()
+	
+	// API endpoints
+	mux.HandleFunc("/api/candles", logRequest(candleDumpLimiter.Limit(deadlineHandler(gzipHandlerLevel(gzip.BestSpeed, headLengthHandler(signResponse(envelopeHandler(negotiate(candleDumpFormats, handleGetAllCandles)))))))), http.MethodGet, http.MethodHead)
+	mux.HandleFunc("/api/candles/{symbol}", logRequest(deadlineHandler(gzipHandler(headLengthHandler(signResponse(envelopeHandler(negotiate(candleFormats, handleGetSymbolCandles))))))), http.MethodGet, http.MethodHead)
+	mux.HandleFunc("/api/candles/{symbol}/coverage", logRequest(deadlineHandler(gzipHandler(signResponse(envelopeHandler(negotiate(dataFormats, handleGetCoverage)))))), http.MethodGet, http.MethodHead)
+	mux.HandleFunc("/api/combined/{symbol}", logRequest(deadlineHandler(gzipHandler(signResponse(envelopeHandler(negotiate(dataFormats, handleGetCombined)))))), http.MethodGet, http.MethodHead)
+	mux.HandleFunc("/api/returns/{symbol}", logRequest(deadlineHandler(gzipHandler(signResponse(envelopeHandler(negotiate(dataFormats, handleGetReturns)))))), http.MethodGet, http.MethodHead)
+	mux.HandleFunc("/api/seasonality/{symbol}", logRequest(deadlineHandler(gzipHandler(signResponse(envelopeHandler(negotiate(dataFormats, handleGetSeasonality)))))), http.MethodGet, http.MethodHead)
+	mux.HandleFunc("/api/export/{symbol}", logRequest(deadlineHandler(gzipHandler(signResponse(negotiate(candleFormats, handleExport))))), http.MethodGet)
+	mux.HandleFunc("/api/candles/{symbol}/asof", logRequest(deadlineHandler(gzipHandler(signResponse(envelopeHandler(negotiate(dataFormats, handleGetCandlesAsOf)))))), http.MethodGet, http.MethodHead)
+	mux.HandleFunc("/api/candles/latest", logRequest(deadlineHandler(signResponse(envelopeHandler(negotiate(dataFormats, handleGetLatestCandles))))), http.MethodGet, http.MethodHead)
+	mux.HandleFunc("/api/mids", logRequest(deadlineHandler(signResponse(envelopeHandler(negotiate(dataFormats, handleGetMids))))), http.MethodGet, http.MethodHead)
+	mux.HandleFunc("/api/intervals", logRequest(deadlineHandler(signResponse(handleGetIntervals))), http.MethodGet)
+	mux.HandleFunc("/api/symbols", logRequest(deadlineHandler(gzipHandler(signResponse(envelopeHandler(negotiate(dataFormats, handleGetSymbols)))))), http.MethodGet)
+	mux.HandleFunc("/api/summary", logRequest(deadlineHandler(gzipHandler(signResponse(envelopeHandler(negotiate(dataFormats, handleGetSummary)))))), http.MethodGet)
+	mux.HandleFunc("/api/daily/{symbol}", logRequest(deadlineHandler(gzipHandler(signResponse(envelopeHandler(negotiate(candleFormats, handleGetDaily)))))), http.MethodGet)
+	mux.HandleFunc("/api/heatmap", logRequest(deadlineHandler(gzipHandler(signResponse(envelopeHandler(negotiate(dataFormats, handleGetHeatmap)))))), http.MethodGet)
+	mux.HandleFunc("/api/volatility", logRequest(deadlineHandler(gzipHandler(signResponse(envelopeHandler(negotiate(dataFormats, handleGetVolatility)))))), http.MethodGet)
+	mux.HandleFunc("/api/anomalies", logRequest(deadlineHandler(gzipHandler(signResponse(envelopeHandler(negotiate(dataFormats, handleGetAnomalies)))))), http.MethodGet)
+	mux.HandleFunc("/api/beta", logRequest(deadlineHandler(gzipHandler(signResponse(envelopeHandler(negotiate(dataFormats, handleGetBeta)))))), http.MethodGet)
+	mux.HandleFunc("/api/events", logRequest(deadlineHandler(gzipHandler(envelopeHandler(negotiate(dataFormats, handleGetEvents))))), http.MethodGet)
+	mux.HandleFunc("/api/events/stream", logRequest(handleEventStream), http.MethodGet)
+	mux.HandleFunc("/api/stream", logRequest(handleCandleStream), http.MethodGet)
+	mux.HandleFunc("/ws/candles", logRequest(handleCandleWebSocket), http.MethodGet)
+	if config.AlertsEnabled && !config.ReadOnly {
+		mux.HandleFunc("/api/alerts", logRequest(deadlineHandler(handleAlerts)), http.MethodGet, http.MethodPost)
+		mux.HandleFunc("/api/alerts/{id}", logRequest(deadlineHandler(handleAlert)), http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+	mux.HandleFunc("/api/signing-key", logRequest(deadlineHandler(handleGetSigningKey)), http.MethodGet)
+	mux.HandleFunc("/health", logRequest(deadlineHandler(signResponse(handleHealth))), http.MethodGet, http.MethodHead)
+	
+	// Each extra pipeline serves its candles and symbols under its own prefix
+	for _, p := range pipelines {
+		prefix := "/" + p.Name
+		mux.HandleFunc(prefix+"/api/candles", withPipeline(p, logRequest(candleDumpLimiter.Limit(deadlineHandler(gzipHandlerLevel(gzip.BestSpeed, headLengthHandler(signResponse(envelopeHandler(negotiate(candleDumpFormats, handleGetAllCandles))))))))), http.MethodGet, http.MethodHead)
+		// Spot pair names contain a slash, e.g. /spot/api/candles/PURR/USDC
+		mux.HandleFunc(prefix+"/api/candles/{symbol...}", withPipeline(p, logRequest(deadlineHandler(gzipHandler(headLengthHandler(signResponse(envelopeHandler(negotiate(candleFormats, handleGetSymbolCandles)))))))), http.MethodGet, http.MethodHead)
+		mux.HandleFunc(prefix+"/api/symbols", withPipeline(p, logRequest(deadlineHandler(gzipHandler(signResponse(envelopeHandler(negotiate(dataFormats, handleGetSymbols))))))), http.MethodGet)
+	}
+	return mux
+}
+
+// requestDeadline is how long a request may run: slightly under
+// WRITE_TIMEOUT_SEC, so a render that can't finish in time is abandoned
+// before the server cuts the connection anyway
+func requestDeadline() time.Duration {
+	d := time.Duration(config.WriteTimeoutSec) * time.Second
+	return d - min(d/10, 2*time.Second)
+}
+
+// deadlineHandler cancels the request's context at requestDeadline. Handlers
+// and writeJSON stop working on a request once its context is done, which
+// also happens when the client disconnects.
+func deadlineHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d := requestDeadline()
+		if d <= 0 {
+			next(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next(w, r.WithContext(ctx))
+	}
+}
+
 func logRequest(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -269,6 +1591,8 @@ func logRequest(next http.HandlerFunc) http.HandlerFunc {
 		next(wrapped, r)
 		
 		duration := time.Since(start)
+		metrics.Inc("http_requests_total", "method", r.Method, "code", strconv.Itoa(wrapped.statusCode))
+		metrics.Add("http_request_duration_seconds_total", duration.Seconds(), "method", r.Method)
 		log.Printf("%s %s - %d - %v", r.Method, r.URL.Path, wrapped.statusCode, duration)
 	}
 }
@@ -283,34 +1607,86 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-func gzipHandler(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
-			next(w, r)
-			return
-		}
-		
-		w.Header().Set("Content-Encoding", "gzip")
-		gz := gzip.NewWriter(w)
-		defer gz.Close()
-		
-		gzw := gzipResponseWriter{Writer: gz, ResponseWriter: w}
-		next(gzw, r)
-	}
-}
-
-type gzipResponseWriter struct {
-	io.Writer
-	http.ResponseWriter
+// Unwrap lets http.ResponseController reach the connection, for streams
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 }
 
-func (w gzipResponseWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
+// Hijack hands the connection over to WebSocket upgrades
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	rw.statusCode = http.StatusSwitchingProtocols
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
 }
 
 // Utilities
 
 func generateETag(t time.Time) string {
-	return `"` + strconv.FormatInt(t.Unix(), 10) + `"`
+	return `"` + strconv.FormatInt(t.UnixNano(), 36) + `"`
+}
+
+// contentETag derives an ETag from a response body
+func contentETag(body []byte) string {
+	h := fnv.New64a()
+	h.Write(body)
+	return `"` + strconv.FormatUint(h.Sum64(), 36) + `"`
+}
+
+// setETag sets the ETag and revalidation headers and answers conditional
+// requests. It returns true when a 304 was written and the handler should stop.
+func setETag(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// setOmittedHeader tells clients of an aggregate response how many symbols
+// it leaves out because they were evicted
+func setOmittedHeader(w http.ResponseWriter, c *Cache) {
+	if n := c.Omitted(); n > 0 {
+		w.Header().Set("X-Symbols-Omitted", strconv.Itoa(n))
+	}
+}
+
+// setValidators sets an ETag and Last-Modified derived from the data's
+// update time and answers conditional requests, honouring If-Modified-Since
+// when there is no If-None-Match. It returns true when a 304 was written.
+func setValidators(w http.ResponseWriter, r *http.Request, updated time.Time) bool {
+	if !updated.IsZero() {
+		w.Header().Set("Last-Modified", updated.UTC().Format(http.TimeFormat))
+	}
+	if setETag(w, r, generateETag(updated)) {
+		return true
+	}
+	if r.Header.Get("If-None-Match") != "" || updated.IsZero() {
+		return false
+	}
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !updated.Truncate(time.Second).After(since) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// etagMatches reports whether an If-None-Match header matches the ETag,
+// using weak comparison as required for GET/HEAD
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
 }
 
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metrics is the process-wide registry exposed at /metrics on the admin listener
+var metrics = NewMetrics()
+
+type metricKind int
+
+const (
+	counterMetric metricKind = iota
+	gaugeMetric
+)
+
+// Metrics is a minimal Prometheus-compatible registry of counters and gauges
+type Metrics struct {
+	mu     sync.RWMutex
+	kinds  map[string]metricKind
+	values map[string]map[string]float64 // name -> rendered labels -> value
+}
+
+// NewMetrics creates an empty registry
+func NewMetrics() *Metrics {
+	return &Metrics{
+		kinds:  make(map[string]metricKind),
+		values: make(map[string]map[string]float64),
+	}
+}
+
+// Inc adds one to a counter. Labels are given as key, value pairs.
+func (m *Metrics) Inc(name string, labels ...string) {
+	m.Add(name, 1, labels...)
+}
+
+// Add adds delta to a counter
+func (m *Metrics) Add(name string, delta float64, labels ...string) {
+	m.update(name, counterMetric, labels, func(v float64) float64 { return v + delta })
+}
+
+// Set sets a gauge to value
+func (m *Metrics) Set(name string, value float64, labels ...string) {
+	m.update(name, gaugeMetric, labels, func(float64) float64 { return value })
+}
+
+// Get returns the current value of a series, or zero if unset
+func (m *Metrics) Get(name string, labels ...string) float64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.values[name][renderLabels(labels)]
+}
+
+func (m *Metrics) update(name string, kind metricKind, labels []string, fn func(float64) float64) {
+	key := renderLabels(labels)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series, ok := m.values[name]
+	if !ok {
+		series = make(map[string]float64)
+		m.values[name] = series
+		m.kinds[name] = kind
+	}
+	series[key] = fn(series[key])
+}
+
+// WritePrometheus writes all series in the Prometheus text exposition format
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := make([]string, 0, len(m.values))
+	for name := range m.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		kind := "counter"
+		if m.kinds[name] == gaugeMetric {
+			kind = "gauge"
+		}
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+
+		series := m.values[name]
+		keys := make([]string, 0, len(series))
+		for key := range series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s%s %s\n", name, key, formatMetricValue(series[key]))
+		}
+	}
+}
+
+func renderLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatMetricValue(v float64) string {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	// Cache gauges are sampled at scrape time rather than on every write
+	metrics.Set("cache_symbols", float64(len(cache.GetSymbols())))
+	if lastUpdate := cache.GetLastUpdate(); !lastUpdate.IsZero() {
+		metrics.Set("cache_last_update_timestamp_seconds", float64(lastUpdate.Unix()))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WritePrometheus(w)
+}
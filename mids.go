@@ -0,0 +1,147 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// liveBar is the price action of the current candle interval as traced by
+// polled mids
+type liveBar struct {
+	start   int64 // Candle open time (ms)
+	open    float64
+	high    float64
+	low     float64
+	close   float64
+	updated time.Time
+}
+
+// MidStore keeps the latest mid of every coin, folded into a bar per symbol
+// for the cached candle interval
+type MidStore struct {
+	mu      sync.RWMutex
+	step    int64 // Candle interval (ms)
+	bars    map[string]liveBar
+	updated time.Time
+}
+
+// NewMidStore creates an empty store for candles of interval
+func NewMidStore(interval string) *MidStore {
+	step := time.Hour.Milliseconds()
+	if d, ok := intervalDuration(interval); ok {
+		step = d.Milliseconds()
+	}
+	return &MidStore{step: step, bars: make(map[string]liveBar)}
+}
+
+// Update folds mids polled at into each symbol's bar, starting a new bar
+// when a new candle interval has begun
+func (s *MidStore) Update(mids map[string]float64, at time.Time) {
+	start := at.UnixMilli() - at.UnixMilli()%s.step
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for symbol, mid := range mids {
+		bar, ok := s.bars[symbol]
+		if !ok || bar.start != start {
+			bar = liveBar{start: start, open: mid, high: mid, low: mid}
+		}
+		bar.high = max(bar.high, mid)
+		bar.low = min(bar.low, mid)
+		bar.close = mid
+		bar.updated = at
+		s.bars[symbol] = bar
+	}
+	s.updated = at
+}
+
+// Updated returns when mids were last polled
+func (s *MidStore) Updated() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.updated
+}
+
+// Overlay brings candles, fetched at fetched, up to date with the mids
+// polled since: the last candle's close, high and low follow the mids, or an
+// in-progress candle is appended when its interval began after the fetch.
+// It reports whether the series changed.
+func (s *MidStore) Overlay(symbol string, candles CandleSeries, fetched time.Time) (CandleSeries, bool) {
+	if s == nil || candles.Len() == 0 {
+		return candles, false
+	}
+	s.mu.RLock()
+	bar, ok := s.bars[symbol]
+	s.mu.RUnlock()
+	if !ok || !bar.updated.After(fetched) {
+		return candles, false
+	}
+
+	result := candles.Candles()
+	last := &result[len(result)-1]
+	switch {
+	case bar.start == last.Timestamp:
+		last.High = max(last.High, bar.high)
+		last.Low = min(last.Low, bar.low)
+		last.Close = bar.close
+	case bar.start > last.Timestamp:
+		// Volume isn't known until the candle is fetched
+		result = append(result, Candle{Timestamp: bar.start, Open: bar.open, High: bar.high, Low: bar.low, Close: bar.close})
+	default:
+		return candles, false
+	}
+	return NewCandleSeries(result), true
+}
+
+// MidPollerActor polls allMids so ?live=true candles tick between fetch
+// cycles
+type MidPollerActor struct {
+	hyperliquidClient *HyperliquidClient
+	store             *MidStore
+	pollInterval      time.Duration
+}
+
+// NewMidPollerActor creates a new mid poller actor
+func NewMidPollerActor(hyperliquidClient *HyperliquidClient, store *MidStore, pollInterval time.Duration) *MidPollerActor {
+	return &MidPollerActor{
+		hyperliquidClient: hyperliquidClient,
+		store:             store,
+		pollInterval:      pollInterval,
+	}
+}
+
+func (a *MidPollerActor) Receive(ctx *actor.Context) {
+	switch ctx.Message().(type) {
+	case actor.Started:
+		log.Println("[Mids] Actor started")
+		a.poll()
+		scheduler.Add(RefreshMids, a.pollInterval, ctx.PID(), PollMidsMsg{})
+
+	case PollMidsMsg:
+		a.poll()
+
+	case actor.Stopped:
+		scheduler.Remove(RefreshMids, ctx.PID())
+		log.Println("[Mids] Actor stopped")
+	}
+}
+
+func (a *MidPollerActor) poll() {
+	if !features.Enabled(FlagLiveMids) {
+		return
+	}
+	mids, err := a.hyperliquidClient.FetchAllMids()
+	if err != nil {
+		log.Printf("[Mids] ERROR: %v", err)
+		metrics.Inc("mids_poll_total", "result", "error")
+		return
+	}
+	a.store.Update(mids, time.Now())
+	metrics.Inc("mids_poll_total", "result", "success")
+}
@@ -0,0 +1,36 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// mappedFile is a read-only view of a file's contents
+type mappedFile struct {
+	data []byte
+	info os.FileInfo
+}
+
+// mapFile reads path into memory. Platforms without mmap get a private copy
+// per process, so readers work but don't share memory.
+func mapFile(path string) (*mappedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, info.Size())
+	if _, err := f.ReadAt(data, 0); err != nil && info.Size() > 0 {
+		return nil, err
+	}
+	return &mappedFile{data: data, info: info}, nil
+}
+
+// release drops the copy; the garbage collector reclaims it
+func (m *mappedFile) release() {
+	m.data = nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MQTTConfig holds broker connection and publishing settings
+type MQTTConfig struct {
+	BrokerURL   string
+	ClientID    string
+	Username    string
+	Password    string
+	TopicPrefix string
+	QoS         byte
+	Retain      bool
+}
+
+// MQTTPublisherActor publishes the latest price and candle of every changed
+// symbol after each candle cycle, on per-symbol topics:
+//
+//	<prefix>/<SYMBOL>/price   latest close as a plain number
+//	<prefix>/<SYMBOL>/candle  latest candle as JSON
+type MQTTPublisherActor struct {
+	cache  *Cache
+	config MQTTConfig
+	client mqtt.Client
+}
+
+// NewMQTTPublisherActor creates a new MQTT publisher actor
+func NewMQTTPublisherActor(cache *Cache, config MQTTConfig) *MQTTPublisherActor {
+	return &MQTTPublisherActor{
+		cache:  cache,
+		config: config,
+	}
+}
+
+func (a *MQTTPublisherActor) Receive(ctx *actor.Context) {
+	switch msg := ctx.Message().(type) {
+	case actor.Started:
+		opts := mqtt.NewClientOptions().
+			AddBroker(a.config.BrokerURL).
+			SetClientID(a.config.ClientID).
+			SetUsername(a.config.Username).
+			SetPassword(a.config.Password).
+			SetAutoReconnect(true).
+			SetConnectRetry(true).
+			SetConnectRetryInterval(5 * time.Second).
+			SetOnConnectHandler(func(mqtt.Client) {
+				log.Printf("[MQTT] Connected to %s", a.config.BrokerURL)
+			}).
+			SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+				log.Printf("[MQTT] ERROR: Connection lost: %v", err)
+			})
+		a.client = mqtt.NewClient(opts)
+		// With connect retry enabled this returns immediately and keeps trying
+		a.client.Connect()
+		ctx.Engine().Subscribe(ctx.PID())
+		log.Printf("[MQTT] Publisher started (prefix %q)", a.config.TopicPrefix)
+
+	case CandleCycleDoneMsg:
+		a.publish(msg.Changed)
+
+	case ListingsBackfilledMsg:
+		a.publish(msg.Symbols)
+
+	case actor.Stopped:
+		ctx.Engine().Unsubscribe(ctx.PID())
+		if a.client != nil {
+			a.client.Disconnect(250)
+		}
+		log.Println("[MQTT] Publisher stopped")
+	}
+}
+
+func (a *MQTTPublisherActor) publish(symbols []string) {
+	if !a.client.IsConnectionOpen() {
+		metrics.Add("mqtt_publish_total", float64(len(symbols)), "result", "skipped")
+		return
+	}
+
+	for _, symbol := range symbols {
+		entry, ok := a.cache.Get(symbol)
+		if !ok || entry.Candles.Len() == 0 {
+			continue
+		}
+		latest := entry.Candles.At(entry.Candles.Len() - 1)
+		candle, err := json.Marshal(latest)
+		if err != nil {
+			continue
+		}
+
+		prefix := fmt.Sprintf("%s/%s", a.config.TopicPrefix, symbol)
+		a.client.Publish(prefix+"/price", a.config.QoS, a.config.Retain, strconv.FormatFloat(latest.Close, 'f', -1, 64))
+		a.client.Publish(prefix+"/candle", a.config.QoS, a.config.Retain, candle)
+	}
+	metrics.Add("mqtt_publish_total", float64(len(symbols)), "result", "published")
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// formatMediaTypes lists the media types of each response format; the first
+// one is the Content-Type the format is served with
+var formatMediaTypes = map[string][]string{
+	"json":    {"application/json"},
+	"ndjson":  {"application/x-ndjson", "application/ndjson"},
+	"csv":     {"text/csv; charset=utf-8", "text/csv"},
+	"msgpack": {"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"},
+	"parquet": {"application/vnd.apache.parquet", "application/x-parquet"},
+}
+
+// Transcoder renders a handler's JSON body in another format
+type Transcoder func(w io.Writer, body []byte) error
+
+// Formats maps the formats a route offers besides JSON to their transcoders
+type Formats map[string]Transcoder
+
+// names returns json plus the offered formats, sorted
+func (f Formats) names() []string {
+	names := []string{"json"}
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+var (
+	// candleFormats is offered by routes returning a single CacheEntry
+	candleFormats = Formats{"ndjson": entryNDJSON, "csv": entryCSV, "msgpack": msgpackFromJSON, "parquet": entryParquet}
+	// candleDumpFormats is offered by routes returning entries keyed by symbol
+	candleDumpFormats = Formats{"ndjson": dumpNDJSON, "csv": dumpCSV, "msgpack": msgpackFromJSON, "parquet": dumpParquet}
+	// dataFormats is offered by every other JSON data route
+	dataFormats = Formats{"msgpack": msgpackFromJSON}
+)
+
+// negotiate picks the response format from ?format= or, failing that, the
+// Accept header, and transcodes the handler's JSON into it. Handlers keep
+// writing JSON and never see the negotiation. Each representation gets its
+// own ETag, so conditional requests keep working across formats.
+func negotiate(formats Formats, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		format, err := negotiateFormat(r, formats)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotAcceptable)
+			return
+		}
+		if format == "json" {
+			next(w, r)
+			return
+		}
+
+		suffix := "." + format
+		inner := r.Clone(r.Context())
+		inner.Header.Del("Accept-Encoding")
+		if match := representationETags(r.Header.Get("If-None-Match"), suffix); match != "" {
+			inner.Header.Set("If-None-Match", match)
+		} else {
+			inner.Header.Del("If-None-Match")
+		}
+		captured := &capturedResponse{ResponseWriter: w, statusCode: http.StatusOK}
+		next(captured, inner)
+
+		h := w.Header()
+		if etag := h.Get("ETag"); etag != "" {
+			h.Set("ETag", strings.TrimSuffix(etag, `"`)+suffix+`"`)
+		}
+		if r.Method == http.MethodHead {
+			// Nothing was rendered to transcode
+			if captured.statusCode == http.StatusOK && strings.HasPrefix(h.Get("Content-Type"), "application/json") {
+				h.Set("Content-Type", formatMediaTypes[format][0])
+			}
+			h.Del("Content-Length")
+			w.WriteHeader(captured.statusCode)
+			return
+		}
+		if captured.statusCode != http.StatusOK || h.Get("Content-Encoding") != "" ||
+			!strings.HasPrefix(h.Get("Content-Type"), "application/json") {
+			w.WriteHeader(captured.statusCode)
+			w.Write(captured.buf.Bytes())
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := formats[format](&buf, bytes.TrimSpace(captured.buf.Bytes())); err != nil {
+			log.Printf("Error encoding %s response: %v", format, err)
+			h.Del("ETag")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		h.Set("Content-Type", formatMediaTypes[format][0])
+		h.Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.Write(buf.Bytes())
+	}
+}
+
+// negotiateFormat returns the format to serve r in. An explicit ?format=
+// that the route doesn't offer is an error; an Accept header that matches
+// nothing falls back to JSON, like clients sending only text/html expect.
+func negotiateFormat(r *http.Request, formats Formats) (string, error) {
+	if requested := strings.ToLower(r.URL.Query().Get("format")); requested != "" {
+		if _, ok := formats[requested]; ok || requested == "json" {
+			return requested, nil
+		}
+		if _, known := formatMediaTypes[requested]; known {
+			return "", fmt.Errorf("Format %s is not available here; use one of: %s", requested, strings.Join(formats.names(), ", "))
+		}
+		return "", fmt.Errorf("Unknown format %q; use one of: %s", requested, strings.Join(formats.names(), ", "))
+	}
+
+	for _, mediaType := range acceptedMediaTypes(r.Header.Get("Accept")) {
+		switch mediaType {
+		case "*/*", "application/*":
+			return "json", nil
+		case "text/*":
+			if _, ok := formats["csv"]; ok {
+				return "csv", nil
+			}
+			continue
+		}
+		for _, name := range formats.names() {
+			for _, t := range formatMediaTypes[name] {
+				if mediaType == strings.SplitN(t, ";", 2)[0] {
+					return name, nil
+				}
+			}
+		}
+	}
+	return "json", nil
+}
+
+// acceptedMediaTypes returns the media types in an Accept header, most
+// preferred first, leaving out those with q=0
+func acceptedMediaTypes(header string) []string {
+	type accepted struct {
+		mediaType string
+		q         float64
+	}
+	var list []accepted
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+		q := 1.0
+		for _, p := range params[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(p), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			list = append(list, accepted{mediaType, q})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].q > list[j].q })
+
+	types := make([]string, len(list))
+	for i, a := range list {
+		types[i] = a.mediaType
+	}
+	return types
+}
+
+// representationETags keeps the If-None-Match candidates that name a
+// representation with suffix, stripped back to the handler's JSON ETag
+func representationETags(header, suffix string) string {
+	if strings.TrimSpace(header) == "*" {
+		return "*"
+	}
+	var kept []string
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if stripped, ok := strings.CutSuffix(candidate, suffix+`"`); ok {
+			kept = append(kept, stripped+`"`)
+		}
+	}
+	return strings.Join(kept, ", ")
+}
+
+// candleRecord is a candle decoded from a response body with its numbers
+// kept exactly as the handler formatted them
+type candleRecord struct {
+	Timestamp json.Number `json:"timestamp"`
+	Open      json.Number `json:"open"`
+	High      json.Number `json:"high"`
+	Low       json.Number `json:"low"`
+	Close     json.Number `json:"close"`
+	Volume    json.Number `json:"volume"`
+}
+
+func (c candleRecord) fields() []string {
+	return []string{c.Timestamp.String(), c.Open.String(), c.High.String(), c.Low.String(), c.Close.String(), c.Volume.String()}
+}
+
+var candleCSVHeader = []string{"timestamp", "open", "high", "low", "close", "volume"}
+
+// entryCSV writes a CacheEntry body as one CSV row per candle
+func entryCSV(w io.Writer, body []byte) error {
+	var entry struct {
+		Candles []candleRecord `json:"candles"`
+	}
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(candleCSVHeader)
+	for _, c := range entry.Candles {
+		cw.Write(c.fields())
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// eachDumpEntry decodes a body of entries keyed by symbol one entry at a
+// time, in body order (sorted, as writeJSON renders dumps), so transcoding
+// a dump never holds a decoded copy of all of it
+func eachDumpEntry[T any](body []byte, fn func(symbol string, entry *T) error) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("expected an object of entries")
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		symbol, _ := key.(string)
+		var entry T
+		if err := dec.Decode(&entry); err != nil {
+			return err
+		}
+		if err := fn(symbol, &entry); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// dumpCSV writes a body of entries keyed by symbol as one CSV row per
+// candle, led by the symbol
+func dumpCSV(w io.Writer, body []byte) error {
+	cw := csv.NewWriter(w)
+	cw.Write(append([]string{"symbol"}, candleCSVHeader...))
+	err := eachDumpEntry(body, func(symbol string, entry *struct {
+		Candles []candleRecord `json:"candles"`
+	}) error {
+		for _, c := range entry.Candles {
+			cw.Write(append([]string{symbol}, c.fields()...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// entryNDJSON writes a CacheEntry body as one candle object per line
+func entryNDJSON(w io.Writer, body []byte) error {
+	var entry struct {
+		Candles []json.RawMessage `json:"candles"`
+	}
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return err
+	}
+	for _, c := range entry.Candles {
+		if _, err := fmt.Fprintf(w, "%s\n", c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dumpNDJSON writes a body of entries keyed by symbol as one candle object
+// per line, each with a leading "symbol" field
+func dumpNDJSON(w io.Writer, body []byte) error {
+	return eachDumpEntry(body, func(symbol string, entry *struct {
+		Candles []json.RawMessage `json:"candles"`
+	}) error {
+		quoted, _ := json.Marshal(symbol)
+		for _, c := range entry.Candles {
+			if _, err := fmt.Fprintf(w, `{"symbol":%s,%s`+"\n", quoted, bytes.TrimPrefix(c, []byte("{"))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// msgpackFromJSON re-encodes any JSON body as MessagePack, keeping object
+// key order. Integral numbers become integers, the rest float64.
+func msgpackFromJSON(w io.Writer, body []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	b, err := appendMsgpack(nil, dec)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// appendMsgpack appends the next JSON value from dec as MessagePack
+func appendMsgpack(b []byte, dec *json.Decoder) ([]byte, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		// Lengths come first in MessagePack, so encode the children aside
+		var children []byte
+		n := 0
+		for dec.More() {
+			if v == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				s, _ := key.(string)
+				children = appendMsgpackString(children, s)
+			}
+			if children, err = appendMsgpack(children, dec); err != nil {
+				return nil, err
+			}
+			n++
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		if v == '{' {
+			b = appendMsgpackHeader(b, n, 0x80, 0xde)
+		} else {
+			b = appendMsgpackHeader(b, n, 0x90, 0xdc)
+		}
+		return append(b, children...), nil
+	case string:
+		return appendMsgpackString(b, v), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendMsgpackInt(b, i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f)), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	default:
+		return append(b, 0xc0), nil
+	}
+}
+
+// appendMsgpackHeader appends a map or array header: the fix form for fewer
+// than 16 items, else the 16- or 32-bit form (code16 and code16+1)
+func appendMsgpackHeader(b []byte, n int, fix, code16 byte) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, code16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, code16+1), uint32(n))
+	}
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+// appendMsgpackInt appends i in the smallest MessagePack integer form
+func appendMsgpackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= math.MaxInt8:
+		return append(b, byte(i))
+	case i < 0 && i >= -32:
+		return append(b, byte(i))
+	case i >= 0 && i <= math.MaxUint8:
+		return append(b, 0xcc, byte(i))
+	case i >= 0 && i <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(i))
+	case i >= 0 && i <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(i))
+	case i >= 0:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), uint64(i))
+	case i >= math.MinInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+	}
+}
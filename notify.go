@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// Operational events reported to webhooks
+const (
+	EventFetchCycleFailed = "fetch_cycle_failed"
+	EventSymbolListEmpty  = "symbol_list_empty"
+	EventCacheStale       = "cache_stale"
+	EventCycleOverlap     = "fetch_cycle_overlap"
+)
+
+// maintenanceSuppressed are the events expected while the exchange is in
+// maintenance, so they aren't sent then
+var maintenanceSuppressed = map[string]bool{
+	EventFetchCycleFailed: true,
+	EventCacheStale:       true,
+	EventCycleOverlap:     true,
+}
+
+// WebhookPayload is compatible with both Slack ("text") and Discord
+// ("content") incoming webhooks; the remaining fields are for generic receivers
+type WebhookPayload struct {
+	Text    string    `json:"text"`
+	Content string    `json:"content"`
+	Event   string    `json:"event"`
+	Time    time.Time `json:"time"`
+}
+
+// postWebhook sends a JSON payload to a webhook URL
+func postWebhook(client *http.Client, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Notifier fires operational event webhooks. Each event is sent at most once
+// per cooldown so a persistent failure doesn't flood the channel.
+type Notifier struct {
+	urls         []string
+	cooldown     time.Duration
+	failureRatio float64 // Fetch cycle failure ratio that triggers a webhook
+	httpClient   *http.Client
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+}
+
+// NewNotifier creates a notifier; with no URLs it does nothing
+func NewNotifier(urls []string, cooldown time.Duration, failureRatio float64) *Notifier {
+	return &Notifier{
+		urls:         urls,
+		cooldown:     cooldown,
+		failureRatio: failureRatio,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		lastSent:     make(map[string]time.Time),
+	}
+}
+
+// FetchCycleDone reports a candle fetch cycle, notifying when the share of
+// failed symbols exceeds the configured ratio
+func (n *Notifier) FetchCycleDone(failed, total int) {
+	if n == nil || total == 0 {
+		return
+	}
+	if ratio := float64(failed) / float64(total); ratio > n.failureRatio {
+		n.Notify(EventFetchCycleFailed, fmt.Sprintf("Candle fetch cycle failed for %d/%d symbols (%.0f%%)", failed, total, ratio*100))
+	}
+}
+
+// Notify sends an event to every webhook in the background
+func (n *Notifier) Notify(event, message string) {
+	if n == nil || len(n.urls) == 0 {
+		return
+	}
+	if maintenanceSuppressed[event] && exchangeStatus.InMaintenance() {
+		metrics.Inc("webhook_notifications_suppressed_total", "event", event)
+		return
+	}
+
+	n.mu.Lock()
+	if last, ok := n.lastSent[event]; ok && time.Since(last) < n.cooldown {
+		n.mu.Unlock()
+		return
+	}
+	n.lastSent[event] = time.Now()
+	n.mu.Unlock()
+
+	text := fmt.Sprintf("[hyperliquid-backend] %s", message)
+	payload := WebhookPayload{Text: text, Content: text, Event: event, Time: time.Now().UTC()}
+
+	for _, url := range n.urls {
+		go func(url string) {
+			if err := postWebhook(n.httpClient, url, payload); err != nil {
+				log.Printf("[Notifier] ERROR: %s: %v", event, err)
+				metrics.Inc("webhook_notifications_total", "event", event, "result", "error")
+				return
+			}
+			metrics.Inc("webhook_notifications_total", "event", event, "result", "success")
+		}(url)
+	}
+}
+
+// StalenessWatchActor raises a webhook when the candle cache hasn't been
+// updated for longer than the configured threshold
+type StalenessWatchActor struct {
+	cache     *Cache
+	notifier  *Notifier
+	threshold time.Duration
+	started   time.Time
+}
+
+// NewStalenessWatchActor creates a new staleness watch actor
+func NewStalenessWatchActor(cache *Cache, notifier *Notifier, threshold time.Duration) *StalenessWatchActor {
+	return &StalenessWatchActor{
+		cache:     cache,
+		notifier:  notifier,
+		threshold: threshold,
+	}
+}
+
+func (a *StalenessWatchActor) Receive(ctx *actor.Context) {
+	switch ctx.Message().(type) {
+	case actor.Started:
+		a.started = time.Now()
+		ctx.SendRepeat(ctx.PID(), CheckStalenessMsg{}, time.Minute)
+
+	case CheckStalenessMsg:
+		a.check()
+	}
+}
+
+func (a *StalenessWatchActor) check() {
+	// Until the first cycle after startup completes, measure from startup
+	lastUpdate := a.cache.GetLastUpdate()
+	if lastUpdate.Before(a.started) {
+		lastUpdate = a.started
+	}
+	if age := time.Since(lastUpdate); age > a.threshold {
+		a.notifier.Notify(EventCacheStale, fmt.Sprintf("Candle cache is stale: last update %v ago (threshold %v)", age.Round(time.Second), a.threshold))
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// OnDemandFetcher fills cache misses for valid symbols outside the regular
+// fetch cycle. Concurrent requests for the same symbol share one upstream call.
+type OnDemandFetcher struct {
+	cache             *Cache
+	hyperliquidClient *HyperliquidClient
+	candleInterval    string
+	candleDays        int
+	group             singleflight.Group
+}
+
+// NewOnDemandFetcher creates a new on-demand fetcher
+func NewOnDemandFetcher(cache *Cache, hyperliquidClient *HyperliquidClient, candleInterval string, candleDays int) *OnDemandFetcher {
+	return &OnDemandFetcher{
+		cache:             cache,
+		hyperliquidClient: hyperliquidClient,
+		candleInterval:    candleInterval,
+		candleDays:        candleDays,
+	}
+}
+
+// Fetch starts (or joins) a fetch for symbol and waits up to wait for it.
+// It returns the cached entry and true if the fetch finished in time; the
+// fetch keeps running in the background otherwise and fills the cache later.
+func (f *OnDemandFetcher) Fetch(symbol string, wait time.Duration) (CacheEntry, bool) {
+	ch := f.group.DoChan(symbol, func() (interface{}, error) {
+		metrics.Inc("ondemand_fetch_total")
+		log.Printf("[OnDemand] Fetching %s after cache miss", symbol)
+
+		endTime := time.Now().UnixMilli()
+		startTime := time.Now().AddDate(0, 0, -symbolOverrides.MainDays(symbol, f.candleDays)).UnixMilli()
+		candles, err := f.hyperliquidClient.FetchCandlesWithRetry(symbol, f.candleInterval, startTime, endTime, 3)
+		if errors.Is(err, errDryRun) {
+			return nil, err
+		}
+		if err != nil {
+			log.Printf("[OnDemand] ERROR: Failed to fetch %s: %v", symbol, err)
+			metrics.Inc("ondemand_fetch_errors_total")
+			errorTrace.RecordSymbol(SubsystemFetcher, "ondemand", symbol, err)
+			return nil, err
+		}
+		f.cache.Set(symbol, candles)
+		return nil, nil
+	})
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return CacheEntry{}, false
+		}
+		return f.cache.Get(symbol)
+	case <-timer.C:
+		return CacheEntry{}, false
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SymbolOverride gives one symbol its own candle interval and lookback
+type SymbolOverride struct {
+	Interval string `json:"interval"`
+	Days     int    `json:"days"`
+}
+
+// SymbolOverrides holds the per-symbol overrides of the main pipeline. An
+// override at the main interval only changes that series' lookback. One at
+// another interval adds a series kept in its own cache, which the symbol's
+// candle endpoint serves by default; the main series is still fetched for
+// everything built on the shared interval (summary, heatmap, resampling...).
+// A nil SymbolOverrides has no overrides.
+type SymbolOverrides struct {
+	mainInterval string
+	bySymbol     map[string]SymbolOverride // Upper-cased symbols
+	cache        *Cache                    // Series at an overridden interval
+}
+
+// parseSymbolOverrides parses SYMBOL_OVERRIDES, a comma-separated list of
+// SYMBOL=interval[/Nd]. A missing lookback uses the interval's default.
+func parseSymbolOverrides(spec string) (map[string]SymbolOverride, error) {
+	overrides := make(map[string]SymbolOverride)
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		symbol, rest, ok := strings.Cut(item, "=")
+		symbol = strings.ToUpper(strings.TrimSpace(symbol))
+		if !ok || symbol == "" {
+			return nil, fmt.Errorf("invalid override %q: use SYMBOL=interval[/days]", item)
+		}
+		if _, dup := overrides[symbol]; dup {
+			return nil, fmt.Errorf("duplicate override for %s", symbol)
+		}
+		rawInterval, rawDays, hasDays := strings.Cut(rest, "/")
+		interval, err := normalizeInterval(strings.TrimSpace(rawInterval))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", symbol, err)
+		}
+		if _, ok := intervalDuration(interval); !ok {
+			return nil, fmt.Errorf("%s: interval %q is below one minute", symbol, rawInterval)
+		}
+		override := SymbolOverride{Interval: interval}
+		if hasDays {
+			days, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(rawDays), "d"))
+			if err != nil || days <= 0 {
+				return nil, fmt.Errorf("%s: invalid lookback %q, use e.g. 3d", symbol, rawDays)
+			}
+			if err := checkSnapshotCap(interval, days); err != nil {
+				return nil, fmt.Errorf("%s: %w", symbol, err)
+			}
+			override.Days = days
+		}
+		overrides[symbol] = override
+	}
+	return overrides, nil
+}
+
+// NewSymbolOverrides creates the overrides of a main pipeline at
+// mainInterval, resolving missing lookbacks; nil when there are none
+func NewSymbolOverrides(bySymbol map[string]SymbolOverride, mainInterval string) *SymbolOverrides {
+	if len(bySymbol) == 0 {
+		return nil
+	}
+	for symbol, override := range bySymbol {
+		if override.Days == 0 {
+			override.Days = config.LookbackDays(override.Interval)
+			bySymbol[symbol] = override
+		}
+	}
+	c := NewCache()
+	c.namespace = "overrides"
+	return &SymbolOverrides{mainInterval: mainInterval, bySymbol: bySymbol, cache: c}
+}
+
+// For returns symbol's override
+func (o *SymbolOverrides) For(symbol string) (SymbolOverride, bool) {
+	if o == nil {
+		return SymbolOverride{}, false
+	}
+	override, ok := o.bySymbol[strings.ToUpper(symbol)]
+	return override, ok
+}
+
+// All returns every override by symbol
+func (o *SymbolOverrides) All() map[string]SymbolOverride {
+	if o == nil {
+		return nil
+	}
+	return o.bySymbol
+}
+
+// MainDays returns how many days of symbol's main series to fetch
+func (o *SymbolOverrides) MainDays(symbol string, defaultDays int) int {
+	if override, ok := o.For(symbol); ok && override.Interval == o.mainInterval {
+		return override.Days
+	}
+	return defaultDays
+}
+
+// Separate returns symbol's override when it's at another interval than the
+// main series
+func (o *SymbolOverrides) Separate(symbol string) (SymbolOverride, bool) {
+	override, ok := o.For(symbol)
+	if !ok || override.Interval == o.mainInterval {
+		return SymbolOverride{}, false
+	}
+	return override, true
+}
+
+// Series returns symbol's series at its overridden interval, once fetched
+func (o *SymbolOverrides) Series(symbol string) (CacheEntry, bool) {
+	if _, ok := o.Separate(symbol); !ok {
+		return CacheEntry{}, false
+	}
+	return o.cache.Get(symbol)
+}
+
+// fetch refreshes the separate series of those of symbols that have one. A
+// failure keeps the last series, since the main series still covers the
+// symbol.
+func (o *SymbolOverrides) fetch(client *HyperliquidClient, symbols []string) {
+	if o == nil {
+		return
+	}
+	type result struct {
+		symbol  string
+		candles []Candle
+		err     error
+	}
+	results := make(chan result)
+	pending := 0
+	endTime := time.Now().UnixMilli()
+	for _, symbol := range symbols {
+		override, ok := o.Separate(symbol)
+		if !ok {
+			continue
+		}
+		pending++
+		go func(symbol string, override SymbolOverride) {
+			startTime := time.Now().AddDate(0, 0, -override.Days).UnixMilli()
+			candles, err := client.FetchCandlesWithRetry(symbol, override.Interval, startTime, endTime, 3)
+			results <- result{symbol: symbol, candles: candles, err: err}
+		}(symbol, override)
+	}
+	for ; pending > 0; pending-- {
+		res := <-results
+		if res.err != nil {
+			log.Printf("[CandleFetcher] ERROR: Failed to fetch %s override series: %v", res.symbol, res.err)
+			metrics.Inc("symbol_override_fetch_total", "result", "error")
+			continue
+		}
+		o.cache.Set(res.symbol, res.candles)
+		metrics.Inc("symbol_override_fetch_total", "result", "success")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseSymbolOverrides(t *testing.T) {
+	tests := []struct {
+		spec string
+		want map[string]SymbolOverride
+	}{
+		{"", map[string]SymbolOverride{}},
+		{"BTC=1m", map[string]SymbolOverride{"BTC": {Interval: "1m"}}},
+		{"BTC=1m/3d", map[string]SymbolOverride{"BTC": {Interval: "1m", Days: 3}}},
+		{" btc = 5m /3d , ETH=1h/7,", map[string]SymbolOverride{
+			"BTC": {Interval: "5m", Days: 3},
+			"ETH": {Interval: "1h", Days: 7},
+		}},
+		{"SOL=1 hour", map[string]SymbolOverride{"SOL": {Interval: "1h"}}},
+		{"BTC=1M", map[string]SymbolOverride{"BTC": {Interval: "1M"}}},
+	}
+	for _, tt := range tests {
+		got, err := parseSymbolOverrides(tt.spec)
+		if err != nil {
+			t.Errorf("parseSymbolOverrides(%q): %v", tt.spec, err)
+			continue
+		}
+		if !maps.Equal(got, tt.want) {
+			t.Errorf("parseSymbolOverrides(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseSymbolOverridesErrors(t *testing.T) {
+	for _, spec := range []string{
+		"BTC",
+		"=1m",
+		"BTC=",
+		"BTC=7m",
+		"BTC=15s",       // Below one minute
+		"BTC=1m,btc=5m", // Duplicate, whatever the case
+		"BTC=1m/0d",
+		"BTC=1m/-2d",
+		"BTC=1m/xd",
+		"BTC=1m/30d", // More candles than one request returns
+	} {
+		if got, err := parseSymbolOverrides(spec); err == nil {
+			t.Errorf("parseSymbolOverrides(%q) = %v, want an error", spec, got)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+)
+
+// Parquet responses are written by hand, like MessagePack: one row group of
+// required, PLAIN-encoded, uncompressed columns, a single data page each.
+// That's all a candle table needs and every Parquet reader accepts it.
+
+const parquetMagic = "PAR1"
+
+// Parquet physical types, converted types and the other enum values used here
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetRequired     = 0
+	parquetPlain        = 0
+	parquetRLE          = 3
+	parquetUncompressed = 0
+	parquetDataPage     = 0
+)
+
+// parquetColumn is one column's PLAIN-encoded values
+type parquetColumn struct {
+	name      string
+	kind      int32
+	converted int32 // -1 for none
+	values    []byte
+}
+
+// candleParquetColumns accumulates candles, optionally led by their symbol,
+// into Parquet columns
+type candleParquetColumns struct {
+	symbol  *parquetColumn
+	columns []*parquetColumn // timestamp, open, high, low, close, volume
+	rows    int64
+}
+
+func newCandleParquetColumns(withSymbol bool) *candleParquetColumns {
+	c := &candleParquetColumns{
+		columns: []*parquetColumn{{name: "timestamp", kind: parquetInt64, converted: parquetTimestampMillis}},
+	}
+	for _, name := range candleCSVHeader[1:] {
+		c.columns = append(c.columns, &parquetColumn{name: name, kind: parquetDouble, converted: -1})
+	}
+	if withSymbol {
+		c.symbol = &parquetColumn{name: "symbol", kind: parquetByteArray, converted: parquetUTF8}
+	}
+	return c
+}
+
+func (c *candleParquetColumns) add(symbol string, candle candleRecord) error {
+	ts, err := candle.Timestamp.Int64()
+	if err != nil {
+		return err
+	}
+	c.columns[0].values = binary.LittleEndian.AppendUint64(c.columns[0].values, uint64(ts))
+	for i, n := range []json.Number{candle.Open, candle.High, candle.Low, candle.Close, candle.Volume} {
+		f, err := n.Float64()
+		if err != nil {
+			return err
+		}
+		c.columns[i+1].values = binary.LittleEndian.AppendUint64(c.columns[i+1].values, math.Float64bits(f))
+	}
+	if c.symbol != nil {
+		c.symbol.values = binary.LittleEndian.AppendUint32(c.symbol.values, uint32(len(symbol)))
+		c.symbol.values = append(c.symbol.values, symbol...)
+	}
+	c.rows++
+	return nil
+}
+
+func (c *candleParquetColumns) write(w io.Writer) error {
+	columns := c.columns
+	if c.symbol != nil {
+		columns = append([]*parquetColumn{c.symbol}, columns...)
+	}
+	_, err := w.Write(appendParquetFile(nil, columns, c.rows))
+	return err
+}
+
+// entryParquet writes a CacheEntry body as a Parquet table of its candles
+func entryParquet(w io.Writer, body []byte) error {
+	var entry struct {
+		Candles []candleRecord `json:"candles"`
+	}
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return err
+	}
+	columns := newCandleParquetColumns(false)
+	for _, candle := range entry.Candles {
+		if err := columns.add("", candle); err != nil {
+			return err
+		}
+	}
+	return columns.write(w)
+}
+
+// dumpParquet writes a body of entries keyed by symbol as one Parquet table,
+// led by a symbol column
+func dumpParquet(w io.Writer, body []byte) error {
+	columns := newCandleParquetColumns(true)
+	err := eachDumpEntry(body, func(symbol string, entry *struct {
+		Candles []candleRecord `json:"candles"`
+	}) error {
+		for _, candle := range entry.Candles {
+			if err := columns.add(symbol, candle); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return columns.write(w)
+}
+
+// appendParquetFile appends a complete Parquet file holding columns, each
+// with rows values. With no rows the file has no row group.
+func appendParquetFile(b []byte, columns []*parquetColumn, rows int64) []byte {
+	b = append(b, parquetMagic...)
+
+	type chunk struct{ offset, size int64 }
+	chunks := make([]chunk, len(columns))
+	if rows > 0 {
+		for i, col := range columns {
+			offset := int64(len(b))
+			page := thriftStruct{}
+			page.i32(1, parquetDataPage)
+			page.i32(2, int32(len(col.values)))
+			page.i32(3, int32(len(col.values)))
+			header := page.structField(5)
+			header.i32(1, int32(rows))
+			header.i32(2, parquetPlain)
+			header.i32(3, parquetRLE)
+			header.i32(4, parquetRLE)
+			header.stop()
+			page.take(header)
+			page.stop()
+			b = append(append(b, page.b...), col.values...)
+			chunks[i] = chunk{offset, int64(len(b)) - offset}
+		}
+	}
+
+	meta := thriftStruct{}
+	meta.i32(1, 1)
+	meta.list(2, thriftStructType, len(columns)+1)
+	root := meta.element()
+	root.binary(4, "schema")
+	root.i32(5, int32(len(columns)))
+	root.stop()
+	meta.take(root)
+	for _, col := range columns {
+		element := meta.element()
+		element.i32(1, col.kind)
+		element.i32(3, parquetRequired)
+		element.binary(4, col.name)
+		if col.converted >= 0 {
+			element.i32(6, col.converted)
+		}
+		element.stop()
+		meta.take(element)
+	}
+	meta.i64(3, rows)
+	if rows > 0 {
+		meta.list(4, thriftStructType, 1)
+		group := meta.element()
+		group.list(1, thriftStructType, len(columns))
+		var total int64
+		for i, col := range columns {
+			cc := group.element()
+			cc.i64(2, chunks[i].offset)
+			md := cc.structField(3)
+			md.i32(1, col.kind)
+			md.list(2, thriftI32Type, 2)
+			md.b = appendZigzag(md.b, parquetPlain)
+			md.b = appendZigzag(md.b, parquetRLE)
+			md.list(3, thriftBinaryType, 1)
+			md.b = appendThriftString(md.b, col.name)
+			md.i32(4, parquetUncompressed)
+			md.i64(5, rows)
+			md.i64(6, chunks[i].size)
+			md.i64(7, chunks[i].size)
+			md.i64(9, chunks[i].offset)
+			md.stop()
+			cc.take(md)
+			cc.stop()
+			group.take(cc)
+			total += chunks[i].size
+		}
+		group.i64(2, total)
+		group.i64(3, rows)
+		group.stop()
+		meta.take(group)
+	} else {
+		meta.list(4, thriftStructType, 0)
+	}
+	meta.binary(6, "hyperliquid-backend")
+	meta.stop()
+
+	b = append(b, meta.b...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(meta.b)))
+	return append(b, parquetMagic...)
+}
+
+// Thrift compact protocol type codes
+const (
+	thriftI32Type    = 5
+	thriftI64Type    = 6
+	thriftBinaryType = 8
+	thriftListType   = 9
+	thriftStructType = 12
+)
+
+// thriftStruct encodes one struct in the Thrift compact protocol, which
+// Parquet uses for its page headers and footer. Fields must be written in
+// increasing id order.
+type thriftStruct struct {
+	b    []byte
+	last int16 // Id of the last field written, for the delta encoding
+}
+
+func (s *thriftStruct) field(id int16, kind byte) {
+	if delta := id - s.last; delta > 0 && delta <= 15 {
+		s.b = append(s.b, byte(delta)<<4|kind)
+	} else {
+		s.b = appendZigzag(append(s.b, kind), int64(id))
+	}
+	s.last = id
+}
+
+func (s *thriftStruct) i32(id int16, v int32) {
+	s.field(id, thriftI32Type)
+	s.b = appendZigzag(s.b, int64(v))
+}
+
+func (s *thriftStruct) i64(id int16, v int64) {
+	s.field(id, thriftI64Type)
+	s.b = appendZigzag(s.b, v)
+}
+
+func (s *thriftStruct) binary(id int16, v string) {
+	s.field(id, thriftBinaryType)
+	s.b = appendThriftString(s.b, v)
+}
+
+// list writes a list field's header; the caller appends its n elements
+func (s *thriftStruct) list(id int16, kind byte, n int) {
+	s.field(id, thriftListType)
+	if n < 15 {
+		s.b = append(s.b, byte(n)<<4|kind)
+	} else {
+		s.b = binary.AppendUvarint(append(s.b, 0xf0|kind), uint64(n))
+	}
+}
+
+// structField starts a nested struct field; hand it back with take once
+// it's stopped
+func (s *thriftStruct) structField(id int16) *thriftStruct {
+	s.field(id, thriftStructType)
+	return s.element()
+}
+
+// element starts a struct written inline, as a list element or nested field
+func (s *thriftStruct) element() *thriftStruct {
+	return &thriftStruct{b: s.b}
+}
+
+// take continues after a nested struct, which wrote on from s's bytes
+func (s *thriftStruct) take(nested *thriftStruct) {
+	s.b = nested.b
+}
+
+func (s *thriftStruct) stop() {
+	s.b = append(s.b, 0)
+}
+
+func appendZigzag(b []byte, v int64) []byte {
+	return binary.AppendUvarint(b, uint64(v<<1)^uint64(v>>63))
+}
+
+func appendThriftString(b []byte, v string) []byte {
+	return append(binary.AppendUvarint(b, uint64(len(v))), v...)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// seedFromPeer warms the cache from another instance's /api/candles, so a
+// new instance serves candles before its first Hyperliquid cycle finishes.
+// Seeded entries are marked stale until the fetcher refreshes them. The
+// peer must cache the same interval, otherwise nothing is seeded.
+func seedFromPeer(peerURL string, c *Cache, timeout time.Duration) error {
+	start := time.Now()
+	client := &http.Client{Timeout: timeout}
+	base := strings.TrimSuffix(peerURL, "/")
+
+	var intervals struct {
+		Default string `json:"default"`
+	}
+	if err := getPeerJSON(client, base+"/api/intervals", &intervals); err != nil {
+		return err
+	}
+	if intervals.Default != config.CandleInterval {
+		return fmt.Errorf("peer caches %s candles, not %s", intervals.Default, config.CandleInterval)
+	}
+
+	// Full precision, since the candles are stored rather than displayed
+	var entries map[string]CacheEntry
+	if err := getPeerJSON(client, base+"/api/candles?precision=full", &entries); err != nil {
+		return err
+	}
+	for symbol, entry := range entries {
+		if entry.Candles.Len() == 0 {
+			delete(entries, symbol)
+		}
+	}
+
+	c.Restore(CacheSnapshot{Entries: entries})
+	log.Printf("[Peer] Seeded %d symbols from %s in %v (serving as stale until refreshed)",
+		len(entries), peerURL, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func getPeerJSON(client *http.Client, url string, v interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", url, err)
+	}
+	return nil
+}
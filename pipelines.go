@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// Pipeline is an extra candle pipeline next to the main one: its own market,
+// interval and lookback, fetched into its own cache by its own actors and
+// served under /{name}/api/...
+type Pipeline struct {
+	Name     string `json:"name"`
+	Market   string `json:"market"` // MarketPerp or MarketSpot
+	Interval string `json:"interval"`
+	Days     int    `json:"days"`
+
+	cache      *Cache
+	symbolsPID *actor.PID
+	candlesPID *actor.PID
+}
+
+// pipelines are the configured extra pipelines, in PIPELINES order
+var pipelines []*Pipeline
+
+var pipelineNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// reservedPipelineNames would shadow routes of the main pipeline
+var reservedPipelineNames = map[string]bool{
+	"api": true, "admin": true, "health": true, "metrics": true, "debug": true,
+}
+
+// parsePipelines parses PIPELINES, a comma-separated list of
+// [name=]market@interval[/Nd]. The name defaults to the market, and the
+// lookback to the interval's default.
+func parsePipelines(spec string) ([]*Pipeline, error) {
+	var result []*Pipeline
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, rest, named := strings.Cut(item, "=")
+		market, rest, ok := strings.Cut(rest, "@")
+		if !named {
+			market, rest, ok = strings.Cut(item, "@")
+			name = market
+		}
+		if !ok {
+			return nil, fmt.Errorf("invalid pipeline %q: use [name=]market@interval[/days]", item)
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !pipelineNamePattern.MatchString(name) || reservedPipelineNames[name] {
+			return nil, fmt.Errorf("invalid pipeline name %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate pipeline %q", name)
+		}
+		seen[name] = true
+
+		p := &Pipeline{Name: name}
+		switch strings.ToLower(strings.TrimSpace(market)) {
+		case "perp", "perps":
+			p.Market = MarketPerp
+		case "spot":
+			p.Market = MarketSpot
+		default:
+			return nil, fmt.Errorf("pipeline %s: unknown market %q, use perps or spot", name, market)
+		}
+
+		rawInterval, rawDays, hasDays := strings.Cut(rest, "/")
+		interval, err := normalizeInterval(strings.TrimSpace(rawInterval))
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %s: %w", name, err)
+		}
+		if _, ok := intervalDuration(interval); !ok {
+			return nil, fmt.Errorf("pipeline %s: interval %q is below one minute", name, rawInterval)
+		}
+		p.Interval = interval
+		if hasDays {
+			days, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(rawDays), "d"))
+			if err != nil || days <= 0 {
+				return nil, fmt.Errorf("pipeline %s: invalid lookback %q, use e.g. 7d", name, rawDays)
+			}
+			if err := checkSnapshotCap(interval, days); err != nil {
+				return nil, fmt.Errorf("pipeline %s: %w", name, err)
+			}
+			p.Days = days
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// pipelineRefreshTier is the refresh schedule tier of a pipeline's fetch cycles
+func pipelineRefreshTier(name string) string {
+	return RefreshCandles + ":" + name
+}
+
+// Start spawns the pipeline's symbol and candle fetchers
+func (p *Pipeline) Start(hydromancerClient *HydromancerClient, hyperliquidClient *HyperliquidClient) {
+	p.cache = NewCache()
+	p.cache.namespace = p.Name
+	if p.Days == 0 {
+		p.Days = config.LookbackDays(p.Interval)
+	}
+
+	p.symbolsPID = engine.Spawn(
+		func() actor.Receiver {
+			return NewPipelineSymbolsActor(p, hydromancerClient, time.Duration(config.SymbolRefreshIntervalMin)*time.Minute)
+		},
+		"pipelineSymbols-"+p.Name,
+	)
+	watchdog.Spawn(
+		&p.candlesPID,
+		func() actor.Receiver {
+			fetcher := NewCandleFetcherActor(
+				p.cache,
+				hyperliquidClient,
+				time.Duration(config.RefreshIntervalMin)*time.Minute,
+				p.Interval,
+				p.Days,
+				FetchProfile{
+					BatchSize:  config.BatchSize,
+					BatchDelay: time.Duration(config.BatchDelayMs) * time.Millisecond,
+				},
+				FetchProfile{
+					BatchSize:  config.WarmupBatchSize,
+					BatchDelay: time.Duration(config.WarmupBatchDelayMs) * time.Millisecond,
+				},
+				config.RevisionWindow,
+				nil,
+				PriorityProfile{},
+				LazyProfile{},
+				nil,
+			)
+			fetcher.pipeline = p.Name
+			fetcher.logTag = "[CandleFetcher:" + p.Name + "]"
+			return fetcher
+		},
+		"pipelineCandles-"+p.Name,
+	)
+	log.Printf("[Pipelines] %s: %s %s candles over %dd at /%s/api/candles", p.Name, p.Market, p.Interval, p.Days, p.Name)
+}
+
+// Stop poisons the pipeline's actors
+func (p *Pipeline) Stop() {
+	for _, pid := range []*actor.PID{p.symbolsPID, p.candlesPID} {
+		if pid != nil {
+			engine.Poison(pid)
+		}
+	}
+}
+
+// PipelineSymbolsActor keeps a pipeline's symbol list and metadata current
+type PipelineSymbolsActor struct {
+	pipeline          *Pipeline
+	hydromancerClient *HydromancerClient
+	refreshInterval   time.Duration
+}
+
+// NewPipelineSymbolsActor creates a new pipeline symbol actor
+func NewPipelineSymbolsActor(p *Pipeline, hydromancerClient *HydromancerClient, refreshInterval time.Duration) *PipelineSymbolsActor {
+	return &PipelineSymbolsActor{
+		pipeline:          p,
+		hydromancerClient: hydromancerClient,
+		refreshInterval:   refreshInterval,
+	}
+}
+
+func (a *PipelineSymbolsActor) Receive(ctx *actor.Context) {
+	switch ctx.Message().(type) {
+	case actor.Started:
+		a.fetchSymbols()
+		scheduler.Add(RefreshSymbols+":"+a.pipeline.Name, a.refreshInterval, ctx.PID(), FetchSymbolsMsg{})
+
+	case FetchSymbolsMsg:
+		a.fetchSymbols()
+
+	case actor.Stopped:
+		scheduler.Remove(RefreshSymbols+":"+a.pipeline.Name, ctx.PID())
+	}
+}
+
+func (a *PipelineSymbolsActor) fetchSymbols() {
+	fetch := a.hydromancerClient.FetchPerpetualMetadata
+	if a.pipeline.Market == MarketSpot {
+		fetch = a.hydromancerClient.FetchSpotMetadata
+	}
+	metadata, err := fetch()
+	if err != nil {
+		// The last list stays in the cache
+		log.Printf("[Pipelines] %s: ERROR: Failed to fetch symbols: %v", a.pipeline.Name, err)
+		return
+	}
+	symbols := make([]string, len(metadata))
+	for i, meta := range metadata {
+		symbols[i] = meta.Name
+	}
+	if len(symbols) == 0 {
+		log.Printf("[Pipelines] %s: WARNING: Received empty symbol list", a.pipeline.Name)
+		return
+	}
+	a.pipeline.cache.SetSymbols(symbols)
+	a.pipeline.cache.SetMetadata(metadata)
+	log.Printf("[Pipelines] %s: Discovered %d symbols", a.pipeline.Name, len(symbols))
+}
+
+type pipelineContextKey struct{}
+
+// withPipeline serves next for pipeline p: the request's cache and interval
+// are p's instead of the main pipeline's
+func withPipeline(p *Pipeline, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(context.WithValue(r.Context(), pipelineContextKey{}, p)))
+	}
+}
+
+// requestPipeline returns the pipeline r is served from, or nil for the
+// main pipeline
+func requestPipeline(r *http.Request) *Pipeline {
+	p, _ := r.Context().Value(pipelineContextKey{}).(*Pipeline)
+	return p
+}
+
+// requestCache returns the cache r is served from
+func requestCache(r *http.Request) *Cache {
+	if p := requestPipeline(r); p != nil {
+		return p.cache
+	}
+	return cache
+}
+
+// requestInterval returns the candle interval of the cache r is served from
+func requestInterval(r *http.Request) string {
+	if p := requestPipeline(r); p != nil {
+		return p.Interval
+	}
+	return config.CandleInterval
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"math"
+	"net/url"
+)
+
+// Precision is the number of decimals prices and sizes of a symbol are
+// rounded to in responses
+type Precision struct {
+	Price int
+	Size  int
+}
+
+// maxPriceDecimals is Hyperliquid's decimal budget for prices: a price may
+// have at most this many decimals minus the asset's szDecimals
+var maxPriceDecimals = map[string]int{
+	MarketPerp: 6,
+	MarketSpot: 8,
+}
+
+// metadataPrecision derives each symbol's response precision from its
+// szDecimals, with PRICE_DECIMALS overrides. Nil when rounding is disabled.
+func metadataPrecision(metadata []SymbolMeta) map[string]Precision {
+	if config == nil || !config.RoundPrices {
+		return nil
+	}
+	result := make(map[string]Precision, len(metadata))
+	for _, m := range metadata {
+		budget, ok := maxPriceDecimals[m.Market]
+		if !ok {
+			budget = maxPriceDecimals[MarketPerp]
+		}
+		p := Precision{Price: max(budget-m.SzDecimals, 0), Size: m.SzDecimals}
+		if decimals, ok := config.PriceDecimals[m.Name]; ok && decimals >= 0 {
+			p.Price = decimals
+		}
+		result[m.Name] = p
+	}
+	return result
+}
+
+// applyPrecision rounds entry's candles to the symbol's precision when they
+// are encoded. Converted quotes keep full precision, since the USD tick size
+// says nothing about a BTC- or EUR-denominated price, and ?precision=full
+// opts out.
+func applyPrecision(entry *CacheEntry, query url.Values) {
+	if entry.Quote != "" || query.Get("precision") == "full" {
+		return
+	}
+	if p, ok := cache.Precision(entry.Symbol); ok {
+		entry.Candles = entry.Candles.WithPrecision(p)
+	}
+}
+
+// roundTo rounds v to decimals places. Values too large for the scaled
+// result to be exact are returned as is.
+func roundTo(v float64, decimals int) float64 {
+	scale := math.Pow10(decimals)
+	scaled := v * scale
+	if math.Abs(scaled) >= 1<<53 || math.IsNaN(scaled) {
+		return v
+	}
+	return math.Round(scaled) / scale
+}
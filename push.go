@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// Push webhook payload modes
+const (
+	PushModeChanges  = "changes"  // Changed symbol list only
+	PushModeSnapshot = "snapshot" // Changed list plus the latest candle of every symbol
+)
+
+// PushWebhook is a consumer endpoint notified at the end of each refresh cycle
+type PushWebhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Mode      string    `json:"mode"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PushPayload is posted to push webhooks after each candle cycle
+type PushPayload struct {
+	Event    string            `json:"event"`
+	Finished time.Time         `json:"finished"`
+	Interval string            `json:"interval"`
+	Changed  []string          `json:"changed"`
+	Snapshot map[string]Candle `json:"snapshot,omitempty"` // Symbol -> latest candle
+}
+
+// PushWebhookRegistry holds the registered push webhooks
+type PushWebhookRegistry struct {
+	mu       sync.RWMutex
+	webhooks map[string]PushWebhook
+}
+
+// NewPushWebhookRegistry creates a registry seeded with statically
+// configured webhooks
+func NewPushWebhookRegistry(urls []string, mode string) *PushWebhookRegistry {
+	r := &PushWebhookRegistry{webhooks: make(map[string]PushWebhook)}
+	for _, url := range urls {
+		webhook := PushWebhook{URL: url, Mode: mode}
+		if err := validatePushWebhook(&webhook); err != nil {
+			log.Printf("[PushWebhooks] ERROR: Skipping %s: %v", url, err)
+			continue
+		}
+		r.Add(webhook)
+	}
+	return r
+}
+
+// Add registers a webhook and returns it with its assigned ID
+func (r *PushWebhookRegistry) Add(webhook PushWebhook) PushWebhook {
+	webhook.ID = newAlertID()
+	webhook.CreatedAt = time.Now().UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.webhooks[webhook.ID] = webhook
+	return webhook
+}
+
+// Remove unregisters a webhook, reporting whether it existed
+func (r *PushWebhookRegistry) Remove(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.webhooks[id]; !ok {
+		return false
+	}
+	delete(r.webhooks, id)
+	return true
+}
+
+// List returns all webhooks, oldest first
+func (r *PushWebhookRegistry) List() []PushWebhook {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]PushWebhook, 0, len(r.webhooks))
+	for _, webhook := range r.webhooks {
+		result = append(result, webhook)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// PushWebhookActor posts a cycle summary to every registered webhook when
+// the candle fetcher finishes a cycle
+type PushWebhookActor struct {
+	cache      *Cache
+	registry   *PushWebhookRegistry
+	interval   string
+	httpClient *http.Client
+}
+
+// NewPushWebhookActor creates a new push webhook actor
+func NewPushWebhookActor(cache *Cache, registry *PushWebhookRegistry, interval string) *PushWebhookActor {
+	return &PushWebhookActor{
+		cache:      cache,
+		registry:   registry,
+		interval:   interval,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (a *PushWebhookActor) Receive(ctx *actor.Context) {
+	switch msg := ctx.Message().(type) {
+	case actor.Started:
+		ctx.Engine().Subscribe(ctx.PID())
+		log.Println("[PushWebhooks] Actor started")
+
+	case CandleCycleDoneMsg:
+		a.push(msg)
+
+	case actor.Stopped:
+		ctx.Engine().Unsubscribe(ctx.PID())
+		log.Println("[PushWebhooks] Actor stopped")
+	}
+}
+
+func (a *PushWebhookActor) push(msg CandleCycleDoneMsg) {
+	if !features.Enabled(FlagPushWebhooks) {
+		return
+	}
+	webhooks := a.registry.List()
+	if len(webhooks) == 0 {
+		return
+	}
+
+	changed := msg.Changed
+	if changed == nil {
+		changed = []string{}
+	}
+	payload := PushPayload{
+		Event:    "cycle_complete",
+		Finished: msg.Finished.UTC(),
+		Interval: a.interval,
+		Changed:  changed,
+	}
+
+	var snapshot *PushPayload
+	for _, webhook := range webhooks {
+		p := &payload
+		if webhook.Mode == PushModeSnapshot {
+			// Built once per cycle, and only if someone wants it
+			if snapshot == nil {
+				snapshot = &PushPayload{}
+				*snapshot = payload
+				snapshot.Snapshot = latestCandles(a.cache.GetAll())
+			}
+			p = snapshot
+		}
+		go func(webhook PushWebhook, p *PushPayload) {
+			result := "success"
+			if err := postWebhook(a.httpClient, webhook.URL, p); err != nil {
+				log.Printf("[PushWebhooks] ERROR: Push to %s failed: %v", webhook.ID, err)
+				result = "error"
+			}
+			metrics.Inc("push_webhook_total", "result", result)
+		}(webhook, p)
+	}
+}
+
+// latestCandles returns the newest candle of every non-empty series
+func latestCandles(all map[string]CacheEntry) map[string]Candle {
+	result := make(map[string]Candle, len(all))
+	for symbol, entry := range all {
+		if n := entry.Candles.Len(); n > 0 {
+			result[symbol] = entry.Candles.At(n - 1)
+		}
+	}
+	return result
+}
+
+// handleAdminWebhooks lists (GET) or registers (POST) push webhooks
+func handleAdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		webhooks := pushWebhooks.List()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"webhooks": webhooks,
+			"count":    len(webhooks),
+		})
+
+	case http.MethodPost:
+		var webhook PushWebhook
+		if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if err := validatePushWebhook(&webhook); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		webhook = pushWebhooks.Add(webhook)
+		log.Printf("[Admin] Registered push webhook %s (%s)", webhook.ID, webhook.Mode)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(webhook)
+	}
+}
+
+// handleAdminWebhook unregisters the push webhook DELETE /admin/webhooks/{id}
+func handleAdminWebhook(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !pushWebhooks.Remove(id) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("[Admin] Removed push webhook %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validatePushWebhook(webhook *PushWebhook) error {
+	if !strings.HasPrefix(webhook.URL, "http://") && !strings.HasPrefix(webhook.URL, "https://") {
+		return fmt.Errorf("url must be an http(s) URL")
+	}
+	if webhook.Mode == "" {
+		webhook.Mode = PushModeChanges
+	}
+	if webhook.Mode != PushModeChanges && webhook.Mode != PushModeSnapshot {
+		return fmt.Errorf("invalid mode %q: use changes or snapshot", webhook.Mode)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// filterCandles narrows a sorted candle series according to the request's
+// query parameters. The input slice is never modified.
+func filterCandles(candles CandleSeries, query url.Values) (CandleSeries, error) {
+	if raw := query.Get("lookback"); raw != "" {
+		lookback, err := parseLookback(raw)
+		if err != nil {
+			return CandleSeries{}, err
+		}
+		if n := candles.Len(); n > 0 {
+			// Resolve against the newest candle rather than wall-clock time
+			cutoff := candles.Timestamp(n-1) - lookback.Milliseconds()
+			candles = candles.Slice(candles.SearchAfter(cutoff), n)
+		}
+	}
+
+	// ?from= and ?to= keep candles opening in [from, to]
+	var from, to int64
+	var hasFrom, hasTo bool
+	var err error
+	if raw := query.Get("from"); raw != "" {
+		if from, err = parseCandleTime("from", raw); err != nil {
+			return CandleSeries{}, err
+		}
+		hasFrom = true
+		candles = candles.Slice(candles.Search(from), candles.Len())
+	}
+	if raw := query.Get("to"); raw != "" {
+		if to, err = parseCandleTime("to", raw); err != nil {
+			return CandleSeries{}, err
+		}
+		hasTo = true
+		candles = candles.Slice(0, candles.SearchAfter(to))
+	}
+	if hasFrom && hasTo && from > to {
+		return CandleSeries{}, fmt.Errorf("Invalid range: from is after to")
+	}
+	return candles, nil
+}
+
+// parseCandleTime parses a range bound: Unix milliseconds or RFC3339
+func parseCandleTime(name, raw string) (int64, error) {
+	if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return ms, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t.UnixMilli(), nil
+	}
+	return 0, fmt.Errorf("Invalid %s: use Unix milliseconds or RFC3339", name)
+}
+
+// candlePage is a response's ?limit= and ?order=. It applies to the
+// candles returned, after any resampling, so limit counts buckets or bars
+// rather than cached candles.
+type candlePage struct {
+	limit int  // Newest candles kept; 0 keeps them all
+	desc  bool // Newest first
+}
+
+// parseCandlePage validates ?limit= and ?order=asc|desc
+func parseCandlePage(query url.Values) (candlePage, error) {
+	var page candlePage
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return page, fmt.Errorf("Invalid limit: use a positive number of candles")
+		}
+		page.limit = n
+	}
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		page.desc = true
+	default:
+		return page, fmt.Errorf("Invalid order: use asc or desc")
+	}
+	return page, nil
+}
+
+// apply keeps the newest limit candles, newest first when desc
+func (p candlePage) apply(candles CandleSeries) CandleSeries {
+	if n := candles.Len(); p.limit > 0 && n > p.limit {
+		candles = candles.Slice(n-p.limit, n)
+	}
+	if p.desc {
+		candles = candles.Reversed()
+	}
+	return candles
+}
+
+// parseLookback parses a positive duration, accepting Go duration syntax plus
+// day ("7d") and week ("2w") suffixes
+func parseLookback(s string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+
+	switch {
+	case strings.HasSuffix(s, "d"), strings.HasSuffix(s, "w"):
+		unit := 24 * time.Hour
+		if strings.HasSuffix(s, "w") {
+			unit *= 7
+		}
+		var n float64
+		n, err = strconv.ParseFloat(s[:len(s)-1], 64)
+		// NaN and ±Inf parse, and too large a count doesn't fit a Duration
+		if err == nil && (math.IsNaN(n) || math.IsInf(n, 0) || n*float64(unit) > math.MaxInt64) {
+			err = fmt.Errorf("out of range")
+		}
+		d = time.Duration(n * float64(unit))
+	default:
+		d, err = time.ParseDuration(s)
+	}
+
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid lookback %q: use a positive duration like 48h, 7d or 2w", s)
+	}
+	return d, nil
+}
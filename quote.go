@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// FXRates holds fiat exchange rates quoted as units of currency per USD
+type FXRates struct {
+	mu         sync.RWMutex
+	rates      map[string]float64
+	lastUpdate time.Time
+}
+
+// NewFXRates creates an empty rate table
+func NewFXRates() *FXRates {
+	return &FXRates{rates: make(map[string]float64)}
+}
+
+// Set replaces the rate table
+func (f *FXRates) Set(rates map[string]float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rates = rates
+	f.lastUpdate = time.Now()
+}
+
+// Get returns the rate for a currency and when the table was refreshed
+func (f *FXRates) Get(currency string) (float64, time.Time, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	rate, ok := f.rates[currency]
+	return rate, f.lastUpdate, ok
+}
+
+// fetchFXRates loads USD-based rates from a Frankfurter-style endpoint
+// returning {"rates": {"EUR": 0.92, ...}}
+func fetchFXRates(client *http.Client, url string) (map[string]float64, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch FX rates: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("FX source returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode FX rates: %w", err)
+	}
+
+	rates := make(map[string]float64, len(body.Rates))
+	for currency, rate := range body.Rates {
+		if rate > 0 {
+			rates[strings.ToUpper(currency)] = rate
+		}
+	}
+	return rates, nil
+}
+
+// FXRateActor periodically refreshes the FX rate table
+type FXRateActor struct {
+	rates           *FXRates
+	url             string
+	refreshInterval time.Duration
+	httpClient      *http.Client
+}
+
+// NewFXRateActor creates a new FX rate actor
+func NewFXRateActor(rates *FXRates, url string, refreshInterval time.Duration) *FXRateActor {
+	return &FXRateActor{
+		rates:           rates,
+		url:             url,
+		refreshInterval: refreshInterval,
+		httpClient:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (a *FXRateActor) Receive(ctx *actor.Context) {
+	switch ctx.Message().(type) {
+	case actor.Started:
+		log.Println("[FXRates] Actor started")
+		a.refresh()
+		scheduler.Add(RefreshFXRates, a.refreshInterval, ctx.PID(), FetchFXRatesMsg{})
+
+	case FetchFXRatesMsg:
+		a.refresh()
+
+	case actor.Stopped:
+		scheduler.Remove(RefreshFXRates, ctx.PID())
+		log.Println("[FXRates] Actor stopped")
+	}
+}
+
+func (a *FXRateActor) refresh() {
+	rates, err := fetchFXRates(a.httpClient, a.url)
+	if err != nil {
+		log.Printf("[FXRates] ERROR: %v, keeping previous rates", err)
+		return
+	}
+	a.rates.Set(rates)
+	log.Printf("[FXRates] Updated %d rates", len(rates))
+}
+
+// convertQuote re-denominates USD candles into another quote. Cached symbols
+// (e.g. BTC) are used as a reference series: each candle is divided by the
+// reference close at or before its timestamp, and candles older than the
+// reference history are dropped. Other quotes use the latest FX rate. Volume
+// stays in base units. Returns the converted candles and the reference's
+// last update for ETag purposes.
+func convertQuote(candles CandleSeries, quote string) (CandleSeries, time.Time, error) {
+	quote = strings.ToUpper(quote)
+
+	if ref, ok := cache.Get(cache.CanonicalSymbol(quote)); ok && ref.Candles.Len() > 0 {
+		result := make([]Candle, 0, candles.Len())
+		for i := 0; i < candles.Len(); i++ {
+			j := ref.Candles.SearchAfter(candles.Timestamp(i)) - 1
+			if j < 0 || ref.Candles.Closes[j] == 0 {
+				continue
+			}
+			result = append(result, scaleCandle(candles.At(i), 1/ref.Candles.Closes[j]))
+		}
+		return NewCandleSeries(result), ref.LastUpdate, nil
+	}
+
+	if fxRates != nil {
+		if rate, updated, ok := fxRates.Get(quote); ok {
+			result := make([]Candle, candles.Len())
+			for i := range result {
+				result[i] = scaleCandle(candles.At(i), rate)
+			}
+			return NewCandleSeries(result), updated, nil
+		}
+	}
+
+	return CandleSeries{}, time.Time{}, fmt.Errorf("unsupported quote %q", quote)
+}
+
+// scaleCandle multiplies the prices of a candle by factor
+func scaleCandle(c Candle, factor float64) Candle {
+	c.Open *= factor
+	c.High *= factor
+	c.Low *= factor
+	c.Close *= factor
+	return c
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// Replication modes: the leader fetches from Hyperliquid and streams cache
+// updates to followers, which mirror it without fetching
+const (
+	ReplicationLeader   = "leader"
+	ReplicationFollower = "follower"
+)
+
+const (
+	replicationHeartbeat = 15 * time.Second
+	// A follower reconnects when the leader has been silent this long
+	replicationIdleTimeout = 3 * replicationHeartbeat
+	// Updates queued per follower before it's dropped and has to resync
+	replicationBuffer   = 16
+	replicationMaxRetry = 30 * time.Second
+	// Connecting and waiting for the leader's headers; the stream itself is
+	// bounded by the idle timeout instead
+	replicationConnectTimeout = 10 * time.Second
+)
+
+// replicationClient has no overall timeout, as the stream never ends
+var replicationClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: replicationConnectTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   replicationConnectTimeout,
+		ResponseHeaderTimeout: replicationConnectTimeout,
+	},
+}
+
+// MirrorsCache reports whether this process serves a cache fetched by
+// another one, as a shared snapshot reader or a replication follower
+func (c *Config) MirrorsCache() bool {
+	return c.SharedSnapshotMode == "reader" || c.ReplicationMode == ReplicationFollower
+}
+
+// ReplicationUpdate is one message of the replication stream, sent as a
+// line of JSON. The first message of a stream is a full snapshot; later
+// ones carry the entries changed by a fetch cycle. Heartbeats are empty.
+type ReplicationUpdate struct {
+	Snapshot bool                  `json:"snapshot,omitempty"` // Entries replace the follower's whole cache
+	Entries  map[string]CacheEntry `json:"entries,omitempty"`
+	Symbols  []string              `json:"symbols,omitempty"`
+	Metadata []SymbolMeta          `json:"metadata,omitempty"`
+}
+
+// replicationHub fans encoded updates out to connected followers
+type replicationHub struct {
+	mu        sync.Mutex
+	followers map[chan []byte]string // Update channel -> remote address
+	closed    bool
+}
+
+var replication = &replicationHub{followers: make(map[chan []byte]string)}
+
+// subscribe registers a follower; nil once the hub is closed
+func (h *replicationHub) subscribe(addr string) chan []byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	ch := make(chan []byte, replicationBuffer)
+	h.followers[ch] = addr
+	metrics.Set("replication_followers", float64(len(h.followers)))
+	return ch
+}
+
+func (h *replicationHub) unsubscribe(ch chan []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.followers[ch]; ok {
+		delete(h.followers, ch)
+		close(ch)
+	}
+	metrics.Set("replication_followers", float64(len(h.followers)))
+}
+
+// publish queues an update for every follower. A follower too far behind is
+// disconnected rather than allowed to stall the others; it resyncs from a
+// fresh snapshot when it reconnects.
+func (h *replicationHub) publish(line []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch, addr := range h.followers {
+		select {
+		case ch <- line:
+		default:
+			log.Printf("[Replication] Follower %s fell behind, disconnecting", addr)
+			delete(h.followers, ch)
+			close(ch)
+		}
+	}
+	metrics.Set("replication_followers", float64(len(h.followers)))
+}
+
+// close ends every stream, so followers reconnect to the next leader
+func (h *replicationHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.followers {
+		delete(h.followers, ch)
+		close(ch)
+	}
+}
+
+func encodeReplicationUpdate(update ReplicationUpdate) ([]byte, error) {
+	line, err := json.Marshal(update)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+// ReplicationLeaderActor streams the symbols changed by each candle cycle
+// to followers, along with the symbol list and metadata when they change
+type ReplicationLeaderActor struct {
+	cache *Cache
+	hub   *replicationHub
+
+	lastSymbols  []string // Last sent, as followers start from a snapshot
+	lastMetadata []SymbolMeta
+}
+
+// NewReplicationLeaderActor creates a new replication leader actor
+func NewReplicationLeaderActor(cache *Cache, hub *replicationHub) *ReplicationLeaderActor {
+	return &ReplicationLeaderActor{cache: cache, hub: hub}
+}
+
+func (a *ReplicationLeaderActor) Receive(ctx *actor.Context) {
+	switch msg := ctx.Message().(type) {
+	case actor.Started:
+		ctx.Engine().Subscribe(ctx.PID())
+		log.Println("[Replication] Leader started")
+
+	case CandleCycleDoneMsg:
+		a.publish(msg.Changed)
+
+	case ListingsBackfilledMsg:
+		a.publish(msg.Symbols)
+
+	case actor.Stopped:
+		ctx.Engine().Unsubscribe(ctx.PID())
+		a.hub.close()
+		log.Println("[Replication] Leader stopped")
+	}
+}
+
+// publish sends followers the changed symbols' entries, and the symbol list
+// and metadata when they changed
+func (a *ReplicationLeaderActor) publish(changed []string) {
+	update := ReplicationUpdate{Entries: make(map[string]CacheEntry, len(changed))}
+	if symbols := a.cache.GetSymbols(); !slices.Equal(symbols, a.lastSymbols) {
+		update.Symbols = symbols
+		a.lastSymbols = symbols
+	}
+	if metadata := a.cache.GetMetadata(); !slices.Equal(metadata, a.lastMetadata) {
+		update.Metadata = metadata
+		a.lastMetadata = metadata
+	}
+	for _, symbol := range changed {
+		if entry, ok := a.cache.Get(symbol); ok {
+			update.Entries[symbol] = entry
+		}
+	}
+	line, err := encodeReplicationUpdate(update)
+	if err != nil {
+		log.Printf("[Replication] ERROR: Failed to encode update: %v", err)
+		return
+	}
+	a.hub.publish(line)
+	metrics.Inc("replication_updates_total")
+}
+
+// handleAdminReplication streams the cache to a follower: a snapshot, then
+// an update after every candle cycle, with heartbeats in between
+func handleAdminReplication(w http.ResponseWriter, r *http.Request) {
+	if config.ReplicationMode != ReplicationLeader {
+		http.Error(w, "Not a replication leader", http.StatusNotFound)
+		return
+	}
+	if !checkClusterToken(w, r) {
+		return
+	}
+
+	// Subscribe before taking the snapshot so no cycle falls in between
+	updates := replication.subscribe(r.RemoteAddr)
+	if updates == nil {
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer replication.unsubscribe(updates)
+
+	snapshot := cache.Snapshot()
+	line, err := encodeReplicationUpdate(ReplicationUpdate{
+		Snapshot: true,
+		Entries:  snapshot.Entries,
+		Symbols:  snapshot.Symbols,
+		Metadata: snapshot.Metadata,
+	})
+	if err != nil {
+		log.Printf("[Replication] ERROR: Failed to encode snapshot: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	rc := http.NewResponseController(w)
+	send := func(line []byte) error {
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	if err := send(line); err != nil {
+		return
+	}
+	log.Printf("[Replication] Follower %s connected (%d symbols)", r.RemoteAddr, len(snapshot.Entries))
+
+	heartbeat := time.NewTicker(replicationHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case line, ok := <-updates:
+			if !ok {
+				return
+			}
+			err = send(line)
+		case <-heartbeat.C:
+			err = send([]byte("{}\n"))
+		case <-r.Context().Done():
+			err = r.Context().Err()
+		}
+		if err != nil {
+			log.Printf("[Replication] Follower %s disconnected: %v", r.RemoteAddr, err)
+			return
+		}
+	}
+}
+
+// ReplicationFollowerActor mirrors leaders' caches over their replication
+// streams, reconnecting with backoff whenever a stream ends. Several leaders
+// are sharded fetchers, each owning part of the symbols, and their streams
+// are merged. With a shard coordinator the leaders are discovered from it
+// and followed as they join and leave.
+type ReplicationFollowerActor struct {
+	cache       *Cache
+	leaderURLs  []string
+	coordinator *shardClient
+	token       string
+	streams     map[string]context.CancelFunc // Leader URL -> stop its stream
+}
+
+// NewReplicationFollowerActor creates a new replication follower actor for
+// a comma-separated list of leader URLs, or for the leaders registered with
+// coordinator when it's non-nil
+func NewReplicationFollowerActor(cache *Cache, leaderURLs string, coordinator *shardClient, token string) *ReplicationFollowerActor {
+	a := &ReplicationFollowerActor{
+		cache:       cache,
+		coordinator: coordinator,
+		token:       token,
+		streams:     make(map[string]context.CancelFunc),
+	}
+	for _, url := range strings.Split(leaderURLs, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			a.leaderURLs = append(a.leaderURLs, replicationStreamURL(url))
+		}
+	}
+	return a
+}
+
+func replicationStreamURL(leaderURL string) string {
+	return strings.TrimSuffix(leaderURL, "/") + "/admin/replication"
+}
+
+func (a *ReplicationFollowerActor) Receive(ctx *actor.Context) {
+	switch ctx.Message().(type) {
+	case actor.Started:
+		startHeartbeat(ctx)
+		if a.coordinator != nil {
+			log.Printf("[Replication] Follower started (leaders from %s)", a.coordinator.url)
+			a.discoverLeaders()
+			ctx.SendRepeat(ctx.PID(), ShardHeartbeatMsg{}, shardHeartbeatInterval)
+		} else {
+			log.Printf("[Replication] Follower started (leaders %s)", strings.Join(a.leaderURLs, ", "))
+			a.setLeaders(a.leaderURLs)
+		}
+
+	case ShardHeartbeatMsg:
+		a.discoverLeaders()
+
+	case HeartbeatMsg:
+		heartbeats.Beat(ctx.PID())
+
+	case actor.Stopped:
+		a.setLeaders(nil)
+		log.Println("[Replication] Follower stopped")
+	}
+}
+
+// discoverLeaders follows the fetcher nodes registered with the
+// coordinator. If it's unreachable the current streams carry on.
+func (a *ReplicationFollowerActor) discoverLeaders() {
+	members, err := a.coordinator.members()
+	if err != nil {
+		log.Printf("[Replication] ERROR: Leader discovery failed: %v", err)
+		return
+	}
+	urls := make([]string, 0, len(members))
+	for _, m := range members {
+		urls = append(urls, replicationStreamURL(m.URL))
+	}
+	a.setLeaders(urls)
+}
+
+// setLeaders starts streams from new leaders and stops those from leaders
+// no longer listed
+func (a *ReplicationFollowerActor) setLeaders(urls []string) {
+	keep := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		keep[url] = true
+		if _, ok := a.streams[url]; !ok {
+			ctx, cancel := context.WithCancel(context.Background())
+			a.streams[url] = cancel
+			go a.run(ctx, url)
+		}
+	}
+	for url, cancel := range a.streams {
+		if !keep[url] {
+			cancel()
+			delete(a.streams, url)
+			metrics.Set("replication_connected", 0, "leader", url)
+			log.Printf("[Replication] Stopped following %s", url)
+		}
+	}
+}
+
+// run follows the leader at url until ctx is cancelled
+func (a *ReplicationFollowerActor) run(ctx context.Context, url string) {
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := a.follow(ctx, url)
+		if ctx.Err() != nil {
+			return
+		}
+		metrics.Set("replication_connected", 0, "leader", url)
+		// A stream that stayed up resets the backoff
+		if time.Since(start) > replicationIdleTimeout {
+			backoff = time.Second
+		}
+		log.Printf("[Replication] Stream from %s ended: %v, reconnecting in %v", url, err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, replicationMaxRetry)
+	}
+}
+
+// follow applies one stream's updates until it fails or goes idle
+func (a *ReplicationFollowerActor) follow(ctx context.Context, url string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+	resp, err := replicationClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("leader returned status %d", resp.StatusCode)
+	}
+
+	// Heartbeats keep the idle timer from firing on a healthy stream
+	idle := time.AfterFunc(replicationIdleTimeout, cancel)
+	defer idle.Stop()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var update ReplicationUpdate
+		if err := decoder.Decode(&update); err != nil {
+			if ctx.Err() != nil && !idle.Stop() {
+				return fmt.Errorf("no data from leader for %v", replicationIdleTimeout)
+			}
+			return err
+		}
+		idle.Reset(replicationIdleTimeout)
+		a.apply(url, update)
+	}
+}
+
+func (a *ReplicationFollowerActor) apply(url string, update ReplicationUpdate) {
+	if update.Snapshot {
+		metrics.Set("replication_connected", 1, "leader", url)
+		log.Printf("[Replication] Synced %d symbols from %s", len(update.Entries), url)
+		// A shard's snapshot only covers its own symbols, so it's merged below
+		if len(a.leaderURLs) == 1 && a.coordinator == nil {
+			lastUpdate := time.Time{}
+			for _, entry := range update.Entries {
+				if entry.LastUpdate.After(lastUpdate) {
+					lastUpdate = entry.LastUpdate
+				}
+			}
+			a.cache.ReplaceAll(update.Entries, update.Symbols, update.Metadata, lastUpdate)
+			return
+		}
+	}
+	if update.Entries == nil && update.Symbols == nil && update.Metadata == nil {
+		return // Heartbeat
+	}
+	a.cache.Apply(update.Entries)
+	if update.Symbols != nil {
+		a.cache.SetSymbols(update.Symbols)
+	}
+	if update.Metadata != nil {
+		a.cache.SetMetadata(update.Metadata)
+		openInterestHistory.Record(update.Metadata)
+	}
+	metrics.Inc("replication_updates_total")
+	metrics.Set("replication_last_update_timestamp_seconds", float64(time.Now().Unix()))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// exchangeLocation is the default time zone for resampled day and week
+// boundaries, from EXCHANGE_TIMEZONE
+var exchangeLocation = time.UTC
+
+// calendarIntervals are the resample targets whose buckets follow the
+// calendar of a time zone rather than fixed UTC multiples
+var calendarIntervals = map[string]bool{"1d": true, "1w": true, "1M": true}
+
+// canResample reports whether a series of interval from can be resampled
+// into interval to
+func canResample(from, to string) bool {
+	fromLen, ok := intervalDuration(from)
+	if !ok || !calendarIntervals[to] {
+		return false
+	}
+	toLen, _ := intervalDuration(to)
+	return fromLen < toLen
+}
+
+// bucketBounds returns the start and end of the day, ISO week (Monday) or
+// calendar month containing t in loc
+func bucketBounds(t time.Time, target string, loc *time.Location) (time.Time, time.Time) {
+	t = t.In(loc)
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	switch target {
+	case "1w":
+		start = start.AddDate(0, 0, -int((start.Weekday()+6)%7))
+		return start, start.AddDate(0, 0, 7)
+	case "1M":
+		start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0)
+	}
+	return start, start.AddDate(0, 0, 1)
+}
+
+// resample aggregates candles into days, weeks or months starting at local
+// midnight in loc. Bucket timestamps are the bucket's open time in milliseconds. Each
+// bucket boundary must fall on a source candle boundary, otherwise a candle
+// would straddle two buckets: hourly candles can't be cut at a +05:30
+// midnight, for example.
+func resample(candles CandleSeries, from, target string, loc *time.Location) ([]Candle, error) {
+	fromLen, _ := intervalDuration(from)
+	step := fromLen.Milliseconds()
+
+	var buckets []Candle
+	var bucketEnd int64
+	var volume decimalSum
+	for i := 0; i < candles.Len(); i++ {
+		ts := candles.Timestamp(i)
+		if n := len(buckets); n > 0 && ts < bucketEnd {
+			b := &buckets[n-1]
+			b.High = max(b.High, candles.Highs[i])
+			b.Low = min(b.Low, candles.Lows[i])
+			b.Close = candles.Closes[i]
+			volume.Add(candles.Volumes[i])
+			b.Volume = volume.Value()
+			continue
+		}
+
+		start, end := bucketBounds(time.UnixMilli(ts), target, loc)
+		if start.UnixMilli()%step != 0 {
+			return nil, fmt.Errorf("%s candles can't be aligned to %s midnight (UTC%s)", from, loc, start.Format("-07:00"))
+		}
+		bucketEnd = end.UnixMilli()
+		c := candles.At(i)
+		c.Timestamp = start.UnixMilli()
+		buckets = append(buckets, c)
+		volume = decimalSum{}
+		volume.Add(c.Volume)
+	}
+	return buckets, nil
+}
+
+// requestLocation resolves ?tz=, falling back to EXCHANGE_TIMEZONE
+func requestLocation(query url.Values) (*time.Location, error) {
+	name := query.Get("tz")
+	if name == "" {
+		return exchangeLocation, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tz %q: use an IANA name like America/New_York", name)
+	}
+	return loc, nil
+}
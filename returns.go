@@ -0,0 +1,119 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// ReturnPoint is the return of the candle at Timestamp over the period
+// candles before it
+type ReturnPoint struct {
+	Timestamp int64   `json:"timestamp"`
+	Return    float64 `json:"return"`
+}
+
+// computeReturns returns close-to-close returns over period candles, simple
+// or log. Candles without a positive close on both ends are skipped.
+func computeReturns(candles CandleSeries, period int, logReturns bool) []ReturnPoint {
+	returns := make([]ReturnPoint, 0, max(candles.Len()-period, 0))
+	for i := period; i < candles.Len(); i++ {
+		prev, cur := candles.At(i-period).Close, candles.At(i).Close
+		if prev <= 0 || cur <= 0 {
+			continue
+		}
+		ret := cur/prev - 1
+		if logReturns {
+			ret = math.Log(cur / prev)
+		}
+		returns = append(returns, ReturnPoint{Timestamp: candles.Timestamp(i), Return: ret})
+	}
+	return returns
+}
+
+// handleGetReturns returns a symbol's per-candle returns. ?period=N compares
+// each close with the one N candles earlier, ?log=true gives log returns,
+// and ?interval= computes them over calendar-resampled candles.
+func handleGetReturns(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	period := 1
+	if raw := query.Get("period"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid period: use a positive number of candles", http.StatusBadRequest)
+			return
+		}
+		period = n
+	}
+	logReturns := query.Get("log") == "true"
+
+	interval, resampleTo := config.CandleInterval, ""
+	if requested := query.Get("interval"); requested != "" {
+		normalized, err := normalizeInterval(requested)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch {
+		case normalized == interval:
+		case canResample(interval, normalized):
+			resampleTo = normalized
+		default:
+			http.Error(w, "Interval "+normalized+" is not served; see /api/intervals", http.StatusBadRequest)
+			return
+		}
+	}
+	loc, err := requestLocation(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.Get("tz") != "" && resampleTo == "" {
+		http.Error(w, "tz applies to resampled intervals only: use interval=1d, 1w or 1M", http.StatusBadRequest)
+		return
+	}
+
+	symbol := cache.CanonicalSymbol(r.PathValue("symbol"))
+	entry, exists := cache.Get(symbol)
+	if !exists {
+		http.Error(w, "Symbol not found", http.StatusNotFound)
+		return
+	}
+	if setETag(w, r, generateETag(entry.LastUpdate)) {
+		return
+	}
+
+	candles, err := filterCandles(entry.Candles, query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if resampleTo != "" {
+		buckets, err := resample(candles, interval, resampleTo, loc)
+		if err != nil {
+			http.Error(w, err.Error()+"; use a shorter CANDLE_INTERVAL", http.StatusBadRequest)
+			return
+		}
+		candles = NewCandleSeries(buckets)
+		interval = resampleTo
+	}
+
+	returns := computeReturns(candles, period, logReturns)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := writeJSON(r.Context(), w, map[string]interface{}{
+		"symbol":      entry.Symbol,
+		"interval":    interval,
+		"period":      period,
+		"log":         logReturns,
+		"returns":     returns,
+		"count":       len(returns),
+		"last_update": entry.LastUpdate,
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// rotationPolicy controls when a rotatingFile rotates and what it retains.
+// Zero values disable the corresponding limit.
+type rotationPolicy struct {
+	MaxSize  int64         // Rotate once the file would grow past this many bytes
+	Interval time.Duration // Rotate at each multiple of this (e.g. 24h rotates at midnight UTC)
+	Keep     int           // Rotated files to keep
+	MaxAge   time.Duration // Delete rotated files last written longer ago than this
+}
+
+// rotatingFile is an append-only file that is renamed to path.1 (shifting
+// older generations to path.2 ... path.<keep>) when its policy says so
+type rotatingFile struct {
+	mu     sync.Mutex
+	path   string
+	policy rotationPolicy
+	file   *os.File
+	size   int64
+	period time.Time // Start of the interval the live file belongs to
+}
+
+// openRotatingFile opens (or creates) path for appending
+func openRotatingFile(path string, policy rotationPolicy) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, policy: policy}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	// A file left over from an earlier run belongs to the interval it was
+	// last written in, so it rotates on the first write if that has passed
+	r.period = r.periodOf(time.Now())
+	if r.size > 0 {
+		r.period = r.periodOf(info.ModTime())
+	}
+	return nil
+}
+
+func (r *rotatingFile) periodOf(t time.Time) time.Time {
+	if r.policy.Interval <= 0 {
+		return time.Time{}
+	}
+	return t.UTC().Truncate(r.policy.Interval)
+}
+
+// Write appends p, rotating first if p would push the file past MaxSize or
+// the current interval has ended. A failed rotation is reported, but p is
+// still appended to the current file rather than lost.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.periodOf(time.Now())
+	full := r.policy.MaxSize > 0 && r.size+int64(len(p)) > r.policy.MaxSize
+	var rotateErr error
+	if r.size > 0 && (full || now.After(r.period)) {
+		if err := r.rotateLocked(); err != nil {
+			rotateErr = fmt.Errorf("failed to rotate %s: %w", r.path, err)
+		}
+	}
+	if r.size == 0 {
+		r.period = now
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// rotateLocked shifts the generations up by one and starts a fresh file.
+// The live file is only closed once its replacement is open, so if a step
+// fails writes carry on into it. Callers must hold r.mu.
+func (r *rotatingFile) rotateLocked() error {
+	// An earlier rotation moved the live file but couldn't open a new one
+	if _, err := os.Stat(r.path); errors.Is(err, fs.ErrNotExist) {
+		return r.reopenLocked()
+	}
+
+	keep := r.policy.Keep
+	if keep > 0 {
+		if err := os.Remove(r.generation(keep)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		for i := keep - 1; i >= 1; i-- {
+			if err := os.Rename(r.generation(i), r.generation(i+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		if err := os.Rename(r.path, r.generation(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+	if err := r.reopenLocked(); err != nil {
+		return err
+	}
+
+	if r.policy.MaxAge > 0 {
+		cutoff := time.Now().Add(-r.policy.MaxAge)
+		for i := 1; i <= keep; i++ {
+			if info, err := os.Stat(r.generation(i)); err == nil && info.ModTime().Before(cutoff) {
+				os.Remove(r.generation(i))
+			}
+		}
+	}
+	return nil
+}
+
+// reopenLocked opens a fresh file at path and closes the previous one. On
+// failure the previous one stays in use. Callers must hold r.mu.
+func (r *rotatingFile) reopenLocked() error {
+	prev := r.file
+	if err := r.open(); err != nil {
+		return err
+	}
+	prev.Close()
+	return nil
+}
+
+// generation returns the path of the i-th rotated file (0 is the live one)
+func (r *rotatingFile) generation(i int) string {
+	if i == 0 {
+		return r.path
+	}
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
+
+// Files returns the existing files, oldest first
+func (r *rotatingFile) Files() []string {
+	var files []string
+	for i := r.policy.Keep; i >= 0; i-- {
+		if _, err := os.Stat(r.generation(i)); err == nil {
+			files = append(files, r.generation(i))
+		}
+	}
+	return files
+}
+
+// Close closes the live file
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
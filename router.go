@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Router is a ServeMux that knows which methods each route accepts. A
+// request with any other method gets 405 with an Allow header, and OPTIONS
+// is answered from the same list (including CORS preflights, when the CORS
+// middleware is in front), so handlers don't check methods themselves.
+type Router struct {
+	mux *http.ServeMux
+}
+
+// NewRouter creates an empty router
+func NewRouter() *Router {
+	return &Router{mux: http.NewServeMux()}
+}
+
+// HandleFunc registers handler for pattern, a method-less ServeMux pattern
+// whose wildcards handlers read with r.PathValue (e.g. /api/candles/{symbol}).
+// GET doesn't imply HEAD: it's only accepted when listed, because a streaming
+// GET handler such as /api/stream never returns and would hold a HEAD
+// request open.
+func (rt *Router) HandleFunc(pattern string, handler http.HandlerFunc, methods ...string) {
+	allow := strings.Join(append(append([]string(nil), methods...), http.MethodOptions), ", ")
+	rt.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range methods {
+			if r.Method == m {
+				handler(w, r)
+				return
+			}
+		}
+		w.Header().Set("Allow", allow)
+		if r.Method == http.MethodOptions {
+			if w.Header().Get("Access-Control-Allow-Methods") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", allow)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	})
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
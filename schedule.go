@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// Refresh tiers: each periodic refresher whose next run clients may want to
+// poll after
+const (
+	RefreshCandles    = "candles"
+	RefreshSymbols    = "symbols"
+	RefreshDaily      = "daily"
+	RefreshMarketData = "market_data"
+	RefreshFXRates    = "fx_rates"
+	RefreshMids       = "mids"
+)
+
+// Maintenance tasks: scheduled like refreshes, but not reported to clients
+const (
+	TaskArchive = "archive"
+	TaskPrune   = "prune"
+)
+
+var maintenanceTasks = map[string]bool{TaskArchive: true, TaskPrune: true}
+
+var errTaskNotFound = errors.New("task not found")
+
+// scheduledTask sends msg to pid each time its schedule comes round
+type scheduledTask struct {
+	name     string
+	spec     string
+	schedule Schedule
+	interval time.Duration // The actor's own interval, used without a configured spec
+	pid      *actor.PID
+	msg      any
+	timer    *time.Timer
+	next     time.Time
+	last     time.Time
+	runs     int
+}
+
+// ScheduledTask is a task's state on /admin/schedule
+type ScheduledTask struct {
+	Name     string     `json:"name"`
+	Schedule string     `json:"schedule"`
+	Source   string     `json:"source"` // default, env or runtime
+	Next     *time.Time `json:"next,omitempty"`
+	LastRun  *time.Time `json:"last_run,omitempty"`
+	Runs     int        `json:"runs"`
+}
+
+// Scheduler runs the periodic tasks of actors: fetch cycles, symbol
+// refreshes, archival and pruning. A task runs on its cron expression from
+// config (or one set at runtime), and otherwise every interval the actor
+// was configured with. Actors that aren't running on this instance (e.g.
+// fetchers on a shared snapshot reader) have no task.
+type Scheduler struct {
+	mu         sync.Mutex
+	tasks      map[string]*scheduledTask
+	configured map[string]string // Task to cron expression, from the environment
+	overrides  map[string]string // Task to cron expression, set on /admin/schedule
+}
+
+var scheduler = NewScheduler(nil)
+
+// NewScheduler creates a scheduler with the configured cron expressions
+func NewScheduler(configured map[string]string) *Scheduler {
+	return &Scheduler{
+		tasks:      make(map[string]*scheduledTask),
+		configured: configured,
+		overrides:  make(map[string]string),
+	}
+}
+
+// Add schedules msg to be sent to pid, replacing any earlier task of the
+// same name (e.g. from an actor the watchdog replaced). Call it from the
+// actor's actor.Started and Remove from its actor.Stopped.
+func (s *Scheduler) Add(name string, interval time.Duration, pid *actor.PID, msg any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if prev, ok := s.tasks[name]; ok {
+		prev.stop()
+	}
+	t := &scheduledTask{name: name, interval: interval, pid: pid, msg: msg}
+	if err := s.setScheduleLocked(t, s.specLocked(name, interval)); err != nil {
+		// Configured expressions are validated at startup, so this is a runtime one
+		log.Printf("[Scheduler] ERROR: %v, running %s every %v", err, name, interval)
+		if err := s.setScheduleLocked(t, everySpec(interval)); err != nil {
+			log.Printf("[Scheduler] ERROR: %s not scheduled: %v", name, err)
+			return
+		}
+	}
+	s.tasks[name] = t
+}
+
+// Remove stops name's task if it still belongs to pid
+func (s *Scheduler) Remove(name string, pid *actor.PID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tasks[name]; ok && t.pid == pid {
+		t.stop()
+		delete(s.tasks, name)
+	}
+}
+
+// Set changes a running task's schedule until the next restart. An empty
+// spec restores the configured one.
+func (s *Scheduler) Set(name, spec string) (ScheduledTask, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tasks[name]
+	if !ok {
+		return ScheduledTask{}, errTaskNotFound
+	}
+	restore := spec == ""
+	if restore {
+		delete(s.overrides, name)
+		spec = s.specLocked(name, t.interval)
+	}
+	if err := s.setScheduleLocked(t, spec); err != nil {
+		return ScheduledTask{}, err
+	}
+	if !restore {
+		s.overrides[name] = spec
+	}
+	log.Printf("[Scheduler] %s now runs on %q, next at %s", name, t.spec, t.next.UTC().Format(time.RFC3339))
+	return s.statusLocked(t), nil
+}
+
+// specLocked returns name's runtime, configured or default schedule
+func (s *Scheduler) specLocked(name string, interval time.Duration) string {
+	if spec, ok := s.overrides[name]; ok {
+		return spec
+	}
+	if spec := s.configured[name]; spec != "" {
+		return spec
+	}
+	return everySpec(interval)
+}
+
+// setScheduleLocked parses spec and rearms t's timer for its next run. A
+// spec that doesn't parse leaves t as it was.
+func (s *Scheduler) setScheduleLocked(t *scheduledTask, spec string) error {
+	schedule, err := parseSchedule(spec, time.Now())
+	if err != nil {
+		return err
+	}
+	t.stop()
+	t.spec, t.schedule = spec, schedule
+	s.armLocked(t, time.Now())
+	return nil
+}
+
+// armLocked sets t's timer for its next run after now. A cron expression
+// that never matches leaves it unset.
+func (s *Scheduler) armLocked(t *scheduledTask, now time.Time) {
+	t.next = t.schedule.Next(now)
+	t.timer = nil
+	if !t.next.IsZero() {
+		t.timer = time.AfterFunc(t.next.Sub(now), func() { s.fire(t) })
+	}
+}
+
+func (t *scheduledTask) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+func (s *Scheduler) fire(t *scheduledTask) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tasks[t.name] != t {
+		return // Replaced or removed since the timer was set
+	}
+	now := time.Now()
+	t.last = now
+	t.runs++
+	engine.Send(t.pid, t.msg)
+	s.armLocked(t, maxTime(now, t.next))
+}
+
+// Next returns when name's next run is due after now
+func (s *Scheduler) Next(name string, now time.Time) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[name]
+	if !ok || t.next.IsZero() {
+		return time.Time{}, false
+	}
+	return t.schedule.Next(now), true
+}
+
+// All returns the next refresh of every scheduled refresh tier, or nil if
+// there are none
+func (s *Scheduler) All(now time.Time) map[string]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := make(map[string]time.Time, len(s.tasks))
+	for name, t := range s.tasks {
+		if maintenanceTasks[name] || t.next.IsZero() {
+			continue
+		}
+		next[name] = t.schedule.Next(now).UTC()
+	}
+	if len(next) == 0 {
+		return nil
+	}
+	return next
+}
+
+// List returns every task's state, by name
+func (s *Scheduler) List() []ScheduledTask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tasks := make([]ScheduledTask, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		tasks = append(tasks, s.statusLocked(t))
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
+	return tasks
+}
+
+func (s *Scheduler) statusLocked(t *scheduledTask) ScheduledTask {
+	status := ScheduledTask{Name: t.name, Schedule: t.spec, Source: "default", Runs: t.runs}
+	if _, ok := s.overrides[t.name]; ok {
+		status.Source = "runtime"
+	} else if s.configured[t.name] != "" {
+		status.Source = "env"
+	}
+	if !t.next.IsZero() {
+		next := t.next.UTC()
+		status.Next = &next
+	}
+	if !t.last.IsZero() {
+		last := t.last.UTC()
+		status.LastRun = &last
+	}
+	return status
+}
+
+// everySpec is the schedule of a task that runs every interval
+func everySpec(interval time.Duration) string {
+	return "@every " + interval.String()
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// handleAdminSchedule lists the scheduled tasks. POST
+// ?task=candles&schedule=*/2 * * * * changes a task's schedule until the
+// next restart; an empty schedule restores the configured one.
+func handleAdminSchedule(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		task, err := scheduler.Set(r.URL.Query().Get("task"), strings.TrimSpace(r.URL.Query().Get("schedule")))
+		if err == errTaskNotFound {
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(task); err != nil {
+			log.Printf("Error encoding response: %v", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(scheduler.List()); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
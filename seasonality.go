@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SeasonalityBucket is the average return and volume of one hour of the day
+// or day of the week
+type SeasonalityBucket struct {
+	Bucket    int     `json:"bucket"`     // Hour 0-23, or weekday 0 (Sunday) to 6
+	AvgReturn float64 `json:"avg_return"` // Percent, open to close of the hour or day
+	AvgVolume float64 `json:"avg_volume"`
+	Count     int     `json:"count"` // Complete hours or days averaged
+}
+
+// Seasonality is a symbol's hour-of-day and day-of-week profiles. A profile
+// is omitted when the candle interval is longer than its unit.
+type Seasonality struct {
+	Symbol     string              `json:"symbol"`
+	Interval   string              `json:"interval"`
+	Timezone   string              `json:"tz"`
+	HourOfDay  []SeasonalityBucket `json:"hour_of_day,omitempty"`
+	DayOfWeek  []SeasonalityBucket `json:"day_of_week,omitempty"`
+	LastUpdate time.Time           `json:"last_update"`
+}
+
+// seasonalityCache keeps each symbol's profiles in the default time zone
+// until its candles are refreshed
+var seasonalityCache = struct {
+	mu       sync.Mutex
+	bySymbol map[string]Seasonality
+}{bySymbol: make(map[string]Seasonality)}
+
+// seasonalityProfile averages the complete units (hours or days, from
+// unitBounds) in candles by bucketOf their start
+func seasonalityProfile(candles CandleSeries, step int64, buckets int, unitBounds func(time.Time) (time.Time, time.Time), bucketOf func(time.Time) int) []SeasonalityBucket {
+	type sums struct {
+		ret, volume float64
+		count       int
+	}
+	totals := make([]sums, buckets)
+
+	var start, end time.Time
+	var open, last, volume float64
+	count := 0
+	flush := func() {
+		if count == 0 || int64(count)*step != end.Sub(start).Milliseconds() || open <= 0 {
+			return // Partial or gappy unit
+		}
+		t := &totals[bucketOf(start)]
+		t.ret += (last/open - 1) * 100
+		t.volume += volume
+		t.count++
+	}
+	for i := 0; i < candles.Len(); i++ {
+		ts := time.UnixMilli(candles.Timestamp(i))
+		if count == 0 || !ts.Before(end) {
+			flush()
+			start, end = unitBounds(ts)
+			open, volume, count = candles.Opens[i], 0, 0
+		}
+		last = candles.Closes[i]
+		volume += candles.Volumes[i]
+		count++
+	}
+	flush()
+
+	profile := make([]SeasonalityBucket, buckets)
+	for i, t := range totals {
+		profile[i] = SeasonalityBucket{Bucket: i, Count: t.count}
+		if t.count > 0 {
+			profile[i].AvgReturn = t.ret / float64(t.count)
+			profile[i].AvgVolume = t.volume / float64(t.count)
+		}
+	}
+	return profile
+}
+
+// computeSeasonality builds entry's profiles with hours and days in loc
+func computeSeasonality(entry CacheEntry, interval string, loc *time.Location) Seasonality {
+	s := Seasonality{Symbol: entry.Symbol, Interval: interval, Timezone: loc.String(), LastUpdate: entry.LastUpdate}
+	d, ok := intervalDuration(interval)
+	if !ok {
+		return s
+	}
+	step := d.Milliseconds()
+	if d <= time.Hour {
+		s.HourOfDay = seasonalityProfile(entry.Candles, step, 24, func(t time.Time) (time.Time, time.Time) {
+			t = t.In(loc)
+			start := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+			return start, start.Add(time.Hour)
+		}, func(t time.Time) int { return t.In(loc).Hour() })
+	}
+	if d <= 24*time.Hour {
+		s.DayOfWeek = seasonalityProfile(entry.Candles, step, 7, func(t time.Time) (time.Time, time.Time) {
+			return bucketBounds(t, "1d", loc)
+		}, func(t time.Time) int { return int(t.In(loc).Weekday()) })
+	}
+	return s
+}
+
+// handleGetSeasonality returns a symbol's average return and volume by hour
+// of day and day of week over the cached window, in ?tz= (default
+// EXCHANGE_TIMEZONE). Profiles are computed on first request and kept until
+// the symbol's candles are refreshed.
+func handleGetSeasonality(w http.ResponseWriter, r *http.Request) {
+	loc, err := requestLocation(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Hours and days must start on a candle boundary, as for resampling
+	if d, ok := intervalDuration(config.CandleInterval); ok {
+		if _, offset := time.Now().In(loc).Zone(); (time.Duration(offset)*time.Second)%d != 0 {
+			http.Error(w, fmt.Sprintf("%s candles can't be aligned to %s hours", config.CandleInterval, loc), http.StatusBadRequest)
+			return
+		}
+	}
+	symbol := cache.CanonicalSymbol(r.PathValue("symbol"))
+	entry, exists := cache.Get(symbol)
+	if !exists {
+		http.Error(w, "Symbol not found", http.StatusNotFound)
+		return
+	}
+	if setETag(w, r, generateETag(entry.LastUpdate)) {
+		return
+	}
+
+	var s Seasonality
+	if loc == exchangeLocation {
+		seasonalityCache.mu.Lock()
+		cached, ok := seasonalityCache.bySymbol[symbol]
+		seasonalityCache.mu.Unlock()
+		if ok && cached.LastUpdate.Equal(entry.LastUpdate) {
+			s = cached
+		} else {
+			s = computeSeasonality(entry, config.CandleInterval, loc)
+			seasonalityCache.mu.Lock()
+			seasonalityCache.bySymbol[symbol] = s
+			seasonalityCache.mu.Unlock()
+		}
+	} else {
+		s = computeSeasonality(entry, config.CandleInterval, loc)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := writeJSON(r.Context(), w, s); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// CandleSeries holds a sorted candle series column-wise, so aggregations
+// that only read closes or volumes scan contiguous memory. Series handed out
+// by the cache are shared and must not be modified.
+//
+// Candle timestamps are normally a fixed stride, so they are stored as
+// first + i*step; only series with gaps keep an explicit timestamps column.
+type CandleSeries struct {
+	first      int64
+	step       int64
+	timestamps []int64 // Unix milliseconds; nil when the stride is fixed
+	Opens      []float64
+	Highs      []float64
+	Lows       []float64
+	Closes     []float64
+	Volumes    []float64
+	rounded    bool // Encode with precision rather than full float precision
+	precision  Precision
+	mapping    *mappedFile // Shared snapshot the columns alias, kept mapped while referenced
+}
+
+// NewCandleSeries converts candles to columns. The price and volume columns
+// share one allocation.
+func NewCandleSeries(candles []Candle) CandleSeries {
+	n := len(candles)
+	values := make([]float64, 5*n)
+	s := CandleSeries{
+		Opens:   values[0*n : 1*n : 1*n],
+		Highs:   values[1*n : 2*n : 2*n],
+		Lows:    values[2*n : 3*n : 3*n],
+		Closes:  values[3*n : 4*n : 4*n],
+		Volumes: values[4*n : 5*n : 5*n],
+	}
+	if n > 0 {
+		s.first = candles[0].Timestamp
+	}
+	if n > 1 {
+		s.step = candles[1].Timestamp - s.first
+		for i, c := range candles {
+			if s.step <= 0 || c.Timestamp != s.first+int64(i)*s.step {
+				s.step = 0
+				s.timestamps = make([]int64, n)
+				break
+			}
+		}
+	}
+	for i, c := range candles {
+		if s.timestamps != nil {
+			s.timestamps[i] = c.Timestamp
+		}
+		s.Opens[i] = c.Open
+		s.Highs[i] = c.High
+		s.Lows[i] = c.Low
+		s.Closes[i] = c.Close
+		s.Volumes[i] = c.Volume
+	}
+	return s
+}
+
+// Len returns the number of candles
+func (s CandleSeries) Len() int {
+	return len(s.Closes)
+}
+
+// Timestamp returns the i-th candle's open time in Unix milliseconds
+func (s CandleSeries) Timestamp(i int) int64 {
+	if s.timestamps != nil {
+		return s.timestamps[i]
+	}
+	return s.first + int64(i)*s.step
+}
+
+// At returns the i-th candle
+func (s CandleSeries) At(i int) Candle {
+	return Candle{
+		Timestamp: s.Timestamp(i),
+		Open:      s.Opens[i],
+		High:      s.Highs[i],
+		Low:       s.Lows[i],
+		Close:     s.Closes[i],
+		Volume:    s.Volumes[i],
+	}
+}
+
+// Slice returns candles [i, j) without copying
+func (s CandleSeries) Slice(i, j int) CandleSeries {
+	sliced := CandleSeries{
+		first:     s.first,
+		step:      s.step,
+		Opens:     s.Opens[i:j],
+		Highs:     s.Highs[i:j],
+		Lows:      s.Lows[i:j],
+		Closes:    s.Closes[i:j],
+		Volumes:   s.Volumes[i:j],
+		rounded:   s.rounded,
+		precision: s.precision,
+		mapping:   s.mapping,
+	}
+	if s.timestamps != nil {
+		sliced.timestamps = s.timestamps[i:j]
+	} else if i < j {
+		sliced.first = s.Timestamp(i)
+	}
+	return sliced
+}
+
+// WithPrecision returns the series set to encode prices and volumes rounded
+// to p's decimals. The values themselves are untouched.
+func (s CandleSeries) WithPrecision(p Precision) CandleSeries {
+	s.rounded, s.precision = true, p
+	return s
+}
+
+// Candles returns the series as a freshly allocated row slice
+func (s CandleSeries) Candles() []Candle {
+	candles := make([]Candle, s.Len())
+	for i := range candles {
+		candles[i] = s.At(i)
+	}
+	return candles
+}
+
+// Reversed returns a copy of the series newest first. It's for responses
+// only: Search and the other lookups assume ascending timestamps.
+func (s CandleSeries) Reversed() CandleSeries {
+	n := s.Len()
+	candles := make([]Candle, n)
+	for i := range candles {
+		candles[i] = s.At(n - 1 - i)
+	}
+	reversed := NewCandleSeries(candles)
+	reversed.rounded, reversed.precision = s.rounded, s.precision
+	return reversed
+}
+
+// Search returns the index of the first candle with a timestamp at or after ts
+func (s CandleSeries) Search(ts int64) int {
+	n := s.Len()
+	if s.timestamps == nil && s.step > 0 {
+		if ts <= s.first {
+			return 0
+		}
+		// Ceiling division; ts > first so the numerator is positive
+		return int(min((ts-s.first+s.step-1)/s.step, int64(n)))
+	}
+	return sort.Search(n, func(i int) bool { return s.Timestamp(i) >= ts })
+}
+
+// SearchAfter returns the index of the first candle with a timestamp after ts
+func (s CandleSeries) SearchAfter(ts int64) int {
+	if ts == math.MaxInt64 {
+		return s.Len() // ts+1 would wrap around to the oldest time
+	}
+	return s.Search(ts + 1)
+}
+
+// MarshalJSON encodes the series as an array of candle objects, the same
+// shape as []Candle, without going through reflection
+func (s CandleSeries) MarshalJSON() ([]byte, error) {
+	b := make([]byte, 0, 2+s.Len()*112)
+	b = append(b, '[')
+	for i := range s.Closes {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		c := s.At(i)
+		if s.rounded {
+			c = c.Rounded(s.precision)
+		}
+		var err error
+		if b, err = appendCandleJSON(b, c); err != nil {
+			return nil, err
+		}
+	}
+	return append(b, ']'), nil
+}
+
+// Rounded returns c with prices and volume rounded to p
+func (c Candle) Rounded(p Precision) Candle {
+	c.Open = roundTo(c.Open, p.Price)
+	c.High = roundTo(c.High, p.Price)
+	c.Low = roundTo(c.Low, p.Price)
+	c.Close = roundTo(c.Close, p.Price)
+	c.Volume = roundTo(c.Volume, p.Size)
+	return c
+}
+
+// appendCandleJSON appends c as a JSON object, byte-identical to encoding/json
+func appendCandleJSON(b []byte, c Candle) ([]byte, error) {
+	b = append(b, `{"timestamp":`...)
+	b = strconv.AppendInt(b, c.Timestamp, 10)
+	for _, field := range [...]struct {
+		key   string
+		value float64
+	}{
+		{`,"open":`, c.Open},
+		{`,"high":`, c.High},
+		{`,"low":`, c.Low},
+		{`,"close":`, c.Close},
+		{`,"volume":`, c.Volume},
+	} {
+		b = append(b, field.key...)
+		var err error
+		if b, err = appendJSONFloat(b, field.value); err != nil {
+			return nil, err
+		}
+	}
+	return append(b, '}'), nil
+}
+
+// UnmarshalJSON decodes an array of candle objects
+func (s *CandleSeries) UnmarshalJSON(data []byte) error {
+	var candles []Candle
+	if err := json.Unmarshal(data, &candles); err != nil {
+		return err
+	}
+	*s = NewCandleSeries(candles)
+	return nil
+}
+
+// appendJSONFloat formats f exactly like encoding/json does
+func appendJSONFloat(b []byte, f float64) ([]byte, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, fmt.Errorf("unsupported candle value: %v", f)
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// Clean up e-09 to e-9
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b, nil
+}
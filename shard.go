@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+const (
+	shardHeartbeatInterval = 10 * time.Second
+	// A node missing this many heartbeats' worth of time leaves the pool
+	shardMemberTTL = 3 * shardHeartbeatInterval
+)
+
+// ShardAssignment is the slice of symbols a fetcher node owns
+type ShardAssignment struct {
+	Index      int `json:"index"`
+	Count      int `json:"count"`
+	Generation int `json:"generation"` // Bumped on every membership change
+}
+
+// shardAssignment is set by the coordinator when SHARD_COORDINATOR_URL is
+// configured and overrides SHARD_INDEX/SHARD_COUNT
+var shardAssignment atomic.Pointer[ShardAssignment]
+
+// shardOf returns the shard that fetches symbol out of count. The hash is
+// stable across processes and releases, so every instance agrees on it.
+func shardOf(symbol string, count int) int {
+	h := fnv.New32a()
+	h.Write([]byte(symbol))
+	return int(h.Sum32() % uint32(count))
+}
+
+// currentShard returns this instance's shard index and count
+func currentShard() (int, int) {
+	if a := shardAssignment.Load(); a != nil {
+		return a.Index, a.Count
+	}
+	if config == nil {
+		return 0, 1
+	}
+	return config.ShardIndex, config.ShardCount
+}
+
+// inShard reports whether this instance fetches symbol. Without sharding
+// every symbol is ours.
+func inShard(symbol string) bool {
+	index, count := currentShard()
+	if count <= 1 {
+		return true
+	}
+	return shardOf(symbol, count) == index
+}
+
+// validateShard checks SHARD_INDEX against SHARD_COUNT
+func (c *Config) validateShard() error {
+	if c.ShardCount < 1 {
+		return fmt.Errorf("SHARD_COUNT must be at least 1, got %d", c.ShardCount)
+	}
+	if c.ShardIndex < 0 || c.ShardIndex >= c.ShardCount {
+		return fmt.Errorf("SHARD_INDEX must be between 0 and %d, got %d", c.ShardCount-1, c.ShardIndex)
+	}
+	// Any node that can reach the coordinator could otherwise take shards
+	if (c.ShardCoordinator || c.ShardCoordinatorURL != "") && c.ReplicationToken == "" {
+		return fmt.Errorf("REPLICATION_TOKEN is required with SHARD_COORDINATOR or SHARD_COORDINATOR_URL")
+	}
+	return nil
+}
+
+// ShardMember is a fetcher node known to the coordinator
+type ShardMember struct {
+	ID       string    `json:"id"`
+	URL      string    `json:"url"` // Admin listener followers replicate from
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// ShardCoordinator tracks live fetcher nodes from their heartbeats and
+// assigns shards by node ID order, so a join or leave rebalances the
+// symbols across the pool
+type ShardCoordinator struct {
+	mu         sync.Mutex
+	members    map[string]ShardMember
+	generation int
+}
+
+// shardCoordinator is set when this instance coordinates (SHARD_COORDINATOR)
+var shardCoordinator *ShardCoordinator
+
+// NewShardCoordinator creates an empty coordinator
+func NewShardCoordinator() *ShardCoordinator {
+	return &ShardCoordinator{members: make(map[string]ShardMember)}
+}
+
+// expireLocked drops members whose heartbeats stopped. Callers must hold c.mu.
+func (c *ShardCoordinator) expireLocked(now time.Time) {
+	for id, m := range c.members {
+		if now.Sub(m.LastSeen) > shardMemberTTL {
+			delete(c.members, id)
+			c.generation++
+			log.Printf("[Shards] Node %s left (no heartbeat for %v), %d nodes", id, shardMemberTTL, len(c.members))
+		}
+	}
+}
+
+// sortedLocked returns the live members ordered by ID. Callers must hold c.mu.
+func (c *ShardCoordinator) sortedLocked() []ShardMember {
+	members := make([]ShardMember, 0, len(c.members))
+	for _, m := range c.members {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members
+}
+
+// Heartbeat records a node as alive and returns its assignment
+func (c *ShardCoordinator) Heartbeat(id, url string) ShardAssignment {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.expireLocked(now)
+	if prev, ok := c.members[id]; !ok || prev.URL != url {
+		c.generation++
+		log.Printf("[Shards] Node %s joined (%s), %d nodes", id, url, len(c.members)+1)
+	}
+	c.members[id] = ShardMember{ID: id, URL: url, LastSeen: now}
+
+	members := c.sortedLocked()
+	index := sort.Search(len(members), func(i int) bool { return members[i].ID >= id })
+	metrics.Set("shard_nodes", float64(len(members)))
+	return ShardAssignment{Index: index, Count: len(members), Generation: c.generation}
+}
+
+// Members returns the live members ordered by ID, i.e. by shard index
+func (c *ShardCoordinator) Members() ([]ShardMember, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expireLocked(time.Now())
+	return c.sortedLocked(), c.generation
+}
+
+// shardHeartbeatRequest is what a node sends the coordinator
+type shardHeartbeatRequest struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// checkClusterToken enforces REPLICATION_TOKEN on cluster endpoints
+func checkClusterToken(w http.ResponseWriter, r *http.Request) bool {
+	return checkBearerToken(w, r, config.ReplicationToken)
+}
+
+// handleAdminShards lists the fetcher nodes and their shards (GET), or
+// registers a node's heartbeat and returns its assignment (POST)
+func handleAdminShards(w http.ResponseWriter, r *http.Request) {
+	if shardCoordinator == nil {
+		http.Error(w, "Not a shard coordinator", http.StatusNotFound)
+		return
+	}
+	if !checkClusterToken(w, r) {
+		return
+	}
+
+	var response interface{}
+	switch r.Method {
+	case http.MethodGet:
+		members, generation := shardCoordinator.Members()
+		response = map[string]interface{}{
+			"generation": generation,
+			"count":      len(members),
+			"members":    members,
+		}
+	case http.MethodPost:
+		var req shardHeartbeatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" || req.URL == "" {
+			http.Error(w, "Body must be {\"id\": ..., \"url\": ...}", http.StatusBadRequest)
+			return
+		}
+		response = shardCoordinator.Heartbeat(req.ID, req.URL)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// shardClient talks to the coordinator at SHARD_COORDINATOR_URL, or to
+// this process's own coordinator when url is empty
+type shardClient struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+func newShardClient(url, token string) *shardClient {
+	if url == "" {
+		return &shardClient{url: "local"}
+	}
+	return &shardClient{
+		url:        strings.TrimSuffix(url, "/") + "/admin/shards",
+		token:      token,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (c *shardClient) do(method string, body interface{}, v interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach shard coordinator: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("shard coordinator returned status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// heartbeat registers a node and returns its assignment
+func (c *shardClient) heartbeat(id, url string) (ShardAssignment, error) {
+	if c.httpClient == nil {
+		return shardCoordinator.Heartbeat(id, url), nil
+	}
+	var a ShardAssignment
+	err := c.do(http.MethodPost, shardHeartbeatRequest{ID: id, URL: url}, &a)
+	return a, err
+}
+
+// members returns the live fetcher nodes
+func (c *shardClient) members() ([]ShardMember, error) {
+	if c.httpClient == nil {
+		members, _ := shardCoordinator.Members()
+		return members, nil
+	}
+	var resp struct {
+		Members []ShardMember `json:"members"`
+	}
+	err := c.do(http.MethodGet, nil, &resp)
+	return resp.Members, err
+}
+
+// ShardMemberActor heartbeats to the coordinator and applies the shard it
+// hands out. When the coordinator is unreachable the last assignment is
+// kept: fetching a symbol twice is better than leaving it unfetched.
+type ShardMemberActor struct {
+	client *shardClient
+	id     string
+	url    string
+}
+
+// NewShardMemberActor creates a new shard member actor
+func NewShardMemberActor(client *shardClient, id, url string) *ShardMemberActor {
+	return &ShardMemberActor{client: client, id: id, url: url}
+}
+
+func (a *ShardMemberActor) Receive(ctx *actor.Context) {
+	switch ctx.Message().(type) {
+	case actor.Started:
+		log.Printf("[Shards] Member %s started (coordinator %s)", a.id, a.client.url)
+		startHeartbeat(ctx)
+		ctx.SendRepeat(ctx.PID(), ShardHeartbeatMsg{}, shardHeartbeatInterval)
+
+	case ShardHeartbeatMsg:
+		if pid := loadPID(&candleFetcherPID); joinShards(a.client, a.id, a.url) && pid != nil {
+			// Fetch newly assigned symbols now rather than next cycle
+			ctx.Send(pid, FetchCandlesMsg{All: true})
+		}
+
+	case HeartbeatMsg:
+		heartbeats.Beat(ctx.PID())
+
+	case actor.Stopped:
+		log.Println("[Shards] Member stopped")
+	}
+}
+
+// joinShards heartbeats once and stores the assignment, reporting whether
+// it changed
+func joinShards(client *shardClient, id, url string) bool {
+	a, err := client.heartbeat(id, url)
+	if err != nil {
+		log.Printf("[Shards] ERROR: %v", err)
+		return false
+	}
+	prev := shardAssignment.Swap(&a)
+	if prev != nil && prev.Index == a.Index && prev.Count == a.Count {
+		return false
+	}
+	log.Printf("[Shards] Assigned shard %d of %d (generation %d)", a.Index, a.Count, a.Generation)
+	metrics.Set("shard_index", float64(a.Index))
+	metrics.Set("shard_count", float64(a.Count))
+	return true
+}
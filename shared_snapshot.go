@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// Shared snapshot layout (little endian). Candle blocks are 8-byte aligned
+// columns (opens, highs, lows, closes, volumes, then timestamps only when the
+// series has no fixed stride) so readers can serve them straight from a
+// read-only mapping:
+//
+//	magic [8]byte | symbols u32 | entries u32 | metadata u32 | pad u32 | updated i64 (unix ms)
+//	symbols:  { len u16 | name }
+//	entries:  { len u16 | name | offset u64 | count u64 | updated i64 | first i64 | step i64 }
+//	metadata: JSON []SymbolMeta
+//	padding to 8, then one block of columns x count x 8 bytes per entry
+const sharedSnapshotMagic = "HLSNAP03"
+
+const (
+	sharedSnapshotHeaderLen = 32
+	sharedSnapshotIndexLen  = 40 // Fixed part of an entry after its name
+)
+
+// nativeLittleEndian reports whether candles can be read without decoding
+var nativeLittleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// writeSharedSnapshot writes the cache's candles, symbols and metadata to
+// path atomically, so readers never map a partial file
+func writeSharedSnapshot(path string, c *Cache) error {
+	entries := c.GetAll()
+	symbols := c.GetSymbols()
+	metadata, err := json.Marshal(c.GetMetadata())
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Lay out the file before writing so the index can hold absolute offsets
+	offset := sharedSnapshotHeaderLen + len(metadata)
+	for _, s := range symbols {
+		offset += 2 + len(s)
+	}
+	for _, name := range names {
+		offset += 2 + len(name) + sharedSnapshotIndexLen
+	}
+	padding := (8 - offset%8) % 8
+	offset += padding
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create shared snapshot dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriterSize(tmp, 1<<20)
+	le := binary.LittleEndian
+	header := make([]byte, sharedSnapshotHeaderLen)
+	copy(header, sharedSnapshotMagic)
+	le.PutUint32(header[8:], uint32(len(symbols)))
+	le.PutUint32(header[12:], uint32(len(names)))
+	le.PutUint32(header[16:], uint32(len(metadata)))
+	le.PutUint64(header[24:], uint64(c.GetLastUpdate().UnixMilli()))
+	w.Write(header)
+
+	writeName := func(name string) {
+		w.Write(le.AppendUint16(nil, uint16(len(name))))
+		w.WriteString(name)
+	}
+	for _, s := range symbols {
+		writeName(s)
+	}
+	for _, name := range names {
+		entry := entries[name]
+		writeName(name)
+		s := entry.Candles
+		var buf [sharedSnapshotIndexLen]byte
+		le.PutUint64(buf[0:], uint64(offset))
+		le.PutUint64(buf[8:], uint64(s.Len()))
+		le.PutUint64(buf[16:], uint64(entry.LastUpdate.UnixMilli()))
+		if s.Len() > 0 {
+			le.PutUint64(buf[24:], uint64(s.Timestamp(0)))
+			le.PutUint64(buf[32:], uint64(s.step))
+		}
+		w.Write(buf[:])
+		offset += s.Len() * sharedColumns(s.Len(), s.step) * 8
+	}
+	w.Write(metadata)
+	w.Write(make([]byte, padding))
+	for _, name := range names {
+		s := entries[name].Candles
+		columns := []interface{}{s.Opens, s.Highs, s.Lows, s.Closes, s.Volumes}
+		if sharedColumns(s.Len(), s.step) == 6 {
+			timestamps := make([]int64, s.Len())
+			for i := range timestamps {
+				timestamps[i] = s.Timestamp(i)
+			}
+			columns = append(columns, timestamps)
+		}
+		for _, column := range columns {
+			if err := binary.Write(w, le, column); err != nil {
+				tmp.Close()
+				return fmt.Errorf("failed to write candles: %w", err)
+			}
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write shared snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write shared snapshot: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to set shared snapshot mode: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace shared snapshot: %w", err)
+	}
+	return nil
+}
+
+// parseSharedSnapshot decodes a mapped snapshot. The series returned hold
+// on to m, so it must stay mapped until the garbage collector finds them all
+// gone (see retireMapping).
+func parseSharedSnapshot(m *mappedFile) (map[string]CacheEntry, []string, []SymbolMeta, time.Time, error) {
+	data := m.data
+	fail := func(what string) (map[string]CacheEntry, []string, []SymbolMeta, time.Time, error) {
+		return nil, nil, nil, time.Time{}, fmt.Errorf("invalid shared snapshot: %s", what)
+	}
+	if len(data) < sharedSnapshotHeaderLen || string(data[:8]) != sharedSnapshotMagic {
+		return fail("bad header")
+	}
+	le := binary.LittleEndian
+	symbolCount := int(le.Uint32(data[8:]))
+	entryCount := int(le.Uint32(data[12:]))
+	metadataLen := int(le.Uint32(data[16:]))
+	updated := time.UnixMilli(int64(le.Uint64(data[24:])))
+
+	pos := sharedSnapshotHeaderLen
+	readName := func() (string, bool) {
+		if pos+2 > len(data) {
+			return "", false
+		}
+		n := int(le.Uint16(data[pos:]))
+		pos += 2
+		if pos+n > len(data) {
+			return "", false
+		}
+		name := string(data[pos : pos+n])
+		pos += n
+		return name, true
+	}
+
+	symbols := make([]string, 0, symbolCount)
+	for i := 0; i < symbolCount; i++ {
+		s, ok := readName()
+		if !ok {
+			return fail("truncated symbol list")
+		}
+		symbols = append(symbols, s)
+	}
+
+	entries := make(map[string]CacheEntry, entryCount)
+	for i := 0; i < entryCount; i++ {
+		name, ok := readName()
+		if !ok || pos+sharedSnapshotIndexLen > len(data) {
+			return fail("truncated index")
+		}
+		offset := int(le.Uint64(data[pos:]))
+		count := int(le.Uint64(data[pos+8:]))
+		lastUpdate := time.UnixMilli(int64(le.Uint64(data[pos+16:])))
+		first := int64(le.Uint64(data[pos+24:]))
+		step := int64(le.Uint64(data[pos+32:]))
+		pos += sharedSnapshotIndexLen
+		size := count * sharedColumns(count, step) * 8
+		if offset%8 != 0 || count < 0 || offset < 0 || offset+size > len(data) {
+			return fail("candle block out of range for " + name)
+		}
+		entries[name] = CacheEntry{
+			Symbol:     name,
+			Candles:    sharedSeries(m, data[offset:offset+size], count, first, step),
+			LastUpdate: lastUpdate,
+		}
+	}
+
+	if pos+metadataLen > len(data) {
+		return fail("truncated metadata")
+	}
+	var metadata []SymbolMeta
+	if err := json.Unmarshal(data[pos:pos+metadataLen], &metadata); err != nil {
+		return fail("bad metadata")
+	}
+	return entries, symbols, metadata, updated, nil
+}
+
+// sharedColumns returns how many columns an entry's block holds: timestamps
+// are only stored for series longer than one candle without a fixed stride
+func sharedColumns(count int, step int64) int {
+	if count > 1 && step == 0 {
+		return 6
+	}
+	return 5
+}
+
+// sharedSeries returns block as a candle series. When the host byte order
+// matches the file the columns alias the mapping, so readers share its pages
+// rather than each holding a copy; otherwise they're decoded onto the heap.
+func sharedSeries(m *mappedFile, block []byte, count int, first, step int64) CandleSeries {
+	if count == 0 {
+		return NewCandleSeries(nil)
+	}
+	column := func(i int) []byte { return block[i*count*8 : (i+1)*count*8] }
+	s := CandleSeries{first: first, step: step}
+	if nativeLittleEndian {
+		floats := func(i int) []float64 {
+			return unsafe.Slice((*float64)(unsafe.Pointer(&column(i)[0])), count)
+		}
+		s.Opens, s.Highs, s.Lows, s.Closes, s.Volumes = floats(0), floats(1), floats(2), floats(3), floats(4)
+		if sharedColumns(count, step) == 6 {
+			s.timestamps = unsafe.Slice((*int64)(unsafe.Pointer(&column(5)[0])), count)
+		}
+		s.mapping = m
+		return s
+	}
+
+	// The price and volume columns share one allocation, as in NewCandleSeries
+	prices := make([]float64, 5*count)
+	floats := func(i int) []float64 {
+		b := column(i)
+		values := prices[i*count : (i+1)*count : (i+1)*count]
+		for j := range values {
+			values[j] = math.Float64frombits(binary.LittleEndian.Uint64(b[j*8:]))
+		}
+		return values
+	}
+	s.Opens, s.Highs, s.Lows, s.Closes, s.Volumes = floats(0), floats(1), floats(2), floats(3), floats(4)
+	if sharedColumns(count, step) == 6 {
+		b := column(5)
+		s.timestamps = make([]int64, count)
+		for j := range s.timestamps {
+			s.timestamps[j] = int64(binary.LittleEndian.Uint64(b[j*8:]))
+		}
+	}
+	return s
+}
+
+// SharedSnapshotWriterActor rewrites the shared snapshot after every fetch
+// cycle for reader processes on the same host
+type SharedSnapshotWriterActor struct {
+	cache *Cache
+	path  string
+}
+
+// NewSharedSnapshotWriterActor creates a new shared snapshot writer
+func NewSharedSnapshotWriterActor(cache *Cache, path string) *SharedSnapshotWriterActor {
+	return &SharedSnapshotWriterActor{cache: cache, path: path}
+}
+
+func (a *SharedSnapshotWriterActor) Receive(ctx *actor.Context) {
+	switch ctx.Message().(type) {
+	case actor.Started:
+		ctx.Engine().Subscribe(ctx.PID())
+		log.Printf("[SharedSnapshot] Writer started (%s)", a.path)
+
+	case CandleCycleDoneMsg, ListingsBackfilledMsg:
+		start := time.Now()
+		if err := writeSharedSnapshot(a.path, a.cache); err != nil {
+			log.Printf("[SharedSnapshot] ERROR: %v", err)
+			metrics.Inc("shared_snapshot_writes_total", "result", "error")
+			errorTrace.Record(SubsystemStorage, "shared_snapshot", err)
+			return
+		}
+		metrics.Inc("shared_snapshot_writes_total", "result", "success")
+		metrics.Set("shared_snapshot_write_duration_seconds", time.Since(start).Seconds())
+
+	case actor.Stopped:
+		ctx.Engine().Unsubscribe(ctx.PID())
+		log.Println("[SharedSnapshot] Writer stopped")
+	}
+}
+
+// SharedSnapshotReaderActor serves the cache from a snapshot written by
+// another process, reloading it whenever the file is replaced
+type SharedSnapshotReaderActor struct {
+	cache        *Cache
+	path         string
+	pollInterval time.Duration
+	current      os.FileInfo // The snapshot last loaded
+}
+
+// NewSharedSnapshotReaderActor creates a new shared snapshot reader
+func NewSharedSnapshotReaderActor(cache *Cache, path string, pollInterval time.Duration) *SharedSnapshotReaderActor {
+	return &SharedSnapshotReaderActor{cache: cache, path: path, pollInterval: pollInterval}
+}
+
+func (a *SharedSnapshotReaderActor) Receive(ctx *actor.Context) {
+	switch ctx.Message().(type) {
+	case actor.Started:
+		log.Printf("[SharedSnapshot] Reader started (%s, polling every %v)", a.path, a.pollInterval)
+		startHeartbeat(ctx)
+		a.poll()
+		ctx.SendRepeat(ctx.PID(), PollSharedSnapshotMsg{}, a.pollInterval)
+
+	case PollSharedSnapshotMsg:
+		a.poll()
+
+	case HeartbeatMsg:
+		heartbeats.Beat(ctx.PID())
+
+	case actor.Stopped:
+		log.Println("[SharedSnapshot] Reader stopped")
+	}
+}
+
+// poll maps the snapshot if it was replaced since the last load
+func (a *SharedSnapshotReaderActor) poll() {
+	info, err := os.Stat(a.path)
+	if err != nil {
+		if a.current == nil {
+			log.Printf("[SharedSnapshot] Waiting for %s: %v", a.path, err)
+		}
+		return
+	}
+	if a.current != nil && os.SameFile(info, a.current) {
+		return
+	}
+
+	m, err := mapFile(a.path)
+	if err != nil {
+		log.Printf("[SharedSnapshot] ERROR: %v", err)
+		metrics.Inc("shared_snapshot_loads_total", "result", "error")
+		errorTrace.Record(SubsystemStorage, "shared_snapshot", err)
+		return
+	}
+	entries, symbols, metadata, updated, err := parseSharedSnapshot(m)
+	size := len(m.data)
+	if err != nil {
+		m.release()
+		log.Printf("[SharedSnapshot] ERROR: %v", err)
+		metrics.Inc("shared_snapshot_loads_total", "result", "error")
+		errorTrace.Record(SubsystemStorage, "shared_snapshot", err)
+		return
+	}
+	retireMapping(m)
+	a.cache.ReplaceAll(entries, symbols, metadata, updated)
+	metrics.Inc("shared_snapshot_loads_total", "result", "success")
+	metrics.Set("shared_snapshot_bytes", float64(size))
+
+	a.current = m.info
+	log.Printf("[SharedSnapshot] Loaded %d symbols (%d bytes, updated %s)", len(entries), size, updated.UTC().Format(time.RFC3339))
+}
+
+// mappingGrace is how long a mapping outlives the last series referring to
+// it, for columns a request took out of a series before dropping it
+const mappingGrace = time.Minute
+
+// sharedMappings counts snapshots mapped, the current one and any still held
+var sharedMappings atomic.Int64
+
+// retireMapping releases m once nothing refers to it: responses, memos,
+// streams and /asof archives all keep the series they were handed, so the
+// mapping lives exactly as long as the last of them
+func retireMapping(m *mappedFile) {
+	runtime.SetFinalizer(m, func(m *mappedFile) {
+		time.AfterFunc(mappingGrace, func() {
+			m.release()
+			metrics.Set("shared_snapshot_mappings", float64(sharedMappings.Add(-1)))
+		})
+	})
+	metrics.Set("shared_snapshot_mappings", float64(sharedMappings.Add(1)))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Response signing algorithms
+const (
+	SignHMACSHA256 = "hmac-sha256"
+	SignEd25519    = "ed25519"
+)
+
+// ResponseSigner signs response bodies so consumers can verify integrity
+type ResponseSigner struct {
+	algorithm string
+	hmacKey   []byte
+	edKey     ed25519.PrivateKey
+}
+
+// NewResponseSigner creates a signer. For hmac-sha256 the key is the shared
+// secret; for ed25519 it is a base64 32-byte seed or 64-byte private key.
+func NewResponseSigner(algorithm, key string) (*ResponseSigner, error) {
+	if key == "" {
+		return nil, fmt.Errorf("signing key required for %s", algorithm)
+	}
+	switch algorithm {
+	case SignHMACSHA256:
+		return &ResponseSigner{algorithm: algorithm, hmacKey: []byte(key)}, nil
+	case SignEd25519:
+		raw, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ed25519 key: %w", err)
+		}
+		switch len(raw) {
+		case ed25519.SeedSize:
+			return &ResponseSigner{algorithm: algorithm, edKey: ed25519.NewKeyFromSeed(raw)}, nil
+		case ed25519.PrivateKeySize:
+			return &ResponseSigner{algorithm: algorithm, edKey: ed25519.PrivateKey(raw)}, nil
+		default:
+			return nil, fmt.Errorf("invalid ed25519 key length %d: want a 32-byte seed or 64-byte private key", len(raw))
+		}
+	default:
+		return nil, fmt.Errorf("unknown signing algorithm %q: use %s or %s", algorithm, SignHMACSHA256, SignEd25519)
+	}
+}
+
+// Sign returns the base64 signature of body
+func (s *ResponseSigner) Sign(body []byte) string {
+	if s.algorithm == SignEd25519 {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(s.edKey, body))
+	}
+	mac := hmac.New(sha256.New, s.hmacKey)
+	mac.Write(body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// PublicKey returns the base64 ed25519 public key, or "" for HMAC
+func (s *ResponseSigner) PublicKey() string {
+	if s.algorithm != SignEd25519 {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(s.edKey.Public().(ed25519.PublicKey))
+}
+
+// signResponse buffers the handler's body and adds X-Signature over the
+// uncompressed bytes. It must sit inside gzipHandler so the signature covers
+// what clients see after decoding.
+func signResponse(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if responseSigner == nil {
+			next(w, r)
+			return
+		}
+
+		sw := &signingResponseWriter{ResponseWriter: w}
+		next(sw, r)
+
+		if sw.code == 0 {
+			sw.code = http.StatusOK
+		}
+		if sw.buf.Len() > 0 {
+			w.Header().Set("X-Signature", responseSigner.Sign(sw.buf.Bytes()))
+			w.Header().Set("X-Signature-Algorithm", responseSigner.algorithm)
+			w.Header().Set("Content-Length", strconv.Itoa(sw.buf.Len()))
+		}
+		w.WriteHeader(sw.code)
+		w.Write(sw.buf.Bytes())
+	}
+}
+
+// signingResponseWriter holds back the status and body until they're signed
+type signingResponseWriter struct {
+	http.ResponseWriter
+	buf  bytes.Buffer
+	code int
+}
+
+func (w *signingResponseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *signingResponseWriter) Write(b []byte) (int, error) {
+	return w.buf.Write(b)
+}
+
+// handleGetSigningKey publishes the verification key for ed25519 signing
+func handleGetSigningKey(w http.ResponseWriter, r *http.Request) {
+	if responseSigner == nil {
+		http.Error(w, "Response signing disabled", http.StatusNotFound)
+		return
+	}
+
+	response := map[string]string{"algorithm": responseSigner.algorithm}
+	if key := responseSigner.PublicKey(); key != "" {
+		response["public_key"] = key
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
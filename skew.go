@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// clockSkewSamples is how many recent measurements the skew is the median of
+const clockSkewSamples = 31
+
+// ClockSkew estimates how far the local clock is from Hyperliquid's, from
+// the Date header of its responses. A local clock running behind makes the
+// fetch window end before the newest candle opens, silently dropping it.
+type ClockSkew struct {
+	mu        sync.Mutex
+	samples   []time.Duration // Ring of local minus server time
+	next      int
+	threshold time.Duration
+	warned    bool
+}
+
+var clockSkew = &ClockSkew{threshold: 2 * time.Second}
+
+// SetThreshold sets the skew beyond which a warning is logged; zero or
+// less disables warnings
+func (c *ClockSkew) SetThreshold(threshold time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.threshold = threshold
+}
+
+// ObserveResponse measures the skew from resp's Date header. The header
+// has one-second resolution, so single samples are off by up to a second
+// plus half the round trip; the median of recent ones smooths that out.
+func (c *ClockSkew) ObserveResponse(resp *http.Response, sent time.Time) {
+	server, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	received := time.Now()
+	local := sent.Add(received.Sub(sent) / 2)
+	c.observe(local.Sub(server.Add(500 * time.Millisecond)))
+}
+
+func (c *ClockSkew) observe(sample time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.samples) < clockSkewSamples {
+		c.samples = append(c.samples, sample)
+	} else {
+		c.samples[c.next] = sample
+		c.next = (c.next + 1) % clockSkewSamples
+	}
+	skew := c.medianLocked()
+	metrics.Set("clock_skew_seconds", skew.Seconds())
+
+	exceeded := c.threshold > 0 && skew.Abs() > c.threshold
+	switch {
+	case exceeded && !c.warned:
+		effect := "data will look older than it is"
+		if skew < 0 {
+			effect = "fetch windows end early and can miss the newest candle"
+		}
+		log.Printf("[Clock] WARNING: Local clock is %s Hyperliquid by %v, %s (check NTP)",
+			skewDirection(skew), skew.Abs().Round(time.Millisecond), effect)
+	case !exceeded && c.warned:
+		log.Printf("[Clock] Local clock back within %v of Hyperliquid", c.threshold)
+	}
+	c.warned = exceeded
+}
+
+// Skew returns the median local minus server time, and false before any
+// response has been measured
+func (c *ClockSkew) Skew() (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.samples) == 0 {
+		return 0, false
+	}
+	return c.medianLocked(), true
+}
+
+// Exceeded reports whether the skew is beyond the warning threshold
+func (c *ClockSkew) Exceeded() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.warned
+}
+
+func (c *ClockSkew) medianLocked() time.Duration {
+	sorted := append([]time.Duration(nil), c.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+func skewDirection(skew time.Duration) string {
+	if skew > 0 {
+		return "ahead of"
+	}
+	return "behind"
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const snapshotVersion = 1
+
+// CacheSnapshot is the on-disk form of the cache used for warm restarts
+type CacheSnapshot struct {
+	Version      int                   `json:"version"`
+	SavedAt      time.Time             `json:"saved_at"`
+	Symbols      []string              `json:"symbols"`
+	SymbolUpdate time.Time             `json:"symbol_update"`
+	Metadata     []SymbolMeta          `json:"metadata,omitempty"`
+	Entries      map[string]CacheEntry `json:"entries"`
+}
+
+// saveSnapshot writes the cache to path atomically via a temp file and rename
+func saveSnapshot(path string, c *Cache) error {
+	snapshot := c.Snapshot()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create snapshot dir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(snapshot); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+
+	log.Printf("[Snapshot] Saved %d symbols to %s", len(snapshot.Entries), path)
+	return nil
+}
+
+// loadSnapshot restores the cache from path. Restored entries are marked
+// stale until the fetcher refreshes them. A missing file is not an error.
+func loadSnapshot(path string, c *Cache) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		log.Printf("[Snapshot] No snapshot at %s, starting cold", path)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer f.Close()
+
+	var snapshot CacheSnapshot
+	if err := json.NewDecoder(f).Decode(&snapshot); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	if snapshot.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", snapshot.Version)
+	}
+
+	c.Restore(snapshot)
+	log.Printf("[Snapshot] Restored %d symbols from %s (saved %v ago, serving as stale until refreshed)",
+		len(snapshot.Entries), path, time.Since(snapshot.SavedAt).Round(time.Second))
+	return nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Consecutive failures after which the primary source is abandoned
+	sourceFailoverThreshold = 3
+	// How long to stay on a fallback before trying the preferred source again
+	sourceFailbackAfter = 5 * time.Minute
+)
+
+// upstreamSource is one Hyperliquid API base URL and its recent outcomes
+type upstreamSource struct {
+	name        string
+	baseURL     string
+	latency     latencyRing // Successful calls, milliseconds
+	outcomes    [100]bool   // Recent calls, true for success
+	calls       int
+	rejected    int // Calls answered with a 4xx other than 429
+	consecutive int // Consecutive failures
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// SourceStatus describes a source on /admin/sources
+type SourceStatus struct {
+	Name                string           `json:"name"`
+	URL                 string           `json:"url"`
+	Primary             bool             `json:"primary"`
+	Pinned              bool             `json:"pinned"`
+	SuccessRate         *float64         `json:"success_rate"` // Over the last 100 calls; null before any
+	Calls               int              `json:"calls"`
+	Rejected            int              `json:"rejected"` // 4xx other than 429: the source is up but refused the request
+	ConsecutiveFailures int              `json:"consecutive_failures"`
+	Latency             LatencyQuantiles `json:"latency_ms"`
+	LastError           string           `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time       `json:"last_error_at,omitempty"`
+}
+
+// SourcePool picks which Hyperliquid base URL requests go to. The first
+// source is preferred; after sourceFailoverThreshold consecutive failures
+// the pool fails over to the next source, and returns to the preferred one
+// after sourceFailbackAfter. An operator can pin a source, which disables
+// failover.
+type SourcePool struct {
+	mu         sync.Mutex
+	sources    []*upstreamSource
+	primary    int
+	pinned     int // -1 when not pinned
+	failedOver time.Time
+}
+
+// hyperliquidSources is the pool for Hyperliquid REST calls
+var hyperliquidSources = mustSourcePool("https://api.hyperliquid.xyz")
+
+// NewSourcePool creates a pool from comma-separated base URLs, in order of
+// preference. Sources are named by host.
+func NewSourcePool(baseURLs string) (*SourcePool, error) {
+	p := &SourcePool{pinned: -1}
+	seen := make(map[string]bool)
+	for _, raw := range strings.Split(baseURLs, ",") {
+		raw = strings.TrimSuffix(strings.TrimSpace(raw), "/")
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid source URL %q", raw)
+		}
+		name := u.Host
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate source %s", name)
+		}
+		seen[name] = true
+		p.sources = append(p.sources, &upstreamSource{name: name, baseURL: raw})
+	}
+	if len(p.sources) == 0 {
+		return nil, fmt.Errorf("no source URLs configured")
+	}
+	return p, nil
+}
+
+func mustSourcePool(baseURLs string) *SourcePool {
+	p, err := NewSourcePool(baseURLs)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Primary returns the name and base URL requests should use now
+func (p *SourcePool) Primary() (string, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pinned >= 0 {
+		s := p.sources[p.pinned]
+		return s.name, s.baseURL
+	}
+	if p.primary != 0 && time.Since(p.failedOver) > sourceFailbackAfter {
+		log.Printf("[Sources] Trying preferred source %s again", p.sources[0].name)
+		p.primary = 0
+		p.sources[0].consecutive = 0
+		p.publishLocked()
+	}
+	s := p.sources[p.primary]
+	return s.name, s.baseURL
+}
+
+// Record stores the outcome of a call to the named source, as returned by
+// sourceFailure. Only failures of the source itself (network errors, 429s,
+// 5xx) count against it; a rejected request is recorded as such but shows
+// the source is up.
+func (p *SourcePool) Record(name string, err error, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	i := p.indexLocked(name)
+	if i < 0 {
+		return
+	}
+	s := p.sources[i]
+	result := "success"
+	var rejection sourceRejection
+	if errors.As(err, &rejection) {
+		result = "rejected"
+		s.rejected++
+		err = nil
+	}
+	s.outcomes[s.calls%len(s.outcomes)] = err == nil
+	s.calls++
+	if err == nil {
+		s.consecutive = 0
+		s.latency.add(float64(latency.Microseconds()) / 1000)
+	} else {
+		result = "error"
+		s.consecutive++
+		s.lastError = err.Error()
+		s.lastErrorAt = time.Now().UTC()
+	}
+	metrics.Inc("upstream_source_requests_total", "source", name, "result", result)
+
+	if err != nil && i == p.primary && p.pinned < 0 && s.consecutive >= sourceFailoverThreshold && len(p.sources) > 1 {
+		// The next source in preference order with the fewest recent failures
+		next := -1
+		for j := 1; j < len(p.sources); j++ {
+			k := (i + j) % len(p.sources)
+			if next < 0 || p.sources[k].consecutive < p.sources[next].consecutive {
+				next = k
+			}
+		}
+		log.Printf("[Sources] Failing over from %s to %s after %d consecutive failures", name, p.sources[next].name, s.consecutive)
+		metrics.Inc("upstream_source_failovers_total", "from", name, "to", p.sources[next].name)
+		p.primary = next
+		p.failedOver = time.Now()
+		p.publishLocked()
+	}
+}
+
+func (p *SourcePool) indexLocked(name string) int {
+	for i, s := range p.sources {
+		if s.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// publish exports which source is primary
+func (p *SourcePool) publish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.publishLocked()
+}
+
+// publishLocked exports which source is primary. Callers must hold p.mu.
+func (p *SourcePool) publishLocked() {
+	current := p.primary
+	if p.pinned >= 0 {
+		current = p.pinned
+	}
+	for i, s := range p.sources {
+		value := 0.0
+		if i == current {
+			value = 1
+		}
+		metrics.Set("upstream_source_primary", value, "source", s.name)
+	}
+}
+
+// Pin sends every request to the named source until unpinned; an empty
+// name unpins
+func (p *SourcePool) Pin(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if name == "" {
+		p.pinned = -1
+	} else {
+		i := p.indexLocked(name)
+		if i < 0 {
+			return fmt.Errorf("unknown source %q", name)
+		}
+		p.pinned = i
+	}
+	p.publishLocked()
+	return nil
+}
+
+// Status describes every source in preference order
+func (p *SourcePool) Status() []SourceStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := make([]SourceStatus, len(p.sources))
+	for i, s := range p.sources {
+		status := SourceStatus{
+			Name:                s.name,
+			URL:                 s.baseURL,
+			Primary:             (p.pinned < 0 && i == p.primary) || i == p.pinned,
+			Pinned:              i == p.pinned,
+			Calls:               s.calls,
+			Rejected:            s.rejected,
+			ConsecutiveFailures: s.consecutive,
+			Latency:             quantilesOf(append([]float64(nil), s.latency.samples...)),
+			LastError:           s.lastError,
+		}
+		if n := min(s.calls, len(s.outcomes)); n > 0 {
+			ok := 0
+			for _, success := range s.outcomes[:n] {
+				if success {
+					ok++
+				}
+			}
+			rate := float64(ok) / float64(n)
+			status.SuccessRate = &rate
+		}
+		if !s.lastErrorAt.IsZero() {
+			at := s.lastErrorAt
+			status.LastErrorAt = &at
+		}
+		result[i] = status
+	}
+	return result
+}
+
+// sourceRejection is a 4xx other than 429: the request was refused, which
+// doesn't reflect on the source
+type sourceRejection struct {
+	statusCode int
+}
+
+func (e sourceRejection) Error() string {
+	return fmt.Sprintf("rejected with status %d", e.statusCode)
+}
+
+// sourceFailure classifies a call's outcome for SourcePool.Record: err for
+// transport errors, rate limiting and server errors, a sourceRejection for
+// other 4xx responses and nil for success
+func sourceFailure(statusCode int, err error) error {
+	if err != nil {
+		return err
+	}
+	if statusCode == http.StatusTooManyRequests || statusCode >= 500 {
+		return fmt.Errorf("status %d", statusCode)
+	}
+	if statusCode >= 400 {
+		return sourceRejection{statusCode: statusCode}
+	}
+	return nil
+}
+
+// handleAdminSources lists the Hyperliquid sources with their success rate,
+// latency and which one is primary. POST ?pin=<name> pins a source and
+// POST ?pin= unpins.
+func handleAdminSources(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		name := r.URL.Query().Get("pin")
+		if err := hyperliquidSources.Pin(name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if name == "" {
+			log.Println("[Admin] Unpinned Hyperliquid source")
+		} else {
+			log.Printf("[Admin] Pinned Hyperliquid source %s", name)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"sources": hyperliquidSources.Status(),
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
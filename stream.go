@@ -0,0 +1,631 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// streamWriteTimeout is how long a stream client may take to accept a
+// message before it's dropped as too slow
+const streamWriteTimeout = 10 * time.Second
+
+// streamKey is one subscription: a symbol's candles at an interval
+type streamKey struct {
+	symbol, interval string
+}
+
+// StreamCandles is the data of a snapshot or update message
+type StreamCandles struct {
+	Symbol     string       `json:"symbol"`
+	Interval   string       `json:"interval"`
+	Candles    CandleSeries `json:"candles"`
+	LastUpdate time.Time    `json:"last_update"`
+}
+
+// streamMessage is a message to a stream client: snapshot, update or, on
+// the WebSocket, error
+type streamMessage struct {
+	Type string `json:"type"`
+	*StreamCandles
+	Error string `json:"error,omitempty"`
+}
+
+// streamRequest is a WebSocket client's message: subscribe or unsubscribe
+type streamRequest struct {
+	Op       string   `json:"op"`
+	Symbols  []string `json:"symbols"`
+	Interval string   `json:"interval,omitempty"`
+}
+
+// streamClient is one connected stream. The hub only marks the symbols
+// that changed; the client's own goroutine reads the cache and writes the
+// changes, so a slow client's updates coalesce rather than queue up.
+type streamClient struct {
+	peer  string // Remote IP, empty for Unix socket peers
+	mu    sync.Mutex
+	dirty map[string]bool
+	wake  chan struct{}
+}
+
+// mark queues symbol for the client's next pass
+func (c *streamClient) mark(symbol string) {
+	c.mu.Lock()
+	if c.dirty[symbol] {
+		metrics.Inc("stream_updates_coalesced_total")
+	}
+	c.dirty[symbol] = true
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take returns and clears the symbols marked since the last call
+func (c *streamClient) take() map[string]bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dirty := c.dirty
+	c.dirty = make(map[string]bool)
+	return dirty
+}
+
+// StreamHub fans cache changes out to the stream clients subscribed to
+// the changed symbol
+type StreamHub struct {
+	mu         sync.Mutex
+	clients    map[*streamClient]bool
+	bySymbol   map[string]map[*streamClient]int // Client to its intervals of the symbol
+	byPeer     map[string]int
+	maxClients int
+	maxPerPeer int
+}
+
+var streamHub = NewStreamHub(1000, 20)
+
+// NewStreamHub creates a hub accepting up to maxClients clients, and up to
+// maxPerPeer of them from one IP
+func NewStreamHub(maxClients, maxPerPeer int) *StreamHub {
+	return &StreamHub{
+		clients:    make(map[*streamClient]bool),
+		bySymbol:   make(map[string]map[*streamClient]int),
+		byPeer:     make(map[string]int),
+		maxClients: maxClients,
+		maxPerPeer: maxPerPeer,
+	}
+}
+
+// Register adds a client connecting from r's peer, or returns false when
+// the hub or the peer's share of it is full
+func (h *StreamHub) Register(r *http.Request) (*streamClient, bool) {
+	peer := streamPeer(r)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.clients) >= h.maxClients {
+		metrics.Inc("stream_clients_rejected_total", "reason", "total")
+		return nil, false
+	}
+	if peer != "" && h.byPeer[peer] >= h.maxPerPeer {
+		metrics.Inc("stream_clients_rejected_total", "reason", "peer")
+		return nil, false
+	}
+	c := &streamClient{peer: peer, dirty: make(map[string]bool), wake: make(chan struct{}, 1)}
+	h.clients[c] = true
+	if peer != "" {
+		h.byPeer[peer]++
+	}
+	metrics.Set("stream_clients", float64(len(h.clients)))
+	return c, true
+}
+
+// streamPeer returns r's remote IP. Unix socket peers have none and only
+// count against the hub's total, since filesystem permissions gate them.
+func streamPeer(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return ""
+	}
+	return addr.Unmap().String()
+}
+
+// Unregister removes a client and its subscriptions
+func (h *StreamHub) Unregister(c *streamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, c)
+	if c.peer != "" {
+		if h.byPeer[c.peer]--; h.byPeer[c.peer] <= 0 {
+			delete(h.byPeer, c.peer)
+		}
+	}
+	for symbol, clients := range h.bySymbol {
+		delete(clients, c)
+		if len(clients) == 0 {
+			delete(h.bySymbol, symbol)
+		}
+	}
+	metrics.Set("stream_clients", float64(len(h.clients)))
+}
+
+func (h *StreamHub) subscribe(c *streamClient, symbol string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.bySymbol[symbol] == nil {
+		h.bySymbol[symbol] = make(map[*streamClient]int)
+	}
+	h.bySymbol[symbol][c]++
+}
+
+func (h *StreamHub) unsubscribe(c *streamClient, symbol string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	clients := h.bySymbol[symbol]
+	if clients == nil {
+		return
+	}
+	if clients[c]--; clients[c] <= 0 {
+		delete(clients, c)
+	}
+	if len(clients) == 0 {
+		delete(h.bySymbol, symbol)
+	}
+}
+
+// Notify tells the clients subscribed to symbol that its series changed.
+// It's the main cache's watcher, so it never blocks.
+func (h *StreamHub) Notify(symbol string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.bySymbol[symbol] {
+		c.mark(symbol)
+	}
+}
+
+// parseStreamKeys validates symbols at each interval. An empty interval is
+// the cached one; calendar intervals are resampled from it.
+func parseStreamKeys(symbols, intervals []string) ([]streamKey, error) {
+	if len(intervals) == 0 {
+		intervals = []string{""}
+	}
+	var keys []streamKey
+	for _, raw := range intervals {
+		interval := config.CandleInterval
+		if raw != "" {
+			normalized, err := normalizeInterval(raw)
+			if err != nil {
+				return nil, err
+			}
+			if normalized != interval && !canResample(interval, normalized) {
+				return nil, fmt.Errorf("Interval %s is not streamed: use %s, 1d, 1w or 1M", normalized, config.CandleInterval)
+			}
+			if err := checkResampleAlignment(interval, normalized, exchangeLocation); err != nil {
+				return nil, err
+			}
+			interval = normalized
+		}
+		for _, symbol := range symbols {
+			symbol = cache.CanonicalSymbol(strings.ToUpper(strings.TrimSpace(symbol)))
+			if _, cached := cache.Get(symbol); !cached && !cache.HasSymbol(symbol) {
+				return nil, fmt.Errorf("Symbol not found: %s", symbol)
+			}
+			keys = append(keys, streamKey{symbol: symbol, interval: interval})
+		}
+	}
+	return keys, nil
+}
+
+// checkResampleAlignment reports whether from candles can be cut into
+// target buckets at loc's midnight
+func checkResampleAlignment(from, target string, loc *time.Location) error {
+	if from == target {
+		return nil
+	}
+	fromLen, _ := intervalDuration(from)
+	start, _ := bucketBounds(time.Now(), target, loc)
+	if start.UnixMilli()%fromLen.Milliseconds() != 0 {
+		return fmt.Errorf("%s candles can't be aligned to %s midnight (UTC%s)", from, loc, start.Format("-07:00"))
+	}
+	return nil
+}
+
+// splitList splits a comma-separated query value, dropping empty items
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// streamTransport writes messages to a stream client
+type streamTransport interface {
+	Send(msg streamMessage) error
+	Ping() error
+}
+
+// streamSub is a subscription's progress
+type streamSub struct {
+	sent bool   // Whether the snapshot has gone out
+	last Candle // Newest candle sent
+}
+
+// streamSession serves one client's subscriptions over a transport
+type streamSession struct {
+	client    *streamClient
+	transport streamTransport
+	query     url.Values // Snapshot filters and precision, as on /api/candles
+	subs      map[streamKey]*streamSub
+}
+
+func newStreamSession(client *streamClient, transport streamTransport, query url.Values) *streamSession {
+	return &streamSession{client: client, transport: transport, query: query, subs: make(map[streamKey]*streamSub)}
+}
+
+// subscribe adds keys and sends their snapshots
+func (s *streamSession) subscribe(keys []streamKey) error {
+	added := 0
+	for _, key := range keys {
+		if s.subs[key] == nil {
+			added++
+		}
+	}
+	if len(s.subs)+added > config.StreamMaxSubscriptions {
+		return fmt.Errorf("Too many subscriptions: at most %d per client", config.StreamMaxSubscriptions)
+	}
+	for _, key := range keys {
+		if s.subs[key] != nil {
+			continue
+		}
+		sub := &streamSub{}
+		s.subs[key] = sub
+		// Changes from here on mark the symbol, so none is missed between
+		// the snapshot and the first update
+		streamHub.subscribe(s.client, key.symbol)
+		if err := s.refresh(key, sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *streamSession) unsubscribe(keys []streamKey) {
+	for _, key := range keys {
+		if s.subs[key] != nil {
+			delete(s.subs, key)
+			streamHub.unsubscribe(s.client, key.symbol)
+		}
+	}
+}
+
+// keepWarm marks the subscribed symbols as requested, so lazy fetching
+// keeps them fresh while someone listens, and fetches those that aren't
+// cached
+func (s *streamSession) keepWarm() {
+	seen := make(map[string]bool, len(s.subs))
+	for key := range s.subs {
+		if seen[key.symbol] {
+			continue
+		}
+		seen[key.symbol] = true
+		cache.Touch(key.symbol)
+		if _, ok := cache.Get(key.symbol); !ok {
+			fetchForStream(key.symbol)
+		}
+	}
+}
+
+// fetchForStream starts an on-demand fetch for a subscribed symbol that
+// isn't cached (newly listed, expired or evicted). It doesn't wait: the
+// fetched series marks the symbol and its snapshot goes out then.
+func fetchForStream(symbol string) {
+	if onDemand != nil && cache.HasSymbol(symbol) && inShard(symbol) {
+		onDemand.Fetch(symbol, 0)
+	}
+}
+
+// refresh sends key's snapshot, or the candles that changed since the last
+// message. A symbol that isn't cached yet gets its snapshot once it is.
+func (s *streamSession) refresh(key streamKey, sub *streamSub) error {
+	cache.Touch(key.symbol)
+	entry, ok := cache.Get(key.symbol)
+	if !ok {
+		fetchForStream(key.symbol)
+		return nil
+	}
+	if entry.Candles.Len() == 0 {
+		return nil
+	}
+
+	candles := entry.Candles
+	msgType := "update"
+	if !sub.sent {
+		msgType = "snapshot"
+	}
+	if sub.last == (Candle{}) {
+		// Nothing has gone out yet, the snapshot included if the query left
+		// it empty (e.g. from= past the newest candle), so updates keep to
+		// the query's bounds until then
+		filtered, err := filterCandles(candles, s.query)
+		if err != nil {
+			return err
+		}
+		candles = filtered
+	} else {
+		// Only the newest sent candle (or bucket) and later ones can have
+		// changed; revisions of older closed candles wait for a reconnect
+		candles = candles.Slice(candles.Search(sub.last.Timestamp), candles.Len())
+	}
+	if key.interval != config.CandleInterval {
+		buckets, err := resample(candles, config.CandleInterval, key.interval, exchangeLocation)
+		if err != nil {
+			return err
+		}
+		candles = NewCandleSeries(buckets)
+	}
+	if sub.sent {
+		if candles.Len() > 0 && candles.At(0) == sub.last {
+			candles = candles.Slice(1, candles.Len())
+		}
+		if candles.Len() == 0 {
+			return nil
+		}
+	}
+	if n := candles.Len(); n > 0 {
+		sub.last = candles.At(n - 1)
+	}
+	sub.sent = true
+
+	if p, ok := cache.Precision(key.symbol); ok && s.query.Get("precision") != "full" {
+		candles = candles.WithPrecision(p)
+	}
+	metrics.Inc("stream_messages_total", "type", msgType)
+	return s.transport.Send(streamMessage{
+		Type:          msgType,
+		StreamCandles: &StreamCandles{Symbol: key.symbol, Interval: key.interval, Candles: candles, LastUpdate: entry.LastUpdate},
+	})
+}
+
+// handle applies a WebSocket client's request, answering errors with an
+// error message rather than closing the stream
+func (s *streamSession) handle(req streamRequest) error {
+	var err error
+	switch req.Op {
+	case "subscribe", "unsubscribe":
+		var keys []streamKey
+		if keys, err = parseStreamKeys(req.Symbols, splitList(req.Interval)); err == nil {
+			if req.Op == "subscribe" {
+				err = s.subscribe(keys)
+			} else {
+				s.unsubscribe(keys)
+			}
+		}
+	default:
+		err = errors.New(`Invalid message: use {"op": "subscribe" or "unsubscribe", "symbols": [...], "interval": "1h"}`)
+	}
+	if err != nil {
+		return s.transport.Send(streamMessage{Type: "error", Error: err.Error()})
+	}
+	return nil
+}
+
+// run sends updates until the client goes away, requests (nil for SSE)
+// closes or a write fails
+func (s *streamSession) run(ctx context.Context, requests <-chan streamRequest) {
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+	var err error
+	for err == nil {
+		select {
+		case <-s.client.wake:
+			for symbol := range s.client.take() {
+				for key, sub := range s.subs {
+					if key.symbol == symbol && err == nil {
+						err = s.refresh(key, sub)
+					}
+				}
+			}
+		case req, ok := <-requests:
+			if !ok {
+				return
+			}
+			err = s.handle(req)
+		case <-heartbeat.C:
+			s.keepWarm()
+			err = s.transport.Ping()
+		case <-ctx.Done():
+			return
+		}
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		log.Printf("[Stream] Dropping a client that didn't keep up for %v", streamWriteTimeout)
+		metrics.Inc("stream_clients_dropped_total")
+	}
+}
+
+// sseTransport writes messages as server-sent events
+type sseTransport struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (t *sseTransport) Send(msg streamMessage) error {
+	data, err := json.Marshal(msg.StreamCandles)
+	if err != nil {
+		return err
+	}
+	return t.write(fmt.Sprintf("event: %s\ndata: %s\n\n", msg.Type, data))
+}
+
+func (t *sseTransport) Ping() error {
+	return t.write(": ping\n\n")
+}
+
+func (t *sseTransport) write(s string) error {
+	t.rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if _, err := t.w.Write([]byte(s)); err != nil {
+		return err
+	}
+	return t.rc.Flush()
+}
+
+// wsTransport writes messages as WebSocket JSON frames
+type wsTransport struct {
+	conn *websocket.Conn
+}
+
+func (t *wsTransport) Send(msg streamMessage) error {
+	t.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	return t.conn.WriteJSON(msg)
+}
+
+func (t *wsTransport) Ping() error {
+	return t.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout))
+}
+
+// parseStreamQuery validates the subscriptions and snapshot filters given
+// when connecting
+func parseStreamQuery(query url.Values) ([]streamKey, error) {
+	keys, err := parseStreamKeys(splitList(query.Get("symbol")), splitList(query.Get("interval")))
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > config.StreamMaxSubscriptions {
+		return nil, fmt.Errorf("Too many subscriptions: at most %d per client", config.StreamMaxSubscriptions)
+	}
+	if _, err := filterCandles(CandleSeries{}, query); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// handleCandleStream streams candles as server-sent events: a snapshot
+// event per subscription, then an update event with the candles that
+// changed whenever the cache does. ?symbol=BTC,ETH&interval=1h,1d
+// subscribes to each symbol at each interval; ?lookback= narrows the
+// snapshots.
+func handleCandleStream(w http.ResponseWriter, r *http.Request) {
+	keys, err := parseStreamQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(keys) == 0 {
+		http.Error(w, "symbol is required, e.g. ?symbol=BTC,ETH", http.StatusBadRequest)
+		return
+	}
+	client, ok := streamHub.Register(r)
+	if !ok {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Too many stream clients", http.StatusServiceUnavailable)
+		return
+	}
+	defer streamHub.Unregister(client)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	transport := &sseTransport{w: w, rc: rc}
+	if err := transport.write(": connected\n\n"); err != nil {
+		return
+	}
+
+	session := newStreamSession(client, transport, r.URL.Query())
+	if err := session.subscribe(keys); err != nil {
+		return
+	}
+	session.run(r.Context(), nil)
+}
+
+// streamUpgrader accepts WebSocket connections from any origin, like the
+// rest of the API
+var streamUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// handleCandleWebSocket streams candles over a WebSocket. Clients send
+// {"op": "subscribe", "symbols": ["BTC"], "interval": "1h"} (or
+// "unsubscribe") and receive the same snapshot and update messages as on
+// /api/stream, with a "type" field. ?symbol= and ?interval= subscribe on
+// connect.
+func handleCandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	keys, err := parseStreamQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	client, ok := streamHub.Register(r)
+	if !ok {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Too many stream clients", http.StatusServiceUnavailable)
+		return
+	}
+	defer streamHub.Unregister(client)
+
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // The upgrader has answered
+	}
+	defer conn.Close()
+
+	requests := make(chan streamRequest)
+	done := make(chan struct{})
+	defer close(done)
+	go readStreamRequests(conn, requests, done)
+
+	session := newStreamSession(client, &wsTransport{conn: conn}, r.URL.Query())
+	if err := session.subscribe(keys); err != nil {
+		return
+	}
+	session.run(context.Background(), requests)
+}
+
+// readStreamRequests passes a WebSocket client's requests on until the
+// connection fails, or goes quiet for longer than two heartbeats
+func readStreamRequests(conn *websocket.Conn, requests chan<- streamRequest, done <-chan struct{}) {
+	defer close(requests)
+	conn.SetReadLimit(64 * 1024)
+	deadline := func() { conn.SetReadDeadline(time.Now().Add(2*eventStreamHeartbeat + streamWriteTimeout)) }
+	deadline()
+	conn.SetPongHandler(func(string) error {
+		deadline()
+		return nil
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		deadline()
+		var req streamRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			req = streamRequest{} // Answered as an invalid message
+		}
+		select {
+		case requests <- req:
+		case <-done:
+			return
+		}
+	}
+}
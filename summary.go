@@ -0,0 +1,117 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const sparklinePoints = 24
+
+// SymbolSummary is a compact per-symbol digest for screener views
+type SymbolSummary struct {
+	Symbol    string    `json:"symbol"`
+	LastPrice float64   `json:"last_price"`
+	Change1h  *float64  `json:"change_1h,omitempty"`  // Percent
+	Change24h *float64  `json:"change_24h,omitempty"` // Percent
+	Change7d  *float64  `json:"change_7d,omitempty"`  // Percent
+	Volume24h float64   `json:"volume_24h"`
+	Sparkline []float64 `json:"sparkline"`
+}
+
+// summarize builds the screener digest for a series, returning false if it
+// has no candles. Prices and volume are rounded to the symbol's precision
+// unless full is set.
+func summarize(symbol string, candles CandleSeries, full bool) (SymbolSummary, bool) {
+	n := candles.Len()
+	if n == 0 {
+		return SymbolSummary{}, false
+	}
+	p, round := cache.Precision(symbol)
+	round = round && !full
+	if round {
+		candles = candles.WithPrecision(p)
+	}
+
+	dayStart := candles.Timestamp(n-1) - (24 * time.Hour).Milliseconds()
+
+	summary := SymbolSummary{
+		Symbol:    symbol,
+		LastPrice: candles.Closes[n-1],
+		Change1h:  percentChange(candles, time.Hour),
+		Change24h: percentChange(candles, 24*time.Hour),
+		Change7d:  percentChange(candles, 7*24*time.Hour),
+	}
+
+	// Candles are sorted by timestamp, so the last 24h is a suffix
+	start := candles.SearchAfter(dayStart)
+	for _, v := range candles.Volumes[start:] {
+		summary.Volume24h += v
+	}
+	if round {
+		summary.Volume24h = roundTo(summary.Volume24h, p.Size)
+	}
+	summary.Sparkline = sparkline(candles.Closes[start:], sparklinePoints)
+
+	return summary, true
+}
+
+// percentChange returns the percent change of the latest close versus the
+// close at least `window` earlier, or nil when history doesn't reach that far
+func percentChange(candles CandleSeries, window time.Duration) *float64 {
+	n := candles.Len()
+	target := candles.Timestamp(n-1) - window.Milliseconds()
+
+	// Index of the last candle at or before target
+	i := candles.SearchAfter(target) - 1
+	if i < 0 || candles.Closes[i] == 0 {
+		return nil
+	}
+	change := (candles.Closes[n-1] - candles.Closes[i]) / candles.Closes[i] * 100
+	return &change
+}
+
+// sparkline samples closes evenly so the result has at most n points,
+// always including the latest close
+func sparkline(closes []float64, n int) []float64 {
+	if len(closes) <= n {
+		return append([]float64{}, closes...)
+	}
+
+	points := make([]float64, n)
+	step := float64(len(closes)-1) / float64(n-1)
+	for i := 0; i < n; i++ {
+		points[i] = closes[int(float64(i)*step+0.5)]
+	}
+	return points
+}
+
+func handleGetSummary(w http.ResponseWriter, r *http.Request) {
+	setOmittedHeader(w, cache)
+	if setETag(w, r, generateETag(cache.GetLastUpdate())) {
+		return
+	}
+
+	allCandles := cache.GetAll()
+	full := r.URL.Query().Get("precision") == "full"
+
+	summaries := make([]SymbolSummary, 0, len(allCandles))
+	for symbol, entry := range allCandles {
+		if summary, ok := summarize(symbol, entry.Candles, full); ok {
+			summaries = append(summaries, summary)
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Symbol < summaries[j].Symbol })
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := writeJSON(r.Context(), w, map[string]interface{}{
+		"symbols": summaries,
+		"count":   len(summaries),
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// symbolQuery holds the parsed filters for /api/symbols
+type symbolQuery struct {
+	market    string // perp, spot, or all
+	minVolume float64
+	sortBy    string // name, volume, oi, market_cap, or empty for upstream order
+}
+
+func parseSymbolQuery(query url.Values) (symbolQuery, error) {
+	q := symbolQuery{
+		market: strings.ToLower(query.Get("market")),
+		sortBy: strings.ToLower(query.Get("sort")),
+	}
+	if q.market == "" {
+		q.market = MarketPerp
+	}
+	if q.market != MarketPerp && q.market != MarketSpot && q.market != "all" {
+		return q, fmt.Errorf("invalid market %q: use perp, spot or all", q.market)
+	}
+	switch q.sortBy {
+	case "", "name", "volume", "oi", "market_cap":
+	default:
+		return q, fmt.Errorf("invalid sort %q: use name, volume, oi or market_cap", q.sortBy)
+	}
+	if raw := query.Get("min_volume"); raw != "" {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v < 0 {
+			return q, fmt.Errorf("invalid min_volume %q", raw)
+		}
+		q.minVolume = v
+	}
+	return q, nil
+}
+
+// selectSymbols applies market/volume filters and sorting to the metadata.
+// When metadata hasn't been fetched yet, the plain perp symbol list is used.
+func selectSymbols(metadata []SymbolMeta, symbols []string, q symbolQuery) []SymbolMeta {
+	if len(metadata) == 0 {
+		metadata = make([]SymbolMeta, len(symbols))
+		for i, s := range symbols {
+			metadata[i] = SymbolMeta{Name: s, Market: MarketPerp}
+		}
+	}
+
+	result := make([]SymbolMeta, 0, len(metadata))
+	for _, m := range metadata {
+		if q.market != "all" && m.Market != q.market {
+			continue
+		}
+		if m.DayNtlVlm < q.minVolume {
+			continue
+		}
+		result = append(result, m)
+	}
+
+	switch q.sortBy {
+	case "name":
+		sort.SliceStable(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	case "volume":
+		sort.SliceStable(result, func(i, j int) bool { return result[i].DayNtlVlm > result[j].DayNtlVlm })
+	case "oi":
+		sort.SliceStable(result, func(i, j int) bool { return result[i].OpenInterestUSD > result[j].OpenInterestUSD })
+	case "market_cap":
+		sort.SliceStable(result, func(i, j int) bool { return result[i].MarketCap > result[j].MarketCap })
+	}
+
+	return result
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/anthdm/hollywood/actor"
@@ -13,15 +15,22 @@ type SymbolFetcherActor struct {
 	hydromancerClient  *HydromancerClient
 	refreshInterval    time.Duration
 	cachedSymbols      []string // Fallback cache
+	categories         *Categories
+	categorySource     string
+	inlineCategories   map[string]string
+	engine             *actor.Engine
 }
 
 // NewSymbolFetcherActor creates a new symbol fetcher actor
-func NewSymbolFetcherActor(cache *Cache, hydromancerClient *HydromancerClient, refreshInterval time.Duration) *SymbolFetcherActor {
+func NewSymbolFetcherActor(cache *Cache, hydromancerClient *HydromancerClient, refreshInterval time.Duration, categories *Categories, categorySource string, inlineCategories map[string]string) *SymbolFetcherActor {
 	return &SymbolFetcherActor{
 		cache:             cache,
 		hydromancerClient: hydromancerClient,
 		refreshInterval:   refreshInterval,
 		cachedSymbols:     []string{},
+		categories:        categories,
+		categorySource:    categorySource,
+		inlineCategories:  inlineCategories,
 	}
 }
 
@@ -29,19 +38,29 @@ func (a *SymbolFetcherActor) Receive(ctx *actor.Context) {
 	switch msg := ctx.Message().(type) {
 	case actor.Started:
 		log.Println("[SymbolFetcher] Actor started")
+		a.engine = ctx.Engine()
+		startHeartbeat(ctx)
 		// Fetch symbols immediately on start
 		a.fetchSymbols()
 		// Schedule periodic fetches
-		ctx.SendRepeat(ctx.PID(), FetchSymbolsMsg{}, a.refreshInterval)
+		scheduler.Add(RefreshSymbols, a.refreshInterval, ctx.PID(), FetchSymbolsMsg{})
 		
 	case FetchSymbolsMsg:
 		a.fetchSymbols()
+		a.reloadCategories()
+		if msg.Done != nil {
+			close(msg.Done)
+		}
+		
+	case HeartbeatMsg:
+		heartbeats.Beat(ctx.PID())
 		
 	case GetSymbolsMsg:
 		symbols := a.cache.GetSymbols()
 		msg.ResponseChan <- symbols
 		
 	case actor.Stopped:
+		scheduler.Remove(RefreshSymbols, ctx.PID())
 		log.Println("[SymbolFetcher] Actor stopped")
 	}
 }
@@ -49,9 +68,10 @@ func (a *SymbolFetcherActor) Receive(ctx *actor.Context) {
 func (a *SymbolFetcherActor) fetchSymbols() {
 	log.Println("[SymbolFetcher] Fetching perpetual symbols from Hyperliquid...")
 	
-	symbols, err := a.hydromancerClient.FetchPerpetualSymbols()
+	perps, err := a.hydromancerClient.FetchPerpetualMetadata()
 	if err != nil {
 		log.Printf("[SymbolFetcher] ERROR: Failed to fetch symbols: %v", err)
+		errorTrace.Record(SubsystemSymbols, "perps", err)
 		// Use cached symbols if API fails
 		if len(a.cachedSymbols) > 0 {
 			log.Printf("[SymbolFetcher] Using cached symbol list (%d symbols)", len(a.cachedSymbols))
@@ -60,15 +80,123 @@ func (a *SymbolFetcherActor) fetchSymbols() {
 		return
 	}
 	
+	symbols := make([]string, len(perps))
+	for i, meta := range perps {
+		symbols[i] = meta.Name
+	}
+	
 	if len(symbols) == 0 {
 		log.Println("[SymbolFetcher] WARNING: Received empty symbol list")
+		notifier.Notify(EventSymbolListEmpty, "Hyperliquid returned an empty symbol list")
 		return
 	}
 	
 	log.Printf("[SymbolFetcher] Discovered %d symbols from Hyperliquid", len(symbols))
 	
+	// Spot metadata is only used for filtering, so failures aren't fatal
+	metadata := perps
+	spots, err := a.hydromancerClient.FetchSpotMetadata()
+	if err != nil {
+		log.Printf("[SymbolFetcher] ERROR: Failed to fetch spot metadata: %v", err)
+		errorTrace.Record(SubsystemSymbols, "spot", err)
+	} else {
+		metadata = append(metadata, spots...)
+	}
+	
 	// Update cache and fallback
+	previous := a.cache.GetSymbols()
 	a.cache.SetSymbols(symbols)
+	a.cache.SetMetadata(metadata)
+	openInterestHistory.Record(perps)
 	a.cachedSymbols = symbols
+	
+	// On the first discovery every symbol is new and the fetch cycle covers them
+	if len(previous) > 0 {
+		listed := newSymbols(previous, symbols)
+		symbolEvents.Record(EventListing, MarketPerp, listed)
+		symbolEvents.Record(EventDelisting, MarketPerp, newSymbols(symbols, previous))
+		a.backfillListings(listed)
+	}
+}
+
+// newSymbols returns the symbols in current that aren't in previous
+func newSymbols(previous, current []string) []string {
+	known := make(map[string]bool, len(previous))
+	for _, symbol := range previous {
+		known[symbol] = true
+	}
+	var listed []string
+	for _, symbol := range current {
+		if !known[symbol] {
+			listed = append(listed, symbol)
+		}
+	}
+	return listed
+}
+
+// backfillListings fetches newly listed symbols' candles straight away
+// rather than at the next cycle, and tells the daily rollup to backfill
+// their history. Subscribers hear about them as a cycle's changed symbols
+// once the candles are cached.
+func (a *SymbolFetcherActor) backfillListings(listed []string) {
+	var ours []string
+	for _, symbol := range listed {
+		if _, cached := a.cache.Get(symbol); !cached && inShard(symbol) {
+			ours = append(ours, symbol)
+		}
+	}
+	if len(ours) == 0 || onDemand == nil || a.engine == nil {
+		return
+	}
+	log.Printf("[SymbolFetcher] New listings: %v, backfilling now", ours)
+	metrics.Add("symbol_listings_total", float64(len(ours)))
+	a.engine.BroadcastEvent(SymbolsListedMsg{Symbols: ours})
+	
+	if _, _, err := jobQueue.Submit("listings", map[string]string{"symbol": strings.Join(ours, ",")}, ""); err != nil {
+		log.Printf("[SymbolFetcher] ERROR: %v", err)
+	}
+}
+
+// runListingsJob fetches the candles of params' new listings that aren't
+// cached yet, so a retry only fetches those that failed
+func runListingsJob(params map[string]string) (interface{}, error) {
+	if onDemand == nil {
+		return nil, permanent(fmt.Errorf("on-demand fetching not running"))
+	}
+	var fetched, failed []string
+	for _, symbol := range strings.Split(params["symbol"], ",") {
+		if _, cached := cache.Get(symbol); cached {
+			continue
+		}
+		// One at a time: a burst of listings shouldn't burst the rate limit
+		if _, ok := onDemand.Fetch(symbol, time.Minute); ok {
+			fetched = append(fetched, symbol)
+		} else {
+			failed = append(failed, symbol)
+		}
+	}
+	if len(fetched) > 0 {
+		log.Printf("[SymbolFetcher] Backfilled %d new listings", len(fetched))
+		engine.BroadcastEvent(ListingsBackfilledMsg{Symbols: fetched})
+	}
+	result := map[string]interface{}{"fetched": fetched}
+	if len(failed) > 0 {
+		return result, fmt.Errorf("failed to fetch %s", strings.Join(failed, ", "))
+	}
+	return result, nil
 }
 
+// reloadCategories re-reads the category source so file edits and remote
+// updates are picked up on the symbol refresh cadence
+func (a *SymbolFetcherActor) reloadCategories() {
+	if a.categorySource == "" {
+		return
+	}
+	mapping, err := resolveCategories(a.categorySource, a.inlineCategories)
+	if err != nil {
+		log.Printf("[SymbolFetcher] ERROR: Failed to reload categories, keeping previous mapping: %v", err)
+		errorTrace.Record(SubsystemSymbols, "categories", err)
+		return
+	}
+	a.categories.Replace(mapping)
+}
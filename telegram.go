@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const telegramAPIURL = "https://api.telegram.org"
+
+// TelegramTarget is a bot and chat an alert is delivered to
+type TelegramTarget struct {
+	BotToken string `json:"bot_token"`
+	ChatID   string `json:"chat_id"`
+}
+
+// TelegramClient sends messages through the Telegram Bot API
+type TelegramClient struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewTelegramClient creates a new Telegram client
+func NewTelegramClient() *TelegramClient {
+	return &TelegramClient{
+		baseURL: telegramAPIURL,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// SendMessage posts a plain-text message to the target chat
+func (c *TelegramClient) SendMessage(target TelegramTarget, text string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"chat_id":                  target.ChatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/bot%s/sendMessage", c.baseURL, target.BotToken)
+	resp, err := c.httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The error embeds the URL, which contains the bot token
+		return fmt.Errorf("telegram request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("telegram returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
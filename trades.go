@@ -0,0 +1,421 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// TradeCandleStore holds sub-minute candles built from the trade stream
+type TradeCandleStore struct {
+	mu         sync.RWMutex
+	intervals  map[string]int64 // interval name -> bucket size in ms
+	maxCandles int
+	series     map[string]map[string][]Candle // symbol -> interval -> candles
+	lastUpdate map[string]time.Time
+
+	// Reconciliation only trusts buckets the stream saw in full: none before
+	// it last (re)connected or before the oldest trimmed candle
+	streamSince int64                       // Milliseconds
+	trimmed     map[string]map[string]int64 // symbol -> interval -> newest dropped candle
+}
+
+// Relative difference above which a stream-built candle disagrees with the
+// REST snapshot
+const reconcileTolerance = 1e-6
+
+// ReconcileResult counts the snapshot candles one reconciliation compared
+type ReconcileResult struct {
+	Matched       int
+	Diverged      int     // Corrected towards the snapshot
+	Missing       int     // Snapshot traded but the stream has no candles
+	MaxDivergence float64 // Largest relative difference seen
+	Through       int64   // Newest snapshot candle compared
+}
+
+// NewTradeCandleStore creates a store for the given sub-minute intervals
+func NewTradeCandleStore(intervals []string, maxCandles int) (*TradeCandleStore, error) {
+	store := &TradeCandleStore{
+		intervals:  make(map[string]int64, len(intervals)),
+		maxCandles: maxCandles,
+		series:     make(map[string]map[string][]Candle),
+		lastUpdate: make(map[string]time.Time),
+		trimmed:    make(map[string]map[string]int64),
+	}
+	for _, interval := range intervals {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d < time.Second || d >= time.Minute || time.Minute%d != 0 {
+			return nil, fmt.Errorf("unsupported trade candle interval %q", interval)
+		}
+		store.intervals[interval] = d.Milliseconds()
+	}
+	return store, nil
+}
+
+// HasInterval reports whether the store builds candles for an interval
+func (s *TradeCandleStore) HasInterval(interval string) bool {
+	_, ok := s.intervals[interval]
+	return ok
+}
+
+// Intervals returns the store's intervals and their bucket sizes in ms
+func (s *TradeCandleStore) Intervals() map[string]int64 {
+	result := make(map[string]int64, len(s.intervals))
+	for interval, ms := range s.intervals {
+		result[interval] = ms
+	}
+	return result
+}
+
+// Apply folds a trade into every interval series of its symbol
+func (s *TradeCandleStore) Apply(trade HyperliquidTrade) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bySymbol, ok := s.series[trade.Coin]
+	if !ok {
+		bySymbol = make(map[string][]Candle, len(s.intervals))
+		s.series[trade.Coin] = bySymbol
+	}
+
+	for interval, bucketMs := range s.intervals {
+		bucket := trade.Time - trade.Time%bucketMs
+		candles := bySymbol[interval]
+		n := len(candles)
+
+		switch {
+		case n == 0 || bucket > candles[n-1].Timestamp:
+			candles = append(candles, Candle{
+				Timestamp: bucket,
+				Open:      trade.Px,
+				High:      trade.Px,
+				Low:       trade.Px,
+				Close:     trade.Px,
+				Volume:    trade.Sz,
+			})
+			if len(candles) > s.maxCandles {
+				if s.trimmed[trade.Coin] == nil {
+					s.trimmed[trade.Coin] = make(map[string]int64)
+				}
+				s.trimmed[trade.Coin][interval] = candles[len(candles)-s.maxCandles-1].Timestamp
+				candles = candles[len(candles)-s.maxCandles:]
+			}
+		default:
+			// Late trades update their bucket if it's still retained
+			i := sort.Search(n, func(i int) bool { return candles[i].Timestamp >= bucket })
+			if i == n || candles[i].Timestamp != bucket {
+				continue
+			}
+			c := &candles[i]
+			c.High = max(c.High, trade.Px)
+			c.Low = min(c.Low, trade.Px)
+			if i == n-1 {
+				c.Close = trade.Px
+			}
+			c.Volume = addDecimal(c.Volume, trade.Sz)
+		}
+		bySymbol[interval] = candles
+	}
+	s.lastUpdate[trade.Coin] = time.Now()
+}
+
+// MarkStreamStart records that the trade stream has been complete since t,
+// after a (re)connect
+func (s *TradeCandleStore) MarkStreamStart(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streamSince = t.UnixMilli()
+}
+
+// Reconcile compares the stream-built candles of symbol, aggregated to
+// bucketMs, with the closed candles of a REST snapshot newer than after. The
+// snapshot wins where they disagree: the bucket's first open and last close
+// are set to the snapshot's, highs and lows are clamped into its range, and
+// volumes are scaled to its total. Where the stream missed the extreme
+// trades, the sub-minute highs and lows stay short of the snapshot's, as
+// there's no telling when those trades happened.
+func (s *TradeCandleStore) Reconcile(symbol string, snapshot CandleSeries, bucketMs, after int64) ReconcileResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := ReconcileResult{Through: after}
+	bySymbol := s.series[symbol]
+	if s.streamSince == 0 || bySymbol == nil {
+		return result
+	}
+	// The last snapshot candle is still open
+	for i := snapshot.SearchAfter(after); i < snapshot.Len()-1; i++ {
+		rest := snapshot.At(i)
+		result.Through = rest.Timestamp
+		if rest.Timestamp < s.streamSince {
+			continue
+		}
+		for interval := range s.intervals {
+			if trimmed, ok := s.trimmed[symbol][interval]; ok && rest.Timestamp <= trimmed {
+				continue
+			}
+			candles := bySymbol[interval]
+			lo := sort.Search(len(candles), func(i int) bool { return candles[i].Timestamp >= rest.Timestamp })
+			hi := sort.Search(len(candles), func(i int) bool { return candles[i].Timestamp >= rest.Timestamp+bucketMs })
+			if lo == hi {
+				if rest.Volume > 0 {
+					result.Missing++
+				}
+				continue
+			}
+			diff := reconcileBucket(candles[lo:hi], rest)
+			result.MaxDivergence = math.Max(result.MaxDivergence, diff)
+			if diff > reconcileTolerance {
+				result.Diverged++
+			} else {
+				result.Matched++
+			}
+		}
+	}
+	return result
+}
+
+// reconcileBucket compares the stream candles of one snapshot bucket with
+// the snapshot candle, correcting them towards it if they differ by more
+// than reconcileTolerance. It returns the largest relative difference.
+func reconcileBucket(candles []Candle, rest Candle) float64 {
+	agg := Candle{Open: candles[0].Open, Close: candles[len(candles)-1].Close, High: candles[0].High, Low: candles[0].Low}
+	var volume decimalSum
+	for _, c := range candles {
+		agg.High = max(agg.High, c.High)
+		agg.Low = min(agg.Low, c.Low)
+		volume.Add(c.Volume)
+	}
+	agg.Volume = volume.Value()
+
+	relDiff := func(x, y float64) float64 {
+		if scale := math.Max(math.Abs(x), math.Abs(y)); scale > 0 {
+			return math.Abs(x-y) / scale
+		}
+		return 0
+	}
+	diff := max(relDiff(agg.Open, rest.Open), relDiff(agg.High, rest.High), relDiff(agg.Low, rest.Low),
+		relDiff(agg.Close, rest.Close), relDiff(agg.Volume, rest.Volume))
+	if diff <= reconcileTolerance {
+		return diff
+	}
+
+	candles[0].Open = rest.Open
+	candles[len(candles)-1].Close = rest.Close
+	clamp := func(px float64) float64 { return min(max(px, rest.Low), rest.High) }
+	for i := range candles {
+		c := &candles[i]
+		if agg.Volume > 0 {
+			c.Volume = c.Volume * rest.Volume / agg.Volume
+		}
+		c.Open, c.Close = clamp(c.Open), clamp(c.Close)
+		c.High = max(clamp(c.High), c.Open, c.Close)
+		c.Low = min(clamp(c.Low), c.Open, c.Close)
+	}
+	return diff
+}
+
+// Get returns a copy of the candles for a symbol and interval
+func (s *TradeCandleStore) Get(symbol, interval string) (CacheEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	bySymbol, ok := s.series[symbol]
+	if !ok {
+		return CacheEntry{}, false
+	}
+	return CacheEntry{
+		Symbol:     symbol,
+		Candles:    NewCandleSeries(bySymbol[interval]),
+		LastUpdate: s.lastUpdate[symbol],
+	}, true
+}
+
+// TradeCandleActor subscribes to Hyperliquid trades and builds sub-minute candles
+type TradeCandleActor struct {
+	store      *TradeCandleStore
+	symbols    []string
+	wsClient   *HyperliquidWSClient
+	reconciled map[string]int64 // Newest snapshot candle reconciled per symbol
+	subscribed bool
+	streaming  bool
+	filling    atomic.Bool // A gap fill is running
+}
+
+// NewTradeCandleActor creates a new trade candle actor
+func NewTradeCandleActor(store *TradeCandleStore, symbols []string) *TradeCandleActor {
+	return &TradeCandleActor{
+		store:      store,
+		symbols:    symbols,
+		reconciled: make(map[string]int64),
+	}
+}
+
+func (a *TradeCandleActor) Receive(ctx *actor.Context) {
+	switch msg := ctx.Message().(type) {
+	case actor.Started:
+		log.Printf("[TradeCandles] Actor started for %d symbols", len(a.symbols))
+		ctx.Engine().Subscribe(ctx.PID())
+		engine, pid := ctx.Engine(), ctx.PID()
+		a.wsClient = NewHyperliquidWSClient("trades", func(m WSMessage) {
+			if m.Channel != "trades" {
+				return
+			}
+			var trades []HyperliquidTrade
+			if err := json.Unmarshal(m.Data, &trades); err != nil {
+				log.Printf("[TradeCandles] ERROR: Failed to parse trades: %v", err)
+				errorTrace.Record(SubsystemWS, "trades", err)
+				return
+			}
+			engine.Send(pid, TradesMsg{Trades: trades})
+		})
+		a.wsClient.OnReconnect(func(gapStart, gapEnd time.Time) {
+			engine.Send(pid, WSReconnectedMsg{GapStart: gapStart, GapEnd: gapEnd})
+		})
+		a.subscribe()
+		go a.wsClient.Run()
+
+	case TradesMsg:
+		if !a.streaming {
+			// Trades are only complete from the first delivery on
+			a.streaming = true
+			a.store.MarkStreamStart(time.Now())
+		}
+		for _, trade := range msg.Trades {
+			a.store.Apply(trade)
+		}
+
+	case WSReconnectedMsg:
+		a.store.MarkStreamStart(msg.GapEnd)
+		a.fillGap(msg.GapStart, msg.GapEnd)
+
+	case CandleCycleDoneMsg:
+		a.subscribe()
+		a.reconcile()
+
+	case actor.Stopped:
+		ctx.Engine().Unsubscribe(ctx.PID())
+		if a.wsClient != nil {
+			a.wsClient.Close()
+		}
+		log.Println("[TradeCandles] Actor stopped")
+	}
+}
+
+// subscribe resolves the configured symbols to their exchange spelling
+// (e.g. btc -> BTC, KPEPE -> kPEPE) and subscribes to their trades. The
+// symbol list may not be loaded when the actor starts, in which case it's
+// retried after each fetch cycle. Symbols that aren't listed are skipped.
+func (a *TradeCandleActor) subscribe() {
+	if a.subscribed || len(cache.GetSymbols()) == 0 {
+		return
+	}
+	a.subscribed = true
+	var symbols []string
+	for _, symbol := range a.symbols {
+		symbol = cache.CanonicalSymbol(symbol)
+		if !cache.HasSymbol(symbol) {
+			log.Printf("[TradeCandles] WARNING: %s isn't a listed symbol, not streaming its trades", symbol)
+			continue
+		}
+		if slices.Contains(symbols, symbol) {
+			continue
+		}
+		symbols = append(symbols, symbol)
+		a.wsClient.Subscribe(map[string]interface{}{"type": "trades", "coin": symbol})
+	}
+	a.symbols = symbols
+	log.Printf("[TradeCandles] Subscribed to trades for %d symbols", len(symbols))
+}
+
+// reconcile compares the stream-built candles with the candles the last
+// fetch cycle cached, correcting them where the snapshot disagrees
+func (a *TradeCandleActor) reconcile() {
+	bucket, ok := intervalDuration(config.CandleInterval)
+	if !ok {
+		return
+	}
+	var total ReconcileResult
+	for _, symbol := range a.symbols {
+		entry, ok := cache.Get(symbol)
+		if !ok || entry.Stale {
+			continue
+		}
+		r := a.store.Reconcile(symbol, entry.Candles, bucket.Milliseconds(), a.reconciled[symbol])
+		a.reconciled[symbol] = r.Through
+		total.Matched += r.Matched
+		total.Diverged += r.Diverged
+		total.Missing += r.Missing
+		total.MaxDivergence = math.Max(total.MaxDivergence, r.MaxDivergence)
+		if r.Diverged > 0 || r.Missing > 0 {
+			log.Printf("[TradeCandles] %s: %d %s candle(s) diverged from the REST snapshot (max %.2g) and were corrected, %d missing from the stream",
+				symbol, r.Diverged, config.CandleInterval, r.MaxDivergence, r.Missing)
+		}
+	}
+	metrics.Add("ws_reconcile_candles_total", float64(total.Matched), "result", "match")
+	metrics.Add("ws_reconcile_candles_total", float64(total.Diverged), "result", "diverged")
+	metrics.Add("ws_reconcile_candles_total", float64(total.Missing), "result", "missing")
+	if total.Matched+total.Diverged > 0 {
+		metrics.Set("ws_reconcile_max_divergence_ratio", total.MaxDivergence)
+	}
+}
+
+// Gap fills fetch at most gapFillConcurrency symbols at once, rather than
+// every subscribed symbol in one burst against the rate limit. A fetch
+// taking longer than gapFillWait frees its slot and finishes in the
+// background.
+const (
+	gapFillConcurrency = 4
+	gapFillWait        = time.Minute
+)
+
+// fillGap refreshes the subscribed symbols' cached candles from REST after
+// the trade stream missed gapStart to gapEnd, so a candle whose trades were
+// missed isn't left as the stream last saw it. Trades themselves can't be
+// replayed, so sub-minute candles in the gap stay incomplete.
+func (a *TradeCandleActor) fillGap(gapStart, gapEnd time.Time) {
+	log.Printf("[TradeCandles] Trade stream missed %s to %s, sub-minute candles in between are incomplete",
+		gapStart.UTC().Format(time.RFC3339), gapEnd.UTC().Format(time.RFC3339))
+	if onDemand == nil {
+		return
+	}
+	var symbols []string
+	for _, symbol := range a.symbols {
+		if cache.HasSymbol(symbol) && inShard(symbol) {
+			symbols = append(symbols, symbol)
+		}
+	}
+	if len(symbols) == 0 {
+		return
+	}
+	// A fill still running covers this gap too, as it fetches up to now
+	if !a.filling.CompareAndSwap(false, true) {
+		log.Println("[TradeCandles] Previous gap fill still running, not starting another")
+		return
+	}
+	log.Printf("[TradeCandles] Refreshing %d symbols from REST after the gap", len(symbols))
+	metrics.Add("ws_gap_fill_symbols_total", float64(len(symbols)))
+
+	go func() {
+		defer a.filling.Store(false)
+		slots := make(chan struct{}, gapFillConcurrency)
+		var wg sync.WaitGroup
+		for _, symbol := range symbols {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(symbol string) {
+				defer func() { <-slots; wg.Done() }()
+				onDemand.Fetch(symbol, gapFillWait)
+			}(symbol)
+		}
+		wg.Wait()
+	}()
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"strconv"
 	"time"
 )
 
@@ -17,8 +19,15 @@ type Candle struct {
 // CacheEntry holds candle data for a single symbol
 type CacheEntry struct {
 	Symbol     string    `json:"symbol"`
-	Candles    []Candle  `json:"candles"`
+	Candles    CandleSeries `json:"candles"`
 	LastUpdate time.Time `json:"last_update"`
+	Stale      bool      `json:"stale,omitempty"` // Restored from snapshot, not yet refreshed
+	Quote      string    `json:"quote,omitempty"` // Set when prices were converted from USD
+	Interval   string    `json:"interval,omitempty"` // Set when resampled or served at a symbol override's interval
+	Timezone   string    `json:"tz,omitempty"`       // Time zone of resampled bucket boundaries
+	Type       string    `json:"type,omitempty"`     // renko or range when built from price movement
+	BarSize    float64   `json:"bar_size,omitempty"` // Brick or range size of non-time bars
+	Live       bool      `json:"live,omitempty"`     // Last candle brought up to date with polled mids
 }
 
 // SymbolList holds the list of active perpetual symbols
@@ -49,6 +58,26 @@ type HyperliquidCandle struct {
 	N int     `json:"n"` // Number of trades
 }
 
+// HyperliquidWSCandle is a candle pushed on the WebSocket candle channel.
+// The close time needs its own field: encoding/json matches keys case
+// insensitively, so "T" would otherwise overwrite "t".
+type HyperliquidWSCandle struct {
+	HyperliquidCandle
+	CloseTime int64  `json:"T"`
+	Coin      string `json:"s"`
+	Interval  string `json:"i"`
+}
+
+// HyperliquidTrade represents a single trade from the WebSocket trades channel
+type HyperliquidTrade struct {
+	Coin string  `json:"coin"`
+	Side string  `json:"side"`
+	Px   float64 `json:"px,string"`
+	Sz   float64 `json:"sz,string"`
+	Time int64   `json:"time"` // Unix timestamp in milliseconds
+	Tid  int64   `json:"tid"`
+}
+
 // HydromancerRequest represents the request to Hydromancer API
 type HydromancerRequest struct {
 	Type string `json:"type"`
@@ -61,21 +90,178 @@ type HydromancerPerpDeployResponse struct {
 	} `json:"universe"`
 }
 
+// Market identifies which Hyperliquid market a symbol trades on
+const (
+	MarketPerp = "perp"
+	MarketSpot = "spot"
+)
+
+// SymbolMeta holds per-symbol metadata merged from meta and asset contexts
+type SymbolMeta struct {
+	Name            string  `json:"name"`
+	DisplayName     string  `json:"display_name,omitempty"`
+	Market          string  `json:"market"`
+	SzDecimals      int     `json:"sz_decimals"`
+	MaxLeverage     int     `json:"max_leverage,omitempty"`
+	MarkPx          float64 `json:"mark_px"`
+	MidPx           float64 `json:"mid_px,omitempty"`
+	PrevDayPx       float64 `json:"prev_day_px"`
+	DayNtlVlm       float64 `json:"day_ntl_vlm"` // 24h notional volume in USD
+	OpenInterest    float64 `json:"open_interest,omitempty"`
+	OpenInterestUSD float64 `json:"open_interest_usd,omitempty"`
+	Funding         float64 `json:"funding,omitempty"`
+	Category        string  `json:"category,omitempty"`
+
+	// From CoinGecko enrichment, when enabled
+	MarketCap         float64 `json:"market_cap,omitempty"`
+	CirculatingSupply float64 `json:"circulating_supply,omitempty"`
+}
+
+// MarketData is market cap information from an external source
+type MarketData struct {
+	MarketCap         float64 `json:"market_cap"`
+	CirculatingSupply float64 `json:"circulating_supply"`
+}
+
+func (m *SymbolMeta) applyCtx(ctx AssetCtx) {
+	m.MarkPx = float64(ctx.MarkPx)
+	m.MidPx = float64(ctx.MidPx)
+	m.PrevDayPx = float64(ctx.PrevDayPx)
+	m.DayNtlVlm = float64(ctx.DayNtlVlm)
+	m.OpenInterest = float64(ctx.OpenInterest)
+	m.OpenInterestUSD = float64(ctx.OpenInterest) * float64(ctx.MarkPx)
+	m.Funding = float64(ctx.Funding)
+}
+
+// AssetCtx represents a perp or spot asset context from Hyperliquid
+type AssetCtx struct {
+	Coin         string    `json:"coin,omitempty"` // Spot only
+	MarkPx       flexFloat `json:"markPx"`
+	MidPx        flexFloat `json:"midPx"`
+	PrevDayPx    flexFloat `json:"prevDayPx"`
+	DayNtlVlm    flexFloat `json:"dayNtlVlm"`
+	OpenInterest flexFloat `json:"openInterest"` // Perp only
+	Funding      flexFloat `json:"funding"`      // Perp only
+}
+
+// flexFloat decodes numbers that Hyperliquid sends as strings, numbers, or null
+type flexFloat float64
+
+func (f *flexFloat) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		*f = flexFloat(v)
+		return nil
+	}
+	var v float64
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*f = flexFloat(v)
+	return nil
+}
+
 // HealthResponse represents the health check response
 type HealthResponse struct {
-	Status       string    `json:"status"`
-	SymbolCount  int       `json:"symbol_count"`
-	LastUpdate   time.Time `json:"last_update,omitempty"`
-	SymbolUpdate time.Time `json:"symbol_update,omitempty"`
+	Status       string                    `json:"status"`
+	SymbolCount  int                       `json:"symbol_count"`
+	LastUpdate   time.Time                 `json:"last_update,omitempty"`
+	SymbolUpdate time.Time                 `json:"symbol_update,omitempty"`
+	StaleCount   int                       `json:"stale_count,omitempty"`
+	Upstreams    map[string]UpstreamStatus `json:"upstreams,omitempty"`
+	Checks       map[string]HealthCheck    `json:"checks,omitempty"`
+	NextRefresh  map[string]time.Time      `json:"next_refresh,omitempty"` // Next scheduled run per refresh tier
+	Exchange     *ExchangeStatus           `json:"exchange,omitempty"`     // Hyperliquid's own status, once polled
 }
 
 // Actor Messages
-type FetchSymbolsMsg struct{}
-type FetchCandlesMsg struct{}
+type FetchSymbolsMsg struct {
+	Done chan struct{} // Closed once the fetch has run, when set
+}
+type FetchCandlesMsg struct {
+	All  bool          // Fetch every symbol, whatever its refresh priority
+	Done chan struct{} // Closed once the cycle has run, when set
+}
 type GetCacheMsg struct {
 	ResponseChan chan map[string]CacheEntry
 }
 type GetSymbolsMsg struct {
 	ResponseChan chan []string
 }
+type RollupDailyMsg struct{}
+
+// BackfillDailyMsg refetches symbols' full daily history, even those
+// backfilled already, and sends the outcome on Done
+type BackfillDailyMsg struct {
+	Symbols []string
+	Done    chan error
+}
+type FetchMarketDataMsg struct{}
+type FetchFXRatesMsg struct{}
+type CheckStalenessMsg struct{}
+type EvaluateAlertsMsg struct{}
+type HeartbeatMsg struct{}
+type CheckHeartbeatsMsg struct{}
+type PollSharedSnapshotMsg struct{}
+type ShardHeartbeatMsg struct{}
+type ArchiveSnapshotMsg struct{}
+type PruneSnapshotsMsg struct{}
+type RunJobsMsg struct{}
+
+// JobFinishedMsg reports the outcome of one attempt at a job to the runner
+type JobFinishedMsg struct {
+	ID     string
+	Result interface{}
+	Err    error
+}
+type PollMidsMsg struct{}
+type PollExchangeStatusMsg struct{}
+
+// CandleCycleDoneMsg is broadcast on the engine's event stream after every
+// candle fetch cycle
+type CandleCycleDoneMsg struct {
+	Changed  []string // Symbols whose candles changed this cycle
+	Finished time.Time
+}
+
+// ListingsBackfilledMsg is broadcast on the engine's event stream when new
+// listings' candles were fetched between cycles. It isn't a fetch cycle, so
+// cycle subscribers such as push webhooks ignore it.
+type ListingsBackfilledMsg struct {
+	Symbols []string
+}
+type StreamedCandlesMsg struct {
+	Candles []HyperliquidWSCandle
+}
+
+// FlushStreamedCandlesMsg applies the candles streamed since the last flush
+type FlushStreamedCandlesMsg struct{}
+type TradesMsg struct {
+	Trades []HyperliquidTrade
+}
+
+// SymbolsListedMsg is broadcast on the engine's event stream when the
+// symbol fetcher discovers symbols that weren't listed before
+type SymbolsListedMsg struct {
+	Symbols []string
+}
+
+// WSReconnectedMsg reports a WebSocket reconnect and the window in which no
+// messages were received
+type WSReconnectedMsg struct {
+	GapStart time.Time
+	GapEnd   time.Time
+}
+
+// GapCandlesMsg carries the candles refetched from REST over a stream gap
+type GapCandlesMsg struct {
+	Candles map[string][]Candle
+}
 
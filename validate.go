@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// envErrors collects environment values the getEnv* helpers couldn't parse.
+// They fall back to the default, which would otherwise hide a typo.
+var envErrors []string
+
+func badEnv(key, val, want string) {
+	envErrors = append(envErrors, fmt.Sprintf("%s: %q is not %s", key, val, want))
+}
+
+// ConfigError lists every problem found in the configuration
+type ConfigError []string
+
+func (e ConfigError) Error() string {
+	return fmt.Sprintf("%d problem(s):\n  - %s", len(e), strings.Join(e, "\n  - "))
+}
+
+// intSetting and stringSetting pair an environment variable with its value.
+// Checks walk them in slices rather than maps so the report lists problems
+// in the same order on every boot.
+type intSetting struct {
+	key string
+	val int
+}
+
+type stringSetting struct {
+	key string
+	val string
+}
+
+// Validate checks the whole configuration and reports all problems at once,
+// so a bad deploy fails at boot instead of running with empty fetches. It
+// normalizes the intervals as it goes.
+func (c *Config) Validate() error {
+	problems := append(ConfigError(nil), envErrors...)
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	// Intervals
+	check(c.normalizeIntervals())
+	if len(c.TradeCandleSymbols) > 0 {
+		_, err := NewTradeCandleStore(c.TradeCandleIntervals, c.TradeCandleMax)
+		check(prefixErr("TRADE_CANDLE_INTERVALS", err))
+	}
+	if _, err := time.LoadLocation(c.ExchangeTimezone); err != nil {
+		check(fmt.Errorf("EXCHANGE_TIMEZONE: %v", err))
+	}
+
+	// Durations and sizes the actors and batching can't run with at zero
+	for _, setting := range []intSetting{
+		{"REFRESH_INTERVAL_MIN", c.RefreshIntervalMin},
+		{"SYMBOL_REFRESH_INTERVAL_MIN", c.SymbolRefreshIntervalMin},
+		{"SHARED_SNAPSHOT_POLL_SEC", c.SharedSnapshotPollSec},
+		{"COINGECKO_REFRESH_INTERVAL_MINUTES", c.CoinGeckoRefreshMin},
+		{"FX_RATES_REFRESH_INTERVAL_MINUTES", c.FXRatesRefreshMin},
+		{"BATCH_SIZE", c.BatchSize},
+		{"WARMUP_BATCH_SIZE", c.WarmupBatchSize},
+		{"READ_TIMEOUT_SEC", c.ReadTimeoutSec},
+		{"READ_HEADER_TIMEOUT_SEC", c.ReadHeaderTimeoutSec},
+		{"WRITE_TIMEOUT_SEC", c.WriteTimeoutSec},
+		{"IDLE_TIMEOUT_SEC", c.IdleTimeoutSec},
+		{"TRADE_CANDLE_MAX", c.TradeCandleMax},
+		{"ALERTS_MAX_RULES", c.AlertsMaxRules},
+		{"JOB_WORKERS", c.JobWorkers},
+		{"JOB_MAX_ATTEMPTS", c.JobMaxAttempts},
+		{"ERROR_TRACE_SIZE", c.ErrorTraceSize},
+		{"STREAM_MAX_CLIENTS_PER_IP", c.StreamMaxClientsPerIP},
+		{"STREAM_MAX_CLIENTS", c.StreamMaxClients},
+		{"STREAM_MAX_SUBSCRIPTIONS", c.StreamMaxSubscriptions},
+	} {
+		if setting.val <= 0 {
+			check(fmt.Errorf("%s must be positive, got %d", setting.key, setting.val))
+		}
+	}
+	// Zero disables these
+	for _, setting := range []intSetting{
+		{"CANDLE_DAYS", c.CandleDays},
+		{"BATCH_DELAY_MS", c.BatchDelayMs},
+		{"WARMUP_BATCH_DELAY_MS", c.WarmupBatchDelayMs},
+		{"WATCHDOG_TIMEOUT_MINUTES", c.WatchdogTimeoutMin},
+		{"MIDS_POLL_SEC", c.MidsPollSec},
+		{"EXCHANGE_STATUS_POLL_SEC", c.ExchangeStatusPollSec},
+		{"MAX_CONNECTIONS", c.MaxConnections},
+		{"CACHE_MEMORY_BUDGET_MB", c.CacheMemoryBudgetMB},
+		{"LAZY_TTL_MINUTES", c.LazyTTLMin},
+	} {
+		if setting.val < 0 {
+			check(fmt.Errorf("%s can't be negative, got %d", setting.key, setting.val))
+		}
+	}
+
+	// Modes
+	switch c.SharedSnapshotMode {
+	case "off", "writer", "reader":
+	default:
+		check(fmt.Errorf("SHARED_SNAPSHOT_MODE: invalid mode %q, use off, writer or reader", c.SharedSnapshotMode))
+	}
+	switch c.ReplicationMode {
+	case "off":
+	case ReplicationLeader:
+		if c.ReplicationToken == "" {
+			check(fmt.Errorf("REPLICATION_TOKEN is required for REPLICATION_MODE=leader"))
+		}
+	case ReplicationFollower:
+		if c.ReplicationToken == "" {
+			check(fmt.Errorf("REPLICATION_TOKEN is required for REPLICATION_MODE=follower"))
+		}
+		if c.ReplicationLeaderURL == "" && c.ShardCoordinatorURL == "" && !c.ShardCoordinator {
+			check(fmt.Errorf("REPLICATION_LEADER_URL or SHARD_COORDINATOR_URL is required for REPLICATION_MODE=follower"))
+		}
+		if c.SharedSnapshotMode == "reader" {
+			check(fmt.Errorf("REPLICATION_MODE=follower can't be combined with SHARED_SNAPSHOT_MODE=reader"))
+		}
+	default:
+		check(fmt.Errorf("REPLICATION_MODE: invalid mode %q, use off, leader or follower", c.ReplicationMode))
+	}
+	if c.DryRun && (c.SharedSnapshotMode == "writer" || c.ReplicationMode == ReplicationLeader) {
+		check(fmt.Errorf("DRY_RUN can't publish its empty cache: unset SHARED_SNAPSHOT_MODE=writer and REPLICATION_MODE=leader"))
+	}
+	check(c.validateShard())
+	switch c.FetchMode {
+	case FetchModeEager, FetchModeLazy:
+	default:
+		check(fmt.Errorf("FETCH_MODE: invalid mode %q, use eager or lazy", c.FetchMode))
+	}
+	if c.PushWebhookMode != PushModeChanges && c.PushWebhookMode != PushModeSnapshot {
+		check(fmt.Errorf("PUSH_WEBHOOK_MODE: invalid mode %q, use changes or snapshot", c.PushWebhookMode))
+	}
+	_, err := newJSONEncoder(c.JSONEncoder)
+	check(prefixErr("JSON_ENCODER", err))
+	if c.SigningAlgorithm != "" {
+		_, err := NewResponseSigner(c.SigningAlgorithm, c.SigningKey)
+		check(prefixErr("SIGNING_ALGORITHM", err))
+	}
+	pipelines, err := parsePipelines(c.Pipelines)
+	check(prefixErr("PIPELINES", err))
+	for _, p := range pipelines {
+		if p.Days == 0 {
+			check(prefixErr("PIPELINES", prefixErr("pipeline "+p.Name, checkSnapshotCap(p.Interval, c.LookbackDays(p.Interval)))))
+		}
+	}
+	overrides, err := parseSymbolOverrides(c.SymbolOverrides)
+	check(prefixErr("SYMBOL_OVERRIDES", err))
+	for symbol, override := range overrides {
+		if override.Days == 0 {
+			err := checkSnapshotCap(override.Interval, c.LookbackDays(override.Interval))
+			check(prefixErr("SYMBOL_OVERRIDES", prefixErr(symbol, err)))
+		}
+	}
+	_, err = LoadFeatureFlags(c.FeatureFlagsFile, c.FeatureFlags)
+	check(prefixErr("FEATURE_FLAGS", err))
+	_, err = NewCDNPurger(c.CDNPurgeProvider, c.CDNPurgeURL, c.CDNPurgeToken)
+	check(prefixErr("CDN_PURGE_PROVIDER", err))
+	if c.AlertsEnabled && !c.ReadOnly && c.AlertsToken == "" {
+		check(fmt.Errorf("ALERTS_TOKEN is required with ALERTS_ENABLED=true"))
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		check(fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+
+	// URLs
+	_, err = NewSourcePool(c.HyperliquidAPIURLs)
+	check(prefixErr("HYPERLIQUID_API_URLS", err))
+	for _, setting := range []stringSetting{
+		{"PEER_SEED_URL", c.PeerSeedURL},
+		{"REPLICATION_LEADER_URL", c.ReplicationLeaderURL},
+		{"SHARD_COORDINATOR_URL", c.ShardCoordinatorURL},
+		{"SHARD_NODE_URL", c.ShardNodeURL},
+		{"COINGECKO_BASE_URL", c.CoinGeckoBaseURL},
+		{"FX_RATES_URL", c.FXRatesURL},
+		{"CDN_PURGE_URL", c.CDNPurgeURL},
+	} {
+		check(validateURL(setting.key, setting.val, "http", "https"))
+	}
+	for _, raw := range c.WebhookURLs {
+		check(validateURL("WEBHOOK_URLS", raw, "http", "https"))
+	}
+	for _, raw := range c.PushWebhookURLs {
+		check(validateURL("PUSH_WEBHOOK_URLS", raw, "http", "https"))
+	}
+	for _, setting := range []stringSetting{
+		{"CANDLE_REFRESH_SCHEDULE", c.Schedules[RefreshCandles]},
+		{"SYMBOL_REFRESH_SCHEDULE", c.Schedules[RefreshSymbols]},
+		{"SNAPSHOT_HISTORY_SCHEDULE", c.Schedules[TaskArchive]},
+		{"SNAPSHOT_PRUNE_SCHEDULE", c.Schedules[TaskPrune]},
+	} {
+		if setting.val == "" {
+			continue
+		}
+		if _, err := parseSchedule(setting.val, time.Now()); err != nil {
+			check(fmt.Errorf("%s: %w", setting.key, err))
+		}
+	}
+	check(validateURL("MQTT_BROKER_URL", c.MQTTBrokerURL, "tcp", "tcps", "ssl", "tls", "mqtt", "mqtts", "ws", "wss"))
+
+	// Storage must be writable now rather than failing on the first save
+	storage := []stringSetting{
+		{"SNAPSHOT_PATH", c.SnapshotPath},
+		{"DAILY_STORE_PATH", c.DailyStorePath},
+		{"ALERTS_PATH", c.AlertsPath},
+		{"SYMBOL_EVENTS_PATH", c.SymbolEventsPath},
+		{"JOBS_PATH", c.JobsPath},
+		{"EXPORT_DIR", c.ExportDir},
+		{"AUDIT_LOG_PATH", c.AuditLogPath},
+		{"LOG_FILE", c.LogFile},
+	}
+	if c.SharedSnapshotMode == "writer" {
+		storage = append(storage, stringSetting{"SHARED_SNAPSHOT_PATH", c.SharedSnapshotPath})
+	}
+	for _, setting := range storage {
+		if setting.val == "" {
+			continue
+		}
+		if hc := checkStorage(setting.val); hc.Status != HealthHealthy {
+			problems = append(problems, fmt.Sprintf("%s: %s is not writable: %s", setting.key, setting.val, hc.Detail))
+		}
+	}
+	for _, setting := range []stringSetting{{"TLS_CERT_FILE", c.TLSCertFile}, {"TLS_KEY_FILE", c.TLSKeyFile}} {
+		if setting.val == "" {
+			continue
+		}
+		if _, err := os.Stat(setting.val); err != nil {
+			check(fmt.Errorf("%s: %v", setting.key, err))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return problems
+}
+
+// validateURL checks raw, when set, is an absolute URL with one of schemes
+func validateURL(key, raw string, schemes ...string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+	if u.Host == "" || !slices.Contains(schemes, u.Scheme) {
+		return fmt.Errorf("%s: %q is not a %s URL", key, raw, strings.Join(schemes, "/"))
+	}
+	return nil
+}
+
+func prefixErr(key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", key, err)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultVerifySample = 5
+	maxVerifySample     = 50
+	// Mismatches listed per symbol; the counts cover all of them
+	maxVerifyExamples = 5
+)
+
+// verifyClient fetches the live series to compare against. It bypasses the
+// fetch deduplication, so a verification never shares a cycle's request.
+var verifyClient = NewHyperliquidClient()
+
+// CandleMismatch is one candle whose cached values differ from Hyperliquid's
+type CandleMismatch struct {
+	Timestamp int64   `json:"timestamp"`
+	Cached    *Candle `json:"cached,omitempty"`
+	Live      *Candle `json:"live,omitempty"`
+}
+
+// SymbolVerification compares one symbol's cached series with a fresh fetch
+// of the same window. The cached series' last candle was usually still open
+// when it was fetched, so a different close there is reported as stale
+// rather than as a mismatch.
+type SymbolVerification struct {
+	Symbol     string           `json:"symbol"`
+	OK         bool             `json:"ok"`
+	Error      string           `json:"error,omitempty"`
+	Cached     int              `json:"cached"`
+	Live       int              `json:"live"`
+	Missing    int              `json:"missing"`    // Live candles absent from the cache
+	Extra      int              `json:"extra"`      // Cached candles Hyperliquid doesn't return
+	Mismatched int              `json:"mismatched"` // Closed candles with different values
+	StaleClose bool             `json:"stale_close,omitempty"`
+	AgeSec     float64          `json:"age_sec"`
+	Examples   []CandleMismatch `json:"examples,omitempty"`
+}
+
+// VerifyReport is the /admin/verify response
+type VerifyReport struct {
+	Interval string               `json:"interval"`
+	Checked  int                  `json:"checked"`
+	Failed   int                  `json:"failed"`
+	Elapsed  float64              `json:"elapsed_ms"`
+	Symbols  []SymbolVerification `json:"symbols"`
+}
+
+// candlesEqual compares candles at full precision, allowing for float noise
+func candlesEqual(a, b Candle) bool {
+	near := func(x, y float64) bool {
+		return math.Abs(x-y) <= 1e-9*math.Max(math.Abs(x), math.Abs(y))
+	}
+	return a.Timestamp == b.Timestamp && near(a.Open, b.Open) && near(a.High, b.High) &&
+		near(a.Low, b.Low) && near(a.Close, b.Close) && near(a.Volume, b.Volume)
+}
+
+// diffSeries compares a cached series with the live one for the same window
+func diffSeries(cached CandleSeries, live []Candle) SymbolVerification {
+	v := SymbolVerification{Cached: cached.Len(), Live: len(live)}
+	if cached.Len() == 0 {
+		v.Missing = len(live)
+		return v
+	}
+	last := cached.Timestamp(cached.Len() - 1)
+	example := func(m CandleMismatch) {
+		if len(v.Examples) < maxVerifyExamples {
+			v.Examples = append(v.Examples, m)
+		}
+	}
+
+	liveAt := make(map[int64]Candle, len(live))
+	for _, c := range live {
+		liveAt[c.Timestamp] = c
+		if i := cached.Search(c.Timestamp); i >= cached.Len() || cached.Timestamp(i) != c.Timestamp {
+			v.Missing++
+			c := c
+			example(CandleMismatch{Timestamp: c.Timestamp, Live: &c})
+		}
+	}
+	for i := 0; i < cached.Len(); i++ {
+		c := cached.At(i)
+		l, ok := liveAt[c.Timestamp]
+		switch {
+		case !ok:
+			v.Extra++
+			example(CandleMismatch{Timestamp: c.Timestamp, Cached: &c})
+		case candlesEqual(c, l):
+		case c.Timestamp == last:
+			v.StaleClose = true
+		default:
+			v.Mismatched++
+			example(CandleMismatch{Timestamp: c.Timestamp, Cached: &c, Live: &l})
+		}
+	}
+	v.OK = v.Missing == 0 && v.Extra == 0 && v.Mismatched == 0
+	return v
+}
+
+// verifySymbol re-fetches symbol's cached window and diffs it
+func verifySymbol(symbol string) SymbolVerification {
+	entry, ok := cache.Get(symbol)
+	if !ok || entry.Candles.Len() == 0 {
+		return SymbolVerification{Symbol: symbol, Error: "not cached"}
+	}
+	// The cached window exactly, so the response cap cuts both the same way
+	first, last := entry.Candles.Timestamp(0), entry.Candles.Timestamp(entry.Candles.Len()-1)
+	live, err := verifyClient.FetchCandles(symbol, config.CandleInterval, first, last)
+	if err != nil {
+		return SymbolVerification{Symbol: symbol, Error: err.Error(), Cached: entry.Candles.Len()}
+	}
+	v := diffSeries(entry.Candles, live)
+	v.Symbol = symbol
+	v.AgeSec = time.Since(entry.LastUpdate).Seconds()
+	return v
+}
+
+// verifySample picks n cached symbols with candles at random
+func verifySample(n int) []string {
+	var symbols []string
+	for symbol, entry := range cache.GetAll() {
+		if entry.Candles.Len() > 0 {
+			symbols = append(symbols, symbol)
+		}
+	}
+	rand.Shuffle(len(symbols), func(i, j int) { symbols[i], symbols[j] = symbols[j], symbols[i] })
+	symbols = symbols[:min(n, len(symbols))]
+	sort.Strings(symbols)
+	return symbols
+}
+
+// handleAdminVerify re-fetches symbols from Hyperliquid and diffs them
+// against the cache. ?symbol=BTC,ETH checks those, otherwise ?sample=N
+// (default 5) cached symbols are picked at random. It answers with the
+// report; with ?async=true a POST queues a verify job and answers with the
+// job instead.
+func handleAdminVerify(w http.ResponseWriter, r *http.Request) {
+	if config.DryRun {
+		http.Error(w, "DRY_RUN is set: nothing is fetched to verify against", http.StatusConflict)
+		return
+	}
+
+	var symbols []string
+	if list := r.URL.Query().Get("symbol"); list != "" {
+		for _, symbol := range strings.Split(list, ",") {
+			if symbol = strings.TrimSpace(symbol); symbol != "" {
+				symbols = append(symbols, cache.CanonicalSymbol(symbol))
+			}
+		}
+		if len(symbols) > maxVerifySample {
+			http.Error(w, fmt.Sprintf("At most %d symbols per verification", maxVerifySample), http.StatusBadRequest)
+			return
+		}
+	} else {
+		n := defaultVerifySample
+		if s := r.URL.Query().Get("sample"); s != "" {
+			var err error
+			if n, err = strconv.Atoi(s); err != nil || n < 1 || n > maxVerifySample {
+				http.Error(w, fmt.Sprintf("sample must be between 1 and %d", maxVerifySample), http.StatusBadRequest)
+				return
+			}
+		}
+		symbols = verifySample(n)
+	}
+
+	if r.Method == http.MethodPost && r.URL.Query().Get("async") == "true" {
+		submitJob(w, r, "verify", map[string]string{"symbol": strings.Join(symbols, ",")})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(verifySymbols(symbols)); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// runVerifyJob verifies params' comma-separated symbol list
+func runVerifyJob(params map[string]string) (interface{}, error) {
+	if config.DryRun {
+		return nil, permanent(fmt.Errorf("DRY_RUN is set: nothing is fetched to verify against"))
+	}
+	var symbols []string
+	if params["symbol"] != "" {
+		symbols = strings.Split(params["symbol"], ",")
+	}
+	return verifySymbols(symbols), nil
+}
+
+// verifySymbols diffs each of symbols against Hyperliquid
+func verifySymbols(symbols []string) VerifyReport {
+	start := time.Now()
+	report := VerifyReport{Interval: config.CandleInterval, Symbols: make([]SymbolVerification, 0, len(symbols))}
+	for _, symbol := range symbols {
+		v := verifySymbol(symbol)
+		report.Symbols = append(report.Symbols, v)
+		report.Checked++
+		if !v.OK {
+			report.Failed++
+			metrics.Inc("cache_verify_failures_total")
+		}
+	}
+	report.Elapsed = float64(time.Since(start).Microseconds()) / 1000
+	log.Printf("[Verify] %d/%d symbols match Hyperliquid", report.Checked-report.Failed, report.Checked)
+	return report
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// volatilityWindows are the realized vol windows reported per symbol
+var volatilityWindows = []struct {
+	name   string
+	window time.Duration
+}{
+	{"1d", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// SymbolVolatility holds annualized realized volatility (percent) per window.
+// Windows the cached history doesn't cover are omitted.
+type SymbolVolatility struct {
+	Symbol  string             `json:"symbol"`
+	Windows map[string]float64 `json:"windows"`
+}
+
+// cycleMemo caches a value derived from the candle cache until the cache
+// changes, so it's recomputed once per candle cycle rather than per request
+type cycleMemo[T any] struct {
+	mu       sync.Mutex
+	computed time.Time
+	valid    bool
+	result   T
+	compute  func() T
+}
+
+// get returns the value for the cache state at lastUpdate
+func (m *cycleMemo[T]) get(lastUpdate time.Time) T {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.valid || !m.computed.Equal(lastUpdate) {
+		m.result = m.compute()
+		m.computed = lastUpdate
+		m.valid = true
+	}
+	return m.result
+}
+
+var volSurface = &cycleMemo[[]SymbolVolatility]{
+	compute: func() []SymbolVolatility {
+		return computeVolatility(cache.GetAll(), config.CandleInterval)
+	},
+}
+
+// computeVolatility computes realized vol for every cached symbol
+func computeVolatility(all map[string]CacheEntry, interval string) []SymbolVolatility {
+	step, ok := intervalDuration(interval)
+	if !ok {
+		return []SymbolVolatility{}
+	}
+	periodsPerYear := float64(365*24*time.Hour) / float64(step)
+
+	result := make([]SymbolVolatility, 0, len(all))
+	for symbol, entry := range all {
+		n := entry.Candles.Len()
+		if n < 2 {
+			continue
+		}
+		sv := SymbolVolatility{Symbol: symbol, Windows: make(map[string]float64)}
+		last := entry.Candles.Timestamp(n - 1)
+		for _, w := range volatilityWindows {
+			cutoff := last - w.window.Milliseconds()
+			if entry.Candles.Timestamp(0) > cutoff {
+				continue // History doesn't reach back far enough
+			}
+			start := entry.Candles.Search(cutoff)
+			if vol, ok := realizedVol(entry.Candles.Closes[start:], periodsPerYear); ok {
+				sv.Windows[w.name] = vol
+			}
+		}
+		result = append(result, sv)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Symbol < result[j].Symbol })
+	return result
+}
+
+// realizedVol returns the annualized standard deviation of log close-to-close
+// returns, in percent
+func realizedVol(closes []float64, periodsPerYear float64) (float64, bool) {
+	returns := make([]float64, 0, len(closes))
+	for i := 1; i < len(closes); i++ {
+		if closes[i-1] <= 0 || closes[i] <= 0 {
+			continue
+		}
+		returns = append(returns, math.Log(closes[i]/closes[i-1]))
+	}
+	if len(returns) < 2 {
+		return 0, false
+	}
+
+	var mean float64
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	var variance float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	variance /= float64(len(returns) - 1)
+
+	return math.Sqrt(variance*periodsPerYear) * 100, true
+}
+
+func handleGetVolatility(w http.ResponseWriter, r *http.Request) {
+	lastUpdate := cache.GetLastUpdate()
+	if setETag(w, r, generateETag(lastUpdate)) {
+		return
+	}
+
+	surface := volSurface.get(lastUpdate)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := writeJSON(r.Context(), w, map[string]interface{}{
+		"interval": config.CandleInterval,
+		"symbols":  surface,
+		"count":    len(surface),
+	}); err != nil {
+		log.Printf("Error encoding response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
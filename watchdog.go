@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/anthdm/hollywood/actor"
+)
+
+// heartbeatInterval is how often watched actors report in. A busy actor
+// only handles the heartbeat between other messages, so a wedged handler
+// (stuck in a long sleep or backoff) stops beating.
+const heartbeatInterval = 30 * time.Second
+
+// Heartbeats records the last heartbeat per actor PID
+type Heartbeats struct {
+	mu   sync.RWMutex
+	last map[string]time.Time
+}
+
+var heartbeats = &Heartbeats{last: make(map[string]time.Time)}
+
+// Beat records a heartbeat for pid
+func (h *Heartbeats) Beat(pid *actor.PID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last[pid.ID] = time.Now()
+}
+
+// Age returns how long ago pid last beat, and whether it ever did
+func (h *Heartbeats) Age(pid *actor.PID) (time.Duration, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	last, ok := h.last[pid.ID]
+	return time.Since(last), ok
+}
+
+// Forget drops the heartbeat record of a replaced actor
+func (h *Heartbeats) Forget(pid *actor.PID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.last, pid.ID)
+}
+
+// startHeartbeat records a first heartbeat and schedules the rest. Actors
+// call it from actor.Started and call heartbeats.Beat on HeartbeatMsg.
+func startHeartbeat(ctx *actor.Context) {
+	heartbeats.Beat(ctx.PID())
+	ctx.SendRepeat(ctx.PID(), HeartbeatMsg{}, heartbeatInterval)
+}
+
+// watchedPIDs guards the globals holding the PIDs of watched actors, which
+// the watchdog swaps on restart
+var watchedPIDs sync.RWMutex
+
+// loadPID returns the PID held in *pid. Globals of watched actors must be
+// read through it.
+func loadPID(pid **actor.PID) *actor.PID {
+	watchedPIDs.RLock()
+	defer watchedPIDs.RUnlock()
+	return *pid
+}
+
+// storePID replaces the PID held in *pid
+func storePID(pid **actor.PID, value *actor.PID) {
+	watchedPIDs.Lock()
+	defer watchedPIDs.Unlock()
+	*pid = value
+}
+
+// watchedActor is an actor the watchdog can respawn
+type watchedActor struct {
+	name       string
+	pid        **actor.PID // Global holding the current PID, swapped on restart
+	producer   actor.Producer
+	spawned    time.Time
+	restarts   int
+	restarting bool // Waiting for the stuck instance to stop, up to restartGrace
+}
+
+// Watchdog restarts actors whose heartbeat stopped for longer than timeout
+type Watchdog struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	actors  []*watchedActor
+}
+
+// NewWatchdog creates a watchdog; a zero timeout disables restarts
+func NewWatchdog(timeout time.Duration) *Watchdog {
+	return &Watchdog{timeout: timeout}
+}
+
+// Spawn starts an actor, stores its PID in *pid, and watches it
+func (w *Watchdog) Spawn(pid **actor.PID, producer actor.Producer, name string) {
+	storePID(pid, engine.Spawn(producer, name))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.actors = append(w.actors, &watchedActor{name: name, pid: pid, producer: producer, spawned: time.Now()})
+}
+
+// Check reports a watched actor's heartbeat state for /health
+func (w *Watchdog) Check(pid *actor.PID) (HealthCheck, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, a := range w.actors {
+		if loadPID(a.pid) != pid {
+			continue
+		}
+		if age, ok := heartbeats.Age(pid); ok && w.timeout > 0 && age > w.timeout {
+			return HealthCheck{Status: HealthUnhealthy, Detail: fmt.Sprintf("no heartbeat for %v", age.Round(time.Second))}, true
+		}
+		if a.restarts > 0 && time.Since(a.spawned) < w.timeout {
+			return HealthCheck{Status: HealthDegraded, Detail: fmt.Sprintf("restarted by watchdog %v ago (%d restarts)", time.Since(a.spawned).Round(time.Second), a.restarts)}, true
+		}
+		return HealthCheck{Status: HealthHealthy}, true
+	}
+	return HealthCheck{}, false
+}
+
+// checkAll restarts actors that missed their heartbeat deadline
+func (w *Watchdog) checkAll() {
+	w.mu.Lock()
+	var stuck []*watchedActor
+	for _, a := range w.actors {
+		pid := loadPID(a.pid)
+		age, ok := heartbeats.Age(pid)
+		if !ok {
+			// Still in actor.Started (e.g. the first candle fetch)
+			age = time.Since(a.spawned)
+		}
+		metrics.Set("actor_heartbeat_age_seconds", age.Seconds(), "actor", a.name)
+
+		if w.timeout <= 0 || age <= w.timeout || a.restarting {
+			continue
+		}
+
+		log.Printf("[Watchdog] %s missed heartbeats for %v, restarting", a.name, age.Round(time.Second))
+		metrics.Inc("actor_restarts_total", "actor", a.name)
+		a.restarting = true
+		stuck = append(stuck, a)
+	}
+	w.mu.Unlock()
+
+	for _, a := range stuck {
+		go w.restart(a)
+	}
+}
+
+// restartGrace is how long a restart waits for the stuck instance to stop
+// before spawning its replacement anyway
+const restartGrace = 10 * time.Second
+
+// restart replaces a stuck actor, preferably once it has stopped. The stuck
+// instance can't be interrupted: the poison pill queues behind whatever
+// wedged it, so after restartGrace the replacement starts alongside it and
+// the old instance stops whenever it drains its mailbox.
+func (w *Watchdog) restart(a *watchedActor) {
+	pid := loadPID(a.pid)
+	select {
+	case <-engine.Poison(pid).Done():
+	case <-time.After(restartGrace):
+		log.Printf("[Watchdog] %s still hasn't stopped after %v, starting its replacement", a.name, restartGrace)
+	}
+	heartbeats.Forget(pid)
+	storePID(a.pid, engine.Spawn(a.producer, a.name))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	a.spawned = time.Now()
+	a.restarts++
+	a.restarting = false
+}
+
+// WatchdogActor drives the watchdog's periodic checks
+type WatchdogActor struct {
+	watchdog *Watchdog
+}
+
+// NewWatchdogActor creates a new watchdog actor
+func NewWatchdogActor(watchdog *Watchdog) *WatchdogActor {
+	return &WatchdogActor{watchdog: watchdog}
+}
+
+func (a *WatchdogActor) Receive(ctx *actor.Context) {
+	switch ctx.Message().(type) {
+	case actor.Started:
+		log.Printf("[Watchdog] Actor started (timeout %v)", a.watchdog.timeout)
+		ctx.SendRepeat(ctx.PID(), CheckHeartbeatsMsg{}, heartbeatInterval)
+
+	case CheckHeartbeatsMsg:
+		a.watchdog.checkAll()
+
+	case actor.Stopped:
+		log.Println("[Watchdog] Actor stopped")
+	}
+}
@@ -1,12 +1,35 @@
 package main
 
 import (
+	"errors"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/anthdm/hollywood/actor"
 )
 
+// FetchProfile controls how aggressively a fetch cycle hits the API
+type FetchProfile struct {
+	BatchSize  int
+	BatchDelay time.Duration
+}
+
+// Candle fetch modes
+const (
+	FetchModeEager = "eager" // Fetch every symbol each cycle
+	FetchModeLazy  = "lazy"  // Fetch priority symbols each cycle and the rest on request
+)
+
+// LazyProfile limits proactive fetching to priority symbols and those
+// requested within TTL; the rest are fetched on first request. The zero
+// value fetches everything.
+type LazyProfile struct {
+	Enabled  bool
+	Priority map[string]bool // Upper-cased symbols
+	TTL      time.Duration
+}
+
 // CandleFetcherActor periodically fetches candle data for all symbols
 type CandleFetcherActor struct {
 	cache             *Cache
@@ -14,8 +37,18 @@ type CandleFetcherActor struct {
 	refreshInterval   time.Duration
 	candleInterval    string
 	candleDays        int
-	batchSize         int
-	batchDelay        time.Duration
+	steady            FetchProfile
+	warmup            FetchProfile // Used until the first successful cycle
+	revisionWindow    int          // Recent closed candles checked for revisions
+	access            *AccessStats
+	priority          PriorityProfile
+	lazy              LazyProfile
+	overrides         *SymbolOverrides
+	pipeline          string // Empty for the main pipeline
+	logTag            string
+	engine            *actor.Engine
+	warmedUp          bool
+	cycle             int
 }
 
 // NewCandleFetcherActor creates a new candle fetcher actor
@@ -25,6 +58,13 @@ func NewCandleFetcherActor(
 	refreshInterval time.Duration,
 	candleInterval string,
 	candleDays int,
+	steady FetchProfile,
+	warmup FetchProfile,
+	revisionWindow int,
+	access *AccessStats,
+	priority PriorityProfile,
+	lazy LazyProfile,
+	overrides *SymbolOverrides,
 ) *CandleFetcherActor {
 	return &CandleFetcherActor{
 		cache:             cache,
@@ -32,63 +72,111 @@ func NewCandleFetcherActor(
 		refreshInterval:   refreshInterval,
 		candleInterval:    candleInterval,
 		candleDays:        candleDays,
-		batchSize:         10,
-		batchDelay:        200 * time.Millisecond,
+		steady:            steady,
+		warmup:            warmup,
+		revisionWindow:    revisionWindow,
+		access:            access,
+		priority:          priority,
+		lazy:              lazy,
+		overrides:         overrides,
+		logTag:            "[CandleFetcher]",
 	}
 }
 
 func (a *CandleFetcherActor) Receive(ctx *actor.Context) {
 	switch msg := ctx.Message().(type) {
 	case actor.Started:
-		log.Println("[CandleFetcher] Actor started")
+		log.Println(a.logTag, "Actor started")
+		a.engine = ctx.Engine()
+		startHeartbeat(ctx)
 		// Fetch candles immediately on start
-		a.fetchAllCandles()
+		a.fetchAllCandles(true)
 		// Schedule periodic fetches
-		ctx.SendRepeat(ctx.PID(), FetchCandlesMsg{}, a.refreshInterval)
+		scheduler.Add(a.refreshTier(), a.refreshInterval, ctx.PID(), FetchCandlesMsg{})
 		
 	case FetchCandlesMsg:
-		a.fetchAllCandles()
+		a.fetchAllCandles(msg.All)
+		if msg.Done != nil {
+			close(msg.Done)
+		}
+		
+	case HeartbeatMsg:
+		heartbeats.Beat(ctx.PID())
 		
 	case GetCacheMsg:
 		msg.ResponseChan <- a.cache.GetAll()
 		
 	case actor.Stopped:
-		log.Println("[CandleFetcher] Actor stopped")
+		scheduler.Remove(a.refreshTier(), ctx.PID())
+		log.Println(a.logTag, "Actor stopped")
 	}
 }
 
-func (a *CandleFetcherActor) fetchAllCandles() {
-	symbols := a.cache.GetSymbols()
+// fetchAllCandles fetches the symbols due this cycle, or every symbol when
+// all is set
+func (a *CandleFetcherActor) fetchAllCandles(all bool) {
+	// Series evicted for the memory budget are only fetched again on
+	// request, and other shards' symbols are left to them
+	var symbols []string
+	for _, symbol := range a.cache.GetSymbols() {
+		if !a.cache.IsEvicted(symbol) && inShard(symbol) {
+			symbols = append(symbols, symbol)
+		}
+	}
+	
+	if len(symbols) == 0 {
+		log.Println(a.logTag, "No symbols available yet, skipping fetch")
+		return
+	}
 	
+	a.cycle++
+	if a.lazy.Enabled {
+		symbols = a.lazySymbols(symbols)
+	}
+	if !all && a.warmedUp {
+		symbols = a.dueSymbols(symbols)
+	}
 	if len(symbols) == 0 {
-		log.Println("[CandleFetcher] No symbols available yet, skipping fetch")
+		log.Println(a.logTag, "No symbols due this cycle, skipping fetch")
 		return
 	}
 	
-	log.Printf("[CandleFetcher] Found %d symbols, starting candle fetch...", len(symbols))
+	profile := a.steady
+	if !a.warmedUp {
+		profile = a.warmup
+	}
+	batchSize, batchDelay := profile.BatchSize, profile.BatchDelay
+	
+	log.Printf(a.logTag+" Found %d symbols, starting candle fetch (batch size %d, delay %v)...", len(symbols), batchSize, batchDelay)
+	
+	cycleStart := time.Now()
 	
 	// Calculate time range
 	endTime := time.Now().UnixMilli()
-	startTime := time.Now().AddDate(0, 0, -a.candleDays).UnixMilli()
+	defaultStart := time.Now().AddDate(0, 0, -a.candleDays)
 	
-	totalBatches := (len(symbols) + a.batchSize - 1) / a.batchSize
+	totalBatches := (len(symbols) + batchSize - 1) / batchSize
 	successCount := 0
+	var changed []string
+	outcomes := make([]SymbolOutcome, 0, len(symbols))
 	
-	for batchIdx := 0; batchIdx < len(symbols); batchIdx += a.batchSize {
-		end := batchIdx + a.batchSize
+	for batchIdx := 0; batchIdx < len(symbols); batchIdx += batchSize {
+		end := batchIdx + batchSize
 		if end > len(symbols) {
 			end = len(symbols)
 		}
 		
 		batch := symbols[batchIdx:end]
-		currentBatch := (batchIdx / a.batchSize) + 1
+		currentBatch := (batchIdx / batchSize) + 1
 		
-		log.Printf("[CandleFetcher] Fetching batch %d/%d (%d symbols)...", currentBatch, totalBatches, len(batch))
+		log.Printf(a.logTag+" Fetching batch %d/%d (%d symbols)...", currentBatch, totalBatches, len(batch))
 		
 		// Fetch batch concurrently
 		type result struct {
 			symbol  string
 			candles []Candle
+			started time.Time
+			stats   FetchStats
 			err     error
 		}
 		
@@ -96,37 +184,209 @@ func (a *CandleFetcherActor) fetchAllCandles() {
 		
 		for _, symbol := range batch {
 			go func(sym string) {
-				candles, err := a.hyperliquidClient.FetchCandlesWithRetry(
+				started := time.Now()
+				startTime := defaultStart.UnixMilli()
+				if days := a.overrides.MainDays(sym, a.candleDays); days != a.candleDays {
+					startTime = time.Now().AddDate(0, 0, -days).UnixMilli()
+				}
+				candles, stats, err := a.hyperliquidClient.FetchCandlesWithStats(
 					sym,
 					a.candleInterval,
 					startTime,
 					endTime,
 					3, // max retries
 				)
-				results <- result{symbol: sym, candles: candles, err: err}
+				results <- result{symbol: sym, candles: candles, started: started, stats: stats, err: err}
 			}(symbol)
 		}
 		
 		// Collect results
 		for i := 0; i < len(batch); i++ {
 			res := <-results
+			// A dry run fetched nothing, so whatever is cached stays
+			planned := errors.Is(res.err, errDryRun)
+			if planned {
+				res.err = nil
+			}
+			outcome := SymbolOutcome{Symbol: res.symbol, OK: res.err == nil, Candles: len(res.candles), FetchStats: res.stats}
 			if res.err != nil {
-				log.Printf("[CandleFetcher] ERROR: Failed to fetch %s: %v", res.symbol, res.err)
-				// Store empty array for failed symbols
-				a.cache.Set(res.symbol, []Candle{})
+				outcome.Error = res.err.Error()
+			}
+			outcomes = append(outcomes, outcome)
+			if res.err != nil && exchangeStatus.InMaintenance() {
+				// Expected while the exchange is down: keep serving what we
+				// have, flagged stale, rather than blanking it
+				log.Printf(a.logTag+" %s unavailable during exchange maintenance: %v", res.symbol, res.err)
+				metrics.Inc("candle_fetch_total", append(a.cache.labels(), "result", "maintenance")...)
+				a.cache.MarkStale(res.symbol)
+			} else if res.err != nil {
+				log.Printf(a.logTag+" ERROR: Failed to fetch %s: %v", res.symbol, res.err)
+				source := "cycle"
+				if a.pipeline != "" {
+					source = "pipeline:" + a.pipeline
+				}
+				errorTrace.RecordSymbol(SubsystemFetcher, source, res.symbol, res.err)
+				metrics.Inc("candle_fetch_total", append(a.cache.labels(), "result", "error")...)
+				// Store empty array for failed symbols, but keep restored data
+				// around (still marked stale) rather than discarding it
+				if entry, ok := a.cache.Get(res.symbol); !ok || !entry.Stale {
+					a.cache.Set(res.symbol, []Candle{})
+				}
+			} else if planned {
+				successCount++
 			} else {
-				a.cache.Set(res.symbol, res.candles)
+				prev, ok := a.cache.Get(res.symbol)
+				revised := 0
+				if ok {
+					revised = revisedCandles(prev.Candles, res.candles, a.revisionWindow)
+				}
+				if revised > 0 {
+					log.Printf(a.logTag+" %s: Hyperliquid revised %d closed candle(s)", res.symbol, revised)
+					metrics.Add("candle_revisions_total", float64(revised), append(a.cache.labels(), "symbol", res.symbol)...)
+				}
+				if !ok || revised > 0 || candlesChanged(prev.Candles, res.candles) {
+					changed = append(changed, res.symbol)
+				}
+				a.cache.SetFetched(res.symbol, res.candles, res.started)
+				metrics.Inc("candle_fetch_total", append(a.cache.labels(), "result", "success")...)
 				successCount++
 			}
 		}
 		
 		// Delay between batches to avoid rate limiting
 		if currentBatch < totalBatches {
-			time.Sleep(a.batchDelay)
+			time.Sleep(batchDelay)
 		}
 	}
 	
-	log.Printf("[CandleFetcher] Batch %d/%d complete (%d symbols cached successfully)", totalBatches, totalBatches, successCount)
-	log.Printf("[CandleFetcher] ✓ Cached %d/%d symbols", successCount, len(symbols))
+	log.Printf(a.logTag+" Batch %d/%d complete (%d symbols cached successfully)", totalBatches, totalBatches, successCount)
+	log.Printf(a.logTag+" ✓ Cached %d/%d symbols", successCount, len(symbols))
+	
+	a.overrides.fetch(a.hyperliquidClient, symbols)
+	
+	if !a.warmedUp && successCount > 0 {
+		a.warmedUp = true
+		log.Println(a.logTag, "Warm-up complete, switching to steady-state fetch profile")
+	}
+	
+	if a.pipeline != "" {
+		// Cycle reporting, notifications and subscribers follow the main pipeline
+		metrics.Inc("pipeline_fetch_cycles_total", "pipeline", a.pipeline)
+		metrics.Set("pipeline_fetch_cycle_duration_seconds", time.Since(cycleStart).Seconds(), "pipeline", a.pipeline)
+		metrics.Set("pipeline_fetch_cycle_success_ratio", float64(successCount)/float64(len(symbols)), "pipeline", a.pipeline)
+		return
+	}
+	metrics.Inc("candle_fetch_cycles_total")
+	metrics.Set("candle_fetch_cycle_duration_seconds", time.Since(cycleStart).Seconds())
+	metrics.Set("candle_fetch_cycle_success_ratio", float64(successCount)/float64(len(symbols)))
+	notifier.FetchCycleDone(len(symbols)-successCount, len(symbols))
+	latency := fetchLatency.CycleDone(outcomes, time.Since(cycleStart), a.refreshInterval)
+	requestBudget.CycleDone(cycleStart, len(symbols), a.refreshInterval)
+	if dryRun() {
+		logDryRunCycle()
+	}
+	auditLog.Append(AuditRecord{
+		Start:    cycleStart,
+		End:      time.Now(),
+		Symbols:  len(symbols),
+		Latency:  latency,
+		Outcomes: outcomes,
+	})
+	
+	// Let subscribed actors (publishers, push webhooks) react to the new data
+	a.engine.BroadcastEvent(CandleCycleDoneMsg{
+		Changed:  changed,
+		Finished: time.Now(),
+	})
+}
+
+// refreshTier is the refresh schedule tier of this fetcher's cycles
+func (a *CandleFetcherActor) refreshTier() string {
+	if a.pipeline != "" {
+		return pipelineRefreshTier(a.pipeline)
+	}
+	return RefreshCandles
+}
+
+// lazySymbols keeps the priority symbols and those requested within the
+// TTL. The rest are evicted, so their next request fetches them on demand.
+func (a *CandleFetcherActor) lazySymbols(symbols []string) []string {
+	now := time.Now()
+	kept := make([]string, 0, len(symbols))
+	var expired []string
+	for _, symbol := range symbols {
+		if a.lazy.Priority[strings.ToUpper(symbol)] || now.Sub(a.cache.LastAccess(symbol)) < a.lazy.TTL {
+			kept = append(kept, symbol)
+		} else if _, ok := a.cache.Get(symbol); ok {
+			expired = append(expired, symbol)
+		}
+	}
+	if len(expired) > 0 {
+		a.cache.Expire(expired...)
+		log.Printf(a.logTag+" Lazy mode: %d symbol(s) not requested within %v, fetched on demand from now on", len(expired), a.lazy.TTL)
+	}
+	metrics.Set("candle_lazy_warm_symbols", float64(len(kept)))
+	return kept
+}
+
+// dueSymbols keeps the symbols whose refresh tier is due this cycle. A tier
+// fetched every n cycles is spread evenly over them, and series without
+// fresh data are always due.
+func (a *CandleFetcherActor) dueSymbols(symbols []string) []string {
+	tiers := a.access.Tiers(a.priority.HotSymbols)
+	counts := make(map[string]int, 3)
+	due := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		tier, ok := tiers[symbol]
+		if !ok {
+			tier = PriorityCold
+		}
+		counts[tier]++
+		
+		every := a.priority.every(tier)
+		entry, cached := a.cache.Get(symbol)
+		if every == 1 || !cached || entry.Stale || entry.Candles.Len() == 0 ||
+			priorityPhase(symbol, every) == a.cycle%every {
+			due = append(due, symbol)
+		}
+	}
+	for _, tier := range []string{PriorityHot, PriorityWarm, PriorityCold} {
+		metrics.Set("candle_refresh_priority_symbols", float64(counts[tier]), "tier", tier)
+	}
+	if len(due) < len(symbols) {
+		log.Printf(a.logTag+" %d/%d symbols due this cycle (%d hot, %d warm, %d cold)",
+			len(due), len(symbols), counts[PriorityHot], counts[PriorityWarm], counts[PriorityCold])
+	}
+	return due
+}
+
+// candlesChanged reports whether a fetched series differs from the cached
+// one in length or in its latest candle
+func candlesChanged(prev CandleSeries, next []Candle) bool {
+	if prev.Len() != len(next) {
+		return true
+	}
+	return len(next) > 0 && prev.At(prev.Len()-1) != next[len(next)-1]
+}
+
+// revisedCandles counts how many of the last window closed candles of prev
+// have different values in next. prev's last candle was still open when it
+// was fetched, so it isn't a revision and isn't counted.
+func revisedCandles(prev CandleSeries, next []Candle, window int) int {
+	if window <= 0 || prev.Len() < 2 {
+		return 0
+	}
+	revised := 0
+	j := len(next) - 1
+	for i := prev.Len() - 2; i >= 0 && i >= prev.Len()-1-window; i-- {
+		old := prev.At(i)
+		for j >= 0 && next[j].Timestamp > old.Timestamp {
+			j--
+		}
+		if j >= 0 && next[j].Timestamp == old.Timestamp && next[j] != old {
+			revised++
+		}
+	}
+	return revised
 }
 